@@ -0,0 +1,51 @@
+//go:build windows
+
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/credentialprovider"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+var (
+	credentialProviderCmd = &cobra.Command{
+		Use:   "credential-provider",
+		Short: "Serves registry credentials to kubelet",
+		Long: "Implements the kubelet credential provider exec plugin protocol, reading a CredentialProviderRequest " +
+			"from stdin and writing a CredentialProviderResponse holding the credentials within the node's registry " +
+			"credential store to stdout",
+		Run: runCredentialProviderCmd,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(credentialProviderCmd)
+}
+
+func runCredentialProviderCmd(cmd *cobra.Command, args []string) {
+	// stdout is reserved for the response, klog writes to stderr
+	if err := credentialprovider.Respond(os.Stdin, windows.RegistryCredentialStorePath, os.Stdout); err != nil {
+		klog.Exitf(err.Error())
+	}
+}
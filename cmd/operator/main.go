@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -9,6 +10,7 @@ import (
 	openshiftconfig "github.com/openshift/api/config/v1"
 	mapi "github.com/openshift/api/machine/v1beta1"
 	mcfg "github.com/openshift/api/machineconfiguration/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
 	operators "github.com/operator-framework/api/pkg/operators/v2"
 	"github.com/operator-framework/operator-lib/leader"
 	monv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
@@ -20,15 +22,22 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	"github.com/openshift/windows-machine-config-operator/controllers"
+	"github.com/openshift/windows-machine-config-operator/pkg/audit"
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig/payload"
+	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
 	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+	"github.com/openshift/windows-machine-config-operator/pkg/webhooks"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 	"github.com/openshift/windows-machine-config-operator/version"
 	//+kubebuilder:scaffold:imports
@@ -56,6 +65,7 @@ func init() {
 	utilruntime.Must(operators.AddToScheme(scheme))
 	utilruntime.Must(mcfg.Install(scheme))
 	utilruntime.Must(openshiftconfig.AddToScheme(scheme))
+	utilruntime.Must(operatorv1.AddToScheme(scheme))
 	utilruntime.Must(monv1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
@@ -63,10 +73,28 @@ func init() {
 func main() {
 	var debugLogging bool
 	var metricsAddr string
+	var auditLogPath string
+	var auditLogMaxSize int64
+	var auditLogMaxBackups int
+	var auditEvents bool
+	var auditWebhookURL string
+	var webhookPort int
 
 	flag.BoolVar(&debugLogging, "debugLogging", false, "Log debug messages")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0.0.0.0:9182",
 		"The address and port the metric endpoint binds to 0.0.0.0:9182")
+	flag.StringVar(&auditLogPath, "audit-log-path", "",
+		"The file the commands run and files transferred on Windows instances are audited to, disabled if empty")
+	flag.Int64Var(&auditLogMaxSize, "audit-log-max-size", 100,
+		"The size in megabytes the audit log is rotated at")
+	flag.IntVar(&auditLogMaxBackups, "audit-log-max-backups", 5, "The number of rotated audit logs kept")
+	flag.BoolVar(&auditEvents, "audit-events", false,
+		"Emit the commands run and files transferred on Windows instances as events on their nodes")
+	flag.StringVar(&auditWebhookURL, "audit-webhook-url", "",
+		"The HTTPS endpoint the audit records are sent to, in addition to the audit log, disabled if empty")
+	// The operator runs on the host network, so the port must not collide with those of other host network pods
+	flag.IntVar(&webhookPort, "webhook-port", 9183,
+		"The port the admission webhooks are served on, the webhooks are not served if 0")
 
 	// Add flags registered by imported packages (e.g. glog and
 	// controller-runtime)
@@ -140,10 +168,18 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := payload.PopulateNetworkConfScript(clusterConfig.Network().GetServiceCIDR(), windows.OVNKubeOverlayNetwork,
-		windows.HNSPSModule, windows.CniConfDir+"\\cni.conf"); err != nil {
-		setupLog.Error(err, "unable to generate CNI config script")
-		os.Exit(1)
+	// Seed the service CIDR used to configure nodes. The cluster config controller keeps it up to date from then on.
+	nodeconfig.SetClusterServiceCIDR(clusterConfig.Network().GetServiceCIDR())
+
+	setupLog.Info("network", "backend", clusterConfig.Network().Backend())
+	// The network configuration script is only used by the hybrid overlay, a user provided CNI is configured through
+	// the windows-cni-config ConfigMap
+	if clusterConfig.Network().Backend() == cluster.HybridOverlayBackend {
+		if err := payload.PopulateNetworkConfScript(clusterConfig.Network().GetServiceCIDR(),
+			windows.OVNKubeOverlayNetwork, windows.HNSPSModule, windows.CniConfDir+"\\cni.conf"); err != nil {
+			setupLog.Error(err, "unable to generate CNI config script")
+			os.Exit(1)
+		}
 	}
 
 	// Become the leader before proceeding
@@ -166,6 +202,7 @@ func main() {
 			SecureServing:  true,
 			FilterProvider: filters.WithAuthenticationAndAuthorization,
 		},
+		WebhookServer: webhook.NewServer(webhook.Options{Port: webhookPort}),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -192,13 +229,34 @@ func main() {
 	}
 	setupLog.Info("operator", "namespace", watchNamespace)
 
+	// Audit the actions taken on Windows instances
+	auditConfig, err := newAuditConfig(ctx, mgr, watchNamespace, auditLogPath, auditLogMaxSize, auditLogMaxBackups,
+		auditWebhookURL)
+	if err != nil {
+		setupLog.Error(err, "unable to configure auditing")
+		os.Exit(1)
+	}
+	if auditEvents {
+		auditConfig.Recorder = mgr.GetEventRecorderFor("audit")
+	}
+	if err = audit.Configure(auditConfig); err != nil {
+		setupLog.Error(err, "unable to configure auditing")
+		os.Exit(1)
+	}
+
 	// Setup all Controllers
+	clusterConfigReconciler := controllers.NewClusterConfigReconciler(mgr, clusterConfig, watchNamespace)
+	if err = clusterConfigReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterConfig")
+		os.Exit(1)
+	}
+
 	winMachineReconciler, err := controllers.NewWindowsMachineReconciler(mgr, clusterConfig, watchNamespace)
 	if err != nil {
 		setupLog.Error(err, "unable to create Windows Machine reconciler")
 		os.Exit(1)
 	}
-	if err = winMachineReconciler.SetupWithManager(mgr); err != nil {
+	if err = winMachineReconciler.SetupWithManager(mgr, clusterConfigReconciler.Subscribe()); err != nil {
 		setupLog.Error(err, "unable to create Windows Machine controller")
 		os.Exit(1)
 	}
@@ -242,7 +300,7 @@ func main() {
 		setupLog.Error(err, "unable to create ConfigMap reconciler")
 		os.Exit(1)
 	}
-	if err = configMapReconciler.SetupWithManager(mgr); err != nil {
+	if err = configMapReconciler.SetupWithManager(mgr, clusterConfigReconciler.Subscribe()); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ConfigMap")
 		os.Exit(1)
 	}
@@ -278,6 +336,85 @@ func main() {
 		os.Exit(1)
 	}
 
+	runtimeClassReconciler, err := controllers.NewRuntimeClassReconciler(mgr, clusterConfig, watchNamespace)
+	if err != nil {
+		setupLog.Error(err, "unable to create RuntimeClass reconciler")
+		os.Exit(1)
+	}
+	if err = runtimeClassReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "RuntimeClass")
+		os.Exit(1)
+	}
+
+	prePullReconciler, err := controllers.NewPrePullReconciler(mgr, clusterConfig, watchNamespace)
+	if err != nil {
+		setupLog.Error(err, "unable to create image pre-pull reconciler")
+		os.Exit(1)
+	}
+	if err = prePullReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PrePull")
+		os.Exit(1)
+	}
+
+	certExpiryReconciler, err := controllers.NewCertExpiryReconciler(mgr, clusterConfig, watchNamespace)
+	if err != nil {
+		setupLog.Error(err, "unable to create certificate expiry reconciler")
+		os.Exit(1)
+	}
+	if err = certExpiryReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CertExpiry")
+		os.Exit(1)
+	}
+	wicdCredentialsReconciler, err := controllers.NewWICDCredentialsReconciler(mgr, clusterConfig, watchNamespace)
+	if err != nil {
+		setupLog.Error(err, "unable to create WICD credentials reconciler")
+		os.Exit(1)
+	}
+	if err = wicdCredentialsReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "WICDCredentials")
+		os.Exit(1)
+	}
+	annotationKeyReconciler, err := controllers.NewAnnotationKeyReconciler(mgr, clusterConfig, watchNamespace)
+	if err != nil {
+		setupLog.Error(err, "unable to create annotation key reconciler")
+		os.Exit(1)
+	}
+	if err = annotationKeyReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "AnnotationKey")
+		os.Exit(1)
+	}
+
+	// Reject malformed ConfigMaps at admission. The serving certificate is provided by OLM.
+	if webhookPort != 0 {
+		mgr.GetWebhookServer().Register(webhooks.ConfigMapValidatorPath,
+			&webhook.Admission{Handler: webhooks.NewConfigMapValidator(watchNamespace, mgr.GetScheme())})
+		if cluster.PodWebhookEnabled() {
+			// The manager's cache is not started yet, the network config is read directly
+			networkCR := &openshiftconfig.Network{}
+			if err := mgr.GetAPIReader().Get(ctx, types.NamespacedName{Name: "cluster"}, networkCR); err != nil {
+				setupLog.Error(err, "unable to get cluster network config")
+				os.Exit(1)
+			}
+			clusterNetworks, err := cluster.GetClusterNetworks(networkCR)
+			if err != nil {
+				setupLog.Error(err, "unable to get cluster networks")
+				os.Exit(1)
+			}
+			mgr.GetWebhookServer().Register(webhooks.PodMutatorPath, &webhook.Admission{Handler: webhooks.NewPodMutator(
+				mgr.GetClient(), mgr.GetAPIReader(), mgr.GetScheme(), clusterNetworks)})
+		}
+	}
+
+	podWebhookReconciler, err := controllers.NewPodWebhookReconciler(mgr, watchNamespace, webhookPort != 0)
+	if err != nil {
+		setupLog.Error(err, "unable to create pod webhook reconciler")
+		os.Exit(1)
+	}
+	if err = podWebhookReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PodWebhook")
+		os.Exit(1)
+	}
+
 	//+kubebuilder:scaffold:builder
 	// The above marker tells kubebuilder that this is where the SetupWithManager function should be inserted when new
 	// controllers are generated by Operator SDK.
@@ -289,6 +426,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The annotation key is required to configure Windows instances
+	if err := annotationKeyReconciler.EnsureKeySecretExists(ctx); err != nil {
+		setupLog.Error(err, "error ensuring object exists", "singleton", types.NamespacedName{Namespace: watchNamespace,
+			Name: secrets.AnnotationKeySecret})
+		os.Exit(1)
+	}
+
 	if err := configMapReconciler.EnsureWICDRBAC(ctx); err != nil {
 		setupLog.Error(err, "error ensuring WICD RBAC resources exist", "namespace", watchNamespace)
 		os.Exit(1)
@@ -340,3 +484,43 @@ func getWatchNamespace() (string, error) {
 	}
 	return ns, nil
 }
+
+// newAuditConfig returns the configuration of the audit log at the given path, rotated once it reaches maxSize
+// megabytes, and of the audit webhook at the given URL. Either is disabled if its path or URL is empty. The records
+// are chained with the key held by the audit key Secret, continuing from the last record of an existing audit log.
+func newAuditConfig(ctx context.Context, mgr manager.Manager, namespace, logPath string, maxSize int64,
+	maxBackups int, webhookURL string) (audit.Config, error) {
+	auditConfig := audit.Config{}
+	if logPath != "" {
+		previousHash, err := audit.LastHash(logPath)
+		if err != nil {
+			return auditConfig, err
+		}
+		fileSink, err := audit.NewFileSink(logPath, maxSize*1024*1024, maxBackups)
+		if err != nil {
+			return auditConfig, fmt.Errorf("unable to open audit log %s: %w", logPath, err)
+		}
+		auditConfig.PreviousHash = previousHash
+		auditConfig.Sinks = append(auditConfig.Sinks, fileSink)
+	}
+	if webhookURL != "" {
+		webhookSink, err := audit.NewWebhookSink(webhookURL)
+		if err != nil {
+			return auditConfig, err
+		}
+		if err = mgr.Add(webhookSink); err != nil {
+			return auditConfig, fmt.Errorf("unable to start audit webhook: %w", err)
+		}
+		auditConfig.Sinks = append(auditConfig.Sinks, webhookSink)
+	}
+	if len(auditConfig.Sinks) == 0 {
+		return auditConfig, nil
+	}
+	// The manager's client cannot read objects until the manager is started
+	directClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		return auditConfig, fmt.Errorf("unable to create client: %w", err)
+	}
+	auditConfig.Key, err = secrets.EnsureAuditKey(ctx, directClient, namespace)
+	return auditConfig, err
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/crypto"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
+)
+
+const (
+	// AnnotationKeyController is the name of this controller in logs and other outputs.
+	AnnotationKeyController = "annotationkey"
+)
+
+// annotationKeyReconciler manages the versioned key the username annotations of Windows nodes are encrypted with. It
+// creates new key versions on request, re-encrypts the username annotations not encrypted with the newest version,
+// including those in the legacy PGP format, and removes the versions no longer in use.
+type annotationKeyReconciler struct {
+	instanceReconciler
+}
+
+// NewAnnotationKeyReconciler returns a pointer to a new annotationKeyReconciler
+func NewAnnotationKeyReconciler(mgr manager.Manager, clusterConfig cluster.Config,
+	watchNamespace string) (*annotationKeyReconciler, error) {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes clientset: %w", err)
+	}
+
+	return &annotationKeyReconciler{
+		instanceReconciler: instanceReconciler{
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controllers").WithName(AnnotationKeyController),
+			k8sclientset:   clientset,
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(AnnotationKeyController),
+			platform:       clusterConfig.Platform(),
+		},
+	}, nil
+}
+
+// EnsureKeySecretExists creates the annotation key Secret if it does not exist. The key must exist before any Windows
+// instance is configured, as it is used to encrypt the instance's username.
+func (r *annotationKeyReconciler) EnsureKeySecretExists(ctx context.Context) error {
+	_, err := r.k8sclientset.CoreV1().Secrets(r.watchNamespace).Get(ctx, secrets.AnnotationKeySecret,
+		meta.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !k8sapierrors.IsNotFound(err) {
+		return err
+	}
+	return r.createKeySecret(ctx)
+}
+
+// Reconcile creates a new key version if requested, re-encrypts the username annotations not encrypted with the
+// newest version, and removes the key versions no longer in use
+func (r *annotationKeyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	r.log = r.log.WithValues(AnnotationKeyController, req.NamespacedName)
+
+	keySecret := &core.Secret{}
+	if err := r.client.Get(ctx, req.NamespacedName, keySecret); err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			// Annotations encrypted with the deleted key cannot be decrypted, they are replaced with the nodes'
+			// usernames encrypted with the new key
+			r.log.Info("annotation key secret not found, recreating")
+			return ctrl.Result{}, r.createKeySecret(ctx)
+		}
+		return ctrl.Result{}, err
+	}
+
+	if _, present := keySecret.GetAnnotations()[secrets.RotateAnnotationKeyAnnotation]; present {
+		id, err := secrets.AddAnnotationKeyVersion(keySecret)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		delete(keySecret.Annotations, secrets.RotateAnnotationKeyAnnotation)
+		if err = r.client.Update(ctx, keySecret); err != nil {
+			return ctrl.Result{}, fmt.Errorf("error adding version to secret %s: %w", keySecret.GetName(), err)
+		}
+		r.log.Info("created annotation key version", "version", id)
+		r.recorder.Eventf(keySecret, core.EventTypeNormal, "AnnotationKeyRotated",
+			"Created annotation key version %s, re-encrypting node annotations", id)
+		// The update triggers the re-encryption
+		return ctrl.Result{}, nil
+	}
+
+	keyring, err := secrets.AnnotationKeyring(keySecret)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	inUse, err := r.reencryptUsernames(ctx, keyring)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.removeUnusedVersions(ctx, keySecret, inUse)
+}
+
+// createKeySecret creates a new annotation key Secret
+func (r *annotationKeyReconciler) createKeySecret(ctx context.Context) error {
+	keySecret, err := secrets.NewAnnotationKeySecret(r.watchNamespace)
+	if err != nil {
+		return err
+	}
+	if _, err = r.k8sclientset.CoreV1().Secrets(r.watchNamespace).Create(ctx, keySecret,
+		meta.CreateOptions{}); err != nil && !k8sapierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("unable to create secret %s: %w", secrets.AnnotationKeySecret, err)
+	}
+	r.log.Info("Created resource", "Secret", kubeTypes.NamespacedName{Namespace: r.watchNamespace,
+		Name: secrets.AnnotationKeySecret})
+	return nil
+}
+
+// reencryptUsernames re-encrypts the username annotations of all Windows nodes not encrypted with the active key of
+// the given keyring. Returns the IDs of the key versions which are still in use.
+func (r *annotationKeyReconciler) reencryptUsernames(ctx context.Context, keyring *crypto.Keyring) ([]string,
+	error) {
+	nodes := &core.NodeList{}
+	if err := r.client.List(ctx, nodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
+		return nil, fmt.Errorf("error listing Windows nodes: %w", err)
+	}
+	// The private key is only required to read usernames in the legacy format
+	var privateKeyBytes []byte
+	inUse := []string{keyring.ActiveKeyID()}
+	var errs []error
+	for _, node := range nodes.Items {
+		value, present := node.GetAnnotations()[UsernameAnnotation]
+		if !present || !keyring.NeedsReencryption(value) {
+			continue
+		}
+		if crypto.IsLegacy(value) && privateKeyBytes == nil {
+			var err error
+			privateKeyBytes, err = secrets.GetPrivateKey(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
+				Name: secrets.PrivateKeySecret}, r.client)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := r.reencryptUsername(ctx, &node, keyring, privateKeyBytes); err != nil {
+			errs = append(errs, err)
+			if id, ok := crypto.KeyID(value); ok {
+				inUse = append(inUse, id)
+			}
+		}
+	}
+	return inUse, errors.Join(errs...)
+}
+
+// reencryptUsername replaces the username annotation of the given node with the username encrypted with the active
+// key of the given keyring
+func (r *annotationKeyReconciler) reencryptUsername(ctx context.Context, node *core.Node, keyring *crypto.Keyring,
+	privateKeyBytes []byte) error {
+	username, err := keyring.Decrypt(node.GetAnnotations()[UsernameAnnotation], privateKeyBytes)
+	if err != nil {
+		r.log.Info("unable to decrypt username annotation, recovering it", "node", node.GetName(), "error", err)
+		if _, err = r.recoverUsername(ctx, node); err != nil {
+			return fmt.Errorf("unable to recover username annotation of node %s: %w", node.GetName(), err)
+		}
+		return nil
+	}
+	encrypted, err := keyring.Encrypt(username)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt username of node %s: %w", node.GetName(), err)
+	}
+	if err = metadata.ApplyLabelsAndAnnotations(ctx, r.client, *node, nil,
+		map[string]string{UsernameAnnotation: encrypted}); err != nil {
+		return fmt.Errorf("error updating username annotation of node %s: %w", node.GetName(), err)
+	}
+	r.log.Info("re-encrypted username annotation", "node", node.GetName(), "version", keyring.ActiveKeyID())
+	return nil
+}
+
+// removeUnusedVersions removes the key versions of the given Secret which are not in use. The version preceding the
+// active version is kept regardless, as usernames may be in the process of being encrypted with it.
+func (r *annotationKeyReconciler) removeUnusedVersions(ctx context.Context, keySecret *core.Secret,
+	inUse []string) error {
+	versions := secrets.AnnotationKeyVersions(keySecret)
+	if len(versions) > 1 {
+		inUse = append(inUse, versions[len(versions)-2])
+	}
+	var removed []string
+	for _, id := range versions {
+		if !slices.Contains(inUse, id) {
+			delete(keySecret.Data, id)
+			removed = append(removed, id)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	if err := r.client.Update(ctx, keySecret); err != nil {
+		return fmt.Errorf("error removing unused versions from secret %s: %w", keySecret.GetName(), err)
+	}
+	r.log.Info("removed unused annotation key versions", "versions", removed)
+	return nil
+}
+
+// mapToKeySecret maps Windows node events to the annotation key Secret
+func (r *annotationKeyReconciler) mapToKeySecret(_ context.Context, _ client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: kubeTypes.NamespacedName{Namespace: r.watchNamespace,
+		Name: secrets.AnnotationKeySecret}}}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *annotationKeyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	keySecretPredicate := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetName() == secrets.AnnotationKeySecret && obj.GetNamespace() == r.watchNamespace
+	})
+	windowsNodePredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			// get update event only when the username annotation changes
+			return isWindowsNode(e.ObjectNew) &&
+				e.ObjectOld.GetAnnotations()[UsernameAnnotation] != e.ObjectNew.GetAnnotations()[UsernameAnnotation]
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(AnnotationKeyController).
+		For(&core.Secret{}, builder.WithPredicates(keySecretPredicate)).
+		Watches(&core.Node{}, handler.EnqueueRequestsFromMapFunc(r.mapToKeySecret),
+			builder.WithPredicates(windowsNodePredicate)).
+		Complete(r)
+}
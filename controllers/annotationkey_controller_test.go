@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	config "github.com/openshift/api/config/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/crypto"
+	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
+	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
+)
+
+func TestAnnotationKeyReencryption(t *testing.T) {
+	ctx := context.Background()
+	watchNamespace := "test"
+	keySecret, err := secrets.NewAnnotationKeySecret(watchNamespace)
+	require.NoError(t, err)
+	previousKeyring, err := secrets.AnnotationKeyring(keySecret)
+	require.NoError(t, err)
+	// v1 and v2 are superseded, v3 is active
+	for i := 0; i < 2; i++ {
+		_, err = secrets.AddAnnotationKeyVersion(keySecret)
+		require.NoError(t, err)
+	}
+	keyring, err := secrets.AnnotationKeyring(keySecret)
+	require.NoError(t, err)
+
+	newNode := func(name string, keyring *crypto.Keyring) *core.Node {
+		username, err := keyring.Encrypt("Administrator")
+		require.NoError(t, err)
+		return &core.Node{ObjectMeta: meta.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{core.LabelOSStable: "windows"},
+			Annotations: map[string]string{UsernameAnnotation: username},
+		}}
+	}
+	outdated := newNode("outdated", previousKeyring)
+	current := newNode("current", keyring)
+	c := fake.NewClientBuilder().WithObjects(keySecret, outdated, current).Build()
+	r := annotationKeyReconciler{instanceReconciler: instanceReconciler{client: c, log: logr.Discard(),
+		watchNamespace: watchNamespace}}
+
+	inUse, err := r.reencryptUsernames(ctx, keyring)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v3"}, inUse)
+	for _, node := range []*core.Node{outdated, current} {
+		updated := &core.Node{}
+		require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(node), updated))
+		value := updated.GetAnnotations()[UsernameAnnotation]
+		assert.False(t, keyring.NeedsReencryption(value))
+		username, err := keyring.Decrypt(value, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "Administrator", username)
+	}
+	// the current node's annotation is left as is
+	updated := &core.Node{}
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(current), updated))
+	assert.Equal(t, current.GetAnnotations()[UsernameAnnotation], updated.GetAnnotations()[UsernameAnnotation])
+
+	// the version preceding the active version is kept
+	require.NoError(t, r.removeUnusedVersions(ctx, keySecret, inUse))
+	updatedSecret := &core.Secret{}
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(keySecret), updatedSecret))
+	assert.Equal(t, []string{"v2", "v3"}, secrets.AnnotationKeyVersions(updatedSecret))
+}
+
+func TestRecoverLostUsernames(t *testing.T) {
+	ctx := context.Background()
+	watchNamespace := "test"
+	keySecret, err := secrets.NewAnnotationKeySecret(watchNamespace)
+	require.NoError(t, err)
+	keyring, err := secrets.AnnotationKeyring(keySecret)
+	require.NoError(t, err)
+	// usernames encrypted with the key of a deleted Secret
+	lostKeySecret, err := secrets.NewAnnotationKeySecret(watchNamespace)
+	require.NoError(t, err)
+	lostKeyring, err := secrets.AnnotationKeyring(lostKeySecret)
+	require.NoError(t, err)
+
+	newNode := func(name, address string, labels map[string]string) *core.Node {
+		username, err := lostKeyring.Encrypt("lost")
+		require.NoError(t, err)
+		labels[core.LabelOSStable] = "windows"
+		return &core.Node{
+			ObjectMeta: meta.ObjectMeta{Name: name, Labels: labels,
+				Annotations: map[string]string{UsernameAnnotation: username}},
+			Status: core.NodeStatus{Addresses: []core.NodeAddress{{Type: core.NodeInternalIP, Address: address}}},
+		}
+	}
+	machineNode := newNode("machine", "10.0.0.1", map[string]string{})
+	byohNode := newNode("byoh", "10.0.0.2", map[string]string{BYOHLabel: "true"})
+	instances := &core.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{Name: wiparser.InstanceConfigMap, Namespace: watchNamespace},
+		Data:       map[string]string{"10.0.0.2": "username=byoh-admin"},
+	}
+	c := fake.NewClientBuilder().WithObjects(keySecret, instances, machineNode, byohNode).Build()
+	r := instanceReconciler{client: c, log: logr.Discard(), watchNamespace: watchNamespace,
+		recorder: record.NewFakeRecorder(2), platform: config.AzurePlatformType}
+
+	for node, expected := range map[*core.Node]string{machineNode: "capi", byohNode: "byoh-admin"} {
+		instanceInfo, err := r.instanceFromNode(ctx, node)
+		require.NoError(t, err)
+		assert.Equal(t, expected, instanceInfo.Username)
+
+		updated := &core.Node{}
+		require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(node), updated))
+		username, err := keyring.Decrypt(updated.GetAnnotations()[UsernameAnnotation], nil)
+		require.NoError(t, err, "the recovered username must be encrypted with the active key")
+		assert.Equal(t, expected, username)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/certexpiry"
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
+)
+
+const (
+	// CertExpiryController is the name of this controller in logs and other outputs.
+	CertExpiryController = "certexpiry"
+	// certExpiryCheckPeriod is how often each node's certificates are checked for approaching expiry, in the absence of
+	// any change to them
+	certExpiryCheckPeriod = time.Hour
+)
+
+// certExpiryReconciler reports the expiry of the certificates WMCO manages on each Windows node. The validity period of
+// each certificate is recorded on the node by WICD.
+type certExpiryReconciler struct {
+	instanceReconciler
+}
+
+// NewCertExpiryReconciler returns a pointer to a new certExpiryReconciler
+func NewCertExpiryReconciler(mgr manager.Manager, clusterConfig cluster.Config,
+	watchNamespace string) (*certExpiryReconciler, error) {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes clientset: %w", err)
+	}
+
+	return &certExpiryReconciler{
+		instanceReconciler: instanceReconciler{
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controllers").WithName(CertExpiryController),
+			k8sclientset:   clientset,
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(CertExpiryController),
+		},
+	}, nil
+}
+
+// Reconcile updates the certificate expiry metrics of the given Windows node, and raises an event and sets the node's
+// WindowsCertificatesExpiring condition if any of its certificates are close to expiry
+func (r *certExpiryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	r.log = r.log.WithValues(CertExpiryController, req.NamespacedName)
+
+	node := &core.Node{}
+	if err := r.client.Get(ctx, req.NamespacedName, node); err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			metrics.CertificateExpiry.DeletePartialMatch(prometheus.Labels{"node": req.Name})
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	status, err := certexpiry.GetStatus(node)
+	if err != nil {
+		// The annotation is rewritten by WICD on its next reconcile, there is no point in retrying
+		r.log.Error(err, "unable to determine certificate status")
+		return ctrl.Result{}, nil
+	}
+
+	// Remove the metrics of certificates which are no longer present
+	metrics.CertificateExpiry.DeletePartialMatch(prometheus.Labels{"node": node.GetName()})
+	for name, validity := range status {
+		metrics.CertificateExpiry.WithLabelValues(node.GetName(), name).Set(float64(validity.NotAfter.Unix()))
+	}
+
+	expiring := status.Expiring(time.Now())
+	changed, err := r.setExpiringCondition(ctx, node, expiring)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Events are only raised when the set of expiring certificates changes, the condition reports the ongoing state
+	if changed {
+		for _, name := range expiring {
+			r.recorder.Eventf(node, core.EventTypeWarning, "CertificateExpiring", "certificate %s expires at %s", name,
+				status[name].NotAfter.Format(time.RFC3339))
+		}
+	}
+	// Certificates approach expiry without any change to the node, so they are checked periodically
+	return ctrl.Result{RequeueAfter: certExpiryCheckPeriod}, nil
+}
+
+// setExpiringCondition sets the node's WindowsCertificatesExpiring condition to reflect the given expiring
+// certificates, if it does not already. Returns true if the condition was changed.
+func (r *certExpiryReconciler) setExpiringCondition(ctx context.Context, node *core.Node,
+	expiring []string) (bool, error) {
+	expected := core.NodeCondition{
+		Type:    certexpiry.ConditionType,
+		Status:  core.ConditionFalse,
+		Reason:  "CertificatesValid",
+		Message: "No certificates are close to expiry",
+	}
+	if len(expiring) > 0 {
+		expected.Status = core.ConditionTrue
+		expected.Reason = "CertificatesExpiring"
+		expected.Message = "Certificates close to expiry: " + strings.Join(expiring, ", ")
+	}
+
+	patchBase := client.StrategicMergeFrom(node.DeepCopy())
+	now := meta.Now()
+	found := false
+	for i, condition := range node.Status.Conditions {
+		if condition.Type != certexpiry.ConditionType {
+			continue
+		}
+		found = true
+		if condition.Status == expected.Status && condition.Message == expected.Message {
+			return false, nil
+		}
+		expected.LastTransitionTime = condition.LastTransitionTime
+		if condition.Status != expected.Status {
+			expected.LastTransitionTime = now
+		}
+		expected.LastHeartbeatTime = now
+		node.Status.Conditions[i] = expected
+	}
+	if !found {
+		expected.LastTransitionTime = now
+		expected.LastHeartbeatTime = now
+		node.Status.Conditions = append(node.Status.Conditions, expected)
+	}
+	if err := r.client.Status().Patch(ctx, node, patchBase); err != nil {
+		return false, fmt.Errorf("error setting %s condition on node %s: %w", certexpiry.ConditionType,
+			node.GetName(), err)
+	}
+	r.log.Info("updated certificate expiry condition", "status", expected.Status, "expiring", expiring)
+	return true, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *certExpiryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	windowsNodePredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			// get update event only when the recorded certificate status changes
+			return isWindowsNode(e.ObjectNew) &&
+				e.ObjectOld.GetAnnotations()[certexpiry.Annotation] != e.ObjectNew.GetAnnotations()[certexpiry.Annotation]
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(CertExpiryController).
+		For(&core.Node{}, builder.WithPredicates(windowsNodePredicate)).
+		Complete(r)
+}
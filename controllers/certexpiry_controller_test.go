@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/certexpiry"
+)
+
+func TestCertExpiryEvents(t *testing.T) {
+	now := time.Now().UTC()
+	status := certexpiry.Status{
+		certexpiry.KubeletServing: {NotBefore: now.Add(-30 * 24 * time.Hour), NotAfter: now.Add(time.Hour)},
+		certexpiry.KubeletClient:  {NotBefore: now, NotAfter: now.Add(30 * 24 * time.Hour)},
+	}
+	value, err := status.Marshal()
+	require.NoError(t, err)
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{
+		Name:        "node",
+		Labels:      map[string]string{core.LabelOSStable: "windows"},
+		Annotations: map[string]string{certexpiry.Annotation: value},
+	}}
+	fakeClient := fake.NewClientBuilder().WithObjects(node).WithStatusSubresource(node).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &certExpiryReconciler{instanceReconciler: instanceReconciler{client: fakeClient, log: logr.Discard(),
+		recorder: recorder}}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "node"}}
+	for i := 0; i < 2; i++ {
+		_, err = r.Reconcile(context.Background(), req)
+		require.NoError(t, err)
+	}
+	require.Len(t, recorder.Events, 1, "an unchanged state must not raise the event again")
+	assert.Contains(t, <-recorder.Events, certexpiry.KubeletServing)
+
+	updated := &core.Node{}
+	require.NoError(t, fakeClient.Get(context.Background(), req.NamespacedName, updated))
+	require.Len(t, updated.Status.Conditions, 1)
+	assert.Equal(t, core.ConditionTrue, updated.Status.Conditions[0].Status)
+}
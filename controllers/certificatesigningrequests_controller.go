@@ -63,12 +63,12 @@ func NewCertificateSigningRequestsReconciler(mgr manager.Manager, clusterConfig
 
 	return &certificateSigningRequestsReconciler{
 		instanceReconciler: instanceReconciler{
-			client:             mgr.GetClient(),
-			log:                ctrl.Log.WithName("controllers").WithName(CSRController),
-			k8sclientset:       clientset,
-			clusterServiceCIDR: clusterConfig.Network().GetServiceCIDR(),
-			watchNamespace:     watchNamespace,
-			recorder:           mgr.GetEventRecorderFor(CSRController),
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controllers").WithName(CSRController),
+			k8sclientset:   clientset,
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(CSRController),
+			networkBackend: clusterConfig.Network().Backend(),
 		},
 	}, nil
 }
@@ -116,7 +116,7 @@ func (r *certificateSigningRequestsReconciler) reconcileCSR(ctx context.Context,
 		}
 
 		csrApprover, err := csr.NewApprover(r.client, r.k8sclientset, certificateSigningRequest, r.log, r.recorder,
-			r.watchNamespace)
+			r.watchNamespace, r.networkBackend)
 		if err != nil {
 			return fmt.Errorf("could not create WMCO CSR Approver: %w", err)
 		}
@@ -0,0 +1,188 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	config "github.com/openshift/api/config/v1"
+	core "k8s.io/api/core/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
+	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig/payload"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+//+kubebuilder:rbac:groups=config.openshift.io,resources=infrastructures,verbs=get;list;watch
+//+kubebuilder:rbac:groups=config.openshift.io,resources=networks,verbs=get;list;watch
+
+const (
+	// ClusterConfigController is the name of this controller in logs and other outputs.
+	ClusterConfigController = "clusterconfig"
+	// clusterConfigName is the name of the cluster scoped Infrastructure and Network config singletons
+	clusterConfigName = "cluster"
+)
+
+// ClusterConfigReconciler keeps the cluster endpoints used to configure Windows nodes, the API server endpoint and the
+// service CIDR, in sync with the cluster Infrastructure and Network config. When the endpoints change, the controllers
+// configuring Windows instances are notified of each Windows node that must be reconfigured.
+type ClusterConfigReconciler struct {
+	instanceReconciler
+	// subscribers receive an event for each Windows node configured with outdated cluster endpoints
+	subscribers []chan event.GenericEvent
+}
+
+// NewClusterConfigReconciler returns a pointer to a new ClusterConfigReconciler
+func NewClusterConfigReconciler(mgr manager.Manager, clusterConfig cluster.Config,
+	watchNamespace string) *ClusterConfigReconciler {
+	return &ClusterConfigReconciler{
+		instanceReconciler: instanceReconciler{
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controllers").WithName(ClusterConfigController),
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(ClusterConfigController),
+			networkBackend: clusterConfig.Network().Backend(),
+		},
+	}
+}
+
+// Subscribe returns a channel which receives an event for each Windows node that must be reconfigured after the
+// cluster endpoints change. All subscriptions must be made before the manager is started.
+func (r *ClusterConfigReconciler) Subscribe() <-chan event.GenericEvent {
+	subscriber := make(chan event.GenericEvent)
+	r.subscribers = append(r.subscribers, subscriber)
+	return subscriber
+}
+
+// Reconcile updates the cluster endpoints used to configure Windows nodes, regenerating the network configuration
+// script when the service CIDR changes, and triggers the reconfiguration of Windows nodes using outdated endpoints.
+func (r *ClusterConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.log.WithValues(ClusterConfigController, req.NamespacedName)
+
+	infra := &config.Infrastructure{}
+	if err := r.client.Get(ctx, kubeTypes.NamespacedName{Name: clusterConfigName}, infra); err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to get cluster infrastructure resource: %w", err)
+	}
+	apiServerEndpoint := infra.Status.APIServerInternalURL
+	if apiServerEndpoint == "" {
+		return ctrl.Result{}, fmt.Errorf("could not get host name for the kubernetes api server")
+	}
+	network := &config.Network{}
+	if err := r.client.Get(ctx, kubeTypes.NamespacedName{Name: clusterConfigName}, network); err != nil {
+		return ctrl.Result{}, fmt.Errorf("error getting cluster network object: %w", err)
+	}
+	serviceCIDR, err := cluster.GetServiceCIDR(network)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if apiServerEndpoint == nodeconfig.APIServerEndpoint() && serviceCIDR == nodeconfig.ClusterServiceCIDR() {
+		return ctrl.Result{}, nil
+	}
+	log.Info("cluster endpoints changed", "API server endpoint", apiServerEndpoint, "service CIDR", serviceCIDR)
+	// The script must be regenerated before the cache is updated, so that a failure is retried on requeue
+	if r.networkBackend == cluster.HybridOverlayBackend && serviceCIDR != nodeconfig.ClusterServiceCIDR() {
+		if err := payload.PopulateNetworkConfScript(serviceCIDR, windows.OVNKubeOverlayNetwork, windows.HNSPSModule,
+			windows.CniConfDir+"\\cni.conf"); err != nil {
+			return ctrl.Result{}, fmt.Errorf("unable to generate CNI config script: %w", err)
+		}
+	}
+	nodeconfig.UpdateClusterEndpoints(apiServerEndpoint, serviceCIDR)
+
+	return ctrl.Result{}, r.notifyOutdatedNodes(ctx)
+}
+
+// notifyOutdatedNodes sends an event to all subscribers for each Windows node configured with outdated cluster
+// endpoints. The subscribers reconfigure the nodes following the usual upgrade process.
+func (r *ClusterConfigReconciler) notifyOutdatedNodes(ctx context.Context) error {
+	nodes := &core.NodeList{}
+	if err := r.client.List(ctx, nodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
+		return fmt.Errorf("error listing Windows nodes: %w", err)
+	}
+	for i := range nodes.Items {
+		if nodeconfig.ClusterEndpointsUpToDate(&nodes.Items[i]) {
+			continue
+		}
+		r.log.Info("node requires reconfiguration with the current cluster endpoints", "node",
+			nodes.Items[i].GetName())
+		for _, subscriber := range r.subscribers {
+			select {
+			case subscriber <- event.GenericEvent{Object: &nodes.Items[i]}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// mapToClusterConfig fulfills the MapFn type, while always returning a request for the cluster config singletons
+func (r *ClusterConfigReconciler) mapToClusterConfig(_ context.Context, _ client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: kubeTypes.NamespacedName{Name: clusterConfigName}}}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(ClusterConfigController).
+		For(&config.Infrastructure{}, builder.WithPredicates(clusterEndpointsChangedPredicate())).
+		Watches(&config.Network{}, handler.EnqueueRequestsFromMapFunc(r.mapToClusterConfig),
+			builder.WithPredicates(clusterEndpointsChangedPredicate())).
+		Complete(r)
+}
+
+// clusterEndpointsChangedPredicate filters for the cluster config singletons, only allowing updates which change the
+// API server internal endpoint or the service network through
+func clusterEndpointsChangedPredicate() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return e.Object.GetName() == clusterConfigName
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectNew.GetName() != clusterConfigName {
+				return false
+			}
+			switch newObj := e.ObjectNew.(type) {
+			case *config.Infrastructure:
+				oldObj, ok := e.ObjectOld.(*config.Infrastructure)
+				return ok && oldObj.Status.APIServerInternalURL != newObj.Status.APIServerInternalURL
+			case *config.Network:
+				oldObj, ok := e.ObjectOld.(*config.Network)
+				return ok && !reflect.DeepEqual(oldObj.Spec.ServiceNetwork, newObj.Spec.ServiceNetwork)
+			}
+			return false
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return e.Object.GetName() == clusterConfigName
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+	}
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"testing"
+
+	config "github.com/openshift/api/config/v1"
+	"github.com/stretchr/testify/assert"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestClusterEndpointsChangedPredicate(t *testing.T) {
+	clusterMeta := meta.ObjectMeta{Name: clusterConfigName}
+	infra := func(name, url string) *config.Infrastructure {
+		return &config.Infrastructure{ObjectMeta: meta.ObjectMeta{Name: name},
+			Status: config.InfrastructureStatus{APIServerInternalURL: url}}
+	}
+	network := func(serviceNetwork ...string) *config.Network {
+		return &config.Network{ObjectMeta: clusterMeta, Spec: config.NetworkSpec{ServiceNetwork: serviceNetwork}}
+	}
+
+	testCases := []struct {
+		name     string
+		old      client.Object
+		new      client.Object
+		expected bool
+	}{
+		{
+			name:     "API server endpoint changed",
+			old:      infra(clusterConfigName, "https://api-int.old.com:6443"),
+			new:      infra(clusterConfigName, "https://api-int.new.com:6443"),
+			expected: true,
+		},
+		{
+			name:     "API server endpoint unchanged",
+			old:      infra(clusterConfigName, "https://api-int.old.com:6443"),
+			new:      infra(clusterConfigName, "https://api-int.old.com:6443"),
+			expected: false,
+		},
+		{
+			name:     "not the cluster singleton",
+			old:      infra("other", "https://api-int.old.com:6443"),
+			new:      infra("other", "https://api-int.new.com:6443"),
+			expected: false,
+		},
+		{
+			name:     "service network changed",
+			old:      network("172.30.0.0/16"),
+			new:      network("10.0.0.0/16"),
+			expected: true,
+		},
+		{
+			name:     "service network unchanged",
+			old:      network("172.30.0.0/16"),
+			new:      network("172.30.0.0/16"),
+			expected: false,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected,
+				clusterEndpointsChangedPredicate().Update(event.UpdateEvent{ObjectOld: test.old, ObjectNew: test.new}))
+		})
+	}
+}
@@ -19,6 +19,7 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -28,6 +29,7 @@ import (
 	config "github.com/openshift/api/config/v1"
 	oconfig "github.com/openshift/api/config/v1"
 	mcfgv1 "github.com/openshift/api/machineconfiguration/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
 	core "k8s.io/api/core/v1"
 	rbac "k8s.io/api/rbac/v1"
 	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -42,19 +44,24 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/certificates"
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/cni"
 	"github.com/openshift/windows-machine-config-operator/pkg/condition"
-	"github.com/openshift/windows-machine-config-operator/pkg/crypto"
+	"github.com/openshift/windows-machine-config-operator/pkg/filesets"
 	"github.com/openshift/windows-machine-config-operator/pkg/ignition"
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
 	"github.com/openshift/windows-machine-config-operator/pkg/patch"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
 	"github.com/openshift/windows-machine-config-operator/pkg/services"
 	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
 	"github.com/openshift/windows-machine-config-operator/pkg/signer"
+	"github.com/openshift/windows-machine-config-operator/pkg/wicdauth"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
 	"github.com/openshift/windows-machine-config-operator/version"
 )
@@ -67,6 +74,10 @@ import (
 //+kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
 //+kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=rolebindings,verbs=get;create;delete
 //+kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=clusterrolebindings,verbs=get;create;delete
+//+kubebuilder:rbac:groups="admissionregistration.k8s.io",resources=validatingadmissionpolicies;validatingadmissionpolicybindings,verbs=get;create;update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=delete
+//+kubebuilder:rbac:groups="",resources=serviceaccounts/token,verbs=create
+//+kubebuilder:rbac:groups="operator.openshift.io",resources=networks,verbs=get;list;watch
 
 const (
 	// BYOHLabel is a label that should be applied to all Windows nodes not associated with a Machine.
@@ -75,6 +86,8 @@ const (
 	UsernameAnnotation = "windowsmachineconfig.openshift.io/username"
 	// ConfigMapController is the name of this controller in logs and other outputs.
 	ConfigMapController = "configmap"
+	// networkOperatorConfigName is the name of the cluster network operator configuration object
+	networkOperatorConfigName = "cluster"
 	// wicdRBACResourceName is the name of the resources associated with WICD's RBAC permissions
 	wicdRBACResourceName = "windows-instance-config-daemon"
 	// InjectionRequestLabel is used to allow CNO to inject the trusted CA bundle when the global Proxy resource changes
@@ -86,7 +99,6 @@ type ConfigMapReconciler struct {
 	instanceReconciler
 	servicesManifest *servicescm.Data
 	proxyEnabled     bool
-	VXLANPort        string
 }
 
 // NewConfigMapReconciler returns a pointer to a ConfigMapReconciler
@@ -101,24 +113,24 @@ func NewConfigMapReconciler(ctx context.Context, mgr manager.Manager, clusterCon
 	if err != nil {
 		return nil, err
 	}
-	svcData, err := generateServicesManifest(ctx, directClient, clusterConfig.Network().VXLANPort(), clusterConfig.Platform())
+	svcData, err := generateServicesManifest(ctx, directClient, watchNamespace, clusterConfig.Network().Backend(),
+		clusterConfig.Platform())
 	if err != nil {
 		return nil, err
 	}
 
 	return &ConfigMapReconciler{
 		instanceReconciler: instanceReconciler{
-			client:             mgr.GetClient(),
-			k8sclientset:       clientset,
-			clusterServiceCIDR: clusterConfig.Network().GetServiceCIDR(),
-			log:                ctrl.Log.WithName("controllers").WithName(ConfigMapController),
-			watchNamespace:     watchNamespace,
-			recorder:           mgr.GetEventRecorderFor(ConfigMapController),
-			platform:           clusterConfig.Platform(),
+			client:         mgr.GetClient(),
+			k8sclientset:   clientset,
+			networkBackend: clusterConfig.Network().Backend(),
+			log:            ctrl.Log.WithName("controllers").WithName(ConfigMapController),
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(ConfigMapController),
+			platform:       clusterConfig.Platform(),
 		},
 		servicesManifest: svcData,
 		proxyEnabled:     proxyEnabled,
-		VXLANPort:        clusterConfig.Network().VXLANPort(),
 	}, nil
 }
 
@@ -147,7 +159,8 @@ func (r *ConfigMapReconciler) Reconcile(ctx context.Context,
 		return ctrl.Result{}, fmt.Errorf("unable to create signer from private key secret: %w", err)
 	}
 
-	servicesManifest, err := generateServicesManifest(ctx, r.client, r.VXLANPort, r.platform)
+	servicesManifest, err := generateServicesManifest(ctx, r.client, r.watchNamespace, r.networkBackend,
+		r.platform)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -159,6 +172,7 @@ func (r *ConfigMapReconciler) Reconcile(ctx context.Context,
 	// 2. windows-services, describing expected configuration of WMCO-managed services on all Windows instances
 	// 3. kube-apiserver-to-kubelet-client-ca, contains the CA for the kubelet to recognize the kube-apiserver client cert
 	// 4. trusted-ca, where CNO will publish user-provided certs when there is an active cluster-wide proxy
+	// 5. windows-cni-config, holding the user provided CNI when the BYOCNI network backend is used
 	configMap := &core.ConfigMap{}
 	if err := r.client.Get(ctx, req.NamespacedName, configMap); err != nil {
 		if !k8sapierrors.IsNotFound(err) {
@@ -186,6 +200,8 @@ func (r *ConfigMapReconciler) Reconcile(ctx context.Context,
 		return ctrl.Result{}, r.reconcileNodes(ctx, configMap)
 	case certificates.ProxyCertsConfigMap:
 		return ctrl.Result{}, r.reconcileProxyCerts(ctx, configMap)
+	case cni.ConfigMapName:
+		return ctrl.Result{}, r.reconcileCNIConfig(ctx, configMap)
 	default:
 		// Unexpected configmap, log and return no error so we don't requeue
 		r.log.Error(fmt.Errorf("unexpected resource triggered reconcile"), "ConfigMap", req.NamespacedName)
@@ -199,6 +215,9 @@ func (r *ConfigMapReconciler) reconcileServices(ctx context.Context, windowsServ
 	if err := r.removeOutdatedServicesConfigMaps(ctx); err != nil {
 		return err
 	}
+	if err := r.removeLegacyWICDTokenSecret(ctx); err != nil {
+		return fmt.Errorf("unable to remove legacy WICD token Secret: %w", err)
+	}
 
 	// If a ConfigMap with invalid values is found, WMCO will delete and recreate it with proper values
 	data, err := servicescm.Parse(windowsServices.Data)
@@ -242,6 +261,36 @@ func (r *ConfigMapReconciler) removeOutdatedServicesConfigMaps(ctx context.Conte
 	return nil
 }
 
+// removeLegacyWICDTokenSecret deletes the Secret holding the long-lived WICD ServiceAccount token shared by all nodes
+// configured by previous WMCO versions, revoking the token. This is done once all Windows nodes have been reconfigured
+// with their own short-lived token, so that the nodes yet to be reconfigured are not left unable to run WICD.
+func (r *ConfigMapReconciler) removeLegacyWICDTokenSecret(ctx context.Context) error {
+	nodes := &core.NodeList{}
+	if err := r.client.List(ctx, nodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
+		return err
+	}
+	for _, node := range nodes.Items {
+		if node.Annotations[metadata.VersionAnnotation] != version.Get() {
+			return nil
+		}
+	}
+	tokenSecret := &core.Secret{}
+	err := r.client.Get(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace, Name: windows.WicdServiceName},
+		tokenSecret)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if tokenSecret.Type != core.SecretTypeServiceAccountToken {
+		return nil
+	}
+	if err := r.client.Delete(ctx, tokenSecret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.log.Info("Deleted outdated resource", "Secret",
+		kubeTypes.NamespacedName{Namespace: r.watchNamespace, Name: windows.WicdServiceName})
+	return nil
+}
+
 // isTiedToRelevantVersion checks if the given version is the current WMCO version or is in the given map of versions
 func isTiedToRelevantVersion(v string, versions map[string]struct{}) bool {
 	if v == version.Get() {
@@ -288,9 +337,8 @@ func (r *ConfigMapReconciler) reconcileNodes(ctx context.Context, windowsInstanc
 
 // ensureInstancesAreUpToDate configures all instances that require configuration
 func (r *ConfigMapReconciler) ensureInstancesAreUpToDate(ctx context.Context, instances []*instance.Info) error {
-	// Get private key to encrypt instance usernames
-	privateKeyBytes, err := secrets.GetPrivateKey(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
-		Name: secrets.PrivateKeySecret}, r.client)
+	// Get the annotation keyring to encrypt instance usernames
+	keyring, err := secrets.GetAnnotationKeyring(ctx, r.client, r.watchNamespace)
 	if err != nil {
 		return err
 	}
@@ -300,12 +348,29 @@ func (r *ConfigMapReconciler) ensureInstancesAreUpToDate(ctx context.Context, in
 		// When platform type is none or Nutanix, kubelet will pick a random interface to use for the Node's IP. In that case we
 		// should override that with the IP that the user is providing via the ConfigMap.
 		instanceInfo.SetNodeIP = r.platform == config.NonePlatformType || r.platform == config.NutanixPlatformType
-		encryptedUsername, err := crypto.EncryptToJSONString(instanceInfo.Username, privateKeyBytes)
+		encryptedUsername, err := keyring.Encrypt(instanceInfo.Username)
 		if err != nil {
 			return fmt.Errorf("unable to encrypt username for instance %s: %w", instanceInfo.Address, err)
 		}
+		if instanceInfo.Node != nil && instance.CredentialsFromNode(instanceInfo.Node) != instanceInfo.Credentials {
+			// Credentials can be changed without reconfiguring the instance, as long as they grant access to it
+			if err = metadata.ApplyLabelsAndAnnotations(ctx, r.client, *instanceInfo.Node, nil,
+				instanceInfo.Credentials.Annotations()); err != nil {
+				return fmt.Errorf("error updating credentials of node %s: %w", instanceInfo.Node.GetName(), err)
+			}
+		}
+		annotationsToApply := instanceInfo.Credentials.Annotations()
+		annotationsToApply[UsernameAnnotation] = encryptedUsername
 		err = r.ensureInstanceIsUpToDate(ctx, instanceInfo, map[string]string{BYOHLabel: "true", nodeconfig.WorkerLabel: ""},
-			map[string]string{UsernameAnnotation: encryptedUsername})
+			annotationsToApply)
+		var unsupportedOSErr *windows.UnsupportedOSErr
+		if errors.As(err, &unsupportedOSErr) {
+			// The instance cannot be configured until its OS is changed, don't let it block configuration of the rest
+			r.log.Info("skipping instance", "address", instanceInfo.Address, "reason", unsupportedOSErr.Error())
+			r.recorder.Eventf(windowsInstances, core.EventTypeWarning, "UnsupportedWindowsBuild",
+				"Instance with address %s cannot be configured: %s", instanceInfo.Address, unsupportedOSErr.Error())
+			continue
+		}
 		if err != nil {
 			// It is better to return early like this, instead of trying to configure as many instances as possible in a
 			// single reconcile call, as it simplifies error collection. The order the map is read from is
@@ -383,8 +448,10 @@ func (r *ConfigMapReconciler) mapToServicesConfigMap(_ context.Context, _ client
 	}}
 }
 
-// SetupWithManager sets up the controller with the Manager.
-func (r *ConfigMapReconciler) SetupWithManager(mgr ctrl.Manager) error {
+// SetupWithManager sets up the controller with the Manager. BYOH nodes sent over clusterEndpointsEvents are
+// reconfigured if they are outdated.
+func (r *ConfigMapReconciler) SetupWithManager(mgr ctrl.Manager,
+	clusterEndpointsEvents <-chan event.GenericEvent) error {
 	configMapPredicate := predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
 			return r.isValidConfigMap(e.Object)
@@ -403,13 +470,45 @@ func (r *ConfigMapReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&core.ConfigMap{}, builder.WithPredicates(configMapPredicate)).
 		Watches(&core.Node{}, handler.EnqueueRequestsFromMapFunc(r.mapToInstancesConfigMap),
 			builder.WithPredicates(outdatedWindowsNodePredicate(true))).
+		WatchesRawSource(source.Channel(clusterEndpointsEvents, handler.EnqueueRequestsFromMapFunc(r.mapToInstancesConfigMap),
+			source.WithPredicates[client.Object, reconcile.Request](outdatedWindowsNodePredicate(true)))).
 		Watches(&core.Node{}, handler.EnqueueRequestsFromMapFunc(r.mapToServicesConfigMap),
 			builder.WithPredicates(windowsNodeVersionChangePredicate())).
 		Watches(&mcfgv1.MachineConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapToServicesConfigMap),
 			builder.WithPredicates(machineConfigCreatedPredicate())).
+		Watches(&operatorv1.Network{}, handler.EnqueueRequestsFromMapFunc(r.mapToServicesConfigMap),
+			builder.WithPredicates(hybridOverlayConfigChangedPredicate())).
 		Complete(r)
 }
 
+// hybridOverlayConfigChangedPredicate filters for changes to the hybrid overlay settings of the cluster network
+// operator configuration
+func hybridOverlayConfigChangedPredicate() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return false
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldNetwork, ok := e.ObjectOld.(*operatorv1.Network)
+			if !ok {
+				return false
+			}
+			newNetwork, ok := e.ObjectNew.(*operatorv1.Network)
+			if !ok {
+				return false
+			}
+			return newNetwork.GetName() == networkOperatorConfigName &&
+				cluster.GetHybridOverlayConfig(oldNetwork) != cluster.GetHybridOverlayConfig(newNetwork)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+	}
+}
+
 func machineConfigCreatedPredicate() predicate.Funcs {
 	return predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
@@ -431,7 +530,8 @@ func machineConfigCreatedPredicate() predicate.Funcs {
 func (r *ConfigMapReconciler) isValidConfigMap(o client.Object) bool {
 	return o.GetNamespace() == r.watchNamespace &&
 		(o.GetName() == wiparser.InstanceConfigMap || o.GetName() == servicescm.Name ||
-			(r.proxyEnabled && o.GetName() == certificates.ProxyCertsConfigMap))
+			(r.proxyEnabled && o.GetName() == certificates.ProxyCertsConfigMap) ||
+			(r.networkBackend == cluster.BYOCNIBackend && o.GetName() == cni.ConfigMapName))
 }
 
 // createServicesConfigMap creates a valid ServicesConfigMap and returns it
@@ -513,32 +613,40 @@ func (r *ConfigMapReconciler) reconcileProxyCerts(ctx context.Context, trustedCA
 	return r.ensureTrustedCABundleInNodes(ctx)
 }
 
-// ensureTrustedCABundleInNodes copies over the trust CA bundle onto each Windows instance in the cluster
+// ensureTrustedCABundleInNodes publishes the trusted CA bundle, which WICD places onto each Windows instance
 func (r *ConfigMapReconciler) ensureTrustedCABundleInNodes(ctx context.Context) error {
-	winNodes := &core.NodeList{}
-	if err := r.client.List(ctx, winNodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
-		return fmt.Errorf("error listing nodes: %w", err)
-	}
-	for _, node := range winNodes.Items {
-		if err := r.ensureTrustedCABundleInNode(ctx, node); err != nil {
-			return fmt.Errorf("error ensuring trusted CA bundle is up-to-date on node %s: %w", node.Name, err)
-		}
+	caBundle, userCABundle, err := nodeconfig.GenerateTrustedCABundle(ctx, r.client, r.watchNamespace)
+	if err != nil {
+		return fmt.Errorf("error generating trusted CA bundle: %w", err)
 	}
-	return nil
+	_, fileName := windows.SplitPath(windows.TrustedCABundlePath)
+	_, userFileName := windows.SplitPath(windows.UserCABundlePath)
+	_, err = r.publishFileSet(ctx, filesets.TrustedCABundle,
+		map[string][]byte{fileName: []byte(caBundle), userFileName: []byte(userCABundle)})
+	return err
 }
 
-// ensureTrustedCABundleInNodes places the trusted CA bundle data into a file on the given node
-func (r *ConfigMapReconciler) ensureTrustedCABundleInNode(ctx context.Context, node core.Node) error {
-	winInstance, err := r.instanceFromNode(ctx, &node)
-	if err != nil {
-		return err
+// reconcileCNIConfig publishes the user provided CNI plugins and network configuration, which WICD applies to each
+// Windows instance. The configuration last published is left in place if the ConfigMap is deleted or invalid.
+func (r *ConfigMapReconciler) reconcileCNIConfig(ctx context.Context, cniConfigMap *core.ConfigMap) error {
+	if cniConfigMap.GetName() == "" {
+		r.log.Info("ConfigMap not found, leaving the CNI configuration of existing nodes in place", "ConfigMap",
+			cni.ConfigMapName)
+		return nil
 	}
-	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
-		winInstance, r.signer, nil, nil, r.platform)
+	cniConfig, err := cni.Parse(cniConfigMap)
 	if err != nil {
-		return fmt.Errorf("failed to create new nodeconfig: %w", err)
+		// The ConfigMap is reconciled again once it is fixed
+		r.recorder.Eventf(cniConfigMap, core.EventTypeWarning, "InvalidCNIConfig", err.Error())
+		r.log.Error(err, "invalid CNI configuration", "ConfigMap", cni.ConfigMapName)
+		return nil
+	}
+	// Plugins are published first, so that network configuration never refers to a plugin missing from the instance
+	if _, err = r.publishFileSet(ctx, filesets.CNIPlugins, cniConfig.Plugins); err != nil {
+		return err
 	}
-	return nc.SyncTrustedCABundle(ctx)
+	_, err = r.publishFileSet(ctx, filesets.CNIConfig, cniConfig.NetworkConfigs)
+	return err
 }
 
 // ensureProxyCertsCMIsValid ensures the trusted CA ConfigMap has the expected injection request. Patches the object if not.
@@ -583,9 +691,69 @@ func (r *ConfigMapReconciler) EnsureWICDRBAC(ctx context.Context) error {
 	if err := r.ensureWICDRoleBinding(ctx); err != nil {
 		return err
 	}
+	// The restriction of WICD to its own node must be in place before WICD is granted access to all nodes
+	if err := r.ensureWICDNodeRestriction(ctx); err != nil {
+		return err
+	}
 	return r.ensureWICDClusterRoleBinding(ctx)
 }
 
+// ensureWICDNodeRestriction ensures the ValidatingAdmissionPolicy and binding restricting WICD to modifying its own
+// node exist as expected. Creates them if they don't exist, updates them if they exist with improper spec.
+func (r *ConfigMapReconciler) ensureWICDNodeRestriction(ctx context.Context) error {
+	// The policy denies all requests made by WICD until its parameter exists
+	if err := wicdauth.EnsureCredentialsConfigMap(ctx, r.client, r.watchNamespace); err != nil {
+		return err
+	}
+	expectedPolicy, expectedBinding := wicdauth.NodeRestrictionPolicy(r.watchNamespace)
+	policies := r.k8sclientset.AdmissionregistrationV1().ValidatingAdmissionPolicies()
+	existingPolicy, err := policies.Get(ctx, expectedPolicy.GetName(), meta.GetOptions{})
+	if err != nil {
+		if !k8sapierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to get ValidatingAdmissionPolicy %s: %w", expectedPolicy.GetName(), err)
+		}
+		if _, err = policies.Create(ctx, expectedPolicy, meta.CreateOptions{}); err != nil {
+			return fmt.Errorf("unable to create ValidatingAdmissionPolicy %s: %w", expectedPolicy.GetName(), err)
+		}
+		r.log.Info("Created resource", "ValidatingAdmissionPolicy", expectedPolicy.GetName())
+	} else if !reflect.DeepEqual(existingPolicy.Spec.ParamKind, expectedPolicy.Spec.ParamKind) ||
+		!reflect.DeepEqual(existingPolicy.Spec.MatchConditions, expectedPolicy.Spec.MatchConditions) ||
+		!reflect.DeepEqual(existingPolicy.Spec.Variables, expectedPolicy.Spec.Variables) ||
+		!reflect.DeepEqual(existingPolicy.Spec.Validations, expectedPolicy.Spec.Validations) {
+		existingPolicy.Spec = expectedPolicy.Spec
+		if _, err = policies.Update(ctx, existingPolicy, meta.UpdateOptions{}); err != nil {
+			return fmt.Errorf("unable to update ValidatingAdmissionPolicy %s: %w", expectedPolicy.GetName(), err)
+		}
+		r.log.Info("Updated resource", "ValidatingAdmissionPolicy", expectedPolicy.GetName())
+	}
+
+	bindings := r.k8sclientset.AdmissionregistrationV1().ValidatingAdmissionPolicyBindings()
+	existingBinding, err := bindings.Get(ctx, expectedBinding.GetName(), meta.GetOptions{})
+	if err != nil {
+		if !k8sapierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to get ValidatingAdmissionPolicyBinding %s: %w", expectedBinding.GetName(), err)
+		}
+		if _, err = bindings.Create(ctx, expectedBinding, meta.CreateOptions{}); err != nil {
+			return fmt.Errorf("unable to create ValidatingAdmissionPolicyBinding %s: %w", expectedBinding.GetName(),
+				err)
+		}
+		r.log.Info("Created resource", "ValidatingAdmissionPolicyBinding", expectedBinding.GetName())
+		return nil
+	}
+	if existingBinding.Spec.PolicyName == expectedBinding.Spec.PolicyName &&
+		reflect.DeepEqual(existingBinding.Spec.ParamRef, expectedBinding.Spec.ParamRef) &&
+		existingBinding.Spec.MatchResources == nil &&
+		reflect.DeepEqual(existingBinding.Spec.ValidationActions, expectedBinding.Spec.ValidationActions) {
+		return nil
+	}
+	existingBinding.Spec = expectedBinding.Spec
+	if _, err = bindings.Update(ctx, existingBinding, meta.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to update ValidatingAdmissionPolicyBinding %s: %w", expectedBinding.GetName(), err)
+	}
+	r.log.Info("Updated resource", "ValidatingAdmissionPolicyBinding", expectedBinding.GetName())
+	return nil
+}
+
 // ensureWICDRoleBinding ensures the WICD RoleBinding resource exists as expected.
 // Creates it if it doesn't exist, deletes and re-creates it if it exists with improper spec.
 func (r *ConfigMapReconciler) ensureWICDRoleBinding(ctx context.Context) error {
@@ -690,19 +858,36 @@ func (r *ConfigMapReconciler) ensureWICDClusterRoleBinding(ctx context.Context)
 
 // generateServicesManifest generates and regenerates the services manifest.
 // this gets called when the configmap reconciler is first created, to create the services manifest,
-// and also when the rendered-worker configmap is changed, to regenerate it.
-func generateServicesManifest(ctx context.Context, client client.Client, port string, platform oconfig.PlatformType) (*servicescm.Data, error) {
-	ign, err := ignition.New(ctx, client)
+// and also when the rendered-worker configmap or the hybrid overlay configuration is changed, to regenerate it.
+// The services of the manifest are signed with the service signing key, which is created if needed.
+func generateServicesManifest(ctx context.Context, c client.Client, namespace string,
+	networkBackend cluster.NetworkBackend, platform oconfig.PlatformType) (*servicescm.Data, error) {
+	ign, err := ignition.New(ctx, c)
 	if err != nil {
 		return nil, fmt.Errorf("error creating ignition object: %w", err)
 	}
+	var hybridOverlay cluster.HybridOverlayConfig
+	if networkBackend == cluster.HybridOverlayBackend {
+		networkCR := &operatorv1.Network{}
+		if err := c.Get(ctx, kubeTypes.NamespacedName{Name: networkOperatorConfigName}, networkCR); err != nil {
+			return nil, fmt.Errorf("error getting network operator configuration: %w", err)
+		}
+		hybridOverlay = cluster.GetHybridOverlayConfig(networkCR)
+	}
 	argsFromIgnition, err := ign.GetKubeletArgs()
 	if err != nil {
 		return nil, fmt.Errorf("Error getting kubelet args from ignition: %w", err)
 	}
-	svcData, err := services.GenerateManifest(argsFromIgnition, port, platform, ctrl.Log.V(1).Enabled())
+	svcData, err := services.GenerateManifest(argsFromIgnition, networkBackend, hybridOverlay, platform, ctrl.Log.V(1).Enabled())
 	if err != nil {
 		return nil, fmt.Errorf("error generating expected Windows service state: %w", err)
 	}
+	signingKey, err := secrets.EnsureServiceSigningKey(ctx, c, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if err = svcData.Sign(signingKey, version.Get()); err != nil {
+		return nil, fmt.Errorf("error signing services: %w", err)
+	}
 	return svcData, nil
 }
@@ -1,16 +1,28 @@
 package controllers
 
 import (
+	"context"
 	"testing"
 
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/cni"
+	"github.com/openshift/windows-machine-config-operator/pkg/filesets"
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
+	"github.com/openshift/windows-machine-config-operator/version"
 )
 
 func TestIsValidConfigMap(t *testing.T) {
@@ -95,6 +107,49 @@ func TestIsValidConfigMap(t *testing.T) {
 			require.Equal(t, test.isValidConfigMap, isValidConfigMap)
 		})
 	}
+
+	// The CNI ConfigMap is only watched when the CNI is provided by the user
+	cniConfigMap := &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: cni.ConfigMapName, Namespace: watchNamespace}}
+	assert.False(t, r.isValidConfigMap(cniConfigMap))
+	r.networkBackend = cluster.BYOCNIBackend
+	assert.True(t, r.isValidConfigMap(cniConfigMap))
+}
+
+func TestReconcileCNIConfig(t *testing.T) {
+	watchNamespace := "test"
+	c := fake.NewClientBuilder().Build()
+	r := ConfigMapReconciler{instanceReconciler: instanceReconciler{client: c, log: logr.Discard(),
+		watchNamespace: watchNamespace, recorder: record.NewFakeRecorder(10), networkBackend: cluster.BYOCNIBackend}}
+	cniConfigMap := &core.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{Name: cni.ConfigMapName, Namespace: watchNamespace},
+		Data:       map[string]string{"10-net.conf": `{"cniVersion":"0.3.1"}`},
+		BinaryData: map[string][]byte{"net.exe": []byte("plugin")},
+	}
+	require.NoError(t, r.reconcileCNIConfig(context.Background(), cniConfigMap))
+	entries := publishedFileSets(t, c, watchNamespace)
+	require.Contains(t, entries, filesets.CNIConfig)
+	require.Contains(t, entries, filesets.CNIPlugins)
+	configs, err := filesets.Fetch(context.Background(), c, watchNamespace, filesets.CNIConfig,
+		entries[filesets.CNIConfig])
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"10-net.conf": []byte(`{"cniVersion":"0.3.1"}`)}, configs.Files)
+
+	// Neither an invalid nor a deleted ConfigMap replaces the published configuration
+	invalid := cniConfigMap.DeepCopy()
+	invalid.Data = map[string]string{"net.txt": "invalid"}
+	require.NoError(t, r.reconcileCNIConfig(context.Background(), invalid))
+	require.NoError(t, r.reconcileCNIConfig(context.Background(), &core.ConfigMap{}))
+	assert.Equal(t, entries, publishedFileSets(t, c, watchNamespace))
+}
+
+// publishedFileSets returns the entries of the file set index of the given namespace
+func publishedFileSets(t *testing.T, c client.Client, namespace string) map[string]filesets.Entry {
+	index := &core.ConfigMap{}
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: namespace,
+		Name: filesets.IndexConfigMap}, index))
+	entries, err := filesets.ParseIndex(index)
+	require.NoError(t, err)
+	return entries
 }
 
 func TestHasAssociatedInstance(t *testing.T) {
@@ -150,3 +205,45 @@ func TestHasAssociatedInstance(t *testing.T) {
 		})
 	}
 }
+
+func TestRemoveLegacyWICDTokenSecret(t *testing.T) {
+	watchNamespace := "test"
+	tokenSecret := &core.Secret{
+		ObjectMeta: meta.ObjectMeta{Name: windows.WicdServiceName, Namespace: watchNamespace},
+		Type:       core.SecretTypeServiceAccountToken,
+	}
+	newNode := func(version string) *core.Node {
+		return &core.Node{ObjectMeta: meta.ObjectMeta{
+			Name:        "node-" + version,
+			Labels:      map[string]string{core.LabelOSStable: "windows"},
+			Annotations: map[string]string{metadata.VersionAnnotation: version},
+		}}
+	}
+
+	testCases := []struct {
+		name            string
+		nodes           []client.Object
+		expectedRemoval bool
+	}{
+		{name: "no Windows nodes", expectedRemoval: true},
+		{name: "all nodes reconfigured", nodes: []client.Object{newNode(version.Get())}, expectedRemoval: true},
+		{name: "node yet to be reconfigured", nodes: []client.Object{newNode(version.Get()), newNode("old")}},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithObjects(append(test.nodes, tokenSecret.DeepCopy())...).Build()
+			r := ConfigMapReconciler{instanceReconciler: instanceReconciler{client: c, log: logr.Discard(),
+				watchNamespace: watchNamespace}}
+			require.NoError(t, r.removeLegacyWICDTokenSecret(context.Background()))
+
+			err := c.Get(context.Background(), client.ObjectKeyFromObject(tokenSecret), &core.Secret{})
+			if test.expectedRemoval {
+				assert.True(t, k8sapierrors.IsNotFound(err))
+			} else {
+				assert.NoError(t, err)
+			}
+			// the removal is idempotent
+			assert.NoError(t, r.removeLegacyWICDTokenSecret(context.Background()))
+		})
+	}
+}
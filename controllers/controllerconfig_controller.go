@@ -21,21 +21,17 @@ import (
 	"fmt"
 
 	mcfg "github.com/openshift/api/machineconfiguration/v1"
-	core "k8s.io/api/core/v1"
 	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
-	kubeTypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/filesets"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
-	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
-	"github.com/openshift/windows-machine-config-operator/pkg/signer"
 )
 
 //+kubebuilder:rbac:groups="machineconfiguration.openshift.io",resources=controllerconfigs,verbs=list;watch
@@ -60,12 +56,11 @@ func NewControllerConfigReconciler(mgr manager.Manager, clusterConfig cluster.Co
 
 	return &ControllerConfigReconciler{
 		instanceReconciler: instanceReconciler{
-			client:             mgr.GetClient(),
-			log:                ctrl.Log.WithName("controllers").WithName(ControllerConfigController),
-			k8sclientset:       clientset,
-			clusterServiceCIDR: clusterConfig.Network().GetServiceCIDR(),
-			watchNamespace:     watchNamespace,
-			recorder:           mgr.GetEventRecorderFor(ControllerConfigController),
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controllers").WithName(ControllerConfigController),
+			k8sclientset:   clientset,
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(ControllerConfigController),
 		},
 	}, nil
 }
@@ -80,24 +75,15 @@ func (r *ControllerConfigReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		}
 		return ctrl.Result{}, err
 	}
-	r.signer, err = signer.Create(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
-		Name: secrets.PrivateKeySecret}, r.client)
-	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("unable to create signer from private key secret: %w", err)
-	}
-
-	// fetch all Windows nodes (Machine and BYOH instances)
-	winNodes := &core.NodeList{}
-	if err = r.client.List(ctx, winNodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
-		return ctrl.Result{}, fmt.Errorf("error listing Windows nodes: %w", err)
-	}
-	// loop Windows nodes and trigger kubelet CA update
-	for _, winNode := range winNodes.Items {
-		if err := r.updateKubeletCA(ctx, winNode, cc.Spec.KubeAPIServerServingCAData); err != nil {
-			return ctrl.Result{}, fmt.Errorf("error updating kubelet CA certificate in node %s: %w", winNode.Name, err)
-		}
+	if len(cc.Spec.KubeAPIServerServingCAData) == 0 {
+		// nothing to do
+		return ctrl.Result{}, nil
 	}
-	return ctrl.Result{}, nil
+	// WICD updates the kubelet CA file on each Windows node. No service restart or reboot is required, kubelet detects
+	// the changes in the file system and uses the new CA certificate.
+	_, err = r.publishFileSet(ctx, filesets.KubeletCA,
+		map[string][]byte{nodeconfig.KubeletClientCAFilename: cc.Spec.KubeAPIServerServingCAData})
+	return ctrl.Result{}, err
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -17,12 +17,16 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
 	"github.com/openshift/windows-machine-config-operator/pkg/condition"
 	"github.com/openshift/windows-machine-config-operator/pkg/crypto"
+	"github.com/openshift/windows-machine-config-operator/pkg/filesets"
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
+	"github.com/openshift/windows-machine-config-operator/pkg/signer"
+	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
 	"github.com/openshift/windows-machine-config-operator/version"
 )
 
@@ -44,8 +48,6 @@ type instanceReconciler struct {
 	log    logr.Logger
 	// k8sclientset holds the kube client that is needed for nodeconfig
 	k8sclientset *kubernetes.Clientset
-	// clusterServiceCIDR holds the cluster network service CIDR
-	clusterServiceCIDR string
 	// watchNamespace is the namespace that should be watched for configmaps
 	watchNamespace string
 	// signer is a signer created from the user's private key
@@ -54,6 +56,8 @@ type instanceReconciler struct {
 	recorder record.EventRecorder
 	// platform indicates the cloud on which the cluster is running
 	platform config.PlatformType
+	// networkBackend is the backend providing pod networking to Windows nodes
+	networkBackend cluster.NetworkBackend
 }
 
 // ensureInstanceIsUpToDate ensures that the given instance is configured as a node and upgraded to the specifications
@@ -64,26 +68,34 @@ func (r *instanceReconciler) ensureInstanceIsUpToDate(ctx context.Context, insta
 		return fmt.Errorf("instance cannot be nil")
 	}
 
+	// A node configured with cluster endpoints which have since changed must be reconfigured
+	clusterEndpointsChanged := !nodeconfig.ClusterEndpointsUpToDate(instanceInfo.Node)
+
 	// Instance is up to date, do nothing
-	if instanceInfo.UpToDate() {
+	if instanceInfo.UpToDate() && !clusterEndpointsChanged {
 		// Instance being up to date indicates that node object is present with the version annotation
 		r.log.Info("instance is up to date", "node", instanceInfo.Node.GetName(), "version",
 			instanceInfo.Node.GetAnnotations()[metadata.VersionAnnotation])
 		return nil
 	}
 
-	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
-		instanceInfo, r.signer, labelsToApply, annotationsToApply, r.platform)
+	instanceSigner, err := r.signerFor(ctx, instanceInfo)
+	if err != nil {
+		return err
+	}
+	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.watchNamespace,
+		instanceInfo, instanceSigner, labelsToApply, annotationsToApply, r.platform, r.networkBackend)
 	if err != nil {
 		return fmt.Errorf("failed to create new nodeconfig: %w", err)
 	}
 
-	// Check if the instance was configured by a previous version of WMCO and must be deconfigured before being
-	// configured again.
-	if instanceInfo.UpgradeRequired() {
+	// Check if the instance was configured by a previous version of WMCO, or with outdated cluster endpoints, and must
+	// be deconfigured before being configured again.
+	if instanceInfo.UpgradeRequired() || clusterEndpointsChanged {
 		// Instance requiring an upgrade indicates that node object is present with the version annotation
 		r.log.Info("instance requires upgrade", "node", instanceInfo.Node.GetName(), "version",
-			instanceInfo.Node.GetAnnotations()[metadata.VersionAnnotation], "expected version", version.Get())
+			instanceInfo.Node.GetAnnotations()[metadata.VersionAnnotation], "expected version", version.Get(),
+			"cluster endpoints changed", clusterEndpointsChanged)
 		if err := markNodeAsUpgrading(ctx, r.client, instanceInfo.Node); err != nil {
 			return err
 		}
@@ -92,7 +104,13 @@ func (r *instanceReconciler) ensureInstanceIsUpToDate(ctx context.Context, insta
 		}
 	}
 
-	return nc.Configure(ctx)
+	// The services WMCO generates are allow-listed, so that they are configured even if the signing key has since
+	// changed
+	svcData, err := generateServicesManifest(ctx, r.client, r.watchNamespace, r.networkBackend, r.platform)
+	if err != nil {
+		return err
+	}
+	return nc.Configure(ctx, svcData.Services)
 }
 
 // instanceFromNode returns an instance object for the given node. Requires a username that can be used to SSH into the
@@ -107,33 +125,135 @@ func (r *instanceReconciler) instanceFromNode(ctx context.Context, node *core.No
 		return nil, err
 	}
 
-	// Decrypt username annotation to plain text using private key
-	privateKeyBytes, err := secrets.GetPrivateKey(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
-		Name: secrets.PrivateKeySecret}, r.client)
+	username, err := r.decryptUsername(ctx, usernameAnnotation)
+	if err != nil {
+		// The annotation cannot be decrypted if the key it was encrypted with has been lost, e.g. after the annotation
+		// key Secret was deleted
+		r.log.Info("unable to decrypt username annotation, recovering it", "node", node.GetName(), "error", err)
+		if username, err = r.recoverUsername(ctx, node); err != nil {
+			return nil, fmt.Errorf("unable to recover username annotation for node %s: %w", node.Name, err)
+		}
+	}
+
+	instanceInfo, err := instance.NewInfo(addr, username, "", false, node)
 	if err != nil {
 		return nil, err
 	}
-	username, err := crypto.DecryptFromJSONString(usernameAnnotation, privateKeyBytes)
+	instanceInfo.Credentials = instance.CredentialsFromNode(node)
+	return instanceInfo, nil
+}
+
+// getDefaultUsername returns the default username for a Windows instance
+func (r *instanceReconciler) getDefaultUsername() string {
+	// TODO: This should be changed so that the "core" user is used on all platforms for SSH connections.
+	// https://issues.redhat.com/browse/WINC-430
+	if r.platform == config.AzurePlatformType {
+		return "capi"
+	}
+	return "Administrator"
+}
+
+// getNodeUsername returns the username used to SSH into the instance of the given node. BYOH instances are looked up
+// in the instance ConfigMap, which is the source of truth linking BYOH nodes to their underlying instances, while
+// Machine instances use the platform's default username.
+func (r *instanceReconciler) getNodeUsername(ctx context.Context, node *core.Node) (string, error) {
+	if node.GetLabels()[BYOHLabel] != "true" {
+		return r.getDefaultUsername(), nil
+	}
+	instancesConfigMap := &core.ConfigMap{}
+	if err := r.client.Get(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
+		Name: wiparser.InstanceConfigMap}, instancesConfigMap); err != nil {
+		return "", fmt.Errorf("unable to get instance configmap: %w", err)
+	}
+	return wiparser.GetNodeUsername(instancesConfigMap.Data, node)
+}
+
+// recoverUsername replaces the username annotation of the given node, which can no longer be decrypted, with the
+// node's username encrypted with the active annotation key. Returns the username.
+func (r *instanceReconciler) recoverUsername(ctx context.Context, node *core.Node) (string, error) {
+	username, err := r.getNodeUsername(ctx, node)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := r.encryptUsername(ctx, username)
 	if err != nil {
-		return nil, fmt.Errorf("unable to decrypt username annotation for node %s: %w", node.Name, err)
+		return "", fmt.Errorf("error encrypting node %s username: %w", node.GetName(), err)
+	}
+	if err = metadata.ApplyLabelsAndAnnotations(ctx, r.client, *node, nil,
+		map[string]string{UsernameAnnotation: encrypted}); err != nil {
+		return "", fmt.Errorf("error updating username annotation of node %s: %w", node.GetName(), err)
 	}
+	node.Annotations[UsernameAnnotation] = encrypted
+	r.log.Info("recovered username annotation", "node", node.GetName())
+	r.recorder.Eventf(node, core.EventTypeWarning, "UsernameAnnotationRecovered",
+		"Username annotation could not be decrypted and was replaced with the username of the node's instance")
+	return username, nil
+}
 
-	return instance.NewInfo(addr, username, "", false, node)
+// signerFor returns the signer used to SSH into the given instance. Instances which do not reference credentials of
+// their own are accessed with the reconciler's signer, if it has one.
+func (r *instanceReconciler) signerFor(ctx context.Context, instanceInfo *instance.Info) (ssh.Signer, error) {
+	if instanceInfo.Credentials == (instance.Credentials{}) && r.signer != nil {
+		return r.signer, nil
+	}
+	return signer.ForInstance(ctx, r.client, r.watchNamespace, instanceInfo)
 }
 
-// updateKubeletCA updates the kubelet CA in the node, by copying the kubelet CA file content to the Windows instance
-func (r *instanceReconciler) updateKubeletCA(ctx context.Context, node core.Node, contents []byte) error {
-	winInstance, err := r.instanceFromNode(ctx, &node)
+// decryptUsername returns the plain text of the given username annotation value. Values in the legacy format are
+// decrypted using the private key.
+func (r *instanceReconciler) decryptUsername(ctx context.Context, usernameAnnotation string) (string, error) {
+	keyring, err := secrets.GetAnnotationKeyring(ctx, r.client, r.watchNamespace)
 	if err != nil {
-		return fmt.Errorf("error creating instance for node %s: %w", node.Name, err)
+		return "", err
+	}
+	var privateKeyBytes []byte
+	if crypto.IsLegacy(usernameAnnotation) {
+		privateKeyBytes, err = secrets.GetPrivateKey(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
+			Name: secrets.PrivateKeySecret}, r.client)
+		if err != nil {
+			return "", err
+		}
 	}
-	nodeConfig, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR,
-		r.watchNamespace, winInstance, r.signer, nil, nil, r.platform)
+	return keyring.Decrypt(usernameAnnotation, privateKeyBytes)
+}
+
+// encryptUsername returns the given username encrypted with the active annotation key, as a username annotation value
+func (r *instanceReconciler) encryptUsername(ctx context.Context, username string) (string, error) {
+	keyring, err := secrets.GetAnnotationKeyring(ctx, r.client, r.watchNamespace)
 	if err != nil {
-		return fmt.Errorf("error creating nodeConfig for instance %s: %w", winInstance.Address, err)
+		return "", err
 	}
-	r.log.Info("updating kubelet CA client certificates in", "node", node.Name)
-	return nodeConfig.UpdateKubeletClientCA(contents)
+	return keyring.Encrypt(username)
+}
+
+// publishFileSet publishes the given files as the contents of the named file set, which WICD applies to each Windows
+// instance. Returns the names of the Windows nodes which have yet to apply the published generation.
+func (r *instanceReconciler) publishFileSet(ctx context.Context, name string, files map[string][]byte) ([]string,
+	error) {
+	fileSet, err := filesets.New(name, files)
+	if err != nil {
+		return nil, err
+	}
+	generation, err := filesets.Publish(ctx, r.client, r.watchNamespace, fileSet)
+	if err != nil {
+		return nil, fmt.Errorf("error publishing file set %s: %w", name, err)
+	}
+
+	nodes := &core.NodeList{}
+	if err = r.client.List(ctx, nodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
+		return nil, fmt.Errorf("error listing Windows nodes: %w", err)
+	}
+	var pending []string
+	for i := range nodes.Items {
+		if !filesets.IsApplied(&nodes.Items[i], name, generation) {
+			pending = append(pending, nodes.Items[i].GetName())
+		}
+	}
+	if len(pending) > 0 {
+		r.log.Info("file set published, waiting for WICD to apply it", "file set", name, "generation", generation,
+			"nodes", pending)
+	}
+	return pending, nil
 }
 
 // GetAddress returns a non-ipv6 address that can be used to reach a Windows node. This can be either an ipv4
@@ -158,8 +278,12 @@ func (r *instanceReconciler) deconfigureInstance(ctx context.Context, node *core
 		return fmt.Errorf("unable to create instance object from node: %w", err)
 	}
 
-	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
-		instance, r.signer, nil, nil, r.platform)
+	instanceSigner, err := r.signerFor(ctx, instance)
+	if err != nil {
+		return err
+	}
+	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.watchNamespace,
+		instance, instanceSigner, nil, nil, r.platform, r.networkBackend)
 	if err != nil {
 		return fmt.Errorf("failed to create new nodeconfig: %w", err)
 	}
@@ -205,13 +329,15 @@ func outdatedWindowsNodePredicate(byoh bool) predicate.Funcs {
 	return predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
 			return isValidWindowsNode(e.Object, byoh) &&
-				e.Object.GetAnnotations()[metadata.VersionAnnotation] != version.Get()
+				(e.Object.GetAnnotations()[metadata.VersionAnnotation] != version.Get() ||
+					!clusterEndpointsUpToDate(e.Object))
 		},
 		UpdateFunc: func(e event.UpdateEvent) bool {
 			if !isValidWindowsNode(e.ObjectNew, byoh) {
 				return false
 			}
 			if e.ObjectNew.GetAnnotations()[metadata.VersionAnnotation] != version.Get() ||
+				!clusterEndpointsUpToDate(e.ObjectNew) ||
 				e.ObjectNew.GetAnnotations()[nodeconfig.PubKeyHashAnnotation] !=
 					e.ObjectOld.GetAnnotations()[nodeconfig.PubKeyHashAnnotation] {
 				return true
@@ -220,7 +346,8 @@ func outdatedWindowsNodePredicate(byoh bool) predicate.Funcs {
 		},
 		GenericFunc: func(e event.GenericEvent) bool {
 			return isValidWindowsNode(e.Object, byoh) &&
-				e.Object.GetAnnotations()[metadata.VersionAnnotation] != version.Get()
+				(e.Object.GetAnnotations()[metadata.VersionAnnotation] != version.Get() ||
+					!clusterEndpointsUpToDate(e.Object))
 		},
 		DeleteFunc: func(e event.DeleteEvent) bool {
 			return isValidWindowsNode(e.Object, byoh)
@@ -253,6 +380,16 @@ func isValidWindowsNode(o client.Object, byoh bool) bool {
 	return true
 }
 
+// clusterEndpointsUpToDate returns true if the given object is not a Node, or is a Node configured with the current
+// cluster endpoints
+func clusterEndpointsUpToDate(o client.Object) bool {
+	node, ok := o.(*core.Node)
+	if !ok {
+		return true
+	}
+	return nodeconfig.ClusterEndpointsUpToDate(node)
+}
+
 // markAsFreeOnSuccess is called after a controller's Reconcile function returns. If the given controller finished
 // reconciling without error or requesting a requeue event, the controller is marked as free.
 // When all controllers are free, WMCO upgrades are unblocked.
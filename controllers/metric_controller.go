@@ -59,12 +59,11 @@ func NewMetricReconciler(mgr manager.Manager, clusterConfig cluster.Config, cfg
 	return &metricReconciler{
 		MonitoringV1Client: mclient,
 		instanceReconciler: instanceReconciler{
-			client:             mgr.GetClient(),
-			log:                ctrl.Log.WithName("controllers").WithName(MetricController),
-			k8sclientset:       clientset,
-			clusterServiceCIDR: clusterConfig.Network().GetServiceCIDR(),
-			watchNamespace:     watchNamespace,
-			recorder:           mgr.GetEventRecorderFor(MetricController),
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controllers").WithName(MetricController),
+			k8sclientset:   clientset,
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(MetricController),
 		},
 	}, nil
 }
@@ -23,7 +23,6 @@ import (
 	core "k8s.io/api/core/v1"
 	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -35,8 +34,6 @@ import (
 	"github.com/openshift/windows-machine-config-operator/pkg/condition"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
-	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
-	"github.com/openshift/windows-machine-config-operator/pkg/signer"
 )
 
 const (
@@ -58,12 +55,12 @@ func NewNodeReconciler(mgr manager.Manager, clusterConfig cluster.Config, watchN
 
 	return &nodeReconciler{
 		instanceReconciler: instanceReconciler{
-			client:             mgr.GetClient(),
-			log:                ctrl.Log.WithName("controllers").WithName(NodeController),
-			k8sclientset:       clientset,
-			clusterServiceCIDR: clusterConfig.Network().GetServiceCIDR(),
-			watchNamespace:     watchNamespace,
-			recorder:           mgr.GetEventRecorderFor(NodeController),
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controllers").WithName(NodeController),
+			k8sclientset:   clientset,
+			networkBackend: clusterConfig.Network().Backend(),
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(NodeController),
 		},
 	}, nil
 }
@@ -94,18 +91,17 @@ func (r *nodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (resul
 	}
 
 	if _, ok := node.GetAnnotations()[metadata.RebootAnnotation]; ok {
-		// Create a new signer using the private key that the instances will be reconciled with
-		signer, err := signer.Create(ctx, types.NamespacedName{Namespace: r.watchNamespace,
-			Name: secrets.PrivateKeySecret}, r.client)
+		instanceInfo, err := r.instanceFromNode(ctx, node)
 		if err != nil {
-			return ctrl.Result{}, fmt.Errorf("unable to create signer from private key secret: %w", err)
+			return ctrl.Result{}, err
 		}
-		instanceInfo, err := r.instanceFromNode(ctx, node)
+		// Create a new signer using the credentials that the instance will be reconciled with
+		instanceSigner, err := r.signerFor(ctx, instanceInfo)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
-		nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
-			instanceInfo, signer, nil, nil, r.platform)
+		nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.watchNamespace,
+			instanceInfo, instanceSigner, nil, nil, r.platform, r.networkBackend)
 		if err != nil {
 			return ctrl.Result{}, fmt.Errorf("failed to create new nodeconfig: %w", err)
 		}
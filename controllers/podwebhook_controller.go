@@ -0,0 +1,179 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/webhooks"
+)
+
+//+kubebuilder:rbac:groups="admissionregistration.k8s.io",resources=mutatingwebhookconfigurations,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups="admissionregistration.k8s.io",resources=validatingwebhookconfigurations,verbs=get;list;watch
+
+const (
+	// PodWebhookController is the name of this controller in logs and other outputs.
+	PodWebhookController = "podwebhook"
+)
+
+// podWebhookReconciler registers the pod mutating webhook with the API server. OLM only registers webhooks scoped to
+// the operator's namespace, so the pod webhook is registered through a MutatingWebhookConfiguration managed by WMCO,
+// pointing to the Service and CA bundle OLM set up for the ConfigMap validating webhook.
+type podWebhookReconciler struct {
+	instanceReconciler
+	// enabled indicates if the pod webhook is to be registered, or removed if it was previously registered
+	enabled bool
+}
+
+// NewPodWebhookReconciler returns a pointer to a new podWebhookReconciler. The pod webhook is only registered if
+// serving is true, indicating the operator serves webhooks.
+func NewPodWebhookReconciler(mgr manager.Manager, watchNamespace string,
+	serving bool) (*podWebhookReconciler, error) {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes clientset: %w", err)
+	}
+
+	return &podWebhookReconciler{
+		instanceReconciler: instanceReconciler{
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controllers").WithName(PodWebhookController),
+			k8sclientset:   clientset,
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(PodWebhookController),
+		},
+		enabled: serving && cluster.PodWebhookEnabled(),
+	}, nil
+}
+
+// Reconcile ensures the pod webhook's MutatingWebhookConfiguration matches the webhook registered by OLM, or is
+// removed if the pod webhook is disabled
+func (r *podWebhookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	r.log = r.log.WithValues(PodWebhookController, req.NamespacedName)
+
+	existing := &admissionregistration.MutatingWebhookConfiguration{}
+	err := r.client.Get(ctx, kubeTypes.NamespacedName{Name: webhooks.PodMutatorName}, existing)
+	if err != nil {
+		if !k8sapierrors.IsNotFound(err) {
+			return ctrl.Result{}, fmt.Errorf("error getting MutatingWebhookConfiguration %s: %w",
+				webhooks.PodMutatorName, err)
+		}
+		existing = nil
+	}
+
+	if !r.enabled {
+		if existing == nil {
+			return ctrl.Result{}, nil
+		}
+		r.log.Info("pod webhook disabled, deleting MutatingWebhookConfiguration", "name", existing.GetName())
+		if err = r.client.Delete(ctx, existing); err != nil && !k8sapierrors.IsNotFound(err) {
+			return ctrl.Result{}, fmt.Errorf("error deleting MutatingWebhookConfiguration %s: %w",
+				existing.GetName(), err)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	olmWebhook, err := r.olmClientConfig(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if olmWebhook == nil {
+		// The pod webhook is registered once OLM has set up the serving Service and CA, which triggers a reconcile
+		r.log.V(1).Info("webhook not yet registered by OLM", "name", webhooks.ConfigMapValidatorName)
+		return ctrl.Result{}, nil
+	}
+	expected, err := webhooks.GeneratePodMutatorConfiguration(*olmWebhook, r.watchNamespace)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("error generating MutatingWebhookConfiguration: %w", err)
+	}
+
+	if existing == nil {
+		r.log.Info("creating MutatingWebhookConfiguration", "name", expected.GetName())
+		if err = r.client.Create(ctx, expected); err != nil {
+			return ctrl.Result{}, fmt.Errorf("error creating MutatingWebhookConfiguration %s: %w",
+				expected.GetName(), err)
+		}
+		return ctrl.Result{}, nil
+	}
+	if reflect.DeepEqual(existing.Webhooks, expected.Webhooks) {
+		return ctrl.Result{}, nil
+	}
+	existing.Webhooks = expected.Webhooks
+	r.log.Info("updating MutatingWebhookConfiguration", "name", existing.GetName())
+	if err = r.client.Update(ctx, existing); err != nil {
+		return ctrl.Result{}, fmt.Errorf("error updating MutatingWebhookConfiguration %s: %w", existing.GetName(),
+			err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// olmClientConfig returns how the API server reaches the ConfigMap validating webhook registered by OLM, or nil if
+// OLM has not registered it yet
+func (r *podWebhookReconciler) olmClientConfig(ctx context.Context) (*admissionregistration.WebhookClientConfig,
+	error) {
+	configurations := &admissionregistration.ValidatingWebhookConfigurationList{}
+	if err := r.client.List(ctx, configurations,
+		client.MatchingLabels{webhooks.OLMWebhookNameLabel: webhooks.ConfigMapValidatorName}); err != nil {
+		return nil, fmt.Errorf("error listing ValidatingWebhookConfigurations: %w", err)
+	}
+	for _, configuration := range configurations.Items {
+		for _, webhook := range configuration.Webhooks {
+			if webhook.ClientConfig.Service != nil && len(webhook.ClientConfig.CABundle) > 0 {
+				return &webhook.ClientConfig, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *podWebhookReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	olmWebhookPredicate := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetLabels()[webhooks.OLMWebhookNameLabel] == webhooks.ConfigMapValidatorName
+	})
+	podWebhookPredicate := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetName() == webhooks.PodMutatorName
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(PodWebhookController).
+		Watches(&admissionregistration.ValidatingWebhookConfiguration{},
+			handler.EnqueueRequestsFromMapFunc(r.mapToPodWebhookRequest), builder.WithPredicates(olmWebhookPredicate)).
+		Watches(&admissionregistration.MutatingWebhookConfiguration{},
+			handler.EnqueueRequestsFromMapFunc(r.mapToPodWebhookRequest), builder.WithPredicates(podWebhookPredicate)).
+		Complete(r)
+}
+
+// mapToPodWebhookRequest is a mapping function that returns the request of the pod webhook's
+// MutatingWebhookConfiguration upon any watched object
+func (r *podWebhookReconciler) mapToPodWebhookRequest(_ context.Context, _ client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: kubeTypes.NamespacedName{Name: webhooks.PodMutatorName}}}
+}
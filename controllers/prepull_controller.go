@@ -0,0 +1,198 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
+	"github.com/openshift/windows-machine-config-operator/pkg/prepull"
+)
+
+const (
+	// PrePullController is the name of this controller in logs and other outputs.
+	PrePullController = "prepull"
+)
+
+// prePullReconciler reports the pull status of the images listed for pre-pulling on each Windows node, and uncordons
+// the configured nodes which were kept cordoned until their required images were pulled. The images are pulled by
+// WICD, which records the status of each on its node.
+type prePullReconciler struct {
+	instanceReconciler
+}
+
+// NewPrePullReconciler returns a pointer to a new prePullReconciler
+func NewPrePullReconciler(mgr manager.Manager, clusterConfig cluster.Config,
+	watchNamespace string) (*prePullReconciler, error) {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes clientset: %w", err)
+	}
+
+	return &prePullReconciler{
+		instanceReconciler: instanceReconciler{
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controllers").WithName(PrePullController),
+			k8sclientset:   clientset,
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(PrePullController),
+		},
+	}, nil
+}
+
+// Reconcile validates the image pre-pull lists, updates the per node pre-pull metrics from the status recorded on
+// each Windows node, and uncordons the nodes awaiting their required images once they are pulled
+func (r *prePullReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	r.log = r.log.WithValues(PrePullController, req.NamespacedName)
+
+	cms := &core.ConfigMapList{}
+	err := r.client.List(ctx, cms, client.InNamespace(r.watchNamespace), client.HasLabels{prepull.ListLabel})
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("error listing image pre-pull ConfigMaps: %w", err)
+	}
+	var lists []prepull.List
+	for i := range cms.Items {
+		list, err := prepull.Parse(&cms.Items[i])
+		if err != nil {
+			// An invalid list is ignored until it is corrected, there is no point in retrying
+			r.recorder.Eventf(&cms.Items[i], core.EventTypeWarning, "InvalidImagePrePullList", "%v", err)
+			continue
+		}
+		lists = append(lists, *list)
+	}
+
+	nodes := &core.NodeList{}
+	if err := r.client.List(ctx, nodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("error listing Windows nodes: %w", err)
+	}
+	// Reset the metrics so that deleted nodes are no longer reported
+	metrics.PrePullImages.Reset()
+	var result ctrl.Result
+	var errs []error
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		images, required := prepull.ImagesForNode(lists, node.GetLabels())
+		status, err := prepull.GetStatus(node)
+		if err != nil {
+			r.log.Error(err, "unable to determine image pre-pull status", "node", node.GetName())
+			status = make(prepull.Status)
+		}
+		requeueAfter, err := r.reconcileAwaitingNode(ctx, node, status.Pending(required))
+		if err != nil {
+			errs = append(errs, err)
+		} else if requeueAfter > 0 && (result.RequeueAfter == 0 || requeueAfter < result.RequeueAfter) {
+			result.RequeueAfter = requeueAfter
+		}
+		if len(images) == 0 {
+			continue
+		}
+		pulled, pending, failed := status.Counts(images)
+		metrics.PrePullImages.WithLabelValues(node.GetName(), "pulled").Set(float64(pulled))
+		metrics.PrePullImages.WithLabelValues(node.GetName(), "pending").Set(float64(pending))
+		metrics.PrePullImages.WithLabelValues(node.GetName(), "failed").Set(float64(failed))
+		if failed > 0 {
+			r.log.Info("images failed to pre-pull", "node", node.GetName(), "images", status.Failed())
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// reconcileAwaitingNode uncordons the given node if it is awaiting its required images, and either none are pending or
+// it has waited for longer than prepull.RequiredImagesTimeout. Returns how long until the node's wait times out, if it
+// is still waiting.
+func (r *prePullReconciler) reconcileAwaitingNode(ctx context.Context, node *core.Node,
+	pending []string) (time.Duration, error) {
+	since, awaiting := prepull.AwaitingSince(node)
+	if !awaiting {
+		return 0, nil
+	}
+	if len(pending) > 0 {
+		remaining := time.Until(since.Add(prepull.RequiredImagesTimeout))
+		if remaining > 0 {
+			return remaining, nil
+		}
+		r.recorder.Eventf(node, core.EventTypeWarning, "RequiredImagesTimeout",
+			"uncordoning node after waiting %s for required images %v to be pulled", prepull.RequiredImagesTimeout,
+			pending)
+	}
+	r.log.Info("uncordoning node", "node", node.GetName())
+	patched := node.DeepCopy()
+	patched.Spec.Unschedulable = false
+	delete(patched.Annotations, prepull.AwaitingImagesAnnotation)
+	if err := r.client.Patch(ctx, patched, client.MergeFrom(node)); err != nil {
+		return 0, fmt.Errorf("error uncordoning node %s: %w", node.GetName(), err)
+	}
+	return 0, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *prePullReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	prePullListPredicate := predicate.NewPredicateFuncs(func(object client.Object) bool {
+		_, isPrePullList := object.GetLabels()[prepull.ListLabel]
+		return object.GetNamespace() == r.watchNamespace && isPrePullList
+	})
+	windowsNodePredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			// get update event only when the pull status, whether the node awaits its required images, or the labels the
+			// lists select nodes by change
+			return isWindowsNode(e.ObjectNew) &&
+				(e.ObjectOld.GetAnnotations()[prepull.StatusAnnotation] !=
+					e.ObjectNew.GetAnnotations()[prepull.StatusAnnotation] ||
+					e.ObjectOld.GetAnnotations()[prepull.AwaitingImagesAnnotation] !=
+						e.ObjectNew.GetAnnotations()[prepull.AwaitingImagesAnnotation] ||
+					!reflect.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()))
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(PrePullController).
+		Watches(&core.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.mapToPrePullRequest),
+			builder.WithPredicates(prePullListPredicate)).
+		Watches(&core.Node{}, handler.EnqueueRequestsFromMapFunc(r.mapToPrePullRequest),
+			builder.WithPredicates(windowsNodePredicate)).
+		Complete(r)
+}
+
+// mapToPrePullRequest is a mapping function that returns one request upon any watched object, as all nodes are
+// reported on together
+func (r *prePullReconciler) mapToPrePullRequest(_ context.Context, _ client.Object) []reconcile.Request {
+	return []reconcile.Request{{}}
+}
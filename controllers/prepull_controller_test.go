@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/prepull"
+)
+
+func TestReconcileAwaitingNode(t *testing.T) {
+	testCases := []struct {
+		name               string
+		awaiting           bool
+		waited             time.Duration
+		pending            []string
+		expectUncordoned   bool
+		expectRequeue      bool
+		expectTimeoutEvent bool
+	}{
+		{
+			name:             "not awaiting images",
+			pending:          []string{"app:latest"},
+			expectUncordoned: false,
+		},
+		{
+			name:             "required images pulled",
+			awaiting:         true,
+			expectUncordoned: true,
+		},
+		{
+			name:             "required images pending",
+			awaiting:         true,
+			waited:           time.Minute,
+			pending:          []string{"app:latest"},
+			expectUncordoned: false,
+			expectRequeue:    true,
+		},
+		{
+			name:               "required images pending past the timeout",
+			awaiting:           true,
+			waited:             prepull.RequiredImagesTimeout + time.Minute,
+			pending:            []string{"app:latest"},
+			expectUncordoned:   true,
+			expectTimeoutEvent: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			node := &core.Node{
+				ObjectMeta: meta.ObjectMeta{Name: "node", Annotations: map[string]string{}},
+				Spec:       core.NodeSpec{Unschedulable: true},
+			}
+			if test.awaiting {
+				node.Annotations[prepull.AwaitingImagesAnnotation] =
+					time.Now().Add(-test.waited).UTC().Format(time.RFC3339)
+			}
+			fakeClient := fake.NewClientBuilder().WithObjects(node).Build()
+			recorder := record.NewFakeRecorder(1)
+			r := &prePullReconciler{instanceReconciler: instanceReconciler{client: fakeClient, log: logr.Discard(),
+				recorder: recorder}}
+
+			requeueAfter, err := r.reconcileAwaitingNode(context.Background(), node, test.pending)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectRequeue, requeueAfter > 0)
+			assert.Equal(t, test.expectTimeoutEvent, len(recorder.Events) == 1)
+
+			updated := &core.Node{}
+			require.NoError(t, fakeClient.Get(context.Background(), client.ObjectKeyFromObject(node), updated))
+			assert.Equal(t, !test.expectUncordoned, updated.Spec.Unschedulable)
+			if test.expectUncordoned {
+				assert.NotContains(t, updated.GetAnnotations(), prepull.AwaitingImagesAnnotation)
+			}
+		})
+	}
+}
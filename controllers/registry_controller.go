@@ -19,11 +19,10 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"reflect"
 
 	config "github.com/openshift/api/config/v1"
 	core "k8s.io/api/core/v1"
-	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -35,15 +34,16 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/filesets"
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
 	"github.com/openshift/windows-machine-config-operator/pkg/registries"
-	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
-	"github.com/openshift/windows-machine-config-operator/pkg/signer"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 )
 
 //+kubebuilder:rbac:groups="config.openshift.io",resources=imagedigestmirrorsets,verbs=get;list;watch
 //+kubebuilder:rbac:groups="config.openshift.io",resources=imagetagmirrorsets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="config.openshift.io",resources=images,verbs=get;list;watch
 
 const (
 	// RegistryController is the name of this controller in logs and other outputs.
@@ -65,12 +65,12 @@ func NewRegistryReconciler(mgr manager.Manager, clusterConfig cluster.Config,
 
 	return &registryReconciler{
 		instanceReconciler: instanceReconciler{
-			client:             mgr.GetClient(),
-			log:                ctrl.Log.WithName("controllers").WithName(RegistryController),
-			k8sclientset:       clientset,
-			clusterServiceCIDR: clusterConfig.Network().GetServiceCIDR(),
-			watchNamespace:     watchNamespace,
-			recorder:           mgr.GetEventRecorderFor(RegistryController),
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controllers").WithName(RegistryController),
+			k8sclientset:   clientset,
+			networkBackend: clusterConfig.Network().Backend(),
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(RegistryController),
 		},
 	}, nil
 }
@@ -80,50 +80,49 @@ func NewRegistryReconciler(mgr manager.Manager, clusterConfig cluster.Config,
 func (r *registryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	r.log = r.log.WithValues(RegistryController, req.NamespacedName)
 
-	configFiles, err := registries.GenerateConfigFiles(ctx, r.client)
+	configFiles, err := registries.GenerateConfigFiles(ctx, r.client, r.watchNamespace)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
-
-	// Transfer the generated registry config folder to each Windows node, completely replacing any existing config
-	nodes := &core.NodeList{}
-	if err := r.client.List(ctx, nodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
+	// WICD replaces the registry config directory on each Windows node with the published contents. Each node applies
+	// the contents independently, retrying with backoff on failure, and records the applied generation on the node. The
+	// nodes which are behind are tracked through the node annotation changes watched by this controller.
+	staleNodes, err := r.publishFileSet(ctx, filesets.Registry, configFiles)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
-	r.signer, err = signer.Create(ctx, types.NamespacedName{Namespace: r.watchNamespace, Name: secrets.PrivateKeySecret},
-		r.client)
+	metrics.StaleRegistryConfigNodes.Set(float64(len(staleNodes)))
+	return ctrl.Result{}, r.reconcileCredentialProvider(ctx)
+}
+
+// reconcileCredentialProvider publishes the credential provider config and the registry credential store applied to
+// Windows nodes. The credential store is only published when registry credentials are served by the WICD credential
+// provider, and is cleared from the nodes otherwise. Rotating the pull secret only rewrites the credential store.
+func (r *registryReconciler) reconcileCredentialProvider(ctx context.Context) error {
+	providerConfig, err := nodeconfig.GenerateCredentialProviderConfig(ctx, r.client, r.watchNamespace)
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("unable to create signer from private key secret: %w", err)
+		return fmt.Errorf("error generating credential provider config: %w", err)
+	}
+	providerFiles := map[string][]byte{}
+	if providerConfig != nil {
+		_, fileName := windows.SplitPath(windows.CredentialProviderConfig)
+		providerFiles[fileName] = providerConfig
+	}
+	if _, err = r.publishFileSet(ctx, filesets.CredentialProvider, providerFiles); err != nil {
+		return err
 	}
-	for _, n := range nodes.Items {
-		// Ensure the node status is up to date, going through this list could take a long time depending on the
-		// number of Windows nodes in the cluster
-		var node core.Node
-		if err := r.client.Get(ctx, types.NamespacedName{Name: n.GetName()}, &node); err != nil {
-			if k8sapierrors.IsNotFound(err) {
-				continue
-			}
-			return ctrl.Result{}, fmt.Errorf("unable to get node %s: %w", n.GetName(), err)
-		}
 
-		winInstance, err := r.instanceFromNode(ctx, &node)
+	storeFiles := map[string][]byte{}
+	if cluster.RegistryCredentialProviderEnabled() {
+		pullSecret, err := registries.GetPullSecret(ctx, r.client)
 		if err != nil {
-			return ctrl.Result{}, fmt.Errorf("unable to create instance object from node: %w", err)
-		}
-		nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
-			winInstance, r.signer, nil, nil, r.platform)
-		if err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to create new nodeconfig: %w", err)
-		}
-
-		r.log.Info("updating containerd config", "directory", windows.ContainerdConfigDir, "node", node.Name)
-		// TODO: If this flakes for any one node, we have to loop over all nodes again and re-transfer the directory to
-		// all nodes. We should fix this as part of https://issues.redhat.com/browse/WINC-1306
-		if err := nc.Windows.ReplaceDir(configFiles, windows.ContainerdConfigDir); err != nil {
-			return ctrl.Result{}, err
+			return err
 		}
+		_, fileName := windows.SplitPath(windows.RegistryCredentialStorePath)
+		storeFiles[fileName] = pullSecret
 	}
-	return ctrl.Result{}, nil
+	_, err = r.publishFileSet(ctx, filesets.RegistryCredentials, storeFiles)
+	return err
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -144,7 +143,7 @@ func (r *registryReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 	secretPredicate := predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
-			return isGlobalPullSecret(e.Object)
+			return r.isRegistrySecret(e.Object)
 		},
 		UpdateFunc: func(e event.UpdateEvent) bool {
 			// get update event only when secret data is changed
@@ -154,13 +153,40 @@ func (r *registryReconciler) SetupWithManager(mgr ctrl.Manager) error {
 					return true
 				}
 			}
+			if r.isRegistrySecret(e.ObjectNew) && !isGlobalPullSecret(e.ObjectNew) {
+				return !reflect.DeepEqual(e.ObjectOld.(*core.Secret).Data, e.ObjectNew.(*core.Secret).Data)
+			}
 			return false
 		},
 		GenericFunc: func(e event.GenericEvent) bool {
-			return isGlobalPullSecret(e.Object)
+			return r.isRegistrySecret(e.Object)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return r.isRegistrySecret(e.Object)
+		},
+	}
+
+	imageConfigPredicate := predicate.NewPredicateFuncs(func(object client.Object) bool {
+		return object.GetName() == registries.ImageConfigName
+	})
+	trustedCAPredicate := predicate.NewPredicateFuncs(func(object client.Object) bool {
+		return object.GetNamespace() == registries.AdditionalTrustedCANamespace
+	})
+	windowsNodePredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			// get update event only when the registry configuration applied to the node changes
+			appliedAnnotation := filesets.AppliedAnnotation(filesets.Registry)
+			return isWindowsNode(e.ObjectNew) &&
+				e.ObjectOld.GetAnnotations()[appliedAnnotation] != e.ObjectNew.GetAnnotations()[appliedAnnotation]
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
 		},
 		DeleteFunc: func(e event.DeleteEvent) bool {
-			return isGlobalPullSecret(e.Object)
+			return isWindowsNode(e.Object)
 		},
 	}
 
@@ -168,6 +194,12 @@ func (r *registryReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&config.ImageDigestMirrorSet{}, builder.WithPredicates(mirrorSetPredicate)).
 		Watches(&config.ImageTagMirrorSet{}, &handler.EnqueueRequestForObject{}, builder.WithPredicates(mirrorSetPredicate)).
 		Watches(&core.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapToRegistryRequest), builder.WithPredicates(secretPredicate)).
+		Watches(&core.Node{}, handler.EnqueueRequestsFromMapFunc(r.mapToRegistryRequest),
+			builder.WithPredicates(windowsNodePredicate)).
+		Watches(&config.Image{}, handler.EnqueueRequestsFromMapFunc(r.mapToRegistryRequest),
+			builder.WithPredicates(imageConfigPredicate)).
+		Watches(&core.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.mapTrustedCAToRegistryRequest),
+			builder.WithPredicates(trustedCAPredicate)).
 		Complete(r)
 }
 
@@ -177,6 +209,27 @@ func (r *registryReconciler) mapToRegistryRequest(_ context.Context, _ client.Ob
 	return []reconcile.Request{{}}
 }
 
+// mapTrustedCAToRegistryRequest returns one request if the given ConfigMap is the additional trusted CA ConfigMap
+// referenced by the cluster image config
+func (r *registryReconciler) mapTrustedCAToRegistryRequest(ctx context.Context,
+	obj client.Object) []reconcile.Request {
+	imageConfig := &config.Image{}
+	if err := r.client.Get(ctx, client.ObjectKey{Name: registries.ImageConfigName}, imageConfig); err != nil {
+		return nil
+	}
+	if imageConfig.Spec.AdditionalTrustedCA.Name != obj.GetName() {
+		return nil
+	}
+	return r.mapToRegistryRequest(ctx, obj)
+}
+
+// isRegistrySecret returns true if the given object is the cluster's global pull secret, or the Secret holding the
+// client certificates presented to registries
+func (r *registryReconciler) isRegistrySecret(obj client.Object) bool {
+	return isGlobalPullSecret(obj) ||
+		(obj.GetName() == registries.ClientCertsSecretName && obj.GetNamespace() == r.watchNamespace)
+}
+
 // isGlobalPullSecret returns true if the provided object is the cluster's global pull secret
 func isGlobalPullSecret(obj client.Object) bool {
 	return obj.GetName() == registries.GlobalPullSecretName && obj.GetNamespace() == registries.GlobalPullSecretNamespace
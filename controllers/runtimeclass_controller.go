@@ -0,0 +1,195 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	core "k8s.io/api/core/v1"
+	node "k8s.io/api/node/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/runtimeclass"
+)
+
+//+kubebuilder:rbac:groups="node.k8s.io",resources=runtimeclasses,verbs=get;list;watch;create;update;delete
+
+const (
+	// RuntimeClassController is the name of this controller in logs and other outputs.
+	RuntimeClassController = "runtimeclass"
+)
+
+// runtimeClassReconciler ensures a RuntimeClass exists for each Windows Server build present in the cluster
+type runtimeClassReconciler struct {
+	instanceReconciler
+	// hyperVEnabled indicates if Hyper-V isolated RuntimeClasses should be managed alongside process isolated ones
+	hyperVEnabled bool
+}
+
+// NewRuntimeClassReconciler returns a pointer to a new runtimeClassReconciler
+func NewRuntimeClassReconciler(mgr manager.Manager, clusterConfig cluster.Config,
+	watchNamespace string) (*runtimeClassReconciler, error) {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes clientset: %w", err)
+	}
+
+	return &runtimeClassReconciler{
+		instanceReconciler: instanceReconciler{
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controllers").WithName(RuntimeClassController),
+			k8sclientset:   clientset,
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(RuntimeClassController),
+		},
+		hyperVEnabled: runtimeclass.HyperVEnabled(),
+	}, nil
+}
+
+// Reconcile is part of the main kubernetes reconciliation loop which reads the Windows builds of all Windows Nodes
+// and ensures the RuntimeClasses targeting those builds exist, removing any that target builds no longer present.
+func (r *runtimeClassReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	r.log = r.log.WithValues(RuntimeClassController, req.NamespacedName)
+
+	nodes := &core.NodeList{}
+	if err := r.client.List(ctx, nodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("error listing Windows nodes: %w", err)
+	}
+	expected, err := runtimeclass.GenerateAll(runtimeclass.BuildsFromNodes(nodes.Items), r.hyperVEnabled)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	existing := &node.RuntimeClassList{}
+	if err := r.client.List(ctx, existing, client.HasLabels{runtimeclass.ManagedLabel}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("error listing RuntimeClasses: %w", err)
+	}
+	existingByName := make(map[string]*node.RuntimeClass, len(existing.Items))
+	for i := range existing.Items {
+		existingByName[existing.Items[i].GetName()] = &existing.Items[i]
+	}
+
+	for _, rc := range expected {
+		if err := r.ensureRuntimeClass(ctx, rc, existingByName[rc.GetName()]); err != nil {
+			return ctrl.Result{}, err
+		}
+		delete(existingByName, rc.GetName())
+	}
+
+	// Anything left over targets a Windows build that no longer has any Nodes, or an isolation mode that was disabled
+	for _, stale := range existingByName {
+		r.log.Info("deleting stale RuntimeClass", "name", stale.GetName(),
+			"build", stale.GetLabels()[runtimeclass.ManagedLabel])
+		if err := r.client.Delete(ctx, stale); err != nil && !k8sapierrors.IsNotFound(err) {
+			return ctrl.Result{}, fmt.Errorf("error deleting RuntimeClass %s: %w", stale.GetName(), err)
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// ensureRuntimeClass creates the expected RuntimeClass if it does not exist, or brings the existing one to the
+// expected state. As the handler of a RuntimeClass is immutable, a handler mismatch results in recreation.
+func (r *runtimeClassReconciler) ensureRuntimeClass(ctx context.Context, expected,
+	existing *node.RuntimeClass) error {
+	if existing != nil {
+		if existing.Handler == expected.Handler {
+			if reflect.DeepEqual(existing.Scheduling, expected.Scheduling) &&
+				reflect.DeepEqual(existing.GetLabels(), expected.GetLabels()) {
+				return nil
+			}
+			existing.Scheduling = expected.Scheduling
+			existing.SetLabels(expected.GetLabels())
+			r.log.Info("updating RuntimeClass", "name", existing.GetName())
+			if err := r.client.Update(ctx, existing); err != nil {
+				return fmt.Errorf("error updating RuntimeClass %s: %w", existing.GetName(), err)
+			}
+			return nil
+		}
+		if err := r.client.Delete(ctx, existing); err != nil && !k8sapierrors.IsNotFound(err) {
+			return fmt.Errorf("error deleting RuntimeClass %s with invalid handler: %w", existing.GetName(), err)
+		}
+	}
+	r.log.Info("creating RuntimeClass", "name", expected.GetName(), "handler", expected.Handler)
+	if err := r.client.Create(ctx, expected); err != nil {
+		return fmt.Errorf("error creating RuntimeClass %s: %w", expected.GetName(), err)
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *runtimeClassReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	windowsBuildPredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return isWindowsNode(e.ObjectNew) &&
+				e.ObjectOld.GetLabels()[core.LabelWindowsBuild] != e.ObjectNew.GetLabels()[core.LabelWindowsBuild]
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+	}
+	managedRuntimeClassPredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return false
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return isManagedRuntimeClass(e.ObjectNew)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return isManagedRuntimeClass(e.Object)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return isManagedRuntimeClass(e.Object)
+		},
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(RuntimeClassController).
+		Watches(&core.Node{}, handler.EnqueueRequestsFromMapFunc(r.mapToRuntimeClassRequest),
+			builder.WithPredicates(windowsBuildPredicate)).
+		Watches(&node.RuntimeClass{}, handler.EnqueueRequestsFromMapFunc(r.mapToRuntimeClassRequest),
+			builder.WithPredicates(managedRuntimeClassPredicate)).
+		Complete(r)
+}
+
+// mapToRuntimeClassRequest is a mapping function that returns one request upon any watched object, as all
+// RuntimeClasses are reconciled together
+func (r *runtimeClassReconciler) mapToRuntimeClassRequest(_ context.Context, _ client.Object) []reconcile.Request {
+	return []reconcile.Request{{}}
+}
+
+// isManagedRuntimeClass returns true if the given object is a RuntimeClass managed by WMCO
+func isManagedRuntimeClass(obj client.Object) bool {
+	_, ok := obj.GetLabels()[runtimeclass.ManagedLabel]
+	return ok
+}
@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"golang.org/x/crypto/ssh"
 	core "k8s.io/api/core/v1"
@@ -24,12 +27,12 @@ import (
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
 	"github.com/openshift/windows-machine-config-operator/pkg/condition"
 	"github.com/openshift/windows-machine-config-operator/pkg/crypto"
+	"github.com/openshift/windows-machine-config-operator/pkg/filesets"
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
 	"github.com/openshift/windows-machine-config-operator/pkg/signer"
-	"github.com/openshift/windows-machine-config-operator/pkg/windows"
-	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
 )
 
 //+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;patch
@@ -51,13 +54,13 @@ func NewSecretReconciler(mgr manager.Manager, clusterConfig cluster.Config,
 	reconciler := &SecretReconciler{
 		scheme: mgr.GetScheme(),
 		instanceReconciler: instanceReconciler{
-			client:             mgr.GetClient(),
-			k8sclientset:       clientset,
-			clusterServiceCIDR: clusterConfig.Network().GetServiceCIDR(),
-			log:                ctrl.Log.WithName("controllers").WithName(SecretController),
-			watchNamespace:     watchNamespace,
-			recorder:           mgr.GetEventRecorderFor(SecretController),
-			platform:           clusterConfig.Platform(),
+			client:         mgr.GetClient(),
+			k8sclientset:   clientset,
+			networkBackend: clusterConfig.Network().Backend(),
+			log:            ctrl.Log.WithName("controllers").WithName(SecretController),
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(SecretController),
+			platform:       clusterConfig.Platform(),
 		},
 	}
 	return reconciler, nil
@@ -183,6 +186,18 @@ func (r *SecretReconciler) reconcileUserDataSecret(ctx context.Context) error {
 		}
 		return fmt.Errorf("unable to get secret %s: %w", secrets.PrivateKeySecret, err)
 	}
+	// Instances configured with the previous private key are given the new key in place, Machines which cannot be
+	// accessed are recreated once the userData is updated. The userData is updated even if some instances could not be
+	// rotated, the rotation being retried as the error is returned.
+	rotationErr := r.rotateInstanceKeys(ctx, keySigner)
+	if err = r.reconcileUserData(ctx, keySigner); err != nil {
+		return errors.Join(rotationErr, err)
+	}
+	return rotationErr
+}
+
+// reconcileUserData ensures the userData secret used to provision Windows Machines authorizes the given signer's key
+func (r *SecretReconciler) reconcileUserData(ctx context.Context, keySigner ssh.Signer) error {
 	// Generate expected userData based on the existing private key
 	validUserData, err := secrets.GenerateUserData(r.platform, keySigner.PublicKey())
 	if err != nil {
@@ -231,27 +246,9 @@ func (r *SecretReconciler) reconcileTLSSecret(ctx context.Context) error {
 
 	certFiles["tls.crt"] = tlsSecret.Data["tls.crt"]
 	certFiles["tls.key"] = tlsSecret.Data["tls.key"]
-
-	nodes := &core.NodeList{}
-	err = r.client.List(ctx, nodes, client.MatchingLabels{core.LabelOSStable: "windows"})
-	if err != nil {
-		return fmt.Errorf("error getting node list: %w", err)
-	}
-	for _, node := range nodes.Items {
-		winInstance, err := r.instanceFromNode(ctx, &node)
-		if err != nil {
-			return fmt.Errorf("unable to create instance object from node: %w", err)
-		}
-		nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.clusterServiceCIDR, r.watchNamespace,
-			winInstance, r.signer, nil, nil, r.platform)
-		if err != nil {
-			return fmt.Errorf("failed to create new nodeconfig: %w", err)
-		}
-		if err = nc.Windows.ReplaceDir(certFiles, windows.TLSCertsPath); err != nil {
-			return fmt.Errorf("unable to transfer TLS certs: %w", err)
-		}
-	}
-	return nil
+	// WICD replaces the TLS certs directory on each Windows node with the published contents
+	_, err = r.publishFileSet(ctx, filesets.MetricsTLS, certFiles)
+	return err
 }
 
 // updateUserData updates the userdata secret to the expected state
@@ -264,30 +261,29 @@ func (r *SecretReconciler) updateUserData(ctx context.Context, keySigner ssh.Sig
 
 	// Modify annotations on nodes configured with the previous private key, if it has changed
 	expectedPubKeyAnno := nodeconfig.CreatePubKeyHashAnnotation(keySigner.PublicKey())
-	privateKeyBytes, err := secrets.GetPrivateKey(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
-		Name: secrets.PrivateKeySecret}, r.client)
-	if err != nil {
-		return err
-	}
 	for _, node := range nodes.Items {
 		annotationsToApply := make(map[string]string)
 		if _, present := node.GetLabels()[BYOHLabel]; present {
-			// Since the public key hash and username annotations are both dependent on the private key secret as well
-			// as applied and updated at the same time, checking one is enough to see if the private key is up to date
-			if node.Annotations[nodeconfig.PubKeyHashAnnotation] == expectedPubKeyAnno {
+			// Instances accessed with their own private key are not affected by changes to the shared private key
+			if node.Annotations[nodeconfig.PubKeyHashAnnotation] == expectedPubKeyAnno ||
+				instance.CredentialsFromNode(&node).PrivateKeySecret != "" {
 				continue
 			}
-			// For BYOH nodes, update the username annotation and public key hash annotation using new private key
-			expectedUsernameAnnotation, err := r.getEncryptedUsername(ctx, node, privateKeyBytes)
-			if err != nil {
-				return fmt.Errorf("unable to retrieve expected username annotation: %w", err)
-			}
-
-			annotationsToApply = map[string]string{
-				UsernameAnnotation:              expectedUsernameAnnotation,
-				nodeconfig.PubKeyHashAnnotation: expectedPubKeyAnno,
+			annotationsToApply = map[string]string{nodeconfig.PubKeyHashAnnotation: expectedPubKeyAnno}
+			// Usernames in the legacy format are encrypted with the private key, and are unreadable once it changes.
+			// Usernames encrypted with the annotation key are independent of the private key.
+			if crypto.IsLegacy(node.Annotations[UsernameAnnotation]) {
+				expectedUsernameAnnotation, err := r.getEncryptedUsername(ctx, node)
+				if err != nil {
+					return fmt.Errorf("unable to retrieve expected username annotation: %w", err)
+				}
+				annotationsToApply[UsernameAnnotation] = expectedUsernameAnnotation
 			}
 		} else {
+			// Machines whose key was rotated in place are up to date
+			if node.Annotations[nodeconfig.PubKeyHashAnnotation] == expectedPubKeyAnno {
+				continue
+			}
 			// For Nodes associated with Machines, clear the public key annotation, as the clearing of the
 			// annotation is used solely to kick off the deletion and recreation of Machines, causing them to be
 			// provisioned with the new userdata
@@ -309,19 +305,118 @@ func (r *SecretReconciler) updateUserData(ctx context.Context, keySigner ssh.Sig
 	return nil
 }
 
-// getEncryptedUsername retrieves the username associated with a given node and ecrypts it using the given key
-func (r *SecretReconciler) getEncryptedUsername(ctx context.Context, node core.Node, key []byte) (string, error) {
-	// The instance ConfigMap is the source of truth linking BYOH nodes to their underlying instances
-	instancesConfigMap := &core.ConfigMap{}
-	if err := r.client.Get(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
-		Name: wiparser.InstanceConfigMap}, instancesConfigMap); err != nil {
-		return "", fmt.Errorf("unable to get instance configmap: %w", err)
+// rotateInstanceKeys replaces the previous private key with the given signer's key on the instances configured with
+// the previous key. The previous key is the key held by the applied private key secret, which is only updated once
+// the key of every instance configured with it has been rotated, so that instances which could not be rotated can be
+// retried with it. An error is returned if any instance could not be rotated.
+func (r *SecretReconciler) rotateInstanceKeys(ctx context.Context, keySigner ssh.Signer) error {
+	privateKeyBytes, err := secrets.GetPrivateKey(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
+		Name: secrets.PrivateKeySecret}, r.client)
+	if err != nil {
+		return err
+	}
+	applied := &core.Secret{}
+	if err = r.client.Get(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
+		Name: secrets.AppliedPrivateKeySecret}, applied); err != nil {
+		if !k8sapierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to get secret %s: %w", secrets.AppliedPrivateKeySecret, err)
+		}
+		// The instances are configured with the current key, as far as is known
+		if err = r.client.Create(ctx, secrets.NewAppliedPrivateKeySecret(r.watchNamespace,
+			privateKeyBytes)); err != nil {
+			return fmt.Errorf("unable to create secret %s: %w", secrets.AppliedPrivateKeySecret, err)
+		}
+		return nil
+	}
+
+	previousSigner, err := ssh.ParsePrivateKey(applied.Data[secrets.PrivateKeySecretKey])
+	switch {
+	case err != nil:
+		r.log.Error(err, "unable to parse previous private key, skipping in-place key rotation")
+	case bytes.Equal(previousSigner.PublicKey().Marshal(), keySigner.PublicKey().Marshal()):
+		// The same key may be encoded differently, in which case there is nothing to rotate
+		if bytes.Equal(applied.Data[secrets.PrivateKeySecretKey], privateKeyBytes) {
+			return nil
+		}
+	default:
+		if err = r.rotateNodeKeys(ctx, keySigner, previousSigner); err != nil {
+			return err
+		}
+	}
+	applied.Data = map[string][]byte{secrets.PrivateKeySecretKey: privateKeyBytes}
+	if err = r.client.Update(ctx, applied); err != nil {
+		return fmt.Errorf("error updating secret %s: %w", secrets.AppliedPrivateKeySecret, err)
+	}
+	return nil
+}
+
+// rotateNodeKeys replaces the previous signer's key with the given signer's key on the instances of all Windows nodes
+// configured with the previous key, reporting the outcome for each node through events. Machine nodes which could not
+// be rotated are annotated, so that their Machines are recreated. Returns an error naming the nodes which could not be
+// rotated.
+func (r *SecretReconciler) rotateNodeKeys(ctx context.Context, keySigner, previousSigner ssh.Signer) error {
+	nodes := &core.NodeList{}
+	if err := r.client.List(ctx, nodes, client.MatchingLabels{core.LabelOSStable: "windows"}); err != nil {
+		return fmt.Errorf("error getting node list: %w", err)
 	}
-	instanceUsername, err := wiparser.GetNodeUsername(instancesConfigMap.Data, &node)
+	previousPubKeyAnno := nodeconfig.CreatePubKeyHashAnnotation(previousSigner.PublicKey())
+	var failed []string
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		// The authorized keys of instances accessed with their own credentials are managed by the user
+		if node.Annotations[nodeconfig.PubKeyHashAnnotation] != previousPubKeyAnno ||
+			instance.CredentialsFromNode(node) != (instance.Credentials{}) {
+			continue
+		}
+		r.log.Info("rotating private key in place", "node", node.GetName())
+		if err := r.rotateNodeKey(ctx, node, keySigner, previousSigner); err != nil {
+			r.log.Error(err, "in-place private key rotation failed", "node", node.GetName())
+			failed = append(failed, node.GetName())
+			fallback := "the new public key must be authorized on the instance manually"
+			if _, present := node.GetLabels()[BYOHLabel]; !present {
+				fallback = "the Machine will be recreated"
+				if err := metadata.ApplyLabelsAndAnnotations(ctx, r.client, *node, nil,
+					map[string]string{nodeconfig.KeyRotationFailedAnnotation: previousPubKeyAnno}); err != nil {
+					r.log.Error(err, "unable to mark node for recreation", "node", node.GetName())
+				}
+			}
+			r.recorder.Eventf(node, core.EventTypeWarning, "PrivateKeyRotationFailed",
+				"unable to rotate private key in place, %s: %v", fallback, err)
+			continue
+		}
+		r.recorder.Eventf(node, core.EventTypeNormal, "PrivateKeyRotated", "private key rotated in place")
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to rotate the private key of nodes %s, keeping the previous key until they are "+
+			"rotated", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// rotateNodeKey accesses the node's instance using the previous signer, and replaces the previous key with the given
+// signer's key
+func (r *SecretReconciler) rotateNodeKey(ctx context.Context, node *core.Node, keySigner,
+	previousSigner ssh.Signer) error {
+	instanceInfo, err := r.instanceFromNode(ctx, node)
+	if err != nil {
+		return err
+	}
+	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.watchNamespace, instanceInfo, previousSigner,
+		nil, nil, r.platform, r.networkBackend)
+	if err != nil {
+		return fmt.Errorf("failed to create new nodeconfig: %w", err)
+	}
+	return nc.RotateSSHKey(ctx, keySigner, previousSigner.PublicKey())
+}
+
+// getEncryptedUsername retrieves the username associated with a given node and encrypts it using the active
+// annotation key
+func (r *SecretReconciler) getEncryptedUsername(ctx context.Context, node core.Node) (string, error) {
+	instanceUsername, err := r.getNodeUsername(ctx, &node)
 	if err != nil {
 		return "", err
 	}
-	encryptedUsername, err := crypto.EncryptToJSONString(instanceUsername, key)
+	encryptedUsername, err := r.encryptUsername(ctx, instanceUsername)
 	if err != nil {
 		return "", fmt.Errorf("error encrypting node %s username: %w", node.GetName(), err)
 	}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
+	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
+)
+
+// newPrivateKey returns a new PEM encoded private key, and its signer
+func newPrivateKey(t *testing.T) ([]byte, ssh.Signer) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(block), signer
+}
+
+func TestRotateInstanceKeys(t *testing.T) {
+	ctx := context.Background()
+	watchNamespace := "test"
+	currentKey, currentSigner := newPrivateKey(t)
+	previousKey, _ := newPrivateKey(t)
+	privateKeySecret := &core.Secret{
+		ObjectMeta: meta.ObjectMeta{Name: secrets.PrivateKeySecret, Namespace: watchNamespace},
+		Data:       map[string][]byte{secrets.PrivateKeySecretKey: currentKey},
+	}
+	appliedKey := kubeTypes.NamespacedName{Namespace: watchNamespace, Name: secrets.AppliedPrivateKeySecret}
+
+	testCases := []struct {
+		name    string
+		applied []byte
+	}{
+		{name: "no applied key"},
+		{name: "applied key up to date", applied: currentKey},
+		// the same key with a different encoding, which must not be rotated
+		{name: "applied key re-encoded", applied: append(bytes.Clone(currentKey), '\n')},
+		// no node uses the previous key, so there is nothing to rotate
+		{name: "applied key out of date", applied: previousKey},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithObjects(privateKeySecret.DeepCopy())
+			if test.applied != nil {
+				builder = builder.WithObjects(secrets.NewAppliedPrivateKeySecret(watchNamespace, test.applied))
+			}
+			// a node configured with the current key, which is never accessed
+			node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node",
+				Labels: map[string]string{core.LabelOSStable: "windows"},
+				Annotations: map[string]string{
+					nodeconfig.PubKeyHashAnnotation: nodeconfig.CreatePubKeyHashAnnotation(currentSigner.PublicKey())},
+			}}
+			c := builder.WithObjects(node).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := SecretReconciler{instanceReconciler: instanceReconciler{client: c, log: logr.Discard(),
+				watchNamespace: watchNamespace, recorder: recorder}}
+			require.NoError(t, r.rotateInstanceKeys(ctx, currentSigner))
+			assert.Empty(t, recorder.Events)
+
+			applied, err := secrets.GetPrivateKey(ctx, appliedKey, c)
+			require.NoError(t, err)
+			assert.Equal(t, currentKey, applied)
+		})
+	}
+}
+
+func TestRotateInstanceKeysFailure(t *testing.T) {
+	ctx := context.Background()
+	watchNamespace := "test"
+	currentKey, currentSigner := newPrivateKey(t)
+	previousKey, previousSigner := newPrivateKey(t)
+	previousPubKeyAnno := nodeconfig.CreatePubKeyHashAnnotation(previousSigner.PublicKey())
+	appliedKey := kubeTypes.NamespacedName{Namespace: watchNamespace, Name: secrets.AppliedPrivateKeySecret}
+
+	// nodes configured with the previous key, whose instances cannot be found as they have no address
+	newNode := func(name string, labels map[string]string) *core.Node {
+		labels[core.LabelOSStable] = "windows"
+		return &core.Node{ObjectMeta: meta.ObjectMeta{Name: name, Labels: labels,
+			Annotations: map[string]string{nodeconfig.PubKeyHashAnnotation: previousPubKeyAnno}}}
+	}
+	c := fake.NewClientBuilder().WithObjects(
+		&core.Secret{ObjectMeta: meta.ObjectMeta{Name: secrets.PrivateKeySecret, Namespace: watchNamespace},
+			Data: map[string][]byte{secrets.PrivateKeySecretKey: currentKey}},
+		secrets.NewAppliedPrivateKeySecret(watchNamespace, previousKey),
+		newNode("machine", map[string]string{}),
+		newNode("byoh", map[string]string{BYOHLabel: "true"}),
+	).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := SecretReconciler{instanceReconciler: instanceReconciler{client: c, log: logr.Discard(),
+		watchNamespace: watchNamespace, recorder: recorder}}
+
+	err := r.rotateInstanceKeys(ctx, currentSigner)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "byoh")
+	assert.Contains(t, err.Error(), "machine")
+	require.Len(t, recorder.Events, 2)
+	assert.Contains(t, <-recorder.Events, "PrivateKeyRotationFailed")
+
+	applied, err := secrets.GetPrivateKey(ctx, appliedKey, c)
+	require.NoError(t, err)
+	assert.Equal(t, previousKey, applied, "the previous key must be kept to retry the rotation")
+
+	node := &core.Node{}
+	require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: "machine"}, node))
+	assert.Equal(t, previousPubKeyAnno, node.Annotations[nodeconfig.KeyRotationFailedAnnotation])
+	require.NoError(t, c.Get(ctx, kubeTypes.NamespacedName{Name: "byoh"}, node))
+	assert.NotContains(t, node.Annotations, nodeconfig.KeyRotationFailedAnnotation)
+}
+
+func TestIsKeyRotationPending(t *testing.T) {
+	ctx := context.Background()
+	watchNamespace := "test"
+	previousKey, previousSigner := newPrivateKey(t)
+	_, currentSigner := newPrivateKey(t)
+	newNode := func(signer ssh.Signer) *core.Node {
+		return &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node", Annotations: map[string]string{
+			nodeconfig.PubKeyHashAnnotation: nodeconfig.CreatePubKeyHashAnnotation(signer.PublicKey())}}}
+	}
+
+	r := WindowsMachineReconciler{instanceReconciler: instanceReconciler{client: fake.NewClientBuilder().Build(),
+		watchNamespace: watchNamespace}}
+	pending, err := r.isKeyRotationPending(ctx, newNode(previousSigner))
+	require.NoError(t, err)
+	assert.False(t, pending, "no applied key")
+
+	r.client = fake.NewClientBuilder().WithObjects(secrets.NewAppliedPrivateKeySecret(watchNamespace,
+		previousKey)).Build()
+	pending, err = r.isKeyRotationPending(ctx, newNode(previousSigner))
+	require.NoError(t, err)
+	assert.True(t, pending, "node configured with the applied key")
+	pending, err = r.isKeyRotationPending(ctx, newNode(currentSigner))
+	require.NoError(t, err)
+	assert.False(t, pending, "node configured with another key")
+	failedNode := newNode(previousSigner)
+	failedNode.Annotations[nodeconfig.KeyRotationFailedAnnotation] =
+		nodeconfig.CreatePubKeyHashAnnotation(previousSigner.PublicKey())
+	pending, err = r.isKeyRotationPending(ctx, failedNode)
+	require.NoError(t, err)
+	assert.False(t, pending, "node whose in-place rotation failed")
+}
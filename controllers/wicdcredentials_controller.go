@@ -0,0 +1,249 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
+	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
+	"github.com/openshift/windows-machine-config-operator/pkg/wicdauth"
+	"github.com/openshift/windows-machine-config-operator/version"
+)
+
+const (
+	// WICDCredentialsController is the name of this controller in logs and other outputs.
+	WICDCredentialsController = "wicdcredentials"
+	// wicdCredentialsVerifyPeriod is how often a node is checked for WICD reporting the use of newly distributed
+	// credentials
+	wicdCredentialsVerifyPeriod = 30 * time.Second
+	// wicdCredentialsVerifyTimeout is how long WICD is given to start using newly distributed credentials before the
+	// rotation is considered failed
+	wicdCredentialsVerifyTimeout = 10 * time.Minute
+	// wicdCredentialsRetryPeriod is how long to wait before retrying a failed rotation
+	wicdCredentialsRetryPeriod = 10 * time.Minute
+)
+
+// wicdCredentialsReconciler rotates the credentials WICD uses on each Windows node. New credentials are distributed to
+// the instance over SSH, and the previous credentials are revoked once WICD reports using the new ones. Rotation
+// happens once a third of the lifetime of the current credentials remains, or when requested through the
+// wicdauth.RotationRequestAnnotation.
+type wicdCredentialsReconciler struct {
+	instanceReconciler
+}
+
+// NewWICDCredentialsReconciler returns a pointer to a new wicdCredentialsReconciler
+func NewWICDCredentialsReconciler(mgr manager.Manager, clusterConfig cluster.Config,
+	watchNamespace string) (*wicdCredentialsReconciler, error) {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes clientset: %w", err)
+	}
+
+	return &wicdCredentialsReconciler{
+		instanceReconciler: instanceReconciler{
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controllers").WithName(WICDCredentialsController),
+			k8sclientset:   clientset,
+			watchNamespace: watchNamespace,
+			recorder:       mgr.GetEventRecorderFor(WICDCredentialsController),
+			platform:       clusterConfig.Platform(),
+			networkBackend: clusterConfig.Network().Backend(),
+		},
+	}, nil
+}
+
+// Reconcile verifies that WICD on the given Windows node is using the credentials most recently distributed to it,
+// revoking its previous credentials once it is, and distributes new credentials once a rotation is due or requested
+func (r *wicdCredentialsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	r.log = r.log.WithValues(WICDCredentialsController, req.NamespacedName)
+
+	node := &core.Node{}
+	if err := r.client.Get(ctx, req.NamespacedName, node); err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			// The credentials of a deleted node are invalidated by the API server, only the allowlist entry remains
+			metrics.WICDCredentialExpiry.DeleteLabelValues(req.Name)
+			return ctrl.Result{}, wicdauth.SetAllowedCredentials(ctx, r.client, r.watchNamespace, req.Name)
+		}
+		return ctrl.Result{}, err
+	}
+	// Nodes which are being configured, or run a WICD which does not report its credentials, are given new
+	// credentials as part of their configuration
+	if node.GetAnnotations()[metadata.VersionAnnotation] != version.Get() {
+		return ctrl.Result{}, nil
+	}
+	status, err := wicdauth.GetRotationStatus(node)
+	if err != nil {
+		// The status is rewritten by the rotation, recovering the node
+		r.log.Error(err, "unable to determine WICD credential rotation status")
+	}
+
+	if status != nil && status.Phase == wicdauth.RotationDistributed {
+		return r.verify(ctx, node, *status)
+	}
+	if status != nil && !status.ExpiresAt.IsZero() {
+		metrics.WICDCredentialExpiry.WithLabelValues(node.GetName()).Set(float64(status.ExpiresAt.Unix()))
+	}
+
+	now := time.Now()
+	_, requested := node.GetAnnotations()[wicdauth.RotationRequestAnnotation]
+	var next time.Time
+	switch {
+	case requested || status == nil:
+	case status.Phase == wicdauth.RotationFailed:
+		next = status.LastTransitionTime.Add(wicdCredentialsRetryPeriod)
+	default:
+		next = status.RotationDue()
+	}
+	if now.Before(next) {
+		return ctrl.Result{RequeueAfter: next.Sub(now)}, nil
+	}
+	return r.rotate(ctx, node, status)
+}
+
+// rotate distributes new credentials to the node's instance. The node's current credentials remain allowed until WICD
+// is verified to be using the new ones.
+func (r *wicdCredentialsReconciler) rotate(ctx context.Context, node *core.Node,
+	status *wicdauth.RotationStatus) (ctrl.Result, error) {
+	current := wicdauth.RotationStatus{}
+	if status != nil {
+		current = *status
+	}
+	r.log.Info("rotating WICD credentials")
+	instanceInfo, err := r.instanceFromNode(ctx, node)
+	if err != nil {
+		return r.fail(ctx, node, current, err)
+	}
+	instanceSigner, err := r.signerFor(ctx, instanceInfo)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	nc, err := nodeconfig.NewNodeConfig(r.client, r.k8sclientset, r.watchNamespace, instanceInfo, instanceSigner,
+		nil, nil, r.platform, r.networkBackend)
+	if err != nil {
+		return r.fail(ctx, node, current, err)
+	}
+	claims, err := nc.RotateWICDCredentials(ctx)
+	if err != nil {
+		return r.fail(ctx, node, current, err)
+	}
+	if err = wicdauth.ApplyRotationStatus(ctx, r.client, node, current.Distributed(claims)); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.log.Info("distributed WICD credentials", "credentialID", claims.ID)
+	return ctrl.Result{RequeueAfter: wicdCredentialsVerifyPeriod}, nil
+}
+
+// verify completes the rotation once WICD reports using the pending credentials, revoking all others, and fails it if
+// WICD does not do so in time
+func (r *wicdCredentialsReconciler) verify(ctx context.Context, node *core.Node,
+	status wicdauth.RotationStatus) (ctrl.Result, error) {
+	if node.GetAnnotations()[wicdauth.CredentialAnnotation] != status.PendingCredentialID {
+		if time.Since(status.LastTransitionTime.Time) < wicdCredentialsVerifyTimeout {
+			return ctrl.Result{RequeueAfter: wicdCredentialsVerifyPeriod}, nil
+		}
+		if err := wicdauth.RevokeCredential(ctx, r.client, r.watchNamespace, node.GetName(),
+			status.PendingCredentialID); err != nil {
+			return ctrl.Result{}, fmt.Errorf("error revoking unused WICD credentials: %w", err)
+		}
+		return r.fail(ctx, node, status, fmt.Errorf("WICD did not report using the new credentials within %s",
+			wicdCredentialsVerifyTimeout))
+	}
+
+	if err := wicdauth.SetAllowedCredentials(ctx, r.client, r.watchNamespace, node.GetName(),
+		status.PendingCredentialID); err != nil {
+		return ctrl.Result{}, fmt.Errorf("error revoking previous WICD credentials: %w", err)
+	}
+	status = status.Verified()
+	if err := wicdauth.ApplyRotationStatus(ctx, r.client, node, status); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := wicdauth.RemoveRotationRequest(ctx, r.client, node); err != nil {
+		return ctrl.Result{}, err
+	}
+	metrics.WICDCredentialRotations.WithLabelValues("succeeded").Inc()
+	metrics.WICDCredentialExpiry.WithLabelValues(node.GetName()).Set(float64(status.ExpiresAt.Unix()))
+	r.recorder.Eventf(node, core.EventTypeNormal, "WICDCredentialsRotated",
+		"WICD credentials rotated, new credentials expire at %s", status.ExpiresAt.Format(time.RFC3339))
+	r.log.Info("rotated WICD credentials", "credentialID", status.CredentialID)
+	return ctrl.Result{RequeueAfter: time.Until(status.RotationDue())}, nil
+}
+
+// fail records the failure of the node's rotation, which is retried after wicdCredentialsRetryPeriod. WICD continues
+// to use its current credentials.
+func (r *wicdCredentialsReconciler) fail(ctx context.Context, node *core.Node, status wicdauth.RotationStatus,
+	cause error) (ctrl.Result, error) {
+	r.log.Error(cause, "WICD credential rotation failed")
+	metrics.WICDCredentialRotations.WithLabelValues("failed").Inc()
+	r.recorder.Eventf(node, core.EventTypeWarning, "WICDCredentialRotationFailed",
+		"WICD credential rotation failed: %v", cause)
+	if err := wicdauth.ApplyRotationStatus(ctx, r.client, node, status.Failed(cause.Error())); err != nil {
+		return ctrl.Result{}, err
+	}
+	// The request has been acted on, the status reports its outcome and the rotation is retried regardless
+	if err := wicdauth.RemoveRotationRequest(ctx, r.client, node); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: wicdCredentialsRetryPeriod}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *wicdCredentialsReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	windowsNodePredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if !isWindowsNode(e.ObjectNew) {
+				return false
+			}
+			// get update event only when the rotation is requested, progresses, or the node finishes configuration
+			for _, annotation := range []string{wicdauth.RotationRequestAnnotation, wicdauth.CredentialAnnotation,
+				wicdauth.RotationStatusAnnotation, metadata.VersionAnnotation} {
+				oldValue, oldPresent := e.ObjectOld.GetAnnotations()[annotation]
+				newValue, newPresent := e.ObjectNew.GetAnnotations()[annotation]
+				if oldValue != newValue || oldPresent != newPresent {
+					return true
+				}
+			}
+			return false
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return isWindowsNode(e.Object)
+		},
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(WICDCredentialsController).
+		For(&core.Node{}, builder.WithPredicates(windowsNodePredicate)).
+		Complete(r)
+}
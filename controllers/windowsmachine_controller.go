@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	oconfig "github.com/openshift/api/config/v1"
 	mapi "github.com/openshift/api/machine/v1beta1"
 	mclient "github.com/openshift/client-go/machine/clientset/versioned/typed/machine/v1beta1"
+	"golang.org/x/crypto/ssh"
 	core "k8s.io/api/core/v1"
 	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -24,10 +26,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
 	"github.com/openshift/windows-machine-config-operator/pkg/condition"
-	"github.com/openshift/windows-machine-config-operator/pkg/crypto"
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
@@ -54,6 +56,9 @@ const (
 	WindowsMachineController = "windowsmachine"
 	// IgnoreLabel is a label that will cause machines to be ignored by the Windows Machine controller
 	IgnoreLabel = "windowsmachineconfig.openshift.io/ignore"
+	// keyRotationCheckPeriod is how often a Machine whose private key is being rotated in place is checked for the
+	// completion of the rotation
+	keyRotationCheckPeriod = time.Minute
 )
 
 // WindowsMachineReconciler is used to create a controller which manages Windows Machine objects
@@ -83,20 +88,22 @@ func NewWindowsMachineReconciler(mgr manager.Manager, clusterConfig cluster.Conf
 
 	return &WindowsMachineReconciler{
 		instanceReconciler: instanceReconciler{
-			client:             mgr.GetClient(),
-			log:                ctrl.Log.WithName("controller").WithName(WindowsMachineController),
-			k8sclientset:       clientset,
-			clusterServiceCIDR: clusterConfig.Network().GetServiceCIDR(),
-			recorder:           mgr.GetEventRecorderFor(WindowsMachineController),
-			watchNamespace:     watchNamespace,
-			platform:           clusterConfig.Platform(),
+			client:         mgr.GetClient(),
+			log:            ctrl.Log.WithName("controller").WithName(WindowsMachineController),
+			k8sclientset:   clientset,
+			networkBackend: clusterConfig.Network().Backend(),
+			recorder:       mgr.GetEventRecorderFor(WindowsMachineController),
+			watchNamespace: watchNamespace,
+			platform:       clusterConfig.Platform(),
 		},
 		machineClient: machineClient,
 	}, nil
 }
 
-// SetupWithManager sets up a new Secret controller
-func (r *WindowsMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
+// SetupWithManager sets up a new Secret controller. Windows nodes sent over clusterEndpointsEvents are reconfigured
+// if they are outdated.
+func (r *WindowsMachineReconciler) SetupWithManager(mgr ctrl.Manager,
+	clusterEndpointsEvents <-chan event.GenericEvent) error {
 	// Watch for the Machine objects with label defined by MachineOSLabel
 	machinePredicate := predicate.Funcs{
 		// We need the create event to account for Machines that are in provisioned state but were created
@@ -121,6 +128,8 @@ func (r *WindowsMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&mapi.Machine{}, builder.WithPredicates(machinePredicate)).
 		Watches(&core.Node{}, handler.EnqueueRequestsFromMapFunc(r.mapNodeToMachine),
 			builder.WithPredicates(outdatedWindowsNodePredicate(false))).
+		WatchesRawSource(source.Channel(clusterEndpointsEvents, handler.EnqueueRequestsFromMapFunc(r.mapNodeToMachine),
+			source.WithPredicates[client.Object, reconcile.Request](outdatedWindowsNodePredicate(false)))).
 		Complete(r)
 }
 
@@ -272,9 +281,18 @@ func (r *WindowsMachineReconciler) Reconcile(ctx context.Context,
 		}
 
 		if _, present := node.Annotations[metadata.VersionAnnotation]; present {
-			// If the private key used to configure the machine is out of date, the machine should be deleted
+			// If the private key used to configure the machine is out of date, the machine should be deleted, unless
+			// the key is being rotated in place
 			if node.Annotations[nodeconfig.PubKeyHashAnnotation] !=
 				nodeconfig.CreatePubKeyHashAnnotation(r.signer.PublicKey()) {
+				rotationPending, err := r.isKeyRotationPending(ctx, node)
+				if err != nil {
+					return ctrl.Result{}, err
+				}
+				if rotationPending {
+					log.Info("waiting for in-place private key rotation")
+					return ctrl.Result{RequeueAfter: keyRotationCheckPeriod}, nil
+				}
 				log.Info("deleting machine")
 				deletionAllowed, err := r.isAllowedDeletion(ctx, machine)
 				if err != nil {
@@ -289,7 +307,8 @@ func (r *WindowsMachineReconciler) Reconcile(ctx context.Context,
 				}
 				return ctrl.Result{}, r.deleteMachine(ctx, machine)
 			}
-			if node.Annotations[metadata.VersionAnnotation] == version.Get() {
+			if node.Annotations[metadata.VersionAnnotation] == version.Get() &&
+				nodeconfig.ClusterEndpointsUpToDate(node) {
 				// version annotation exists with a valid value, node is fully configured.
 				return ctrl.Result{}, nil
 			}
@@ -336,6 +355,14 @@ func (r *WindowsMachineReconciler) Reconcile(ctx context.Context,
 				"Machine %s authentication failure", machine.Name)
 			return ctrl.Result{}, r.deleteMachine(ctx, machine)
 		}
+		var unsupportedOSErr *windows.UnsupportedOSErr
+		if errors.As(err, &unsupportedOSErr) {
+			// Retrying will not help, the Machine must be re-provisioned using a supported Windows Server image
+			log.Info("unable to configure Machine", "reason", unsupportedOSErr.Error())
+			r.recorder.Eventf(machine, core.EventTypeWarning, "UnsupportedWindowsBuild",
+				"Machine %s cannot be configured: %s", machine.Name, unsupportedOSErr.Error())
+			return ctrl.Result{}, nil
+		}
 		r.recorder.Eventf(machine, core.EventTypeWarning, "MachineSetupFailure",
 			"Machine %s configuration failure", machine.Name)
 		return ctrl.Result{}, err
@@ -363,16 +390,6 @@ func (r *WindowsMachineReconciler) deleteMachine(ctx context.Context, machine *m
 	return nil
 }
 
-// getDefaultUsername returns the default username for a Windows instance
-func (r *WindowsMachineReconciler) getDefaultUsername() string {
-	// TODO: This should be changed so that the "core" user is used on all platforms for SSH connections.
-	// https://issues.redhat.com/browse/WINC-430
-	if r.platform == oconfig.AzurePlatformType {
-		return "capi"
-	}
-	return "Administrator"
-}
-
 // configureMachine configures the given Windows VM, adding it as a node object to the cluster or upgrading it in place.
 func (r *WindowsMachineReconciler) configureMachine(ctx context.Context, ipAddress, instanceID, machineName string, node *core.Node) error {
 	// The name of the Machine must be the same as the hostname of the associated VM. This is currently not true in the
@@ -390,13 +407,7 @@ func (r *WindowsMachineReconciler) configureMachine(ctx context.Context, ipAddre
 	if err != nil {
 		return err
 	}
-	// Get private key to encrypt instance usernames
-	privateKeyBytes, err := secrets.GetPrivateKey(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
-		Name: secrets.PrivateKeySecret}, r.client)
-	if err != nil {
-		return err
-	}
-	encryptedUsername, err := crypto.EncryptToJSONString(username, privateKeyBytes)
+	encryptedUsername, err := r.encryptUsername(ctx, username)
 	if err != nil {
 		return fmt.Errorf("unable to encrypt username for instance %s: %w", instanceInfo.Address, err)
 	}
@@ -434,6 +445,28 @@ func (r *WindowsMachineReconciler) validateUserData(ctx context.Context) error {
 	return nil
 }
 
+// isKeyRotationPending returns true if the given node is configured with the previous private key, which has yet to be
+// rotated in place
+func (r *WindowsMachineReconciler) isKeyRotationPending(ctx context.Context, node *core.Node) (bool, error) {
+	previousKey, err := secrets.GetPrivateKey(ctx, kubeTypes.NamespacedName{Namespace: r.watchNamespace,
+		Name: secrets.AppliedPrivateKeySecret}, r.client)
+	if err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to get secret %s: %w", secrets.AppliedPrivateKeySecret, err)
+	}
+	previousSigner, err := ssh.ParsePrivateKey(previousKey)
+	if err != nil {
+		// The previous key cannot be used to rotate the key in place
+		return false, nil
+	}
+	previousPubKeyAnno := nodeconfig.CreatePubKeyHashAnnotation(previousSigner.PublicKey())
+	// A Machine whose key could not be rotated in place is recreated
+	return node.Annotations[nodeconfig.PubKeyHashAnnotation] == previousPubKeyAnno &&
+		node.Annotations[nodeconfig.KeyRotationFailedAnnotation] != previousPubKeyAnno, nil
+}
+
 // isAllowedDeletion determines if the number of machines after deletion of the given machine doesn`t fall below the
 // minHealthyCount
 func (r *WindowsMachineReconciler) isAllowedDeletion(ctx context.Context, machine *mapi.Machine) (bool, error) {
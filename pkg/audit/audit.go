@@ -0,0 +1,228 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Operation is the kind of action taken on a Windows instance
+type Operation string
+
+const (
+	// CommandOperation is the execution of a remote command
+	CommandOperation Operation = "command"
+	// TransferOperation is the transfer of a file to the instance
+	TransferOperation Operation = "transfer"
+	// UnknownExitStatus is the exit status of commands which did not report one, such as commands which could not be
+	// started
+	UnknownExitStatus = -1
+	// modulePrefix prefixes the function names of this module
+	modulePrefix = "github.com/openshift/windows-machine-config-operator/"
+	// maxEventCommandLength is the length commands are truncated to in event messages, to keep within the event
+	// message size limit
+	maxEventCommandLength = 256
+	// MinKeySize is the minimum size in bytes of the key the records are chained with
+	MinKeySize = 32
+)
+
+// Record describes a single action taken on a Windows instance
+type Record struct {
+	// Time is when the action was started
+	Time time.Time `json:"time"`
+	// Instance is the address of the instance
+	Instance string `json:"instance"`
+	// Node is the name of the instance's node, empty if the instance is not a node yet
+	Node string `json:"node,omitempty"`
+	// Operation is the kind of action taken
+	Operation Operation `json:"operation"`
+	// Command is the command run, with secret values redacted
+	Command string `json:"command,omitempty"`
+	// Path is the remote path of the file transferred
+	Path string `json:"path,omitempty"`
+	// SHA256 is the checksum of the contents of the file transferred
+	SHA256 string `json:"sha256,omitempty"`
+	// Caller is the operator step which took the action
+	Caller string `json:"caller"`
+	// DurationMilliseconds is how long the action took
+	DurationMilliseconds int64 `json:"durationMilliseconds"`
+	// ExitStatus is the exit status of the command. Always 0 for successful transfers.
+	ExitStatus int `json:"exitStatus"`
+	// Error is the error the action failed with, with secret values redacted
+	Error string `json:"error,omitempty"`
+	// PreviousHash is the hash of the preceding record of the audit log, empty for the first record
+	PreviousHash string `json:"previousHash"`
+	// Hash is the HMAC-SHA256 of this record, computed with an empty hash. As each record includes the hash of the
+	// preceding one, and the hashes cannot be computed without the key, modifying, removing or forging a record breaks
+	// the chain.
+	Hash string `json:"hash"`
+}
+
+// computeHash returns the hash of the record keyed with the given key, computed with an empty hash
+func (r Record) computeHash(key []byte) (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal audit record: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return fmt.Sprintf("%x", mac.Sum(nil)), nil
+}
+
+// chain links audit records to each other
+type chain struct {
+	// key is the key the hashes of the records are computed with
+	key []byte
+	// lastHash is the hash of the last record linked
+	lastHash string
+}
+
+// link chains the given record to the last record linked, and sets its hash
+func (c *chain) link(r *Record) error {
+	// Times are stored in UTC, so that they are marshalled the same way when verifying the record
+	r.Time = r.Time.UTC()
+	r.PreviousHash = c.lastHash
+	hash, err := r.computeHash(c.key)
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	c.lastHash = hash
+	return nil
+}
+
+// Sink persists audit records
+type Sink interface {
+	// Write persists the given record, which is already chained to the preceding one
+	Write(*Record) error
+}
+
+// Config describes where audit records are sent
+type Config struct {
+	// Key is the key the hashes chaining the records are computed with. Required if any sink is given.
+	Key []byte
+	// PreviousHash is the hash of the last record persisted by a previous run, which the first record is chained to
+	PreviousHash string
+	// Sinks persist the records, records are not persisted if empty
+	Sinks []Sink
+	// Recorder emits the records as events on the nodes they concern, no events are emitted if nil
+	Recorder record.EventRecorder
+}
+
+// auditor sends audit records to the configured destinations
+type auditor struct {
+	mutex    sync.Mutex
+	chain    chain
+	sinks    []Sink
+	recorder record.EventRecorder
+}
+
+// defaultAuditor is used to audit all actions taken on Windows instances
+var defaultAuditor = &auditor{}
+
+// Configure sets where audit records are sent
+func Configure(config Config) error {
+	if len(config.Sinks) > 0 && len(config.Key) < MinKeySize {
+		return fmt.Errorf("audit records cannot be persisted without a key of at least %d bytes", MinKeySize)
+	}
+	defaultAuditor.mutex.Lock()
+	defer defaultAuditor.mutex.Unlock()
+	defaultAuditor.chain = chain{key: config.Key, lastHash: config.PreviousHash}
+	defaultAuditor.sinks = config.Sinks
+	defaultAuditor.recorder = config.Recorder
+	return nil
+}
+
+// Log redacts the secret values of the given record and sends it to the configured destinations. The record's caller
+// is set to the innermost function outside the packages interacting with instances. Failing to persist a record is
+// logged rather than returned, so that auditing cannot break instance configuration.
+func Log(r Record) {
+	defaultAuditor.mutex.Lock()
+	defer defaultAuditor.mutex.Unlock()
+	if len(defaultAuditor.sinks) == 0 && defaultAuditor.recorder == nil {
+		return
+	}
+	r.Command = Redact(r.Command)
+	r.Error = Redact(r.Error)
+	if r.Caller == "" {
+		r.Caller = caller()
+	}
+	if err := defaultAuditor.persist(&r); err != nil {
+		ctrl.Log.WithName("audit").Error(err, "unable to persist audit record", "instance", r.Instance)
+	}
+	if defaultAuditor.recorder != nil && r.Node != "" {
+		emitEvent(defaultAuditor.recorder, r)
+	}
+}
+
+// persist chains the given record to the preceding one, and writes it to each sink
+func (a *auditor) persist(r *Record) error {
+	if len(a.sinks) == 0 {
+		return nil
+	}
+	if err := a.chain.link(r); err != nil {
+		return err
+	}
+	var errs []error
+	for _, sink := range a.sinks {
+		if err := sink.Write(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// emitEvent emits the given record as an event on the node it concerns
+func emitEvent(recorder record.EventRecorder, r Record) {
+	// Node events are keyed by name, the same way the kubelet emits them
+	node := &core.ObjectReference{Kind: "Node", Name: r.Node, UID: kubeTypes.UID(r.Node)}
+	eventType := core.EventTypeNormal
+	outcome := "succeeded"
+	if r.Error != "" {
+		eventType = core.EventTypeWarning
+		outcome = "failed"
+	}
+	duration := time.Duration(r.DurationMilliseconds) * time.Millisecond
+	switch r.Operation {
+	case CommandOperation:
+		command := r.Command
+		if len(command) > maxEventCommandLength {
+			command = command[:maxEventCommandLength] + "..."
+		}
+		recorder.Eventf(node, eventType, "RemoteCommand", "%s: command %s with exit status %d after %s: %s",
+			r.Caller, outcome, r.ExitStatus, duration, command)
+	case TransferOperation:
+		recorder.Eventf(node, eventType, "FileTransfer", "%s: transfer of %s (sha256 %s) %s after %s", r.Caller,
+			r.Path, r.SHA256, outcome, duration)
+	}
+}
+
+// caller returns the name of the innermost function of this module outside the packages interacting with instances,
+// relative to the module
+func caller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		name := strings.TrimPrefix(frame.Function, modulePrefix)
+		if name != frame.Function && !strings.HasPrefix(name, "pkg/audit.") &&
+			!strings.HasPrefix(name, "pkg/windows.") {
+			return strings.TrimPrefix(name, "pkg/")
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
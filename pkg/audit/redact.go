@@ -0,0 +1,30 @@
+package audit
+
+import "regexp"
+
+// redacted replaces secret values
+const redacted = "[REDACTED]"
+
+var (
+	// pemBlockRegex matches PEM encoded blocks, such as private keys and certificates
+	pemBlockRegex = regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]+-----.*?-----END [A-Z0-9 ]+-----`)
+	// jwtRegex matches JSON Web Tokens, such as ServiceAccount tokens
+	jwtRegex = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// bearerRegex matches the token of bearer authorization headers
+	bearerRegex = regexp.MustCompile(`(?i)(bearer\s+)[^\s'"]+`)
+	// secretFieldRegex matches the values of fields commonly holding secrets, such as those of kubeconfigs
+	secretFieldRegex = regexp.MustCompile(`(?i)((?:token|password|passwd|secret|client-key-data|` +
+		`client-certificate-data)["']?\s*[:=]\s*)("[^"]*"|'[^']*'|[^\s,;}'"]+)`)
+)
+
+// Redact returns the given text with the secret values it contains, such as the contents of kubeconfigs, tokens and
+// private keys, replaced
+func Redact(text string) string {
+	if text == "" {
+		return text
+	}
+	text = pemBlockRegex.ReplaceAllString(text, redacted)
+	text = jwtRegex.ReplaceAllString(text, redacted)
+	text = bearerRegex.ReplaceAllString(text, "${1}"+redacted)
+	return secretFieldRegex.ReplaceAllString(text, "${1}"+redacted)
+}
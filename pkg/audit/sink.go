@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// tailSize is how much of the end of an existing audit log is read to find its last record
+const tailSize = 64 * 1024
+
+// FileSink persists audit records to a file as JSON lines, rotating it once it reaches its maximum size
+type FileSink struct {
+	mutex sync.Mutex
+	// path is the path of the current audit log. Rotated logs are suffixed with their generation, .1 being the newest.
+	path string
+	// maxSize is the size in bytes the audit log is rotated at
+	maxSize int64
+	// maxBackups is the number of rotated audit logs kept
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewFileSink returns a FileSink writing to the audit log at the given path, rotated once it reaches maxSize bytes,
+// keeping maxBackups rotated logs
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	if maxSize <= 0 || maxBackups < 0 {
+		return nil, fmt.Errorf("invalid audit log size %d or backup count %d", maxSize, maxBackups)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("unable to create audit log directory: %w", err)
+	}
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write appends the given record to the audit log
+func (s *FileSink) Write(r *Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("unable to marshal audit record: %w", err)
+	}
+	line = append(line, '\n')
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("unable to write audit record: %w", err)
+	}
+	return nil
+}
+
+// Close closes the audit log
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+// open opens the audit log for appending
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("unable to stat audit log: %w", err)
+	}
+	s.file, s.size = file, info.Size()
+	return nil
+}
+
+// rotate shifts the rotated audit logs by a generation, removing the oldest, and starts a new audit log
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("unable to close audit log: %w", err)
+	}
+	if s.maxBackups == 0 {
+		if err := os.Remove(s.path); err != nil {
+			return fmt.Errorf("unable to remove audit log: %w", err)
+		}
+		return s.open()
+	}
+	if err := os.Remove(backupPath(s.path, s.maxBackups)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to remove oldest audit log: %w", err)
+	}
+	for generation := s.maxBackups - 1; generation > 0; generation-- {
+		err := os.Rename(backupPath(s.path, generation), backupPath(s.path, generation+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to rotate audit log: %w", err)
+		}
+	}
+	if err := os.Rename(s.path, backupPath(s.path, 1)); err != nil {
+		return fmt.Errorf("unable to rotate audit log: %w", err)
+	}
+	return s.open()
+}
+
+// backupPath returns the path of the given generation of rotated audit log
+func backupPath(path string, generation int) string {
+	return path + "." + strconv.Itoa(generation)
+}
+
+// LastHash returns the hash of the last record of the audit log at the given path, or an empty string if there is no
+// such record. The chain of a restarted operator continues from it.
+func LastHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to open audit log: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("unable to stat audit log: %w", err)
+	}
+	offset := max(info.Size()-tailSize, 0)
+	tail := make([]byte, info.Size()-offset)
+	if _, err = file.ReadAt(tail, offset); err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("unable to read audit log: %w", err)
+	}
+	lines := bytes.Split(bytes.TrimRight(tail, "\n"), []byte("\n"))
+	last := lines[len(lines)-1]
+	if len(last) == 0 {
+		return "", nil
+	}
+	r := Record{}
+	if err = json.Unmarshal(last, &r); err != nil {
+		return "", fmt.Errorf("unable to parse last record of audit log %s: %w", path, err)
+	}
+	return r.Hash, nil
+}
+
+// Verify checks that the records read from the given audit log are unmodified and chained to each other with hashes
+// keyed with the given key, the first one being chained to the given hash. Returns the hash of the last record, which
+// the next audit log generation is chained to.
+func Verify(reader io.Reader, key []byte, previousHash string) (string, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, tailSize), 16*tailSize)
+	for line := 1; scanner.Scan(); line++ {
+		r := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return "", fmt.Errorf("line %d: unable to parse record: %w", line, err)
+		}
+		if r.PreviousHash != previousHash {
+			return "", fmt.Errorf("line %d: record is not chained to the preceding record", line)
+		}
+		hash, err := r.computeHash(key)
+		if err != nil {
+			return "", err
+		}
+		if hash != r.Hash {
+			return "", fmt.Errorf("line %d: record has been modified", line)
+		}
+		previousHash = r.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("unable to read audit log: %w", err)
+	}
+	return previousHash, nil
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKey is the key the records of the tests are chained with
+var testKey = []byte(strings.Repeat("k", MinKeySize))
+
+// writeRecords chains a command record for each of the given commands with the given chain, and writes it to the
+// given sink
+func writeRecords(t *testing.T, sink Sink, c *chain, commands ...string) {
+	for _, command := range commands {
+		r := &Record{Time: time.Now(), Instance: "10.0.0.1", Operation: CommandOperation, Command: command,
+			Caller: "test"}
+		require.NoError(t, c.link(r))
+		require.NoError(t, sink.Write(r))
+	}
+}
+
+// verifyFile verifies the audit log at the given path is chained to the given hash, returning its last hash
+func verifyFile(t *testing.T, path, previousHash string) string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lastHash, err := Verify(bytes.NewReader(data), testKey, previousHash)
+	require.NoError(t, err, path)
+	return lastHash
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	sink, err := NewFileSink(path, 1024, 2)
+	require.NoError(t, err)
+	writeRecords(t, sink, &chain{key: testKey}, "hostname", "hostname", "hostname")
+	require.NoError(t, sink.Close())
+	lastHash := verifyFile(t, path, "")
+
+	// the chain continues across restarts and rotations
+	previousHash, err := LastHash(path)
+	require.NoError(t, err)
+	assert.Equal(t, lastHash, previousHash)
+	sink, err = NewFileSink(path, 1024, 2)
+	require.NoError(t, err)
+	writeRecords(t, sink, &chain{key: testKey, lastHash: previousHash}, strings.Repeat("a", 800),
+		strings.Repeat("b", 800), strings.Repeat("c", 800))
+	require.NoError(t, sink.Close())
+	assert.NoFileExists(t, path+".3", "only the newest rotated logs are kept")
+	lastHash = verifyFile(t, path+".1", verifyFile(t, path+".2", lastHash))
+	verifyFile(t, path, lastHash)
+}
+
+func TestVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(path, 1024*1024, 1)
+	require.NoError(t, err)
+	writeRecords(t, sink, &chain{key: testKey}, "hostname", "whoami", "ipconfig")
+	require.NoError(t, sink.Close())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(data), "\n")
+
+	_, err = Verify(strings.NewReader(strings.Replace(string(data), "whoami", "Restart-Computer", 1)), testKey, "")
+	assert.ErrorContains(t, err, "line 2: record has been modified")
+	_, err = Verify(strings.NewReader(lines[0]+lines[2]), testKey, "")
+	assert.ErrorContains(t, err, "line 2: record is not chained")
+	_, err = Verify(strings.NewReader(string(data)), testKey, "unexpected")
+	assert.ErrorContains(t, err, "line 1: record is not chained")
+
+	// records rewritten with recomputed hashes cannot be passed off as genuine without the key
+	forged := &memorySink{}
+	writeRecords(t, forged, &chain{key: []byte(strings.Repeat("f", MinKeySize))}, "hostname")
+	line, err := json.Marshal(forged.records[0])
+	require.NoError(t, err)
+	_, err = Verify(bytes.NewReader(line), testKey, "")
+	assert.ErrorContains(t, err, "line 1: record has been modified")
+}
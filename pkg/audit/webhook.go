@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// webhookQueueSize is the number of records waiting to be sent, past which records are dropped from the webhook
+	webhookQueueSize = 1024
+	// webhookTimeout is how long sending a single record may take
+	webhookTimeout = 10 * time.Second
+)
+
+// WebhookSink sends audit records as JSON to an HTTPS endpoint, such as a log collector outside the cluster, so that
+// the records outlive the operator's pod. Records are sent in the background, in order, so that an unavailable
+// endpoint does not slow down the configuration of instances.
+type WebhookSink struct {
+	// url is the endpoint each record is sent to in a POST request
+	url string
+	// client sends the requests
+	client *http.Client
+	// records holds the records waiting to be sent
+	records chan Record
+}
+
+// NewWebhookSink returns a WebhookSink sending records to the given HTTPS URL
+func NewWebhookSink(webhookURL string) (*WebhookSink, error) {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit webhook URL: %w", err)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("audit webhook URL %s must be an https URL", parsed.Redacted())
+	}
+	return &WebhookSink{url: webhookURL, client: &http.Client{Timeout: webhookTimeout},
+		records: make(chan Record, webhookQueueSize)}, nil
+}
+
+// Write queues the given record to be sent. Returns an error if the record is dropped as too many records are waiting
+// to be sent.
+func (s *WebhookSink) Write(r *Record) error {
+	select {
+	case s.records <- *r:
+		return nil
+	default:
+		return fmt.Errorf("audit webhook queue is full, dropping record")
+	}
+}
+
+// Start sends the queued records until the given context is cancelled. Records which cannot be sent are logged and
+// dropped, they remain in the audit log if one is written.
+func (s *WebhookSink) Start(ctx context.Context) error {
+	log := ctrl.Log.WithName("audit")
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case r := <-s.records:
+			if err := s.send(ctx, &r); err != nil {
+				log.Error(err, "unable to send audit record", "instance", r.Instance, "hash", r.Hash)
+			}
+		}
+	}
+}
+
+// send sends the given record to the endpoint
+func (s *WebhookSink) send(ctx context.Context, r *Record) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("unable to marshal audit record: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit webhook responded with status %s", resp.Status)
+	}
+	return nil
+}
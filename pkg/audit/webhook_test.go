@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSink(t *testing.T) {
+	_, err := NewWebhookSink("http://collector.example.com/audit")
+	assert.Error(t, err, "records must not be sent in clear text")
+
+	received := make(chan Record, 2)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r := Record{}
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&r))
+		received <- r
+	}))
+	defer server.Close()
+	sink, err := NewWebhookSink(server.URL)
+	require.NoError(t, err)
+	sink.client = server.Client()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sink.Start(ctx)
+
+	writeRecords(t, sink, &chain{key: testKey}, "hostname", "whoami")
+	for _, command := range []string{"hostname", "whoami"} {
+		select {
+		case r := <-received:
+			assert.Equal(t, command, r.Command, "records must be sent in order")
+			assert.NotEmpty(t, r.Hash)
+		case <-time.After(10 * time.Second):
+			t.Fatal("record was not sent")
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package certexpiry
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"time"
+
+	core "k8s.io/api/core/v1"
+)
+
+const (
+	// Annotation is applied to Windows nodes by WICD, holding the validity period of each certificate WMCO manages on
+	// the underlying instance
+	Annotation = "windowsmachineconfig.openshift.io/certificate-expiry"
+	// ConditionType is the type of the Node condition WMCO sets to report whether any of the node's certificates are
+	// close to expiry
+	ConditionType core.NodeConditionType = "WindowsCertificatesExpiring"
+	// ExpiringFraction is the fraction of a certificate's validity period remaining at which it is considered close to
+	// expiry. Kubelet rotates its certificates once 70-90% of their validity period has passed, so only certificates
+	// which have failed to rotate are reported.
+	ExpiringFraction = 0.1
+)
+
+// Names of the certificates tracked on each Windows instance
+const (
+	// KubeletClientCA is the CA bundle kubelet authenticates clients, such as the kube-apiserver, with
+	KubeletClientCA = "kubelet-client-ca"
+	// KubeletClient is the certificate kubelet authenticates with the kube-apiserver with
+	KubeletClient = "kubelet-client"
+	// KubeletServing is the certificate kubelet serves its API with
+	KubeletServing = "kubelet-serving"
+	// TrustedCABundle is the set of CAs supplied by the cluster administrator within the trusted CA bundle imported
+	// into the instance's system trust store
+	TrustedCABundle = "trusted-ca-bundle"
+	// WindowsExporterTLS is the certificate windows_exporter serves metrics with
+	WindowsExporterTLS = "windows-exporter-tls"
+)
+
+// Validity is the validity period of a certificate. For a CA bundle, it is that of the certificate which expires last,
+// and for a trust bundle, that of the certificate which expires first.
+type Validity struct {
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// Expiring returns true if the certificate has expired, or less than ExpiringFraction of its validity period remains
+// at the given time
+func (v Validity) Expiring(now time.Time) bool {
+	lifetime := v.NotAfter.Sub(v.NotBefore)
+	return v.NotAfter.Sub(now) < time.Duration(float64(lifetime)*ExpiringFraction)
+}
+
+// FromPEM returns the validity period of the first certificate within the given PEM data, which is the leaf
+// certificate when the data holds a certificate chain. Blocks other than certificates, such as the private key held
+// alongside kubelet's certificates, are ignored.
+func FromPEM(data []byte) (*Validity, error) {
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Validity{NotBefore: certs[0].NotBefore.UTC(), NotAfter: certs[0].NotAfter.UTC()}, nil
+}
+
+// BundleFromPEM returns the validity period of the certificate which expires last within the given PEM encoded CA
+// bundle. Bundles keep the previous CA alongside its replacement while a CA is rotated, so the bundle remains usable
+// until its newest CA expires.
+func BundleFromPEM(data []byte) (*Validity, error) {
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+	latest := certs[0]
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.After(latest.NotAfter) {
+			latest = cert
+		}
+	}
+	return &Validity{NotBefore: latest.NotBefore.UTC(), NotAfter: latest.NotAfter.UTC()}, nil
+}
+
+// TrustBundleFromPEM returns the validity period of the certificate which expires first within the given PEM encoded
+// trust bundle. Each CA within a trust bundle is trusted independently, so the bundle is only valid in full until its
+// first CA expires.
+func TrustBundleFromPEM(data []byte) (*Validity, error) {
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+	earliest := certs[0]
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(earliest.NotAfter) {
+			earliest = cert
+		}
+	}
+	return &Validity{NotBefore: earliest.NotBefore.UTC(), NotAfter: earliest.NotAfter.UTC()}, nil
+}
+
+// parseCertificates returns the certificates within the given PEM data, in order. An error is returned if there are
+// none.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+	return certs, nil
+}
+
+// Status maps the name of each certificate present on an instance to its validity period
+type Status map[string]Validity
+
+// GetStatus returns the certificate status recorded on the given node. An empty status is returned if none is
+// recorded.
+func GetStatus(node *core.Node) (Status, error) {
+	status := make(Status)
+	value, present := node.GetAnnotations()[Annotation]
+	if !present {
+		return status, nil
+	}
+	if err := json.Unmarshal([]byte(value), &status); err != nil {
+		return nil, fmt.Errorf("unable to parse %s annotation of node %s: %w", Annotation, node.GetName(), err)
+	}
+	return status, nil
+}
+
+// Marshal returns the status in the form recorded on nodes
+func (s Status) Marshal() (string, error) {
+	out, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// Expiring returns the names of the certificates which are close to expiry at the given time, sorted
+func (s Status) Expiring(now time.Time) []string {
+	var expiring []string
+	for name, validity := range s {
+		if validity.Expiring(now) {
+			expiring = append(expiring, name)
+		}
+	}
+	sort.Strings(expiring)
+	return expiring
+}
@@ -0,0 +1,140 @@
+package certexpiry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// generateCertPEM returns a PEM encoded self-signed certificate with the given validity period
+func generateCertPEM(t *testing.T, notBefore, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: notBefore, NotAfter: notAfter}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestFromPEM(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := generateCertPEM(t, start, start.Add(30*24*time.Hour))
+	second := generateCertPEM(t, start.Add(-time.Hour), start.Add(10*24*time.Hour))
+	key := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("key")})
+
+	firstValidity := &Validity{NotBefore: start, NotAfter: start.Add(30 * 24 * time.Hour)}
+	secondValidity := &Validity{NotBefore: start.Add(-time.Hour), NotAfter: start.Add(10 * 24 * time.Hour)}
+
+	testCases := []struct {
+		name           string
+		data           []byte
+		expected       *Validity
+		expectedBundle *Validity
+		expectedTrust  *Validity
+		expectedErr    bool
+	}{
+		{
+			name:           "single certificate",
+			data:           first,
+			expected:       firstValidity,
+			expectedBundle: firstValidity,
+			expectedTrust:  firstValidity,
+		},
+		{
+			name:           "certificate chain reports the leaf, bundle reports the certificate expiring last",
+			data:           append(append([]byte{}, second...), first...),
+			expected:       secondValidity,
+			expectedBundle: firstValidity,
+			expectedTrust:  secondValidity,
+		},
+		{
+			name:           "trust bundle reports the certificate expiring first",
+			data:           append(append([]byte{}, first...), second...),
+			expected:       firstValidity,
+			expectedBundle: firstValidity,
+			expectedTrust:  secondValidity,
+		},
+		{
+			name:           "private key is ignored",
+			data:           append(append([]byte{}, key...), first...),
+			expected:       firstValidity,
+			expectedBundle: firstValidity,
+			expectedTrust:  firstValidity,
+		},
+		{
+			name:        "no certificates",
+			data:        key,
+			expectedErr: true,
+		},
+		{
+			name:        "invalid certificate",
+			data:        pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("invalid")}),
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			validity, err := FromPEM(test.data)
+			bundleValidity, bundleErr := BundleFromPEM(test.data)
+			trustValidity, trustErr := TrustBundleFromPEM(test.data)
+			if test.expectedErr {
+				assert.Error(t, err)
+				assert.Error(t, bundleErr)
+				assert.Error(t, trustErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, bundleErr)
+			require.NoError(t, trustErr)
+			assert.Equal(t, test.expected, validity)
+			assert.Equal(t, test.expectedBundle, bundleValidity)
+			assert.Equal(t, test.expectedTrust, trustValidity)
+		})
+	}
+}
+
+func TestExpiring(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	status := Status{
+		KubeletClient:   {NotBefore: start, NotAfter: start.Add(30 * 24 * time.Hour)},
+		KubeletServing:  {NotBefore: start, NotAfter: start.Add(10 * 24 * time.Hour)},
+		KubeletClientCA: {NotBefore: start.Add(-365 * 24 * time.Hour), NotAfter: start.Add(3650 * 24 * time.Hour)},
+	}
+	assert.Empty(t, status.Expiring(start))
+	// 10% of the serving certificate's validity period remains
+	assert.Empty(t, status.Expiring(start.Add(9*24*time.Hour)))
+	assert.Equal(t, []string{KubeletServing}, status.Expiring(start.Add(9*24*time.Hour+time.Minute)))
+	assert.Equal(t, []string{KubeletClient, KubeletServing}, status.Expiring(start.Add(28*24*time.Hour)))
+	// expired certificates are reported
+	assert.Equal(t, []string{KubeletClient, KubeletServing}, status.Expiring(start.Add(60*24*time.Hour)))
+}
+
+func TestStatusRoundTrip(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	status := Status{WindowsExporterTLS: {NotBefore: start, NotAfter: start.Add(time.Hour)}}
+	value, err := status.Marshal()
+	require.NoError(t, err)
+
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node", Annotations: map[string]string{Annotation: value}}}
+	parsed, err := GetStatus(node)
+	require.NoError(t, err)
+	assert.Equal(t, status, parsed)
+
+	parsed, err = GetStatus(&core.Node{})
+	require.NoError(t, err)
+	assert.Empty(t, parsed)
+
+	node.Annotations[Annotation] = "invalid"
+	_, err = GetStatus(node)
+	assert.Error(t, err)
+}
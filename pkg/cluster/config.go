@@ -5,16 +5,20 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/apparentlymart/go-cidr/cidr"
 	oconfig "github.com/openshift/api/config/v1"
+	operator "github.com/openshift/api/operator/v1"
 	configclient "github.com/openshift/client-go/config/clientset/versioned"
 	operatorv1 "github.com/openshift/client-go/operator/clientset/versioned/typed/operator/v1"
 	"golang.org/x/mod/semver"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/rest"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
 )
 
 //+kubebuilder:rbac:groups=config.openshift.io,resources=infrastructures,verbs=get
@@ -27,6 +31,36 @@ const (
 	baseK8sVersion = "v1.32"
 	// MachineAPINamespace is the name of the namespace in which machine objects and userData secret is created.
 	MachineAPINamespace = "openshift-machine-api"
+	// NetworkBackendEnvVar is the name of the environment variable used to select the network backend of Windows
+	// nodes. The OVN-Kubernetes hybrid overlay is used when it is not set.
+	NetworkBackendEnvVar = "WINDOWS_NETWORK_BACKEND"
+	// RegistryCredentialProviderEnvVar is the name of the environment variable which, when set to true, has Windows
+	// nodes resolve registry credentials through the WICD credential provider rather than registry config headers
+	RegistryCredentialProviderEnvVar = "WINDOWS_REGISTRY_CREDENTIAL_PROVIDER"
+	// MachineCSRApprovalEnvVar is the name of the environment variable which, when set to true, has WMCO validate and
+	// approve the kubelet CSRs of Machine-backed Windows nodes, in addition to those of BYOH instances
+	MachineCSRApprovalEnvVar = "WINDOWS_MACHINE_CSR_APPROVAL"
+	// ServiceAccountsEnvVar is the name of the environment variable selecting the Windows accounts services run as in
+	// place of LocalSystem. Its value is a comma separated list of <service>=<account> pairs, the account being either
+	// VirtualServiceAccount or a group managed service account in the DOMAIN\name$ format.
+	ServiceAccountsEnvVar = "WINDOWS_SERVICE_ACCOUNTS"
+	// PodWebhookEnvVar is the name of the environment variable which, when set to true, has WMCO serve a mutating
+	// webhook steering Windows pods onto Windows nodes
+	PodWebhookEnvVar = "WINDOWS_POD_WEBHOOK"
+	// VirtualServiceAccount selects the virtual account of a service, NT SERVICE\<service>
+	VirtualServiceAccount = "virtual"
+)
+
+// NetworkBackend describes how pod networking is provided to Windows nodes
+type NetworkBackend string
+
+const (
+	// HybridOverlayBackend configures Windows nodes using the OVN-Kubernetes hybrid overlay, with WMCO installing
+	// hybrid-overlay-node, kube-proxy and the CNI plugins
+	HybridOverlayBackend NetworkBackend = "HybridOverlay"
+	// BYOCNIBackend leaves pod networking to the user. WMCO installs only kubelet and containerd, and copies the CNI
+	// plugins and configuration given in the windows-cni-config ConfigMap to each node.
+	BYOCNIBackend NetworkBackend = "BYOCNI"
 )
 
 var (
@@ -40,7 +74,8 @@ var (
 type Network interface {
 	Validate(context.Context) error
 	GetServiceCIDR() string
-	VXLANPort() string
+	// Backend returns the backend providing pod networking to Windows nodes
+	Backend() NetworkBackend
 }
 
 // Config interface contains methods to expose cluster config related information
@@ -164,8 +199,6 @@ func (c *config) Validate(ctx context.Context) error {
 type clusterNetworkCfg struct {
 	// serviceCIDR holds the value for cluster network service CIDR
 	serviceCIDR string
-	// vxlanPort is the port to be used for VXLAN communication
-	vxlanPort string
 }
 
 // ovnKubernetes contains information specific to network type OVNKubernetes
@@ -174,8 +207,18 @@ type ovnKubernetes struct {
 	clusterNetworkConfig *clusterNetworkCfg
 }
 
+// byoCNI contains information specific to Windows nodes whose pod networking is provided by the user
+type byoCNI struct {
+	clusterNetworkConfig *clusterNetworkCfg
+}
+
 // networkConfigurationFactory is a factory method that returns information specific to network type
 func networkConfigurationFactory(ctx context.Context, oclient configclient.Interface, operatorClient operatorv1.OperatorV1Interface) (Network, error) {
+	backend, err := GetNetworkBackend()
+	if err != nil {
+		return nil, err
+	}
+
 	network, err := getNetworkType(ctx, oclient)
 	if err != nil {
 		return nil, fmt.Errorf("error getting cluster network type: %w", err)
@@ -187,13 +230,16 @@ func networkConfigurationFactory(ctx context.Context, oclient configclient.Inter
 		return nil, fmt.Errorf("error getting service network CIDR: %w", err)
 	}
 
-	// retrieve the VXLAN port using cluster config
-	vxlanPort, err := getVXLANPort(ctx, operatorClient)
-	if err != nil {
-		return nil, fmt.Errorf("error getting the custom vxlan port: %w", err)
+	// The user provided CNI is responsible for all pod networking, regardless of the cluster network type
+	if backend == BYOCNIBackend {
+		clusterNetworkCfg, err := NewClusterNetworkCfg(serviceCIDR)
+		if err != nil {
+			return nil, fmt.Errorf("error getting cluster network config: %w", err)
+		}
+		return &byoCNI{clusterNetworkConfig: clusterNetworkCfg}, nil
 	}
 
-	clusterNetworkCfg, err := NewClusterNetworkCfg(serviceCIDR, vxlanPort)
+	clusterNetworkCfg, err := NewClusterNetworkCfg(serviceCIDR)
 	if err != nil {
 		return nil, fmt.Errorf("error getting cluster network config: %w", err)
 	}
@@ -212,14 +258,13 @@ func networkConfigurationFactory(ctx context.Context, oclient configclient.Inter
 }
 
 // NewClusterNetworkCfg assigns a serviceCIDR value and returns a pointer to the clusterNetworkCfg struct
-func NewClusterNetworkCfg(serviceCIDR, vxlanPort string) (*clusterNetworkCfg, error) {
+func NewClusterNetworkCfg(serviceCIDR string) (*clusterNetworkCfg, error) {
 	if serviceCIDR == "" {
 		return nil, fmt.Errorf("can't instantiate cluster network config" +
 			"with empty service CIDR value")
 	}
 	return &clusterNetworkCfg{
 		serviceCIDR: serviceCIDR,
-		vxlanPort:   vxlanPort,
 	}, nil
 }
 
@@ -228,9 +273,9 @@ func (ovn *ovnKubernetes) GetServiceCIDR() string {
 	return ovn.clusterNetworkConfig.serviceCIDR
 }
 
-// GetVXLANPort gets the VXLAN port to be used for VXLAN tunnel establishment
-func (ovn *ovnKubernetes) VXLANPort() string {
-	return ovn.clusterNetworkConfig.vxlanPort
+// Backend returns HybridOverlayBackend, as OVN-Kubernetes networking is extended to Windows nodes by hybrid overlay
+func (ovn *ovnKubernetes) Backend() NetworkBackend {
+	return HybridOverlayBackend
 }
 
 // Validate for OVN Kubernetes checks for network type and hybrid overlay.
@@ -252,6 +297,94 @@ func (ovn *ovnKubernetes) Validate(ctx context.Context) error {
 	return nil
 }
 
+// GetServiceCIDR returns the serviceCIDR string
+func (b *byoCNI) GetServiceCIDR() string {
+	return b.clusterNetworkConfig.serviceCIDR
+}
+
+// Backend returns BYOCNIBackend
+func (b *byoCNI) Backend() NetworkBackend {
+	return BYOCNIBackend
+}
+
+// Validate is a no-op for a user provided CNI. The CNI configuration is validated when it is applied to a node, as it
+// can be changed at any time.
+func (b *byoCNI) Validate(_ context.Context) error {
+	return nil
+}
+
+// GetNetworkBackend returns the network backend selected through the WMCO container's environment, defaulting to
+// HybridOverlayBackend
+func GetNetworkBackend() (NetworkBackend, error) {
+	value, found := os.LookupEnv(NetworkBackendEnvVar)
+	if !found || value == "" {
+		return HybridOverlayBackend, nil
+	}
+	for _, backend := range []NetworkBackend{HybridOverlayBackend, BYOCNIBackend} {
+		if strings.EqualFold(value, string(backend)) {
+			return backend, nil
+		}
+	}
+	return "", fmt.Errorf("invalid %s value %s, expected one of %s or %s", NetworkBackendEnvVar, value,
+		HybridOverlayBackend, BYOCNIBackend)
+}
+
+// RegistryCredentialProviderEnabled returns true if registry credentials are to be served to kubelet by the WICD
+// credential provider, as selected through the WMCO container's environment
+func RegistryCredentialProviderEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv(RegistryCredentialProviderEnvVar))
+	return err == nil && enabled
+}
+
+// MachineCSRApprovalEnabled returns true if WMCO is to approve the kubelet CSRs of Machine-backed Windows nodes, as
+// selected through the WMCO container's environment
+func MachineCSRApprovalEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv(MachineCSRApprovalEnvVar))
+	return err == nil && enabled
+}
+
+// PodWebhookEnabled returns true if Windows pods are to be steered onto Windows nodes by the pod mutating webhook, as
+// selected through the WMCO container's environment
+func PodWebhookEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv(PodWebhookEnvVar))
+	return err == nil && enabled
+}
+
+// GetServiceAccounts returns the names of the Windows accounts services are to run as, keyed by service name, as
+// selected through the WMCO container's environment. Only the given services may be listed, all other services run as
+// LocalSystem.
+func GetServiceAccounts(configurable []string) (map[string]string, error) {
+	accounts := make(map[string]string)
+	value := strings.TrimSpace(os.Getenv(ServiceAccountsEnvVar))
+	if value == "" {
+		return accounts, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		service, account, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || service == "" || account == "" {
+			return nil, fmt.Errorf("invalid %s entry %q, expected <service>=<account>", ServiceAccountsEnvVar, pair)
+		}
+		if !slices.Contains(configurable, service) {
+			return nil, fmt.Errorf("invalid %s entry %q, the account of only %s can be set", ServiceAccountsEnvVar,
+				pair, strings.Join(configurable, ", "))
+		}
+		if _, present := accounts[service]; present {
+			return nil, fmt.Errorf("invalid %s value, service %s is listed more than once", ServiceAccountsEnvVar,
+				service)
+		}
+		switch {
+		case account == VirtualServiceAccount:
+			accounts[service] = servicescm.VirtualAccount(service)
+		case servicescm.IsGroupManagedServiceAccount(account):
+			accounts[service] = account
+		default:
+			return nil, fmt.Errorf("invalid %s entry %q, expected the account to be %s or a group managed service "+
+				"account in the DOMAIN\\name$ format", ServiceAccountsEnvVar, pair, VirtualServiceAccount)
+		}
+	}
+	return accounts, nil
+}
+
 // getNetworkType returns network type of the cluster
 func getNetworkType(ctx context.Context, oclient configclient.Interface) (string, error) {
 	// Get the cluster network object so that we can find the network type
@@ -269,6 +402,11 @@ func getServiceNetworkCIDR(ctx context.Context, oclient configclient.Interface)
 	if err != nil {
 		return "", fmt.Errorf("error getting cluster network object: %w", err)
 	}
+	return GetServiceCIDR(networkCR)
+}
+
+// GetServiceCIDR returns the validated service CIDR from the given cluster network config
+func GetServiceCIDR(networkCR *oconfig.Network) (string, error) {
 	if len(networkCR.Spec.ServiceNetwork) == 0 {
 		return "", fmt.Errorf("error getting cluster service CIDR," + "received empty value for service networks")
 	}
@@ -279,22 +417,55 @@ func getServiceNetworkCIDR(ctx context.Context, oclient configclient.Interface)
 	return serviceCIDR, nil
 }
 
-// getVXLANPort gets the VXLAN port to establish tunnel as a string. The return type doesn't matter as we want to pass
-// this argument to a powershell command
-func getVXLANPort(ctx context.Context, operatorClient operatorv1.OperatorV1Interface) (string, error) {
-	// Get the cluster network object so that we can find the service network
-	networkCR, err := operatorClient.Networks().Get(ctx, "cluster", meta.GetOptions{})
-	if err != nil {
-		return "", fmt.Errorf("error getting cluster network object: %w", err)
+// GetClusterNetworks returns the pod and service networks of the given cluster network config
+func GetClusterNetworks(networkCR *oconfig.Network) ([]*net.IPNet, error) {
+	cidrs := slices.Clone(networkCR.Spec.ServiceNetwork)
+	for _, entry := range networkCR.Spec.ClusterNetwork {
+		cidrs = append(cidrs, entry.CIDR)
+	}
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cluster network CIDR: %w", err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+const (
+	// geneveOverhead is the encapsulation overhead OVN-Kubernetes subtracts from the host MTU to get its network MTU
+	geneveOverhead = 100
+	// vxlanOverhead is the encapsulation overhead of the VXLAN tunnels of the hybrid overlay
+	vxlanOverhead = 50
+)
+
+// HybridOverlayConfig holds the settings of the hybrid overlay network extended to Windows nodes. Empty values
+// indicate the hybrid overlay default should be used.
+type HybridOverlayConfig struct {
+	// VXLANPort is the port to be used for VXLAN communication
+	VXLANPort string
+	// MTU is the MTU of the hybrid overlay network
+	MTU string
+}
+
+// GetHybridOverlayConfig returns the hybrid overlay settings given by the cluster network operator configuration.
+// The MTU of the OVN-Kubernetes network is derived from the host MTU by subtracting the Geneve overhead, so the hybrid
+// overlay MTU is derived from it by swapping that overhead for the smaller VXLAN overhead.
+func GetHybridOverlayConfig(networkCR *operator.Network) HybridOverlayConfig {
+	var hybridOverlay HybridOverlayConfig
+	if networkCR == nil || networkCR.Spec.DefaultNetwork.OVNKubernetesConfig == nil {
+		return hybridOverlay
+	}
+	ovnConfig := networkCR.Spec.DefaultNetwork.OVNKubernetesConfig
+	if ovnConfig.MTU != nil {
+		hybridOverlay.MTU = fmt.Sprint(*ovnConfig.MTU + geneveOverhead - vxlanOverhead)
 	}
-	var vxlanPort *uint32
-	if networkCR.Spec.DefaultNetwork.OVNKubernetesConfig != nil &&
-		networkCR.Spec.DefaultNetwork.OVNKubernetesConfig.HybridOverlayConfig != nil &&
-		networkCR.Spec.DefaultNetwork.OVNKubernetesConfig.HybridOverlayConfig.HybridOverlayVXLANPort != nil {
-		vxlanPort = networkCR.Spec.DefaultNetwork.OVNKubernetesConfig.HybridOverlayConfig.HybridOverlayVXLANPort
-		return fmt.Sprint(*vxlanPort), nil
+	if ovnConfig.HybridOverlayConfig != nil && ovnConfig.HybridOverlayConfig.HybridOverlayVXLANPort != nil {
+		hybridOverlay.VXLANPort = fmt.Sprint(*ovnConfig.HybridOverlayConfig.HybridOverlayVXLANPort)
 	}
-	return "", nil
+	return hybridOverlay
 }
 
 // ValidateCIDR uses the parseCIDR from network package to validate the format of the CIDR
@@ -51,6 +51,86 @@ func TestNetworkConfigurationFactory(t *testing.T) {
 	}
 }
 
+// TestNetworkConfigurationFactoryBYOCNI tests that a user provided CNI is used for any cluster network type when
+// selected through the environment
+func TestNetworkConfigurationFactoryBYOCNI(t *testing.T) {
+	t.Setenv(NetworkBackendEnvVar, string(BYOCNIBackend))
+	for _, networkType := range []string{"OVNKubernetes", "Calico"} {
+		t.Run(networkType, func(t *testing.T) {
+			fakeConfigClient, fakeOperatorClient := createFakeClients(networkType)
+			network, err := networkConfigurationFactory(context.Background(), fakeConfigClient, fakeOperatorClient)
+			require.NoError(t, err)
+			assert.Equal(t, BYOCNIBackend, network.Backend())
+			assert.Equal(t, "172.30.0.0/16", network.GetServiceCIDR())
+			assert.NoError(t, network.Validate(context.Background()))
+		})
+	}
+}
+
+// TestGetNetworkBackend tests that the network backend is correctly read from the environment
+func TestGetNetworkBackend(t *testing.T) {
+	var tests = []struct {
+		name     string
+		value    string
+		expected NetworkBackend
+		wantErr  bool
+	}{
+		{"unset", "", HybridOverlayBackend, false},
+		{"hybrid overlay", "HybridOverlay", HybridOverlayBackend, false},
+		{"bring your own CNI", "byocni", BYOCNIBackend, false},
+		{"invalid", "Flannel", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(NetworkBackendEnvVar, tt.value)
+			backend, err := GetNetworkBackend()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, backend)
+		})
+	}
+}
+
+// TestGetServiceAccounts tests that the service accounts are correctly read from the environment
+func TestGetServiceAccounts(t *testing.T) {
+	configurable := []string{"windows_exporter", "windows-instance-config-daemon"}
+	var tests = []struct {
+		name     string
+		value    string
+		expected map[string]string
+		wantErr  bool
+	}{
+		{"unset", "", map[string]string{}, false},
+		{"virtual account", "windows_exporter=virtual", map[string]string{"windows_exporter": "NT SERVICE\\windows_exporter"},
+			false},
+		{"multiple accounts", " windows_exporter=virtual, windows-instance-config-daemon=CONTOSO\\wicd$",
+			map[string]string{"windows_exporter": "NT SERVICE\\windows_exporter",
+				"windows-instance-config-daemon": "CONTOSO\\wicd$"}, false},
+		{"missing account", "windows_exporter=", nil, true},
+		{"missing separator", "windows_exporter", nil, true},
+		{"unsupported service", "kubelet=virtual", nil, true},
+		{"duplicate service", "windows_exporter=virtual,windows_exporter=CONTOSO\\exporter$", nil, true},
+		{"gMSA without trailing $", "windows_exporter=CONTOSO\\exporter", nil, true},
+		{"gMSA name too long", "windows_exporter=CONTOSO\\windowsexporter1$", nil, true},
+		{"local account", "windows_exporter=Administrator", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ServiceAccountsEnvVar, tt.value)
+			accounts, err := GetServiceAccounts(configurable)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, accounts)
+		})
+	}
+}
+
 // TestNetworkConfigurationValidate tests if validate() method throws error when network is of required type, but network configuration
 // cannot be validated
 func TestNetworkConfigurationValidate(t *testing.T) {
@@ -148,43 +228,51 @@ func TestIsValidKubernetesVersion(t *testing.T) {
 	}
 }
 
-// TestGetVXLANPort checks if the custom VXLAN port is available in the network object
-func TestGetVXLANPort(t *testing.T) {
+// TestGetHybridOverlayConfig checks that the hybrid overlay settings are read from the network operator configuration
+func TestGetHybridOverlayConfig(t *testing.T) {
+	port := uint32(4800)
+	mtu := uint32(1400)
 	tests := []struct {
-		name         string
-		want         string
-		networkPatch []byte
-		wantErr      bool
+		name     string
+		network  *operatorv1.Network
+		expected HybridOverlayConfig
 	}{
 		{
-			name: "custom VXLAN",
-			want: "4800",
-			networkPatch: []byte(`{"spec":{"defaultNetwork":{"ovnKubernetesConfig":{"hybridOverlayConfig": ` +
-				`{"hybridClusterNetwork":[{"cidr":"10.132.0.0/14","hostPrefix":23}],"` +
-				`hybridOverlayVXLANPort": 4800}}}}}`),
-			wantErr: false,
+			name:     "nil network",
+			network:  nil,
+			expected: HybridOverlayConfig{},
 		},
 		{
-			name: "no vxlan - expect an empty string",
-			want: "",
-			networkPatch: []byte(`{"spec":{"defaultNetwork":{"ovnKubernetesConfig":{"hybridOverlayConfig":` +
-				`{"hybridClusterNetwork":[{"cidr":"10.132.0.0/14","hostPrefix":23}]}}}}}`),
-			wantErr: false,
+			name:     "no OVN-Kubernetes configuration",
+			network:  &operatorv1.Network{},
+			expected: HybridOverlayConfig{},
+		},
+		{
+			name: "MTU and VXLAN port",
+			network: &operatorv1.Network{Spec: operatorv1.NetworkSpec{DefaultNetwork: operatorv1.DefaultNetworkDefinition{
+				OVNKubernetesConfig: &operatorv1.OVNKubernetesConfig{
+					MTU: &mtu,
+					HybridOverlayConfig: &operatorv1.HybridOverlayConfig{
+						HybridOverlayVXLANPort: &port,
+					},
+				},
+			}}},
+			expected: HybridOverlayConfig{VXLANPort: "4800", MTU: "1450"},
+		},
+		{
+			name: "MTU only",
+			network: &operatorv1.Network{Spec: operatorv1.NetworkSpec{DefaultNetwork: operatorv1.DefaultNetworkDefinition{
+				OVNKubernetesConfig: &operatorv1.OVNKubernetesConfig{
+					MTU:                 &mtu,
+					HybridOverlayConfig: &operatorv1.HybridOverlayConfig{},
+				},
+			}}},
+			expected: HybridOverlayConfig{MTU: "1450"},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, fakeOperatorClient := createFakeClients("OVNKubernetes")
-			if tt.networkPatch != nil {
-				_, err := fakeOperatorClient.Networks().Patch(context.Background(), "cluster", k8stypes.MergePatchType, tt.networkPatch, meta.PatchOptions{})
-				require.Nil(t, err, "network patch should not throw error")
-			}
-			got, err := getVXLANPort(context.Background(), fakeOperatorClient)
-			require.NoError(t, err)
-			if (err != nil) != tt.wantErr {
-				assert.Errorf(t, err, "getVXLANPort() error = %v, wantErr %v", err, tt.wantErr)
-			}
-			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.expected, GetHybridOverlayConfig(tt.network))
 		})
 	}
 }
@@ -235,3 +323,19 @@ func TestGetDNS(t *testing.T) {
 		})
 	}
 }
+
+func TestGetClusterNetworks(t *testing.T) {
+	networkCR := &oconfig.Network{Spec: oconfig.NetworkSpec{
+		ServiceNetwork: []string{"172.30.0.0/16"},
+		ClusterNetwork: []oconfig.ClusterNetworkEntry{{CIDR: "10.128.0.0/14", HostPrefix: 23}},
+	}}
+	networks, err := GetClusterNetworks(networkCR)
+	require.NoError(t, err)
+	require.Len(t, networks, 2)
+	assert.Equal(t, "172.30.0.0/16", networks[0].String())
+	assert.Equal(t, "10.128.0.0/14", networks[1].String())
+
+	networkCR.Spec.ClusterNetwork[0].CIDR = "10.128.0.0"
+	_, err = GetClusterNetworks(networkCR)
+	assert.Error(t, err)
+}
@@ -0,0 +1,119 @@
+package cni
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+)
+
+const (
+	// ConfigMapName is the name of the ConfigMap in the WMCO namespace which holds the CNI plugins and configuration
+	// to be copied to Windows nodes when the user provides the CNI
+	ConfigMapName = "windows-cni-config"
+	// HNSNetworksKey is the ConfigMap data key listing the HNS networks created by the user provided CNI, one per line.
+	// These networks are removed when a node is deconfigured.
+	HNSNetworksKey = "hnsNetworks"
+	// HNSNetworksAnnotation is applied to nodes configured with a user provided CNI, and lists the HNS networks the CNI
+	// was configured with, so that they can be removed even if the ConfigMap has since been deleted or broken
+	HNSNetworksAnnotation = "windowsmachineconfig.openshift.io/hns-networks"
+	// pluginSuffix is the file extension expected of CNI plugin binaries
+	pluginSuffix = ".exe"
+)
+
+var (
+	// configSuffixes are the file extensions of CNI network configuration files that are recognized by containerd
+	configSuffixes = []string{".conf", ".conflist", ".json"}
+)
+
+// Config is the user provided CNI configuration to be applied to Windows nodes
+type Config struct {
+	// Plugins maps CNI plugin binary file names to their contents
+	Plugins map[string][]byte
+	// NetworkConfigs maps CNI network configuration file names to their contents
+	NetworkConfigs map[string][]byte
+	// HNSNetworks are the names of the HNS networks created by the CNI
+	HNSNetworks []string
+}
+
+// Parse returns the CNI configuration held by the given ConfigMap. CNI network configuration files are given as
+// data entries, and CNI plugins as binaryData entries. Returns an error if the ConfigMap contains unrecognized entries
+// or does not contain any network configuration.
+func Parse(cm *core.ConfigMap) (*Config, error) {
+	if cm == nil {
+		return nil, fmt.Errorf("%s ConfigMap cannot be nil", ConfigMapName)
+	}
+	cfg := &Config{
+		Plugins:        make(map[string][]byte),
+		NetworkConfigs: make(map[string][]byte),
+	}
+	for key, value := range cm.Data {
+		if key == HNSNetworksKey {
+			networks, err := parseHNSNetworks(value)
+			if err != nil {
+				return nil, err
+			}
+			cfg.HNSNetworks = networks
+			continue
+		}
+		if !isNetworkConfig(key) {
+			return nil, fmt.Errorf("unexpected data key %s, expected %s or a file with one of the extensions %s",
+				key, HNSNetworksKey, strings.Join(configSuffixes, ", "))
+		}
+		if !json.Valid([]byte(value)) {
+			return nil, fmt.Errorf("CNI network configuration %s is not valid JSON", key)
+		}
+		cfg.NetworkConfigs[key] = []byte(value)
+	}
+	for key, value := range cm.BinaryData {
+		if !strings.HasSuffix(key, pluginSuffix) {
+			return nil, fmt.Errorf("unexpected binaryData key %s, CNI plugins must have the %s extension", key,
+				pluginSuffix)
+		}
+		cfg.Plugins[key] = value
+	}
+	if len(cfg.NetworkConfigs) == 0 {
+		return nil, fmt.Errorf("%s ConfigMap does not contain any CNI network configuration", ConfigMapName)
+	}
+	return cfg, nil
+}
+
+// isNetworkConfig returns true if the given file name has the extension of a CNI network configuration file
+func isNetworkConfig(fileName string) bool {
+	for _, suffix := range configSuffixes {
+		if strings.HasSuffix(fileName, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHNSNetworks returns the HNS network names listed in the given value, ignoring empty lines
+func parseHNSNetworks(value string) ([]string, error) {
+	var networks []string
+	for _, line := range strings.Split(value, "\n") {
+		name := strings.TrimSpace(line)
+		if name == "" {
+			continue
+		}
+		if err := servicescm.ValidateHNSNetworkName(name); err != nil {
+			return nil, err
+		}
+		networks = append(networks, name)
+	}
+	return networks, nil
+}
+
+// HNSNetworksAnnotationValue returns the value of the HNSNetworksAnnotation recording the given HNS networks
+func HNSNetworksAnnotationValue(networks []string) string {
+	return strings.Join(networks, ",")
+}
+
+// ParseHNSNetworksAnnotation returns the HNS networks recorded by the given HNSNetworksAnnotation value
+func ParseHNSNetworksAnnotation(value string) ([]string, error) {
+	// Commas cannot be part of network names, so they can be handled as line breaks
+	return parseHNSNetworks(strings.ReplaceAll(value, ",", "\n"))
+}
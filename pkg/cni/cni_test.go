@@ -0,0 +1,101 @@
+package cni
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name                string
+		data                map[string]string
+		binaryData          map[string][]byte
+		expectedConfigs     []string
+		expectedPlugins     []string
+		expectedHNSNetworks []string
+		expectedErr         bool
+	}{
+		{
+			name: "configuration and plugins",
+			data: map[string]string{
+				"10-calico.conflist": `{"name":"calico","cniVersion":"0.3.1","plugins":[{"type":"calico"}]}`,
+				HNSNetworksKey:       "Calico\r\n\nvxlan0\n",
+			},
+			binaryData:          map[string][]byte{"calico.exe": []byte("binary"), "calico-ipam.exe": []byte("binary")},
+			expectedConfigs:     []string{"10-calico.conflist"},
+			expectedPlugins:     []string{"calico.exe", "calico-ipam.exe"},
+			expectedHNSNetworks: []string{"Calico", "vxlan0"},
+		},
+		{
+			name:            "configuration only",
+			data:            map[string]string{"cni.conf": `{"name":"custom","type":"win-bridge"}`},
+			expectedConfigs: []string{"cni.conf"},
+		},
+		{
+			name:        "no network configuration",
+			binaryData:  map[string][]byte{"calico.exe": []byte("binary")},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid JSON",
+			data:        map[string]string{"cni.conf": `{"name":`},
+			expectedErr: true,
+		},
+		{
+			name:        "unrecognized data key",
+			data:        map[string]string{"cni.conf": `{}`, "install.ps1": "Write-Host"},
+			expectedErr: true,
+		},
+		{
+			name:        "plugin without exe extension",
+			data:        map[string]string{"cni.conf": `{}`},
+			binaryData:  map[string][]byte{"calico": []byte("binary")},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid HNS network name",
+			data:        map[string]string{"cni.conf": `{}`, HNSNetworksKey: "Calico'; Remove-Item C:\\"},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := Parse(&core.ConfigMap{Data: test.data, BinaryData: test.binaryData})
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			var configs, plugins []string
+			for name := range cfg.NetworkConfigs {
+				configs = append(configs, name)
+			}
+			for name := range cfg.Plugins {
+				plugins = append(plugins, name)
+			}
+			assert.ElementsMatch(t, test.expectedConfigs, configs)
+			assert.ElementsMatch(t, test.expectedPlugins, plugins)
+			assert.Equal(t, test.expectedHNSNetworks, cfg.HNSNetworks)
+		})
+	}
+
+	_, err := Parse(nil)
+	assert.Error(t, err)
+}
+
+func TestHNSNetworksAnnotation(t *testing.T) {
+	networks := []string{"Calico", "External Network"}
+	parsed, err := ParseHNSNetworksAnnotation(HNSNetworksAnnotationValue(networks))
+	require.NoError(t, err)
+	assert.Equal(t, networks, parsed)
+
+	parsed, err = ParseHNSNetworksAnnotation(HNSNetworksAnnotationValue(nil))
+	require.NoError(t, err)
+	assert.Empty(t, parsed)
+
+	_, err = ParseHNSNetworksAnnotation("Calico,'; Remove-Item C:\\")
+	assert.Error(t, err)
+}
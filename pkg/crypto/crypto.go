@@ -18,20 +18,11 @@ const (
 	endTag     = "-----END " + tag + "-----"
 )
 
-// EncryptToJSONString returns the encrypted JSON text value of the given string
-func EncryptToJSONString(plaintext string, key []byte) (string, error) {
-	encryptedData, err := encrypt(plaintext, key)
-	if err != nil {
-		return "", err
-	}
-	// Make encrypted string compatible as JSON Patch request body. Encryption introduces line breaks to the data,
-	// so the newline characters are marked with text placeholder in order to be easily reversed during decryption
-	return strings.Replace(encryptedData, "\n", wmcoMarker, -1), nil
-}
-
-// DecryptFromJSONString returns the plaintext string value of encrypted JSON text
+// DecryptFromJSONString returns the plaintext string value of JSON text encrypted in the legacy PGP format, in which
+// values were encrypted directly with the given key by previous WMCO versions
 func DecryptFromJSONString(encryptedData string, key []byte) (string, error) {
-	// Convert data from JSON compatible representation to string value
+	// Encryption introduced line breaks to the data, which were marked with a text placeholder to make the encrypted
+	// string compatible as a JSON Patch request body. Convert data from JSON compatible representation to string value
 	encryptedData = strings.Replace(encryptedData, wmcoMarker, "\n", -1)
 	return decrypt(encryptedData, key)
 }
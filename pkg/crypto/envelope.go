@@ -0,0 +1,135 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// envelopePrefix identifies values encrypted by a Keyring, as opposed to values in the legacy PGP format
+	envelopePrefix = "enc:v1:"
+	// MinKeySize is the minimum size, in bytes, of the key material of a Keyring key
+	MinKeySize = 32
+	// hkdfInfo binds the keys derived from the key material to their use
+	hkdfInfo = "windows-machine-config-operator annotation encryption "
+)
+
+// Keyring encrypts values with AES-256-GCM, using keys derived through HKDF from versioned key material. Encrypted
+// values are self-describing envelopes of the form enc:v1:<key ID>:<base64 nonce and ciphertext>, so values encrypted
+// with any key of the keyring can be decrypted, while new values are always encrypted with the active key.
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+}
+
+// NewKeyring returns a Keyring holding the given key material by key ID, which encrypts with the key of the given ID
+func NewKeyring(activeID string, keys map[string][]byte) (*Keyring, error) {
+	if _, present := keys[activeID]; !present {
+		return nil, fmt.Errorf("active key %q not found", activeID)
+	}
+	derived := make(map[string][]byte, len(keys))
+	for id, material := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key ID %q", id)
+		}
+		if len(material) < MinKeySize {
+			return nil, fmt.Errorf("key %q must be at least %d bytes", id, MinKeySize)
+		}
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, material, nil, []byte(hkdfInfo+id)), key); err != nil {
+			return nil, fmt.Errorf("unable to derive key %q: %w", id, err)
+		}
+		derived[id] = key
+	}
+	return &Keyring{activeID: activeID, keys: derived}, nil
+}
+
+// ActiveKeyID returns the ID of the key new values are encrypted with
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// Encrypt returns the envelope of the given plaintext, encrypted with the active key. The envelope can be used as a
+// JSON string as is.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	aead, err := newAEAD(k.keys[k.activeID])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("unable to generate nonce: %w", err)
+	}
+	header := envelopePrefix + k.activeID
+	// The header is authenticated, preventing the envelope from being attributed to a different key
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(header))
+	return header + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of the given envelope. Values in the legacy PGP format are decrypted using the given
+// legacy key.
+func (k *Keyring) Decrypt(value string, legacyKey []byte) (string, error) {
+	if IsLegacy(value) {
+		return DecryptFromJSONString(value, legacyKey)
+	}
+	id, _ := KeyID(value)
+	key, present := k.keys[id]
+	if !present {
+		return "", fmt.Errorf("value was encrypted with unknown key %q", id)
+	}
+	header := envelopePrefix + id
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, header+":"))
+	if err != nil {
+		return "", fmt.Errorf("unable to decode encrypted value: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("encrypted value is too short")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(header))
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt value using key %q: %w", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsReencryption returns true if the given value is not encrypted with the active key
+func (k *Keyring) NeedsReencryption(value string) bool {
+	id, ok := KeyID(value)
+	return !ok || id != k.activeID
+}
+
+// KeyID returns the ID of the key the given value was encrypted with, and false if the value is in the legacy format
+func KeyID(value string) (string, bool) {
+	if IsLegacy(value) {
+		return "", false
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, envelopePrefix), ":")
+	return id, true
+}
+
+// IsLegacy returns true if the given value is in the legacy PGP format, which is encrypted directly with the private
+// key used to access Windows instances
+func IsLegacy(value string) bool {
+	return !strings.HasPrefix(value, envelopePrefix)
+}
+
+// newAEAD returns the AES-GCM cipher for the given key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
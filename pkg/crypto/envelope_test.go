@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKeyring(t *testing.T) {
+	key := bytes.Repeat([]byte("a"), MinKeySize)
+
+	_, err := NewKeyring("v1", map[string][]byte{"v1": key})
+	assert.NoError(t, err)
+	_, err = NewKeyring("v2", map[string][]byte{"v1": key})
+	assert.Error(t, err, "missing active key")
+	_, err = NewKeyring("v1", map[string][]byte{"v1": key[:MinKeySize-1]})
+	assert.Error(t, err, "short key")
+	_, err = NewKeyring("v:1", map[string][]byte{"v:1": key})
+	assert.Error(t, err, "invalid key ID")
+}
+
+func TestKeyringEncryptDecrypt(t *testing.T) {
+	v1 := bytes.Repeat([]byte("a"), MinKeySize)
+	v2 := bytes.Repeat([]byte("b"), MinKeySize)
+	previous, err := NewKeyring("v1", map[string][]byte{"v1": v1})
+	require.NoError(t, err)
+	current, err := NewKeyring("v2", map[string][]byte{"v1": v1, "v2": v2})
+	require.NoError(t, err)
+	pruned, err := NewKeyring("v2", map[string][]byte{"v2": v2})
+	require.NoError(t, err)
+
+	for _, plaintext := range []string{"Administrator", ""} {
+		envelope, err := previous.Encrypt(plaintext)
+		require.NoError(t, err)
+		assert.False(t, strings.ContainsAny(envelope, "\n\""))
+		id, ok := KeyID(envelope)
+		assert.True(t, ok)
+		assert.Equal(t, "v1", id)
+		assert.False(t, previous.NeedsReencryption(envelope))
+		assert.True(t, current.NeedsReencryption(envelope))
+
+		// values encrypted with previous keys remain readable
+		out, err := current.Decrypt(envelope, nil)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, out)
+		_, err = pruned.Decrypt(envelope, nil)
+		assert.Error(t, err)
+
+		envelope, err = current.Encrypt(plaintext)
+		require.NoError(t, err)
+		assert.False(t, current.NeedsReencryption(envelope))
+		out, err = pruned.Decrypt(envelope, nil)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, out)
+	}
+}
+
+func TestKeyringDecryptTampered(t *testing.T) {
+	keyring, err := NewKeyring("v1", map[string][]byte{"v1": bytes.Repeat([]byte("a"), MinKeySize),
+		"v2": bytes.Repeat([]byte("b"), MinKeySize)})
+	require.NoError(t, err)
+	envelope, err := keyring.Encrypt("Administrator")
+	require.NoError(t, err)
+
+	for name, value := range map[string]string{
+		"different key ID": strings.Replace(envelope, "enc:v1:v1:", "enc:v1:v2:", 1),
+		"unknown key ID":   strings.Replace(envelope, "enc:v1:v1:", "enc:v1:v3:", 1),
+		"truncated":        envelope[:len(envelope)-4],
+		"not base64":       "enc:v1:v1:!!!",
+		"too short":        "enc:v1:v1:AAAA",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := keyring.Decrypt(value, nil)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestKeyringDecryptLegacy(t *testing.T) {
+	legacyKey, err := generatePrivateKey()
+	require.NoError(t, err)
+	keyring, err := NewKeyring("v1", map[string][]byte{"v1": bytes.Repeat([]byte("a"), MinKeySize)})
+	require.NoError(t, err)
+
+	encrypted, err := encrypt("Administrator", legacyKey)
+	require.NoError(t, err)
+	legacy := strings.Replace(encrypted, "\n", wmcoMarker, -1)
+	assert.True(t, IsLegacy(legacy))
+	assert.True(t, keyring.NeedsReencryption(legacy))
+	_, ok := KeyID(legacy)
+	assert.False(t, ok)
+
+	out, err := keyring.Decrypt(legacy, legacyKey)
+	require.NoError(t, err)
+	assert.Equal(t, "Administrator", out)
+}
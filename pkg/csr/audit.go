@@ -0,0 +1,195 @@
+package csr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	k8sretry "k8s.io/client-go/util/retry"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/metrics"
+)
+
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;update
+
+const (
+	// HistoryConfigMap is the name of the ConfigMap in the WMCO namespace holding the most recent CSR decisions
+	HistoryConfigMap = "windows-csr-decisions"
+	// HistoryKey is the HistoryConfigMap data key holding the decisions, as a JSON list ordered from oldest to newest
+	HistoryKey = "decisions"
+	// MaxHistory is the number of decisions kept in the HistoryConfigMap
+	MaxHistory = 100
+)
+
+// Outcome is the result of WMCO's evaluation of a CSR
+type Outcome string
+
+const (
+	// Approved CSRs are from a Windows instance and were approved by WMCO
+	Approved Outcome = "approved"
+	// Rejected CSRs claim to be from a Windows instance, but do not match its identity, and were denied by WMCO
+	Rejected Outcome = "rejected"
+	// Ignored CSRs are not from a Windows instance, and were left for other approvers
+	Ignored Outcome = "ignored"
+	// Failed CSRs could not be validated, and were left pending to be evaluated again
+	Failed Outcome = "failed"
+)
+
+// Methods through which a CSR's node name is matched to a Windows instance
+const (
+	// DNSMethod matches the node name against the address of a BYOH instance, or the reverse lookup of its IP address
+	DNSMethod = "dns"
+	// HostnameMethod matches the node name against the host name reported by a BYOH instance over SSH
+	HostnameMethod = "hostname"
+	// MachineMethod matches the node name against the node or addresses of a Windows Machine
+	MachineMethod = "machine"
+)
+
+// Decision records the evaluation of a CSR by WMCO
+type Decision struct {
+	// CSR is the name of the CSR
+	CSR string `json:"csr"`
+	// Time is when the decision was made
+	Time meta.Time `json:"time"`
+	// NodeName is the node name the CSR was requested for
+	NodeName string `json:"nodeName,omitempty"`
+	// Outcome is the result of the evaluation
+	Outcome Outcome `json:"outcome"`
+	// Reason explains the outcome
+	Reason string `json:"reason"`
+	// Instance identifies the Windows instance the CSR was matched to: the address of a BYOH instance, or the name of
+	// a Machine
+	Instance string `json:"instance,omitempty"`
+	// Method is the method through which the CSR was matched to the instance
+	Method string `json:"method,omitempty"`
+	// Attempts is the number of consecutive times the CSR failed to be validated, for a Failed decision
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// recordDecision records the given decision about the CSR being approved as an event on the CSR, in the CSR decision
+// metrics, and in the decision history. Failing to update the history does not affect the decision, so it is only
+// logged. Ignored CSRs, which include every CSR of the cluster's Linux nodes, are only counted in the metrics.
+func (a *Approver) recordDecision(ctx context.Context, outcome Outcome, reason string) {
+	if outcome == Ignored {
+		metrics.CSRDecisions.WithLabelValues(string(outcome), a.validationMethod).Inc()
+		a.log.V(1).Info("CSR ignored", "CSR", a.csr.GetName(), "reason", reason, "node", a.nodeName)
+		return
+	}
+
+	decision := Decision{
+		CSR:      a.csr.GetName(),
+		Time:     meta.Now(),
+		NodeName: a.nodeName,
+		Outcome:  outcome,
+		Reason:   reason,
+		Instance: a.matchedInstance,
+		Method:   a.validationMethod,
+	}
+
+	eventType := core.EventTypeNormal
+	if outcome == Rejected || outcome == Failed {
+		eventType = core.EventTypeWarning
+	}
+	message := fmt.Sprintf("CSR %s %s: %s", decision.CSR, outcome, reason)
+	if decision.Instance != "" {
+		message += fmt.Sprintf(" (instance %s, matched by %s)", decision.Instance, decision.Method)
+	}
+	a.recorder.Event(a.csr, eventType, eventReason(outcome), message)
+	metrics.CSRDecisions.WithLabelValues(string(outcome), decision.Method).Inc()
+	a.log.Info("CSR decision", "CSR", decision.CSR, "outcome", outcome, "reason", reason, "node", decision.NodeName,
+		"instance", decision.Instance, "method", decision.Method)
+
+	if err := a.appendHistory(ctx, decision); err != nil {
+		a.log.Error(err, "unable to record CSR decision history", "CSR", decision.CSR)
+	}
+}
+
+// eventReason returns the reason of the event recorded for the given outcome
+func eventReason(outcome Outcome) string {
+	switch outcome {
+	case Approved:
+		return "CSRApproved"
+	case Rejected:
+		return "CSRDenied"
+	default:
+		return "CSRValidationFailed"
+	}
+}
+
+// appendHistory adds the given decision to the decision history ConfigMap, creating it if needed, and removes the
+// oldest decisions beyond MaxHistory. A Failed decision replaces any earlier Failed decision about the same CSR, so
+// that the retries of a CSR take a single entry.
+func (a *Approver) appendHistory(ctx context.Context, decision Decision) error {
+	key := kubeTypes.NamespacedName{Namespace: a.namespace, Name: HistoryConfigMap}
+	// the cached ConfigMap may be stale, in which case the update conflicts or the ConfigMap already exists
+	retriable := func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}
+	return k8sretry.OnError(k8sretry.DefaultBackoff, retriable, func() error {
+		cm := &core.ConfigMap{}
+		err := a.client.Get(ctx, key, cm)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		exists := err == nil
+		history, err := ParseHistory(cm)
+		if err != nil {
+			// A corrupted history is replaced, rather than blocking all further records
+			a.log.Error(err, "discarding CSR decision history")
+			history = nil
+		}
+		history = append(dedupeFailed(history, &decision), decision)
+		if len(history) > MaxHistory {
+			history = history[len(history)-MaxHistory:]
+		}
+		out, err := json.Marshal(history)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			cm = &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+				Data: map[string]string{HistoryKey: string(out)}}
+			return a.client.Create(ctx, cm)
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[HistoryKey] = string(out)
+		return a.client.Update(ctx, cm)
+	})
+}
+
+// dedupeFailed returns the given history without any Failed decision about the CSR of the given Failed decision, whose
+// attempts are counted in the given decision. The history is returned unchanged for other decisions.
+func dedupeFailed(history []Decision, decision *Decision) []Decision {
+	if decision.Outcome != Failed {
+		return history
+	}
+	decision.Attempts = 1
+	deduped := history[:0]
+	for _, previous := range history {
+		if previous.CSR == decision.CSR && previous.Outcome == Failed {
+			decision.Attempts = max(previous.Attempts, 1) + 1
+			continue
+		}
+		deduped = append(deduped, previous)
+	}
+	return deduped
+}
+
+// ParseHistory returns the decisions held by the given decision history ConfigMap, from oldest to newest
+func ParseHistory(cm *core.ConfigMap) ([]Decision, error) {
+	value, present := cm.Data[HistoryKey]
+	if !present {
+		return nil, nil
+	}
+	var history []Decision
+	if err := json.Unmarshal([]byte(value), &history); err != nil {
+		return nil, fmt.Errorf("unable to parse %s ConfigMap %s entry: %w", cm.GetName(), HistoryKey, err)
+	}
+	return history, nil
+}
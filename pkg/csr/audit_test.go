@@ -0,0 +1,103 @@
+package csr
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certificates "k8s.io/api/certificates/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRecordDecision(t *testing.T) {
+	namespace := "wmco"
+	c := fake.NewClientBuilder().Build()
+	recorder := record.NewFakeRecorder(MaxHistory + 10)
+	for i := 0; i < MaxHistory+5; i++ {
+		csr := &certificates.CertificateSigningRequest{ObjectMeta: meta.ObjectMeta{Name: fmt.Sprintf("csr-%d", i)}}
+		a := &Approver{
+			client:           c,
+			csr:              csr,
+			log:              logr.Discard(),
+			recorder:         recorder,
+			namespace:        namespace,
+			nodeName:         "node",
+			matchedInstance:  "10.0.0.1",
+			validationMethod: DNSMethod,
+		}
+		a.recordDecision(context.Background(), Approved, "kubelet client certificate requested by a Windows instance")
+	}
+
+	cm := &core.ConfigMap{}
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: HistoryConfigMap}, cm))
+	history, err := ParseHistory(cm)
+	require.NoError(t, err)
+	// only the most recent decisions are kept, oldest first
+	require.Len(t, history, MaxHistory)
+	assert.Equal(t, "csr-5", history[0].CSR)
+	assert.Equal(t, fmt.Sprintf("csr-%d", MaxHistory+4), history[MaxHistory-1].CSR)
+	assert.Equal(t, Approved, history[0].Outcome)
+	assert.Equal(t, "10.0.0.1", history[0].Instance)
+	assert.Equal(t, DNSMethod, history[0].Method)
+
+	event := <-recorder.Events
+	assert.Contains(t, event, core.EventTypeNormal+" CSRApproved")
+	assert.Contains(t, event, "instance 10.0.0.1, matched by dns")
+}
+
+func TestRecordDecisionDedupe(t *testing.T) {
+	namespace := "wmco"
+	c := fake.NewClientBuilder().Build()
+	recorder := record.NewFakeRecorder(10)
+	newApprover := func(name string) *Approver {
+		return &Approver{
+			client:    c,
+			csr:       &certificates.CertificateSigningRequest{ObjectMeta: meta.ObjectMeta{Name: name}},
+			log:       logr.Discard(),
+			recorder:  recorder,
+			namespace: namespace,
+			nodeName:  "node",
+		}
+	}
+	ctx := context.Background()
+	newApprover("linux").recordDecision(ctx, Ignored, "node name does not match any Windows instance")
+	for i := 0; i < 3; i++ {
+		newApprover("windows").recordDecision(ctx, Failed, "unable to reach instance")
+	}
+	newApprover("other").recordDecision(ctx, Failed, "unable to reach instance")
+
+	cm := &core.ConfigMap{}
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: HistoryConfigMap}, cm))
+	history, err := ParseHistory(cm)
+	require.NoError(t, err)
+	// ignored CSRs are not recorded, and the retries of a failing CSR take a single entry
+	require.Len(t, history, 2)
+	assert.Equal(t, "windows", history[0].CSR)
+	assert.Equal(t, 3, history[0].Attempts)
+	assert.Equal(t, "other", history[1].CSR)
+	assert.Equal(t, 1, history[1].Attempts)
+	// events are raised for the failures only
+	assert.Len(t, recorder.Events, 4)
+}
+
+func TestParseHistory(t *testing.T) {
+	history, err := ParseHistory(&core.ConfigMap{})
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	_, err = ParseHistory(&core.ConfigMap{Data: map[string]string{HistoryKey: "invalid"}})
+	assert.Error(t, err)
+}
+
+func TestEventReason(t *testing.T) {
+	assert.Equal(t, "CSRApproved", eventReason(Approved))
+	assert.Equal(t, "CSRDenied", eventReason(Rejected))
+	assert.Equal(t, "CSRValidationFailed", eventReason(Failed))
+}
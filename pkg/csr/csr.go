@@ -11,6 +11,7 @@ import (
 	"context"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"net"
 	"reflect"
@@ -29,8 +30,8 @@ import (
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
-	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
 	"github.com/openshift/windows-machine-config-operator/pkg/signer"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
@@ -84,24 +85,55 @@ type Approver struct {
 	recorder record.EventRecorder
 	// namespace is the namespace in which CSR's are present
 	namespace string
+	// nodeName is the node name the CSR was requested for
+	nodeName string
+	// matchedInstance identifies the Windows instance the CSR's node name was matched to
+	matchedInstance string
+	// resolver resolves the addresses of BYOH instances, net.DefaultResolver is used if nil
+	resolver addressResolver
+	// networkBackend is the backend providing pod networking to Windows nodes
+	networkBackend cluster.NetworkBackend
+	// validationMethod is the method through which the CSR's node name was matched to the Windows instance
+	validationMethod string
+	// certificateType describes the certificate requested, once it has been determined
+	certificateType string
 }
 
 // NewApprover returns a pointer to the Approver
 func NewApprover(client client.Client, clientSet *kubernetes.Clientset, csr *certificates.CertificateSigningRequest,
-	log logr.Logger, recorder record.EventRecorder, watchNamespace string) (*Approver, error) {
+	log logr.Logger, recorder record.EventRecorder, watchNamespace string,
+	networkBackend cluster.NetworkBackend) (*Approver, error) {
 	if client == nil || csr == nil || clientSet == nil {
 		return nil, fmt.Errorf("kubernetes client, clientSet or CSR should not be nil")
 	}
-	return &Approver{client,
-		clientSet,
-		csr,
-		log,
-		recorder,
-		watchNamespace}, nil
+	return &Approver{client: client,
+		k8sclientset:   clientSet,
+		csr:            csr,
+		log:            log,
+		recorder:       recorder,
+		namespace:      watchNamespace,
+		networkBackend: networkBackend}, nil
 }
 
-// Approve determines if a CSR should be approved by WMCO, and if so, approves it by updating its status. This function
-// is a NOOP if the CSR should not be approved.
+// denialError is returned when a CSR is from a known Windows instance, but does not match the instance's identity.
+// Such CSRs are denied rather than left for another approver.
+type denialError struct {
+	message string
+}
+
+func (e *denialError) Error() string {
+	return e.message
+}
+
+// newDenialError returns a new denialError with the given formatted message
+func newDenialError(format string, args ...interface{}) *denialError {
+	return &denialError{message: fmt.Sprintf(format, args...)}
+}
+
+// Approve determines if a CSR should be approved by WMCO, and if so, approves it by updating its status. CSRs from
+// Windows instances which do not match the instance's identity, such as serving CSRs requesting addresses which are not
+// the instance's, are denied. This function is a NOOP if the CSR should be neither approved nor denied. Each decision
+// is recorded as an event on the CSR, in the CSR decision metrics and in the decision history ConfigMap.
 func (a *Approver) Approve(ctx context.Context) error {
 	if a.k8sclientset == nil {
 		return fmt.Errorf("kubernetes clientSet should not be nil")
@@ -109,9 +141,20 @@ func (a *Approver) Approve(ctx context.Context) error {
 
 	validForApproval, err := a.validateCSRContents(ctx)
 	if err != nil {
-		return fmt.Errorf("error determining if CSR %s should be approved: %w", a.csr.Name, err)
+		var denial *denialError
+		if errors.As(err, &denial) {
+			if err := a.deny(ctx, denial.Error()); err != nil {
+				return err
+			}
+			a.recordDecision(ctx, Rejected, denial.Error())
+			return nil
+		}
+		err = fmt.Errorf("error determining if CSR %s should be approved: %w", a.csr.Name, err)
+		a.recordDecision(ctx, Failed, err.Error())
+		return err
 	}
 	if !validForApproval {
+		a.recordDecision(ctx, Ignored, "node name does not match any Windows instance")
 		return nil
 	}
 
@@ -128,7 +171,24 @@ func (a *Approver) Approve(ctx context.Context) error {
 		// have to return err itself here (not wrapped inside another error) so it can be identified as a conflict
 		return err
 	}
-	a.log.Info("CSR approved", "CSR", a.csr.Name)
+	a.recordDecision(ctx, Approved, a.certificateType+" certificate requested by a Windows instance")
+	return nil
+}
+
+// deny denies the CSR by updating its status, giving the reason it was denied
+func (a *Approver) deny(ctx context.Context, reason string) error {
+	a.csr.Status.Conditions = append(a.csr.Status.Conditions, certificates.CertificateSigningRequestCondition{
+		Type:           certificates.CertificateDenied,
+		Status:         "True",
+		Message:        "This CSR was denied by the WMCO certificate Approver: " + reason,
+		LastUpdateTime: meta.Now(),
+		Reason:         "WMCODeny",
+	})
+	if _, err := a.k8sclientset.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx,
+		a.csr.Name, a.csr, meta.UpdateOptions{}); err != nil {
+		// have to return err itself here (not wrapped inside another error) so it can be identified as a conflict
+		return err
+	}
 	return nil
 }
 
@@ -146,16 +206,24 @@ func (a *Approver) validateCSRContents(ctx context.Context) (bool, error) {
 		return false, fmt.Errorf("CSR %s subject name does not contain the required node user prefix: %s",
 			a.csr.Name, NodeUserNamePrefix)
 	}
+	a.nodeName = nodeName
 
 	// lookup the node name against the instance configMap addresses/host names
 	valid, err := a.validateNodeName(ctx, nodeName)
 	if err != nil {
 		return false, fmt.Errorf("error validating node name %s for CSR: %s: %w", nodeName, a.csr.Name, err)
 	}
-	// CSR is not from a BYOH Windows instance, don't return error to avoid requeue, instead log if it is invalid
+	if !valid && cluster.MachineCSRApprovalEnabled() {
+		// lookup the node name against the addresses of Windows Machines, validating the CSR against the Machine's
+		// identity if it is from one
+		valid, err = a.validateMachineCSR(ctx, nodeName, parsedCSR)
+		if err != nil {
+			return false, err
+		}
+	}
+	// CSR is not from a Windows instance, don't return error to avoid requeue, instead log if it is invalid
 	// as it might be from a linux node.
 	if !valid {
-		a.log.Info("CSR contents are invalid for approval by WMCO", "CSR", a.csr.Name)
 		return false, nil
 	}
 	// Kubelet on a node needs two certificates for its normal operation:
@@ -163,6 +231,7 @@ func (a *Approver) validateCSRContents(ctx context.Context) (bool, error) {
 	// Server certificate for use by Kubernetes API server to talk back to kubelet
 	// Both types are validated based on their contents
 	if a.isNodeClientCert(parsedCSR) {
+		a.certificateType = "kubelet client"
 		// Node client bootstrapper CSR is received before the instance becomes a node
 		// hence we should not proceed if a corresponding node already exists
 		node := &core.Node{}
@@ -174,9 +243,16 @@ func (a *Approver) validateCSRContents(ctx context.Context) (bool, error) {
 			return false, fmt.Errorf("%s node already exists, cannot validate CSR: %s", nodeName, a.csr.Name)
 		}
 	} else {
+		a.certificateType = "kubelet serving"
 		if err := a.validateKubeletServingCSR(parsedCSR); err != nil {
 			return false, fmt.Errorf("unable to validate kubelet serving CSR: %s: %w", a.csr.Name, err)
 		}
+		// the SANs of CSRs from Windows Machines are validated against the Machine's addresses
+		if a.validationMethod != MachineMethod {
+			if err := a.validateInstanceSANs(ctx, parsedCSR); err != nil {
+				return false, fmt.Errorf("unable to validate kubelet serving CSR: %s: %w", a.csr.Name, err)
+			}
+		}
 	}
 	return true, nil
 }
@@ -191,10 +267,11 @@ func (a *Approver) validateNodeName(ctx context.Context, nodeName string) (bool,
 		return false, fmt.Errorf("unable to retrieve Windows instances: %w", err)
 	}
 	// check if the node name matches the lookup of any of the instance addresses
-	hasEntry, err := matchesDNS(nodeName, windowsInstances)
+	matched, err := matchesDNS(nodeName, windowsInstances)
 	if err != nil {
 		a.log.Info("error occurred with reverse DNS lookup, falling back to hostname validation", "error", err)
-	} else if hasEntry {
+	} else if matched != nil {
+		a.matchedInstance, a.validationMethod = matched.Address, DNSMethod
 		return true, nil
 	}
 	return a.validateWithHostName(ctx, nodeName, windowsInstances)
@@ -204,21 +281,20 @@ func (a *Approver) validateNodeName(ctx context.Context, nodeName string) (bool,
 // provided in the instance list. If a match is found, it also validates if the node name complies with the DNS
 // RFC1123 naming convention for internet hosts.
 func (a *Approver) validateWithHostName(ctx context.Context, nodeName string, windowsInstances []*instance.Info) (bool, error) {
-	// Create a new signer using the private key secret
-	instanceSigner, err := signer.Create(ctx, kubeTypes.NamespacedName{Namespace: a.namespace,
-		Name: secrets.PrivateKeySecret}, a.client)
-	if err != nil {
-		return false, fmt.Errorf("unable to create signer from private key secret: %w", err)
+	// Each instance is accessed with the signer created from its own credentials
+	signerFor := func(instanceInfo *instance.Info) (ssh.Signer, error) {
+		return signer.ForInstance(ctx, a.client, a.namespace, instanceInfo)
 	}
 	// check if the node name matches any of the instances host names
-	hasEntry, err := matchesHostname(nodeName, windowsInstances, instanceSigner)
+	matched, err := matchesHostname(nodeName, windowsInstances, signerFor, a.networkBackend)
 	if err != nil {
 		return false, fmt.Errorf("unable to map node name to the host names of Windows instances: %w", err)
 	}
-	if !hasEntry {
+	if matched == nil {
 		// CSR is not from a BYOH instance
 		return false, nil
 	}
+	a.matchedInstance, a.validationMethod = matched.Address, HostnameMethod
 	// validate node name for DNS RFC1123 naming conventions
 	// ref: https://kubernetes.io/docs/concepts/overview/working-with-objects/names/#dns-subdomain-names
 	if errs := validation.IsDNS1123Subdomain(nodeName); len(errs) > 0 {
@@ -298,28 +374,35 @@ func hasUsages(csr *certificates.CertificateSigningRequest, usages []certificate
 	return true
 }
 
-// matchesHostname returns true if given node name matches with host name of any of the instances present
-// in the given instance list
+// matchesHostname returns the instance, within the given instance list, whose host name matches the given node name.
+// Each instance is accessed using the signer returned for it by signerFor, and configured for the given network backend.
+// Returns nil if there is no such instance.
 func matchesHostname(nodeName string, windowsInstances []*instance.Info,
-	instanceSigner ssh.Signer) (bool, error) {
+	signerFor func(*instance.Info) (ssh.Signer, error), networkBackend cluster.NetworkBackend) (*instance.Info, error) {
 	for _, instanceInfo := range windowsInstances {
-		hostName, err := findHostName(instanceInfo, instanceSigner)
+		instanceSigner, err := signerFor(instanceInfo)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create signer for instance with address %s: %w",
+				instanceInfo.Address, err)
+		}
+		hostName, err := findHostName(instanceInfo, instanceSigner, networkBackend)
 		if err != nil {
-			return false, fmt.Errorf("unable to find host name for instance with address %s: %w",
+			return nil, fmt.Errorf("unable to find host name for instance with address %s: %w",
 				instanceInfo.Address, err)
 		}
 		// check if the instance host name matches node name
 		if strings.Contains(hostName, nodeName) {
-			return true, nil
+			return instanceInfo, nil
 		}
 	}
-	return false, nil
+	return nil, nil
 }
 
 // findHostName returns the actual host name of the instance by running the 'hostname' command
-func findHostName(instanceInfo *instance.Info, instanceSigner ssh.Signer) (string, error) {
+func findHostName(instanceInfo *instance.Info, instanceSigner ssh.Signer,
+	networkBackend cluster.NetworkBackend) (string, error) {
 	// We don't need to pass most args here as we just need to be able to run commands on the instance.
-	win, err := windows.New("", instanceInfo, instanceSigner, nil)
+	win, err := windows.New("", instanceInfo, instanceSigner, nil, networkBackend)
 	if err != nil {
 		return "", fmt.Errorf("error instantiating Windows instance: %w", err)
 	}
@@ -327,28 +410,28 @@ func findHostName(instanceInfo *instance.Info, instanceSigner ssh.Signer) (strin
 	return win.GetHostname()
 }
 
-// matchesDNS returns true if the node name passed matches with the instance address of any of the instances present
-// in the given instance list. If the address found is an IP address, we do a reverse lookup for the DNS address.
-func matchesDNS(nodeName string, windowsInstances []*instance.Info) (bool, error) {
+// matchesDNS returns the instance, within the given instance list, whose address matches the node name passed. If the
+// address is an IP address, we do a reverse lookup for the DNS address. Returns nil if there is no such instance.
+func matchesDNS(nodeName string, windowsInstances []*instance.Info) (*instance.Info, error) {
 	for _, instanceInfo := range windowsInstances {
 		// reverse lookup the instance if the address is an IP address
 		if parseAddr := net.ParseIP(instanceInfo.Address); parseAddr != nil {
 			dnsAddresses, err := net.LookupAddr(instanceInfo.Address)
 			if err != nil {
-				return false, fmt.Errorf("failed to lookup DNS for IP %s: %w", instanceInfo.Address, err)
+				return nil, fmt.Errorf("failed to lookup DNS for IP %s: %w", instanceInfo.Address, err)
 			}
 			for _, dns := range dnsAddresses {
 				if strings.Contains(dns, nodeName) {
-					return true, nil
+					return instanceInfo, nil
 				}
 			}
 		} else { // direct match if it is a DNS address
 			if strings.Contains(instanceInfo.Address, nodeName) {
-				return true, nil
+				return instanceInfo, nil
 			}
 		}
 	}
-	return false, nil
+	return nil, nil
 }
 
 // ParseCSR extracts the CSR from the API object and decodes it.
@@ -159,12 +159,12 @@ func TestAddressesEqual(t *testing.T) {
 			out, err := matchesDNS(test.nodeName, test.instances)
 			if test.expectedErr {
 				assert.Error(t, err)
-				assert.False(t, out)
+				assert.Nil(t, out)
 				return
 			}
 			require.NoError(t, err)
 			if test.output {
-				assert.True(t, out)
+				assert.NotNil(t, out)
 			}
 		})
 	}
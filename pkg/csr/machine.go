@@ -0,0 +1,108 @@
+package csr
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	mapi "github.com/openshift/api/machine/v1beta1"
+	core "k8s.io/api/core/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+)
+
+//+kubebuilder:rbac:groups=machine.openshift.io,resources=machines,verbs=get;list;watch
+
+// machineOSLabel identifies the Machines backing Windows instances
+const machineOSLabel = "machine.openshift.io/os-id"
+
+// validateMachineCSR returns true if the node name matches the address of a Windows Machine, and the CSR matches the
+// Machine's identity. A denialError is returned if the CSR is from a Windows Machine but does not match its identity.
+// Returns false with no error if the CSR is not from a Windows Machine.
+func (a *Approver) validateMachineCSR(ctx context.Context, nodeName string,
+	parsedCSR *x509.CertificateRequest) (bool, error) {
+	machines := &mapi.MachineList{}
+	err := a.client.List(ctx, machines, client.InNamespace(cluster.MachineAPINamespace),
+		client.MatchingLabels{machineOSLabel: "Windows"})
+	if err != nil {
+		return false, fmt.Errorf("unable to list Windows Machines: %w", err)
+	}
+	machine := findMachine(machines.Items, nodeName)
+	if machine == nil {
+		return false, nil
+	}
+	a.matchedInstance, a.validationMethod = machine.GetName(), MachineMethod
+
+	if a.isNodeClientCert(parsedCSR) {
+		// A Machine only bootstraps a single node
+		if machine.Status.NodeRef != nil && machine.Status.NodeRef.Name != nodeName {
+			return false, newDenialError("Machine %s already backs node %s", machine.GetName(),
+				machine.Status.NodeRef.Name)
+		}
+		return true, nil
+	}
+
+	node := &core.Node{}
+	if err := a.client.Get(ctx, kubeTypes.NamespacedName{Name: nodeName}, node); err != nil {
+		// kubelet requests its serving certificate once the node is registered, so a missing node is retried in case
+		// it is not yet in the cache
+		return false, fmt.Errorf("unable to get node %s: %w", nodeName, err)
+	}
+	if err := validateProviderID(machine, node); err != nil {
+		return false, err
+	}
+	if err := validateMachineSANs(parsedCSR, machine, nodeName); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// findMachine returns the Machine which the given node name identifies, either through the node the Machine is
+// associated with or through one of the Machine's host names. Returns nil if there is no such Machine.
+func findMachine(machines []mapi.Machine, nodeName string) *mapi.Machine {
+	for i := range machines {
+		if machines[i].Status.NodeRef != nil && machines[i].Status.NodeRef.Name == nodeName {
+			return &machines[i]
+		}
+	}
+	for i := range machines {
+		for _, address := range machines[i].Status.Addresses {
+			if isDNSAddress(address.Type) && hostnameMatches(address.Address, nodeName) {
+				return &machines[i]
+			}
+		}
+	}
+	return nil
+}
+
+// validateProviderID returns a denialError if the given node does not report the provider ID of the given Machine
+func validateProviderID(machine *mapi.Machine, node *core.Node) error {
+	if machine.Spec.ProviderID == nil || *machine.Spec.ProviderID == "" {
+		return newDenialError("Machine %s has no provider ID to validate node %s against", machine.GetName(),
+			node.GetName())
+	}
+	if node.Spec.ProviderID != *machine.Spec.ProviderID {
+		return newDenialError("node %s provider ID %q does not match Machine %s provider ID %q", node.GetName(),
+			node.Spec.ProviderID, machine.GetName(), *machine.Spec.ProviderID)
+	}
+	return nil
+}
+
+// validateMachineSANs returns a denialError if any of the subject alternative names requested are not one of the
+// Machine's addresses or the node name
+func validateMachineSANs(parsedCSR *x509.CertificateRequest, machine *mapi.Machine, nodeName string) error {
+	return validateSANs(parsedCSR, nodeName, machine.Status.Addresses, "Machine "+machine.GetName())
+}
+
+// hostnameMatches returns true if the given node name is the given host name, or its first label. Windows host names
+// are case-insensitive, and are often used without the domain as the node name.
+func hostnameMatches(hostname, nodeName string) bool {
+	if strings.EqualFold(hostname, nodeName) {
+		return true
+	}
+	shortName, _, _ := strings.Cut(hostname, ".")
+	return strings.EqualFold(shortName, nodeName)
+}
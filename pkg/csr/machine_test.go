@@ -0,0 +1,121 @@
+package csr
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+	"testing"
+
+	mapi "github.com/openshift/api/machine/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newMachine returns a Machine with the given name, provider ID and addresses
+func newMachine(name, providerID string, addresses ...core.NodeAddress) mapi.Machine {
+	return mapi.Machine{
+		ObjectMeta: meta.ObjectMeta{Name: name},
+		Spec:       mapi.MachineSpec{ProviderID: &providerID},
+		Status:     mapi.MachineStatus{Addresses: addresses},
+	}
+}
+
+func TestFindMachine(t *testing.T) {
+	first := newMachine("first", "aws:///us-east-1a/i-1",
+		core.NodeAddress{Type: core.NodeInternalIP, Address: "10.0.0.1"},
+		core.NodeAddress{Type: core.NodeInternalDNS, Address: "ip-10-0-0-1.ec2.internal"})
+	second := newMachine("second", "aws:///us-east-1a/i-2",
+		core.NodeAddress{Type: core.NodeInternalIP, Address: "10.0.0.2"},
+		core.NodeAddress{Type: core.NodeHostName, Address: "WINHOST2.example.com"})
+	third := newMachine("third", "aws:///us-east-1a/i-3")
+	third.Status.NodeRef = &core.ObjectReference{Name: "existing-node"}
+	machines := []mapi.Machine{first, second, third}
+
+	testCases := []struct {
+		name     string
+		nodeName string
+		expected string
+	}{
+		{name: "internal DNS name", nodeName: "ip-10-0-0-1.ec2.internal", expected: "first"},
+		{name: "short host name", nodeName: "winhost2", expected: "second"},
+		{name: "node reference", nodeName: "existing-node", expected: "third"},
+		{name: "IP address is not a node name", nodeName: "10.0.0.1"},
+		{name: "unknown node", nodeName: "linux-node"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			machine := findMachine(machines, test.nodeName)
+			if test.expected == "" {
+				assert.Nil(t, machine)
+				return
+			}
+			require.NotNil(t, machine)
+			assert.Equal(t, test.expected, machine.GetName())
+		})
+	}
+}
+
+func TestValidateProviderID(t *testing.T) {
+	machine := newMachine("machine", "aws:///us-east-1a/i-1")
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "node"},
+		Spec: core.NodeSpec{ProviderID: "aws:///us-east-1a/i-1"}}
+	assert.NoError(t, validateProviderID(&machine, node))
+
+	node.Spec.ProviderID = "aws:///us-east-1a/i-2"
+	var denial *denialError
+	assert.ErrorAs(t, validateProviderID(&machine, node), &denial)
+
+	machine = newMachine("machine", "")
+	assert.ErrorAs(t, validateProviderID(&machine, node), &denial)
+}
+
+func TestValidateMachineSANs(t *testing.T) {
+	machine := newMachine("machine", "aws:///us-east-1a/i-1",
+		core.NodeAddress{Type: core.NodeInternalIP, Address: "10.0.0.1"},
+		core.NodeAddress{Type: core.NodeInternalDNS, Address: "ip-10-0-0-1.ec2.internal"})
+
+	testCases := []struct {
+		name        string
+		request     *x509.CertificateRequest
+		expectedErr bool
+	}{
+		{
+			name: "addresses of the Machine",
+			request: &x509.CertificateRequest{DNSNames: []string{"node", "IP-10-0-0-1.ec2.internal"},
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}},
+		},
+		{
+			name:        "unknown DNS name",
+			request:     &x509.CertificateRequest{DNSNames: []string{"other.example.com"}},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown IP address",
+			request:     &x509.CertificateRequest{IPAddresses: []net.IP{net.ParseIP("10.0.0.2")}},
+			expectedErr: true,
+		},
+		{
+			name:        "IP address given as a DNS name",
+			request:     &x509.CertificateRequest{DNSNames: []string{"10.0.0.1"}},
+			expectedErr: true,
+		},
+		{
+			name:        "URI",
+			request:     &x509.CertificateRequest{URIs: []*url.URL{{Scheme: "spiffe", Host: "node"}}},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateMachineSANs(test.request, &machine, "node")
+			if test.expectedErr {
+				var denial *denialError
+				assert.ErrorAs(t, err, &denial)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package csr
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+)
+
+// addressLookupTimeout bounds the time spent resolving the address of a BYOH instance
+const addressLookupTimeout = 10 * time.Second
+
+// addressResolver resolves host names to addresses, and addresses to host names
+type addressResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// validateInstanceSANs returns a denialError if any of the subject alternative names requested by the BYOH instance
+// the CSR was matched to are not the node name or one of the instance's addresses
+func (a *Approver) validateInstanceSANs(ctx context.Context, parsedCSR *x509.CertificateRequest) error {
+	addresses, err := a.instanceAddresses(ctx)
+	if err != nil {
+		return err
+	}
+	return validateSANs(parsedCSR, a.nodeName, addresses, "instance "+a.matchedInstance)
+}
+
+// instanceAddresses returns the address of the matched BYOH instance, as given by the windows-instances ConfigMap,
+// along with the IP addresses its host name resolves to, or the host names its IP address reverse-resolves to. The
+// addresses in the status of the node are never used, as they are reported by the instance's kubelet itself.
+func (a *Approver) instanceAddresses(ctx context.Context) ([]core.NodeAddress, error) {
+	addresses := []core.NodeAddress{instanceAddress(a.matchedInstance)}
+	resolver := a.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, addressLookupTimeout)
+	defer cancel()
+	if net.ParseIP(a.matchedInstance) != nil {
+		names, err := resolver.LookupAddr(lookupCtx, a.matchedInstance)
+		if err != nil && !isNotFound(err) {
+			return nil, fmt.Errorf("unable to reverse lookup instance %s: %w", a.matchedInstance, err)
+		}
+		for _, name := range names {
+			addresses = append(addresses, core.NodeAddress{Type: core.NodeInternalDNS,
+				Address: strings.TrimSuffix(name, ".")})
+		}
+		return addresses, nil
+	}
+	ips, err := resolver.LookupHost(lookupCtx, a.matchedInstance)
+	if err != nil && !isNotFound(err) {
+		return nil, fmt.Errorf("unable to lookup instance %s: %w", a.matchedInstance, err)
+	}
+	for _, ip := range ips {
+		addresses = append(addresses, core.NodeAddress{Type: core.NodeInternalIP, Address: ip})
+	}
+	return addresses, nil
+}
+
+// isNotFound returns true if the given lookup error reports that the name or address has no record
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// instanceAddress returns the given address of a BYOH instance as a node address of the matching type
+func instanceAddress(address string) core.NodeAddress {
+	if net.ParseIP(address) != nil {
+		return core.NodeAddress{Type: core.NodeInternalIP, Address: address}
+	}
+	return core.NodeAddress{Type: core.NodeHostName, Address: address}
+}
+
+// validateSANs returns a denialError if any of the subject alternative names requested are not the node name or one
+// of the given addresses of the instance, which is described by the given owner
+func validateSANs(parsedCSR *x509.CertificateRequest, nodeName string, addresses []core.NodeAddress,
+	owner string) error {
+	for _, dnsName := range parsedCSR.DNSNames {
+		if strings.EqualFold(dnsName, nodeName) {
+			continue
+		}
+		if !hasAddress(addresses, dnsName, isDNSAddress) {
+			return newDenialError("DNS name %s is not an address of %s", dnsName, owner)
+		}
+	}
+	for _, ip := range parsedCSR.IPAddresses {
+		if !hasAddress(addresses, ip.String(), isIPAddress) {
+			return newDenialError("IP address %s is not an address of %s", ip, owner)
+		}
+	}
+	if len(parsedCSR.EmailAddresses) > 0 || len(parsedCSR.URIs) > 0 {
+		return newDenialError("serving certificates cannot include email or URI subject alternative names")
+	}
+	return nil
+}
+
+// hasAddress returns true if the given value is one of the given addresses of the types accepted by the given
+// function. IP addresses are compared in their canonical form.
+func hasAddress(addresses []core.NodeAddress, value string, acceptType func(core.NodeAddressType) bool) bool {
+	for _, address := range addresses {
+		if !acceptType(address.Type) {
+			continue
+		}
+		if ip := net.ParseIP(address.Address); ip != nil {
+			if ip.String() == value {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(address.Address, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDNSAddress returns true if the given address type holds a host name
+func isDNSAddress(addressType core.NodeAddressType) bool {
+	return addressType == core.NodeHostName || addressType == core.NodeInternalDNS ||
+		addressType == core.NodeExternalDNS
+}
+
+// isIPAddress returns true if the given address type holds an IP address
+func isIPAddress(addressType core.NodeAddressType) bool {
+	return addressType == core.NodeInternalIP || addressType == core.NodeExternalIP
+}
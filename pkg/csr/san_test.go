@@ -0,0 +1,133 @@
+package csr
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeResolver resolves the host names and addresses it holds, and reports all others as not found
+type fakeResolver struct {
+	hosts map[string][]string
+	addrs map[string][]string
+	err   error
+}
+
+func (f *fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	return f.lookup(f.hosts, host)
+}
+
+func (f *fakeResolver) LookupAddr(_ context.Context, addr string) ([]string, error) {
+	return f.lookup(f.addrs, addr)
+}
+
+func (f *fakeResolver) lookup(records map[string][]string, name string) ([]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if values, found := records[name]; found {
+		return values, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func TestValidateInstanceSANs(t *testing.T) {
+	resolver := &fakeResolver{
+		hosts: map[string][]string{"winhost.example.com": {"10.0.0.1"}},
+		addrs: map[string][]string{"10.0.0.1": {"winhost.example.com."}},
+	}
+	// the node reports addresses which are not the instance's, which must not be accepted
+	node := &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "winhost"},
+		Status: core.NodeStatus{Addresses: []core.NodeAddress{
+			{Type: core.NodeInternalIP, Address: "172.30.0.1"},
+			{Type: core.NodeHostName, Address: "kubernetes.default.svc"},
+		}},
+	}
+	c := fake.NewClientBuilder().WithObjects(node).Build()
+
+	testCases := []struct {
+		name            string
+		matchedInstance string
+		resolver        *fakeResolver
+		request         *x509.CertificateRequest
+		expectedErr     bool
+		expectedDenial  bool
+	}{
+		{
+			name:            "host name from the windows-instances ConfigMap and its address",
+			matchedInstance: "winhost.example.com",
+			request: &x509.CertificateRequest{DNSNames: []string{"winhost", "WINHOST.example.com"},
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}},
+		},
+		{
+			name:            "IP address from the windows-instances ConfigMap and its host name",
+			matchedInstance: "10.0.0.1",
+			request: &x509.CertificateRequest{DNSNames: []string{"winhost.example.com"},
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}},
+		},
+		{
+			name:            "IP address without reverse record",
+			matchedInstance: "192.168.0.10",
+			request:         &x509.CertificateRequest{IPAddresses: []net.IP{net.ParseIP("192.168.0.10")}},
+		},
+		{
+			name:            "IP address reported by the node",
+			matchedInstance: "winhost.example.com",
+			request: &x509.CertificateRequest{
+				IPAddresses: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("172.30.0.1")}},
+			expectedErr:    true,
+			expectedDenial: true,
+		},
+		{
+			name:            "DNS name reported by the node",
+			matchedInstance: "winhost.example.com",
+			request:         &x509.CertificateRequest{DNSNames: []string{"kubernetes.default.svc"}},
+			expectedErr:     true,
+			expectedDenial:  true,
+		},
+		{
+			name:            "lookup failure is retried",
+			matchedInstance: "winhost.example.com",
+			resolver:        &fakeResolver{err: &net.DNSError{Err: "timeout", IsTimeout: true}},
+			request:         &x509.CertificateRequest{DNSNames: []string{"winhost"}},
+			expectedErr:     true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			testResolver := resolver
+			if test.resolver != nil {
+				testResolver = test.resolver
+			}
+			a := &Approver{client: c, nodeName: "winhost", matchedInstance: test.matchedInstance,
+				resolver: testResolver}
+			err := a.validateInstanceSANs(context.Background(), test.request)
+			if !test.expectedErr {
+				assert.NoError(t, err)
+				return
+			}
+			var denial *denialError
+			assert.Error(t, err)
+			assert.Equal(t, test.expectedDenial, errors.As(err, &denial))
+		})
+	}
+}
+
+func TestHasAddress(t *testing.T) {
+	addresses := []core.NodeAddress{
+		{Type: core.NodeInternalIP, Address: "fd00:0:0::1"},
+		{Type: core.NodeInternalDNS, Address: "WinHost.example.com"},
+	}
+	assert.True(t, hasAddress(addresses, net.ParseIP("fd00::1").String(), isIPAddress))
+	assert.True(t, hasAddress(addresses, "winhost.example.com", isDNSAddress))
+	assert.False(t, hasAddress(addresses, "winhost.example.com", isIPAddress))
+	assert.False(t, hasAddress(addresses, "fd00::2", isIPAddress))
+}
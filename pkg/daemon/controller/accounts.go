@@ -0,0 +1,157 @@
+//go:build windows
+
+package controller
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	syswindows "golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc/mgr"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/winsvc"
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+// namedPipePrefix prefixes the paths of named pipes
+const namedPipePrefix = "\\\\.\\pipe\\"
+
+// reconcileAccount adds the account the given service runs as to its groups, and grants it access to its paths. Nothing
+// is done for services running as LocalSystem. This must be done once the service is configured to run as the
+// account, as a virtual account only exists while its service does.
+func (sc *ServiceController) reconcileAccount(expected servicescm.Service) error {
+	account := expected.Account
+	if account == nil {
+		return nil
+	}
+	for _, group := range account.Groups {
+		cmd := windows.GroupMemberCmd(group, account.Name)
+		if out, err := sc.psCmdRunner.Run(cmd); err != nil {
+			return fmt.Errorf("error adding %s to group %s with output %s: %w", account.Name, group, out, err)
+		}
+	}
+	for _, access := range account.Access {
+		if err := sc.grantAccess(account.Name, access); err != nil {
+			return fmt.Errorf("error granting %s access to %s: %w", account.Name, access.Path, err)
+		}
+	}
+	return nil
+}
+
+// prepareAccounts creates the given services which run as an account other than LocalSystem, without starting them,
+// and reconciles the groups and access of their accounts. Adding an account to a local group requires administrative
+// rights, which WICD is not given when it runs as a service account itself, so this is done while bootstrapping. The
+// service is created first, as a virtual account only exists while its service does. Services are only prepared if they
+// are allow-listed or signed by the operator for the given version of the services ConfigMap.
+func (sc *ServiceController) prepareAccounts(services []servicescm.Service, version string) error {
+	trust, err := sc.loadServiceTrust()
+	if err != nil {
+		return err
+	}
+	existingSvcs, err := sc.GetServices()
+	if err != nil {
+		return fmt.Errorf("could not determine existing Windows services: %w", err)
+	}
+	for _, service := range services {
+		// the accounts of bootstrap services are reconciled along with the services
+		if service.Account == nil || service.Bootstrap {
+			continue
+		}
+		if err := trust.Verify(service, version); err != nil {
+			sc.recordServiceRejection(service.Name, err)
+			return fmt.Errorf("refusing to prepare the account of service %s: %w", service.Name, err)
+		}
+		if _, present := existingSvcs[service.Name]; !present {
+			placeholder, err := sc.CreateService(service.Name, "", mgr.Config{
+				Description:      fmt.Sprintf("%s %s", windows.ManagedTag, service.Name),
+				ServiceStartName: service.AccountName(),
+				SidType:          syswindows.SERVICE_SID_TYPE_UNRESTRICTED,
+			})
+			if err != nil {
+				return err
+			}
+			placeholder.Close()
+			klog.Infof("created service %s to run as %s", service.Name, service.AccountName())
+		}
+		if err := sc.reconcileAccount(service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accountChanged returns true if the given account a service runs as differs from the expected one. The service
+// manager runs services with no account given as LocalSystem.
+func accountChanged(current string, expected servicescm.Service) bool {
+	if current == "" {
+		current = servicescm.LocalSystemAccount
+	}
+	return !strings.EqualFold(current, expected.AccountName())
+}
+
+// privilegesChanged returns true if the privileges the given service is restricted to differ from the expected ones
+func privilegesChanged(service winsvc.Service, expected servicescm.Service) (bool, error) {
+	current, err := service.RequiredPrivileges()
+	if err != nil {
+		return false, err
+	}
+	desired := expected.Privileges()
+	if len(current) != len(desired) {
+		return true, nil
+	}
+	current, desired = slices.Clone(current), slices.Clone(desired)
+	slices.Sort(current)
+	slices.Sort(desired)
+	return !slices.Equal(current, desired), nil
+}
+
+// grantFileAccess adds an entry for the given account to the access rules of the given file, directory or named pipe,
+// replacing any existing entry for the account. Access to a directory is inherited by its contents.
+func grantFileAccess(account string, access servicescm.PathAccess) error {
+	sid, _, _, err := syswindows.LookupSID("", account)
+	if err != nil {
+		return fmt.Errorf("unable to look up account: %w", err)
+	}
+	sd, err := syswindows.GetNamedSecurityInfo(access.Path, syswindows.SE_FILE_OBJECT,
+		syswindows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return fmt.Errorf("unable to get security descriptor: %w", err)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return fmt.Errorf("unable to get DACL: %w", err)
+	}
+	permissions := syswindows.ACCESS_MASK(syswindows.FILE_GENERIC_READ | syswindows.FILE_GENERIC_EXECUTE)
+	if access.Write {
+		permissions |= syswindows.FILE_GENERIC_WRITE | syswindows.DELETE
+	}
+	inheritance := uint32(syswindows.NO_INHERITANCE)
+	if !strings.HasPrefix(access.Path, namedPipePrefix) {
+		info, err := os.Stat(access.Path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			inheritance = syswindows.SUB_CONTAINERS_AND_OBJECTS_INHERIT
+		}
+	}
+	acl, err := syswindows.ACLFromEntries([]syswindows.EXPLICIT_ACCESS{{
+		AccessPermissions: permissions,
+		AccessMode:        syswindows.SET_ACCESS,
+		Inheritance:       inheritance,
+		Trustee: syswindows.TRUSTEE{
+			TrusteeForm:  syswindows.TRUSTEE_IS_SID,
+			TrusteeType:  syswindows.TRUSTEE_IS_USER,
+			TrusteeValue: syswindows.TrusteeValueFromSID(sid),
+		},
+	}}, dacl)
+	if err != nil {
+		return fmt.Errorf("unable to build DACL: %w", err)
+	}
+	return syswindows.SetNamedSecurityInfo(access.Path, syswindows.SE_FILE_OBJECT,
+		syswindows.DACL_SECURITY_INFORMATION, nil, nil, acl, nil)
+}
@@ -0,0 +1,86 @@
+//go:build windows
+
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/certexpiry"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+var (
+	// certificatePaths is the location of each certificate tracked on the instance. Only the CAs supplied by the
+	// cluster administrator are tracked within the trusted CA bundle, as the rest of it includes the CAs of the system
+	// trust store of the cluster, whose expiry is not managed by WMCO.
+	certificatePaths = map[string]string{
+		certexpiry.KubeletClientCA:    windows.KubeletClientCAPath,
+		certexpiry.KubeletClient:      windows.KubeletCertDir + "\\kubelet-client-current.pem",
+		certexpiry.KubeletServing:     windows.KubeletCertDir + "\\kubelet-server-current.pem",
+		certexpiry.TrustedCABundle:    windows.UserCABundlePath,
+		certexpiry.WindowsExporterTLS: windows.TLSCertsPath + "\\tls.crt",
+	}
+	// bundleParsers parse the tracked certificates which are bundles. The other certificates are parsed with
+	// certexpiry.FromPEM.
+	bundleParsers = map[string]func([]byte) (*certexpiry.Validity, error){
+		certexpiry.KubeletClientCA: certexpiry.BundleFromPEM,
+		certexpiry.TrustedCABundle: certexpiry.TrustBundleFromPEM,
+	}
+)
+
+// reconcileCertExpiry records the validity period of each certificate present on the instance on the given node.
+// Certificates which are not present, such as kubelet's serving certificate before its CSR has been approved, or the
+// trusted CA bundle when the cluster administrator has not supplied any CA, are not recorded.
+func (sc *ServiceController) reconcileCertExpiry(node core.Node) error {
+	current, err := certexpiry.GetStatus(&node)
+	if err != nil {
+		klog.Errorf("discarding recorded certificate status: %v", err)
+		current = make(certexpiry.Status)
+	}
+
+	status := make(certexpiry.Status)
+	var errs []error
+	for name, path := range certificatePaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("error reading certificate %s: %w", path, err))
+			}
+			continue
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		parse, isBundle := bundleParsers[name]
+		if !isBundle {
+			parse = certexpiry.FromPEM
+		}
+		validity, err := parse(data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error reading certificate %s: %w", path, err))
+			continue
+		}
+		status[name] = *validity
+	}
+
+	if !reflect.DeepEqual(current, status) {
+		value, err := status.Marshal()
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		err = metadata.ApplyLabelsAndAnnotations(sc.ctx, sc.client, node, nil,
+			map[string]string{certexpiry.Annotation: value})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error recording certificate status on node %s: %w", node.GetName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
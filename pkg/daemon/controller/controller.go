@@ -23,10 +23,12 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"reflect"
 	"strings"
 	"time"
 
+	syswindows "golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
 	core "k8s.io/api/core/v1"
@@ -56,8 +58,10 @@ import (
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/manager"
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/powershell"
 	"github.com/openshift/windows-machine-config-operator/pkg/daemon/winsvc"
+	"github.com/openshift/windows-machine-config-operator/pkg/filesets"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeutil"
+	"github.com/openshift/windows-machine-config-operator/pkg/prepull"
 	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 )
@@ -73,6 +77,10 @@ type Options struct {
 	cmdRunner powershell.CommandRunner
 	caBundle  string
 	recorder  record.EventRecorder
+	// serviceTrustPath is the location of the file describing which services may be configured
+	serviceTrustPath string
+	// grantAccess grants an account access to a file, directory or named pipe
+	grantAccess func(string, servicescm.PathAccess) error
 }
 
 // setDefaults returns an Options based on the received options, with all nil or empty fields filled in with reasonable
@@ -102,6 +110,12 @@ func setDefaults(o Options) (Options, error) {
 	if o.cmdRunner == nil {
 		o.cmdRunner = powershell.NewCommandRunner()
 	}
+	if o.serviceTrustPath == "" {
+		o.serviceTrustPath = windows.ServiceTrustPath
+	}
+	if o.grantAccess == nil {
+		o.grantAccess = grantFileAccess
+	}
 	return o, nil
 }
 
@@ -116,9 +130,16 @@ type ServiceController struct {
 	caBundle       string
 	// recorder to generate events
 	recorder record.EventRecorder
+	// serviceTrustPath is the location of the file describing which services may be configured
+	serviceTrustPath string
+	// grantAccess grants an account access to a file, directory or named pipe
+	grantAccess func(string, servicescm.PathAccess) error
+	// imagePuller pulls the images listed for the node in the background
+	imagePuller *imagePuller
 }
 
-// Bootstrap starts all Windows services marked as necessary for node bootstrapping as defined in the given data
+// Bootstrap starts all Windows services marked as necessary for node bootstrapping as defined in the given data, and
+// prepares the accounts of the services which do not run as LocalSystem
 func (sc *ServiceController) Bootstrap(desiredVersion string) error {
 	var cm core.ConfigMap
 	err := sc.client.Get(sc.ctx,
@@ -130,7 +151,10 @@ func (sc *ServiceController) Bootstrap(desiredVersion string) error {
 	if err != nil {
 		return err
 	}
-	return sc.reconcileServices(cmData.GetBootstrapServices())
+	if err := sc.reconcileServices(cmData.GetBootstrapServices(), desiredVersion); err != nil {
+		return err
+	}
+	return sc.prepareAccounts(cmData.Services, desiredVersion)
 }
 
 // RunController is the entry point of WICD's controller functionality
@@ -139,6 +163,8 @@ func RunController(ctx context.Context, watchNamespace, kubeconfig, caBundle str
 	if err != nil {
 		return err
 	}
+	// The token in the kubeconfig is short-lived, and is rotated by WMCO while the controller runs
+	withKubeconfigToken(cfg, kubeconfig)
 	// This is a client that reads directly from the server, not a cached client. This is required to be used here, as
 	// the cached client, created by ctrl.NewManager() will not be functional until the manager is started.
 	directClient, err := NewDirectClient(cfg)
@@ -161,6 +187,8 @@ func RunController(ctx context.Context, watchNamespace, kubeconfig, caBundle str
 				watchNamespace: {},
 			},
 		},
+		// WICD is only permitted to get the file set Secrets by name, so they must not be cached
+		Client: client.Options{Cache: &client.CacheOptions{DisableFor: []client.Object{&core.Secret{}}}},
 		Scheme: directClient.Scheme(),
 		Logger: klog.NewKlogr(),
 	})
@@ -175,6 +203,13 @@ func RunController(ctx context.Context, watchNamespace, kubeconfig, caBundle str
 	if err = sc.SetupWithManager(ctx, ctrlMgr); err != nil {
 		return err
 	}
+	err = ctrlMgr.Add(&credentialReporter{cfg: cfg, kubeconfig: kubeconfig, nodeName: node.Name})
+	if err != nil {
+		return err
+	}
+	if err = ctrlMgr.Add(sc.imagePuller); err != nil {
+		return err
+	}
 	klog.Info("Starting manager, awaiting events")
 	if err := ctrlMgr.Start(ctx); err != nil {
 		return err
@@ -188,8 +223,11 @@ func NewServiceController(ctx context.Context, nodeName, watchNamespace string,
 	if err != nil {
 		return nil, err
 	}
-	return &ServiceController{client: o.Client, Manager: o.Mgr, ctx: ctx, nodeName: nodeName, psCmdRunner: o.cmdRunner,
-		watchNamespace: watchNamespace, caBundle: o.caBundle, recorder: o.recorder}, nil
+	sc := &ServiceController{client: o.Client, Manager: o.Mgr, ctx: ctx, nodeName: nodeName, psCmdRunner: o.cmdRunner,
+		watchNamespace: watchNamespace, caBundle: o.caBundle, recorder: o.recorder,
+		serviceTrustPath: o.serviceTrustPath, grantAccess: o.grantAccess}
+	sc.imagePuller = newImagePuller(sc)
+	return sc, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -215,7 +253,9 @@ func (sc *ServiceController) SetupWithManager(ctx context.Context, mgr ctrl.Mana
 		},
 	}
 	cmPredicate := predicate.NewPredicateFuncs(func(object client.Object) bool {
-		return strings.HasPrefix(object.GetName(), servicescm.NamePrefix)
+		_, isPrePullList := object.GetLabels()[prepull.ListLabel]
+		return strings.HasPrefix(object.GetName(), servicescm.NamePrefix) ||
+			object.GetName() == filesets.IndexConfigMap || isPrePullList
 	})
 	rebootPredicate := predicate.NewPredicateFuncs(func(object client.Object) bool {
 		return !isAwaitingReboot(object)
@@ -261,6 +301,14 @@ func (sc *ServiceController) Reconcile(_ context.Context, req ctrl.Request) (res
 		return ctrl.Result{}, nil
 	}
 
+	// Apply the files published by WMCO before the certificates are reconciled, as the trusted CA bundle is one of them.
+	// A failure to apply a file set should not block the rest of the node's configuration. The error is returned once
+	// the rest of the reconciliation is complete, so that only the failed file sets are retried with backoff.
+	fileSetsErr := sc.reconcileFileSets(node)
+	// Kubelet rotates its own certificates, so their validity is recorded on every reconcile rather than only when WMCO
+	// publishes a change
+	certExpiryErr := sc.reconcileCertExpiry(node)
+
 	// Fetch the CM of the desired version
 	var cm core.ConfigMap
 	if err := sc.client.Get(sc.ctx,
@@ -282,7 +330,7 @@ func (sc *ServiceController) Reconcile(_ context.Context, req ctrl.Request) (res
 		return ctrl.Result{}, nil
 	}
 	// Reconcile state of Windows services with the ConfigMap data
-	if err = sc.reconcileServices(cmData.Services); err != nil {
+	if err = sc.reconcileServices(cmData.Services, desiredVersion); err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -293,7 +341,10 @@ func (sc *ServiceController) Reconcile(_ context.Context, req ctrl.Request) (res
 	if err = metadata.ApplyVersionAnnotation(sc.ctx, sc.client, node, desiredVersion); err != nil {
 		return ctrl.Result{}, fmt.Errorf("error updating version annotation on node %s: %w", sc.nodeName, err)
 	}
-	return ctrl.Result{}, nil
+	// Pre-pull the images listed for the node once it is configured. The images are pulled in the background, as each
+	// pull can take several minutes.
+	sc.imagePuller.Notify()
+	return ctrl.Result{}, errors.Join(fileSetsErr, certExpiryErr)
 }
 
 // reconcileEnvVarsAndCerts ensures environment variables and certificates exist as expected, or are safely rectified.
@@ -350,13 +401,26 @@ func (sc *ServiceController) reconcileEnvVarsAndCerts(envVars map[string]string,
 }
 
 // reconcileServices ensures that all the services passed in via the services slice are created, configured properly
-// and started
-func (sc *ServiceController) reconcileServices(services []servicescm.Service) error {
+// and started. Services are only configured if they are allow-listed or signed by the operator for the given version of
+// the services ConfigMap, otherwise an error is returned.
+func (sc *ServiceController) reconcileServices(services []servicescm.Service, version string) error {
+	if len(services) == 0 {
+		return nil
+	}
+	trust, err := sc.loadServiceTrust()
+	if err != nil {
+		return err
+	}
 	existingSvcs, err := sc.GetServices()
 	if err != nil {
 		return fmt.Errorf("could not determine existing Windows services: %w", err)
 	}
 	for _, service := range services {
+		// The service is verified as given in the ConfigMap, before any variables are resolved
+		if err := trust.Verify(service, version); err != nil {
+			sc.recordServiceRejection(service.Name, err)
+			return fmt.Errorf("refusing to configure service %s: %w", service.Name, err)
+		}
 		var winSvcObj winsvc.Service
 		if _, present := existingSvcs[service.Name]; !present {
 			// create a service placeholder
@@ -392,6 +456,10 @@ func (sc *ServiceController) reconcileService(service winsvc.Service, expected s
 		return err
 	}
 
+	// The HNS networks created by the service must be recreated for changes to their arguments to take effect. A
+	// service without an existing command is a newly created placeholder, whose networks do not exist yet.
+	recreateNetworks := config.BinaryPathName != "" &&
+		hnsNetworkArgsChanged(config.BinaryPathName, cmd, expected.HNSNetworkArgs)
 	updateRequired := false
 	if config.BinaryPathName != cmd {
 		config.BinaryPathName = cmd
@@ -409,21 +477,126 @@ func (sc *ServiceController) reconcileService(service winsvc.Service, expected s
 		updateRequired = true
 	}
 
-	if updateRequired {
+	if accountChanged(config.ServiceStartName, expected) {
+		config.ServiceStartName = expected.AccountName()
+		updateRequired = true
+	}
+	// The virtual account of a service only exists if the service has its own SID
+	if expected.Account != nil && config.SidType != syswindows.SERVICE_SID_TYPE_UNRESTRICTED {
+		config.SidType = syswindows.SERVICE_SID_TYPE_UNRESTRICTED
+		updateRequired = true
+	}
+	updatePrivileges, err := privilegesChanged(service, expected)
+	if err != nil {
+		return err
+	}
+
+	if updateRequired || updatePrivileges {
 		klog.Infof("updating service %s", expected.Name)
 		// Always ensure the service isn't running before updating its config, just to be safe
 		if err := sc.EnsureServiceState(service, svc.Stopped); err != nil {
 			return err
 		}
+		// The HNS networks are removed while the service and all services depending on it are stopped, the service
+		// recreates them on start
+		if recreateNetworks && len(expected.HNSNetworks) > 0 {
+			if err := sc.removeHNSNetworks(expected.HNSNetworks); err != nil {
+				return fmt.Errorf("error removing HNS networks of service %s: %w", expected.Name, err)
+			}
+		}
 		err = service.UpdateConfig(config)
 		if err != nil {
 			return fmt.Errorf("error updating service config: %w", err)
 		}
+		if updatePrivileges {
+			if err = service.SetRequiredPrivileges(expected.Privileges()); err != nil {
+				return err
+			}
+		}
+	}
+	// The account's groups and access are reconciled even if the service is unchanged, as they can be modified
+	// independently of the service
+	if err = sc.reconcileAccount(expected); err != nil {
+		return err
 	}
 	// always ensure service is started
 	return sc.EnsureServiceState(service, svc.Running)
 }
 
+// removeHNSNetworks removes the given HNS networks, waiting until each is confirmed to no longer exist
+func (sc *ServiceController) removeHNSNetworks(networks []string) error {
+	for _, network := range networks {
+		getCmd, err := getHNSNetworkCmd(network)
+		if err != nil {
+			return err
+		}
+		klog.Infof("removing HNS network %s", network)
+		if out, err := sc.psCmdRunner.Run(getCmd + " | Remove-HnsNetwork"); err != nil {
+			return fmt.Errorf("error removing HNS network %s with output %s: %w", network, out, err)
+		}
+		err = wait.PollUntilContextTimeout(sc.ctx, 5*time.Second, 2*time.Minute, true,
+			func(ctx context.Context) (bool, error) {
+				out, err := sc.psCmdRunner.Run(getCmd)
+				if err != nil {
+					// The connection to the HNS service can be briefly lost while networks are being removed
+					klog.Infof("error checking for HNS network %s: %s", network, err)
+					return false, nil
+				}
+				return strings.TrimSpace(out) == "", nil
+			})
+		if err != nil {
+			return fmt.Errorf("timed out waiting for HNS network %s to be removed: %w", network, err)
+		}
+	}
+	return nil
+}
+
+// getHNSNetworkCmd returns the PowerShell command to get the HNS network with the given name. The name is validated
+// again and escaped, as it is given as a single quoted string within the command.
+func getHNSNetworkCmd(network string) (string, error) {
+	if err := servicescm.ValidateHNSNetworkName(network); err != nil {
+		return "", err
+	}
+	return "Get-HnsNetwork | Where-Object { $_.Name -eq " + singleQuote(network) + " }", nil
+}
+
+// singleQuote returns the given string as a PowerShell single quoted string, doubling any quote characters PowerShell
+// treats as single quotes so that they are taken literally
+func singleQuote(value string) string {
+	escaped := strings.NewReplacer("'", "''", "\u2018", "\u2018\u2018", "\u2019", "\u2019\u2019",
+		"\u201a", "\u201a\u201a", "\u201b", "\u201b\u201b").Replace(value)
+	return "'" + escaped + "'"
+}
+
+// hnsNetworkArgsChanged returns true if the value of any of the given command line flags differs between the two
+// commands
+func hnsNetworkArgsChanged(previousCmd, cmd string, args []string) bool {
+	for _, arg := range args {
+		if argValue(previousCmd, arg) != argValue(cmd, arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// argValue returns the value given to the command line flag in the command, either as "--flag value" or as
+// "--flag=value", or an empty string if the flag is not present
+func argValue(cmd, flag string) string {
+	fields := strings.Fields(cmd)
+	for i, field := range fields {
+		if field == flag {
+			if i+1 < len(fields) {
+				return fields[i+1]
+			}
+			return ""
+		}
+		if value, found := strings.CutPrefix(field, flag+"="); found {
+			return value
+		}
+	}
+	return ""
+}
+
 // expectedServiceCommand returns the full command that the given service should run with
 func (sc *ServiceController) expectedServiceCommand(expected servicescm.Service) (string, error) {
 	var nodeVars, psVars map[string]string
@@ -504,6 +677,27 @@ func (sc *ServiceController) resolvePowershellVariables(svc servicescm.Service)
 	return vars, nil
 }
 
+// loadServiceTrust reads the description of the services which may be configured, published by WMCO
+func (sc *ServiceController) loadServiceTrust() (*servicescm.ServiceTrust, error) {
+	data, err := os.ReadFile(sc.serviceTrustPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service trust, the instance must be reconfigured: %w", err)
+	}
+	return servicescm.ParseServiceTrust(data)
+}
+
+// recordServiceRejection emits a warning event on the node, describing the service which was not configured. No event
+// is emitted while bootstrapping, as the node may not exist yet.
+func (sc *ServiceController) recordServiceRejection(service string, reason error) {
+	if sc.recorder == nil || sc.nodeName == "" {
+		return
+	}
+	// Node events are keyed by name, the same way the kubelet emits them
+	node := &core.ObjectReference{Kind: "Node", Name: sc.nodeName, UID: types.UID(sc.nodeName)}
+	sc.recorder.Eventf(node, core.EventTypeWarning, "WindowsServiceRejected",
+		"Refused to configure service %s: %v", service, reason)
+}
+
 // resolveVariablesInPath converts placeholder command line arguments passed through in the NodeArgs into their actual values
 func (sc *ServiceController) resolveVariablesInPath(script servicescm.PowershellPreScript) (servicescm.PowershellPreScript, error) {
 	if len(script.NodeArgs) != 0 {
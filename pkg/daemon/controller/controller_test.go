@@ -4,18 +4,26 @@ package controller
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	syswindows "golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -282,6 +290,87 @@ func TestResolvePowershellVariables(t *testing.T) {
 	}
 }
 
+func TestReconcileServicesVerifiesTrust(t *testing.T) {
+	publicKey, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	svc := servicescm.Service{Name: "fakeservice", Command: "fakeservice -v"}
+	forged := signedService(t, signingKey, svc, "1.0.0")
+	forged.Command = "evil.exe"
+
+	testIO := []struct {
+		name        string
+		service     servicescm.Service
+		allowed     []servicescm.Service
+		missingFile bool
+		expectErr   bool
+	}{
+		{name: "Allow-listed service", service: svc, allowed: []servicescm.Service{svc}},
+		{name: "Signed service", service: signedService(t, signingKey, svc, "1.0.0")},
+		{name: "Service neither signed nor allow-listed", service: svc, expectErr: true},
+		{name: "Service signed by another key", service: signedService(t, otherKey, svc, "1.0.0"), expectErr: true},
+		{name: "Service signed for another operator version", service: signedService(t, signingKey, svc, "0.9.0"),
+			expectErr: true},
+		{name: "Signed service with a modified command", service: forged, expectErr: true},
+		{name: "Missing trust file", service: signedService(t, signingKey, svc, "1.0.0"), missingFile: true,
+			expectErr: true},
+	}
+	for _, test := range testIO {
+		t.Run(test.name, func(t *testing.T) {
+			trustPath := writeServiceTrust(t, publicKey, test.allowed)
+			if test.missingFile {
+				trustPath = filepath.Join(t.TempDir(), "missing.json")
+			}
+			recorder := record.NewFakeRecorder(1)
+			winSvcMgr := fake.NewTestMgr(make(map[string]*fake.FakeService))
+			c, err := NewServiceController(context.Background(), "node", wmcoNamespace, Options{
+				Client:           clientfake.NewClientBuilder().Build(),
+				Mgr:              winSvcMgr,
+				cmdRunner:        &fakePSCmdRunner{},
+				recorder:         recorder,
+				serviceTrustPath: trustPath,
+			})
+			require.NoError(t, err)
+			err = c.reconcileServices([]servicescm.Service{test.service}, "1.0.0")
+			createdServices, listErr := getAllFakeServices(winSvcMgr)
+			require.NoError(t, listErr)
+			if test.expectErr {
+				require.Error(t, err)
+				assert.Empty(t, createdServices, "a rejected service must not be created")
+				if !test.missingFile {
+					require.Len(t, recorder.Events, 1)
+					assert.Contains(t, <-recorder.Events, "WindowsServiceRejected")
+				}
+				return
+			}
+			require.NoError(t, err)
+			testServicesCreatedAsExpected(t, createdServices, map[string]string{"fakeservice": "fakeservice -v"})
+			assert.Empty(t, recorder.Events)
+		})
+	}
+}
+
+// signedService returns the given service signed by the given key for the given operator version
+func signedService(t *testing.T, key ed25519.PrivateKey, svc servicescm.Service,
+	version string) servicescm.Service {
+	data := &servicescm.Data{Services: []servicescm.Service{svc}}
+	require.NoError(t, data.Sign(key, version))
+	return data.Services[0]
+}
+
+// writeServiceTrust writes a service trust file accepting services signed by the given key, and the given services.
+// Returns the path of the file.
+func writeServiceTrust(t *testing.T, key ed25519.PublicKey, allowed []servicescm.Service) string {
+	trust, err := servicescm.NewServiceTrust(key, allowed)
+	require.NoError(t, err)
+	contents, err := json.Marshal(trust)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), windows.ServiceTrustFile)
+	require.NoError(t, os.WriteFile(path, contents, 0600))
+	return path
+}
+
 func TestReconcileService(t *testing.T) {
 	testIO := []struct {
 		name                  string
@@ -458,7 +547,203 @@ func TestReconcileService(t *testing.T) {
 	}
 }
 
+func TestReconcileServiceRemovesHNSNetworks(t *testing.T) {
+	testIO := []struct {
+		name            string
+		currentCommand  string
+		expectedRemoval bool
+	}{
+		{
+			name:            "network argument changed",
+			currentCommand:  "fakeservice --port 4789",
+			expectedRemoval: true,
+		},
+		{
+			name:            "network argument given with equals sign changed",
+			currentCommand:  "fakeservice --port=4789",
+			expectedRemoval: true,
+		},
+		{
+			name:            "network argument added",
+			currentCommand:  "fakeservice",
+			expectedRemoval: true,
+		},
+		{
+			name:            "configuration unchanged",
+			currentCommand:  "fakeservice --port 4800",
+			expectedRemoval: false,
+		},
+		{
+			name:            "other argument changed",
+			currentCommand:  "fakeservice --port 4800 --loglevel 5",
+			expectedRemoval: false,
+		},
+		{
+			name:            "new service",
+			currentCommand:  "",
+			expectedRemoval: false,
+		},
+	}
+	for _, test := range testIO {
+		t.Run(test.name, func(t *testing.T) {
+			service := fake.NewFakeService("fakeservice", mgr.Config{BinaryPathName: test.currentCommand,
+				Description: "OpenShift managed fakeservice"}, svc.Status{State: svc.Running})
+			runner := &recordingPSCmdRunner{}
+			c, err := NewServiceController(context.Background(), "node", wmcoNamespace, Options{
+				Client: clientfake.NewClientBuilder().WithObjects(&core.Node{
+					ObjectMeta: meta.ObjectMeta{
+						Name: "node",
+					},
+				}).Build(),
+				Mgr:       fake.NewTestMgr(map[string]*fake.FakeService{"fakeservice": service}),
+				cmdRunner: runner,
+			})
+			require.NoError(t, err)
+			err = c.reconcileService(service, servicescm.Service{
+				Name:           "fakeservice",
+				Command:        "fakeservice --port 4800",
+				HNSNetworks:    []string{"network1", "network2"},
+				HNSNetworkArgs: []string{"--port"},
+			})
+			require.NoError(t, err)
+			removalCmds := 0
+			for _, cmd := range runner.cmds {
+				if strings.HasSuffix(cmd, "Remove-HnsNetwork") {
+					removalCmds++
+				}
+			}
+			if test.expectedRemoval {
+				assert.Equal(t, 2, removalCmds)
+			} else {
+				assert.Zero(t, removalCmds)
+			}
+			serviceStatus, _ := service.Query()
+			assert.Equal(t, svc.Running, serviceStatus.State)
+		})
+	}
+}
+
+func TestGetHNSNetworkCmd(t *testing.T) {
+	cmd, err := getHNSNetworkCmd("OVNKubernetesHybridOverlayNetwork")
+	require.NoError(t, err)
+	assert.Equal(t, "Get-HnsNetwork | Where-Object { $_.Name -eq 'OVNKubernetesHybridOverlayNetwork' }", cmd)
+
+	_, err = getHNSNetworkCmd("network'; Remove-Item C:\\k -Recurse; '")
+	assert.Error(t, err)
+	assert.Equal(t, "'it''s \u2019quoted\u2019\u2019'", singleQuote("it's \u2019quoted\u2019"))
+}
+
+func TestReconcileServiceAccount(t *testing.T) {
+	account := &servicescm.ServiceAccount{
+		Name:               "NT SERVICE\\fakeservice",
+		RequiredPrivileges: []string{"SeCreateGlobalPrivilege"},
+		Groups:             []string{"S-1-5-32-558"},
+		Access:             []servicescm.PathAccess{{Path: "C:\\k\\fakeservice.exe"}, {Path: "C:\\var\\log", Write: true}},
+	}
+	testIO := []struct {
+		name               string
+		currentAccount     string
+		currentPrivileges  []string
+		account            *servicescm.ServiceAccount
+		expectedAccount    string
+		expectedPrivileges []string
+		expectedCmds       []string
+		expectedAccess     []servicescm.PathAccess
+	}{
+		{
+			name:    "LocalSystem unchanged",
+			account: nil,
+		},
+		{
+			name:               "LocalSystem to virtual account",
+			account:            account,
+			expectedAccount:    "NT SERVICE\\fakeservice",
+			expectedPrivileges: []string{"SeChangeNotifyPrivilege", "SeCreateGlobalPrivilege"},
+			expectedCmds:       []string{windows.GroupMemberCmd("S-1-5-32-558", "NT SERVICE\\fakeservice")},
+			expectedAccess:     account.Access,
+		},
+		{
+			// the groups and access of the account are reconciled even though the service is unchanged
+			name:               "virtual account unchanged",
+			currentAccount:     "NT SERVICE\\fakeservice",
+			currentPrivileges:  []string{"SeCreateGlobalPrivilege", "SeChangeNotifyPrivilege"},
+			account:            account,
+			expectedAccount:    "NT SERVICE\\fakeservice",
+			expectedPrivileges: []string{"SeCreateGlobalPrivilege", "SeChangeNotifyPrivilege"},
+			expectedCmds:       []string{windows.GroupMemberCmd("S-1-5-32-558", "NT SERVICE\\fakeservice")},
+			expectedAccess:     account.Access,
+		},
+		{
+			name:              "virtual account to LocalSystem",
+			currentAccount:    "NT SERVICE\\fakeservice",
+			currentPrivileges: []string{"SeCreateGlobalPrivilege", "SeChangeNotifyPrivilege"},
+			account:           nil,
+			expectedAccount:   servicescm.LocalSystemAccount,
+		},
+	}
+	for _, test := range testIO {
+		t.Run(test.name, func(t *testing.T) {
+			sidType := uint32(0)
+			if test.currentAccount != "" {
+				sidType = syswindows.SERVICE_SID_TYPE_UNRESTRICTED
+			}
+			service := fake.NewFakeService("fakeservice", mgr.Config{BinaryPathName: "fakeservice",
+				Description: "OpenShift managed fakeservice", ServiceStartName: test.currentAccount, SidType: sidType},
+				svc.Status{State: svc.Running})
+			require.NoError(t, service.SetRequiredPrivileges(test.currentPrivileges))
+			runner := &recordingPSCmdRunner{}
+			var granted []servicescm.PathAccess
+			c, err := NewServiceController(context.Background(), "node", wmcoNamespace, Options{
+				Client: clientfake.NewClientBuilder().WithObjects(&core.Node{
+					ObjectMeta: meta.ObjectMeta{
+						Name: "node",
+					},
+				}).Build(),
+				Mgr:       fake.NewTestMgr(map[string]*fake.FakeService{"fakeservice": service}),
+				cmdRunner: runner,
+				grantAccess: func(name string, access servicescm.PathAccess) error {
+					assert.Equal(t, test.account.Name, name)
+					granted = append(granted, access)
+					return nil
+				},
+			})
+			require.NoError(t, err)
+			err = c.reconcileService(service, servicescm.Service{
+				Name:    "fakeservice",
+				Command: "fakeservice",
+				Account: test.account,
+			})
+			require.NoError(t, err)
+			config, err := service.Config()
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedAccount, config.ServiceStartName)
+			if test.account != nil {
+				assert.Equal(t, uint32(syswindows.SERVICE_SID_TYPE_UNRESTRICTED), config.SidType)
+			}
+			privileges, err := service.RequiredPrivileges()
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedPrivileges, privileges)
+			assert.Equal(t, test.expectedCmds, runner.cmds)
+			assert.Equal(t, test.expectedAccess, granted)
+			serviceStatus, _ := service.Query()
+			assert.Equal(t, svc.Running, serviceStatus.State)
+		})
+	}
+}
+
+// recordingPSCmdRunner records the commands it is given, returning no output for each
+type recordingPSCmdRunner struct {
+	cmds []string
+}
+
+func (r *recordingPSCmdRunner) Run(cmd string) (string, error) {
+	r.cmds = append(r.cmds, cmd)
+	return "", nil
+}
+
 func TestBootstrap(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
 	testIO := []struct {
 		name                         string
 		configMapServices            []servicescm.Service
@@ -541,9 +826,10 @@ func TestBootstrap(t *testing.T) {
 
 			winSvcMgr := fake.NewTestMgr(make(map[string]*fake.FakeService))
 			sc, err := NewServiceController(context.Background(), "", wmcoNamespace, Options{
-				Client:    clientfake.NewClientBuilder().WithObjects(clusterObjs...).Build(),
-				Mgr:       winSvcMgr,
-				cmdRunner: &fakePSCmdRunner{},
+				Client:           clientfake.NewClientBuilder().WithObjects(clusterObjs...).Build(),
+				Mgr:              winSvcMgr,
+				cmdRunner:        &fakePSCmdRunner{},
+				serviceTrustPath: writeServiceTrust(t, publicKey, test.configMapServices),
 			})
 			require.NoError(t, err)
 
@@ -558,7 +844,63 @@ func TestBootstrap(t *testing.T) {
 	}
 }
 
+func TestBootstrapPreparesAccounts(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	account := &servicescm.ServiceAccount{
+		Name:   "NT SERVICE\\test2",
+		Groups: []string{windows.HyperVAdministratorsSID},
+		Access: []servicescm.PathAccess{{Path: "C:\\var\\log\\test2", Write: true}},
+	}
+	services := []servicescm.Service{
+		{Name: "test1", Command: "test1", Bootstrap: true, Priority: 0},
+		{Name: "test2", Command: "test2", Bootstrap: false, Priority: 1, Account: account},
+		{Name: "test3", Command: "test3", Bootstrap: false, Priority: 2},
+	}
+	desiredVersion := "testversion"
+	cm, err := servicescm.Generate(servicescm.NamePrefix+desiredVersion, wmcoNamespace,
+		&servicescm.Data{Services: services, Files: []servicescm.FileInfo{}})
+	require.NoError(t, err)
+	winSvcMgr := fake.NewTestMgr(make(map[string]*fake.FakeService))
+	runner := &recordingPSCmdRunner{}
+	var granted []servicescm.PathAccess
+	sc, err := NewServiceController(context.Background(), "", wmcoNamespace, Options{
+		Client:           clientfake.NewClientBuilder().WithObjects(cm).Build(),
+		Mgr:              winSvcMgr,
+		cmdRunner:        runner,
+		serviceTrustPath: writeServiceTrust(t, publicKey, services),
+		grantAccess: func(name string, access servicescm.PathAccess) error {
+			assert.Equal(t, account.Name, name)
+			granted = append(granted, access)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, sc.Bootstrap(desiredVersion))
+
+	createdServices, err := getAllFakeServices(winSvcMgr)
+	require.NoError(t, err)
+	require.Len(t, createdServices, 2)
+	// the service running as an account is created so that its account exists, but is not configured or started
+	placeholder, present := createdServices["test2"]
+	require.True(t, present)
+	config, err := placeholder.Config()
+	require.NoError(t, err)
+	assert.Empty(t, config.BinaryPathName)
+	assert.Equal(t, account.Name, config.ServiceStartName)
+	assert.Equal(t, uint32(syswindows.SERVICE_SID_TYPE_UNRESTRICTED), config.SidType)
+	assert.Equal(t, "OpenShift managed test2", config.Description)
+	status, err := placeholder.Query()
+	require.NoError(t, err)
+	assert.Equal(t, svc.Stopped, status.State)
+	assert.Equal(t, []string{windows.GroupMemberCmd(windows.HyperVAdministratorsSID, account.Name)}, runner.cmds)
+	assert.Equal(t, account.Access, granted)
+}
+
 func TestReconcile(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
 	testIO := []struct {
 		name                         string
 		existingServices             map[string]*fake.FakeService
@@ -775,6 +1117,7 @@ func TestReconcile(t *testing.T) {
 						"[Environment]::GetEnvironmentVariable('NO_PROXY', 'Process')":    test.existingEnvVars["NO_PROXY"],
 					},
 				},
+				serviceTrustPath: writeServiceTrust(t, publicKey, test.configMapServices),
 			})
 			_, err = c.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node"}})
 			if test.expectErr {
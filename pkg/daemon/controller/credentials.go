@@ -0,0 +1,114 @@
+//go:build windows
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/wicdauth"
+)
+
+const (
+	// credentialReportPeriod is how often WICD reports the credentials held by its kubeconfig
+	credentialReportPeriod = time.Minute
+	// tokenRereadPeriod is how often the token is re-read from the kubeconfig, picking up rotated tokens
+	tokenRereadPeriod = time.Minute
+)
+
+// kubeconfigTokenSource provides the token held by the WICD kubeconfig, which is replaced as tokens are rotated
+type kubeconfigTokenSource struct {
+	path string
+}
+
+// Token fulfills the oauth2.TokenSource interface
+func (k *kubeconfigTokenSource) Token() (*oauth2.Token, error) {
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return nil, err
+	}
+	token, err := wicdauth.KubeconfigToken(data)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: token, TokenType: "Bearer", Expiry: time.Now().Add(tokenRereadPeriod)}, nil
+}
+
+// withKubeconfigToken configures the given client config to authenticate with the token currently held by the given
+// kubeconfig, rather than the token held at startup, so that long-running clients survive token rotations
+func withKubeconfigToken(cfg *rest.Config, kubeconfig string) {
+	cfg.BearerToken = ""
+	cfg.WrapTransport = transport.TokenSourceWrapTransport(
+		transport.NewCachedTokenSource(&kubeconfigTokenSource{path: kubeconfig}))
+}
+
+// credentialReporter reports the ID of the credentials held by the WICD kubeconfig on the node, once WICD has
+// authenticated with them. WMCO distributes new credentials to the instance as part of their rotation, and revokes the
+// previous credentials once the new ones are reported.
+type credentialReporter struct {
+	// cfg is the configuration of the API server WICD connects to
+	cfg        *rest.Config
+	kubeconfig string
+	nodeName   string
+}
+
+// Start fulfills the manager.Runnable interface, periodically reporting the credentials in use until the context is
+// cancelled
+func (c *credentialReporter) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.report(ctx); err != nil {
+			klog.Errorf("unable to report credentials: %v", err)
+		}
+	}, credentialReportPeriod)
+	return nil
+}
+
+// report records the ID of the credentials held by the kubeconfig on the node, if it is not already recorded
+func (c *credentialReporter) report(ctx context.Context) error {
+	data, err := os.ReadFile(c.kubeconfig)
+	if err != nil {
+		return err
+	}
+	token, err := wicdauth.KubeconfigToken(data)
+	if err != nil {
+		return err
+	}
+	claims, err := wicdauth.ParseClaims(token)
+	if err != nil {
+		return err
+	}
+	// Authenticate with the token read, rather than the cached token, so a successful report proves the new
+	// credentials work
+	cfg := rest.CopyConfig(c.cfg)
+	cfg.BearerToken = token
+	cfg.BearerTokenFile = ""
+	cfg.WrapTransport = nil
+	directClient, err := NewDirectClient(cfg)
+	if err != nil {
+		return err
+	}
+	node := &core.Node{}
+	if err = directClient.Get(ctx, client.ObjectKey{Name: c.nodeName}, node); err != nil {
+		return fmt.Errorf("unable to get node %s: %w", c.nodeName, err)
+	}
+	if node.GetAnnotations()[wicdauth.CredentialAnnotation] == claims.ID {
+		return nil
+	}
+	if err = metadata.ApplyLabelsAndAnnotations(ctx, directClient, *node, nil,
+		map[string]string{wicdauth.CredentialAnnotation: claims.ID}); err != nil {
+		return fmt.Errorf("error reporting credentials on node %s: %w", c.nodeName, err)
+	}
+	klog.Infof("using credentials %s, expiring at %s", claims.ID, claims.Expiry.Format(time.RFC3339))
+	return nil
+}
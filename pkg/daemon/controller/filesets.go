@@ -0,0 +1,64 @@
+//go:build windows
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/filesets"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+)
+
+// reconcileFileSets applies each file set published by WMCO which has not yet been applied to this instance, and
+// records the applied generation of each on the given node. A failure to apply one file set does not prevent the
+// others from being applied, and is reported as an event on the node.
+func (sc *ServiceController) reconcileFileSets(node core.Node) error {
+	index := &core.ConfigMap{}
+	err := sc.client.Get(sc.ctx, client.ObjectKey{Namespace: sc.watchNamespace, Name: filesets.IndexConfigMap}, index)
+	if err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			// nothing has been published yet
+			return nil
+		}
+		return fmt.Errorf("unable to get ConfigMap %s: %w", filesets.IndexConfigMap, err)
+	}
+	entries, err := filesets.ParseIndex(index)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[string]string)
+	var errs []error
+	for _, name := range filesets.Names() {
+		entry, published := entries[name]
+		if !published || filesets.IsApplied(&node, name, entry.Generation) {
+			continue
+		}
+		fileSet, err := filesets.Fetch(sc.ctx, sc.client, sc.watchNamespace, name, entry)
+		if err == nil {
+			err = filesets.Apply(fileSet)
+		}
+		if err != nil {
+			sc.recorder.Eventf(&node, core.EventTypeWarning, "FileSetApplyFailed",
+				"failed to apply generation %d of file set %s: %v", entry.Generation, name, err)
+			errs = append(errs, fmt.Errorf("error applying file set %s: %w", name, err))
+			continue
+		}
+		klog.Infof("applied file set %s generation %d to %s", name, entry.Generation, fileSet.Directory())
+		applied[filesets.AppliedAnnotation(name)] = strconv.FormatInt(entry.Generation, 10)
+	}
+
+	if len(applied) > 0 {
+		if err = metadata.ApplyLabelsAndAnnotations(sc.ctx, sc.client, node, nil, applied); err != nil {
+			errs = append(errs, fmt.Errorf("error recording applied file sets on node %s: %w", node.GetName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
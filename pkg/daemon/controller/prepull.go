@@ -0,0 +1,192 @@
+//go:build windows
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/credentialprovider"
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/cri"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/prepull"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+const (
+	// imagePullTimeout is the maximum amount of time given to pull a single image. Windows images can be several GB.
+	imagePullTimeout = 30 * time.Minute
+	// maxPullErrorLength limits the length of the pull error recorded for each image in the node's status annotation
+	maxPullErrorLength = 256
+	// minPullRetryInterval is the initial delay before failed pulls are retried
+	minPullRetryInterval = 30 * time.Second
+	// maxPullRetryInterval is the maximum delay before failed pulls are retried
+	maxPullRetryInterval = 10 * time.Minute
+)
+
+// imagePuller pulls the images listed for the node in the background, so that pulls taking up to imagePullTimeout
+// each do not block the reconciliation of the node's services. Pulls are started whenever the controller signals that
+// the node has been reconciled, and failed pulls are retried with backoff.
+type imagePuller struct {
+	sc *ServiceController
+	// trigger holds a pending request to pull the images listed for the node
+	trigger chan struct{}
+}
+
+// newImagePuller returns a pointer to a new imagePuller for the node of the given controller
+func newImagePuller(sc *ServiceController) *imagePuller {
+	return &imagePuller{sc: sc, trigger: make(chan struct{}, 1)}
+}
+
+// Notify requests the images listed for the node to be pulled, without waiting for the pulls. Requests made while
+// images are being pulled are coalesced into a single request, handled once the current pulls are complete.
+func (p *imagePuller) Notify() {
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Start fulfills the manager.Runnable interface, pulling images whenever requested until the context is cancelled.
+// Requests made while failed pulls are waiting to be retried are handled by the retry, so that the periodic
+// reconciliation of the node does not bypass the backoff.
+func (p *imagePuller) Start(ctx context.Context) error {
+	backoff := minPullRetryInterval
+	retry := time.NewTimer(backoff)
+	retry.Stop()
+	defer retry.Stop()
+	// trigger is nil while a retry is pending, disabling requests
+	trigger := p.trigger
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-trigger:
+		case <-retry.C:
+		}
+		// Drop any request made since, the pulls below handle the latest image lists
+		select {
+		case <-p.trigger:
+		default:
+		}
+		if err := p.pullImages(ctx); err != nil {
+			klog.Errorf("image pre-pull failed, retrying in %s: %v", backoff, err)
+			retry.Reset(backoff)
+			backoff = min(2*backoff, maxPullRetryInterval)
+			trigger = nil
+			continue
+		}
+		backoff = minPullRetryInterval
+		trigger = p.trigger
+	}
+}
+
+// pullImages pulls each image listed for the node which is not present on the instance, recording the pull status of
+// each listed image on the node as it is pulled. A failure to pull one image does not prevent the others from being
+// pulled, and is reported as an event on the node.
+func (p *imagePuller) pullImages(ctx context.Context) error {
+	sc := p.sc
+	var node core.Node
+	if err := sc.client.Get(ctx, types.NamespacedName{Name: sc.nodeName}, &node); err != nil {
+		return err
+	}
+	lists, parseErrs, err := prepull.GetLists(ctx, sc.client, sc.watchNamespace)
+	if err != nil {
+		return err
+	}
+	for _, parseErr := range parseErrs {
+		// invalid lists are reported by WMCO, the remaining lists are still pulled
+		klog.Errorf("ignoring image pre-pull list: %v", parseErr)
+	}
+	images, _ := prepull.ImagesForNode(lists, node.GetLabels())
+	current, err := prepull.GetStatus(&node)
+	if err != nil {
+		klog.Errorf("discarding recorded image pre-pull status: %v", err)
+		current = make(prepull.Status)
+	}
+
+	// Images no longer listed for the node are dropped from its status, the status of the others is kept until they
+	// are checked so that previously pulled images are not reported as pending
+	status := make(prepull.Status, len(images))
+	for _, image := range images {
+		if imageStatus, ok := current[image]; ok {
+			status[image] = imageStatus
+		}
+	}
+	if err = p.recordStatus(ctx, &node, current, status); err != nil || len(images) == 0 {
+		return err
+	}
+
+	imageClient, err := cri.NewImageClient()
+	if err != nil {
+		return err
+	}
+	defer imageClient.Close()
+	var errs []error
+	for _, image := range images {
+		previous := maps.Clone(status)
+		if err = p.ensureImage(ctx, imageClient, image); err != nil {
+			sc.recorder.Eventf(&node, core.EventTypeWarning, "ImagePrePullFailed", "failed to pull image %s: %v",
+				image, err)
+			errs = append(errs, err)
+			message := err.Error()
+			if len(message) > maxPullErrorLength {
+				message = message[:maxPullErrorLength]
+			}
+			status[image] = prepull.ImageStatus{Error: message}
+		} else {
+			status[image] = prepull.ImageStatus{Pulled: true}
+		}
+		// The status is recorded after each image, so that progress is reported while the remaining images are pulled
+		if err = p.recordStatus(ctx, &node, previous, status); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// recordStatus records the given pull status on the node if it differs from the previously recorded status
+func (p *imagePuller) recordStatus(ctx context.Context, node *core.Node, previous, status prepull.Status) error {
+	if reflect.DeepEqual(previous, status) {
+		return nil
+	}
+	value, err := status.Marshal()
+	if err != nil {
+		return err
+	}
+	err = metadata.ApplyLabelsAndAnnotations(ctx, p.sc.client, *node, nil,
+		map[string]string{prepull.StatusAnnotation: value})
+	if err != nil {
+		return fmt.Errorf("error recording image pre-pull status on node %s: %w", node.GetName(), err)
+	}
+	return nil
+}
+
+// ensureImage pulls the given image if it is not present on the instance. Credentials for the image are taken from
+// the registry credential store, if it exists. Otherwise containerd authenticates with any credentials given by the
+// registry host configuration.
+func (p *imagePuller) ensureImage(ctx context.Context, imageClient *cri.ImageClient, image string) error {
+	present, err := imageClient.IsPresent(ctx, image)
+	if err != nil || present {
+		return err
+	}
+	auth, err := credentialprovider.Lookup(windows.RegistryCredentialStorePath, image)
+	if err != nil {
+		return err
+	}
+	pullCtx, cancel := context.WithTimeout(ctx, imagePullTimeout)
+	defer cancel()
+	if err = imageClient.Pull(pullCtx, image, auth); err != nil {
+		return err
+	}
+	klog.Infof("pre-pulled image %s", image)
+	return nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentialprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	credentialproviderv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+	"k8s.io/kubernetes/pkg/credentialprovider"
+)
+
+// CacheDuration is how long kubelet caches the credentials returned by the credential provider. Updates to the
+// credential store are picked up by kubelet within this duration.
+const CacheDuration = 5 * time.Minute
+
+// Respond reads a kubelet CredentialProviderRequest from the given reader, and writes the CredentialProviderResponse
+// holding the credentials within the credential store at the given path to the given writer. kubelet matches the image
+// against the registries of the returned credentials itself, so the full store is returned and cached globally.
+func Respond(in io.Reader, storePath string, out io.Writer) error {
+	var request credentialproviderv1.CredentialProviderRequest
+	if err := json.NewDecoder(in).Decode(&request); err != nil {
+		return fmt.Errorf("unable to decode credential provider request: %w", err)
+	}
+	if request.Image == "" {
+		return fmt.Errorf("credential provider request does not specify an image")
+	}
+	auth, err := readStore(storePath)
+	if err != nil {
+		return err
+	}
+	response := credentialproviderv1.CredentialProviderResponse{
+		TypeMeta: meta.TypeMeta{
+			APIVersion: credentialproviderv1.SchemeGroupVersion.String(),
+			Kind:       "CredentialProviderResponse",
+		},
+		CacheKeyType:  credentialproviderv1.GlobalPluginCacheKeyType,
+		CacheDuration: &meta.Duration{Duration: CacheDuration},
+		Auth:          auth,
+	}
+	if err = json.NewEncoder(out).Encode(&response); err != nil {
+		return fmt.Errorf("unable to encode credential provider response: %w", err)
+	}
+	return nil
+}
+
+// Lookup returns the credentials within the credential store at the given path which apply to the given image. Returns
+// nil if the store does not exist or holds no credentials for the image.
+func Lookup(storePath, image string) (*credentialproviderv1.AuthConfig, error) {
+	auth, err := readStore(storePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	dockerConfig := make(credentialprovider.DockerConfig, len(auth))
+	for registry, entry := range auth {
+		dockerConfig[registry] = credentialprovider.DockerConfigEntry{Username: entry.Username, Password: entry.Password}
+	}
+	keyring := &credentialprovider.BasicDockerKeyring{}
+	keyring.Add(dockerConfig)
+	matches, found := keyring.Lookup(image)
+	if !found || len(matches) == 0 {
+		return nil, nil
+	}
+	return &credentialproviderv1.AuthConfig{Username: matches[0].Username, Password: matches[0].Password}, nil
+}
+
+// readStore returns the credentials within the credential store at the given path, keyed by the registry they apply
+// to. A missing store is an error rather than an empty set of credentials, so that kubelet does not cache the absence
+// of credentials while WICD is yet to write the store.
+func readStore(storePath string) (map[string]credentialproviderv1.AuthConfig, error) {
+	contents, err := os.ReadFile(storePath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read credential store: %w", err)
+	}
+	var store credentialprovider.DockerConfigJSON
+	if err = json.Unmarshal(contents, &store); err != nil {
+		return nil, fmt.Errorf("unable to parse credential store: %w", err)
+	}
+	auth := make(map[string]credentialproviderv1.AuthConfig, len(store.Auths))
+	for registry, entry := range store.Auths {
+		auth[matchImage(registry)] = credentialproviderv1.AuthConfig{Username: entry.Username,
+			Password: entry.Password}
+	}
+	return auth, nil
+}
+
+// matchImage returns the given pull secret registry key in the form kubelet expects of the keys of a credential
+// provider response, which do not include a URL scheme or registry API path
+func matchImage(registry string) string {
+	for _, scheme := range []string{"https://", "http://"} {
+		registry = strings.TrimPrefix(registry, scheme)
+	}
+	registry = strings.TrimSuffix(registry, "/")
+	for _, apiPath := range []string{"/v1", "/v2"} {
+		registry = strings.TrimSuffix(registry, apiPath)
+	}
+	return registry
+}
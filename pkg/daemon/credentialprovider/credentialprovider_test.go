@@ -0,0 +1,120 @@
+package credentialprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	credentialproviderv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+)
+
+const request = `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest",` +
+	`"image":"registry.example.com/org/image:latest"}`
+
+func TestRespond(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "config.json")
+	store := `{"auths":{` +
+		`"registry.example.com":{"auth":"dXNlcjpwYXNz"},` +
+		`"https://mirror.example.com:5000/v2/":{"username":"mirror","password":"secret"}}}`
+	require.NoError(t, os.WriteFile(storePath, []byte(store), 0600))
+
+	var out bytes.Buffer
+	require.NoError(t, Respond(strings.NewReader(request), storePath, &out))
+	var response credentialproviderv1.CredentialProviderResponse
+	require.NoError(t, json.Unmarshal(out.Bytes(), &response))
+
+	assert.Equal(t, "credentialprovider.kubelet.k8s.io/v1", response.APIVersion)
+	assert.Equal(t, "CredentialProviderResponse", response.Kind)
+	assert.Equal(t, credentialproviderv1.GlobalPluginCacheKeyType, response.CacheKeyType)
+	require.NotNil(t, response.CacheDuration)
+	assert.Equal(t, CacheDuration, response.CacheDuration.Duration)
+	assert.Equal(t, map[string]credentialproviderv1.AuthConfig{
+		"registry.example.com":    {Username: "user", Password: "pass"},
+		"mirror.example.com:5000": {Username: "mirror", Password: "secret"},
+	}, response.Auth)
+}
+
+func TestRespondErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalidStore := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalidStore, []byte("not json"), 0600))
+	validStore := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(validStore, []byte(`{"auths":{}}`), 0600))
+
+	testCases := []struct {
+		name      string
+		request   string
+		storePath string
+	}{
+		{
+			name:      "missing store",
+			request:   request,
+			storePath: filepath.Join(dir, "missing.json"),
+		},
+		{
+			name:      "invalid store",
+			request:   request,
+			storePath: invalidStore,
+		},
+		{
+			name:      "invalid request",
+			request:   "{",
+			storePath: validStore,
+		},
+		{
+			name:      "request without image",
+			request:   `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest"}`,
+			storePath: validStore,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.Error(t, Respond(strings.NewReader(test.request), test.storePath, &out))
+			assert.Empty(t, out.Bytes())
+		})
+	}
+}
+
+func TestMatchImage(t *testing.T) {
+	testCases := []struct {
+		registry string
+		expected string
+	}{
+		{registry: "quay.io", expected: "quay.io"},
+		{registry: "https://index.docker.io/v1/", expected: "index.docker.io"},
+		{registry: "http://registry.example.com:5000", expected: "registry.example.com:5000"},
+		{registry: "registry.example.com/org", expected: "registry.example.com/org"},
+	}
+	for _, test := range testCases {
+		t.Run(test.registry, func(t *testing.T) {
+			assert.Equal(t, test.expected, matchImage(test.registry))
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	storePath := filepath.Join(dir, "config.json")
+	store := `{"auths":{"registry.example.com":{"username":"user","password":"pass"}}}`
+	require.NoError(t, os.WriteFile(storePath, []byte(store), 0600))
+
+	auth, err := Lookup(storePath, "registry.example.com/org/image:latest")
+	require.NoError(t, err)
+	require.NotNil(t, auth)
+	assert.Equal(t, credentialproviderv1.AuthConfig{Username: "user", Password: "pass"}, *auth)
+
+	auth, err = Lookup(storePath, "quay.io/org/image:latest")
+	require.NoError(t, err)
+	assert.Nil(t, auth)
+
+	// a missing store holds no credentials
+	auth, err = Lookup(filepath.Join(dir, "missing.json"), "registry.example.com/org/image:latest")
+	require.NoError(t, err)
+	assert.Nil(t, auth)
+}
@@ -0,0 +1,79 @@
+//go:build windows
+
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cri
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/Microsoft/go-winio"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+	credentialproviderv1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+// ImageClient manages images through the CRI image service of the instance's containerd. Images pulled through the CRI
+// are pulled the same way kubelet pulls them, using the registry host configuration and mirrors given to containerd.
+type ImageClient struct {
+	conn    *grpc.ClientConn
+	service runtimeapi.ImageServiceClient
+}
+
+// NewImageClient returns a client of containerd's CRI image service. The connection is established on first use.
+func NewImageClient() (*ImageClient, error) {
+	conn, err := grpc.NewClient("passthrough:///containerd",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return winio.DialPipeContext(ctx, windows.ContainerdPipePath)
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create CRI client: %w", err)
+	}
+	return &ImageClient{conn: conn, service: runtimeapi.NewImageServiceClient(conn)}, nil
+}
+
+// IsPresent returns true if the given image is present on the instance
+func (c *ImageClient) IsPresent(ctx context.Context, image string) (bool, error) {
+	resp, err := c.service.ImageStatus(ctx, &runtimeapi.ImageStatusRequest{Image: &runtimeapi.ImageSpec{Image: image}})
+	if err != nil {
+		return false, fmt.Errorf("unable to get status of image %s: %w", image, err)
+	}
+	return resp.GetImage() != nil, nil
+}
+
+// Pull pulls the given image, authenticating with the given credentials if they are not nil
+func (c *ImageClient) Pull(ctx context.Context, image string, auth *credentialproviderv1.AuthConfig) error {
+	req := &runtimeapi.PullImageRequest{Image: &runtimeapi.ImageSpec{Image: image}}
+	if auth != nil {
+		req.Auth = &runtimeapi.AuthConfig{Username: auth.Username, Password: auth.Password}
+	}
+	if _, err := c.service.PullImage(ctx, req); err != nil {
+		return fmt.Errorf("unable to pull image %s: %w", image, err)
+	}
+	return nil
+}
+
+// Close closes the connection to containerd
+func (c *ImageClient) Close() error {
+	return c.conn.Close()
+}
@@ -33,7 +33,9 @@ const systemEnvVarRegistryPath = `SYSTEM\CurrentControlSet\Control\Session Manag
 // pick up the updated values.
 func Reconcile(envVars map[string]string, watchedEnvVars []string) (bool, error) {
 	envVarsUpdated := false
-	registryKey, err := registry.OpenKey(registry.LOCAL_MACHINE, systemEnvVarRegistryPath, registry.ALL_ACCESS)
+	// Only the access WMCO grants WICD when it runs as a service account is requested
+	registryKey, err := registry.OpenKey(registry.LOCAL_MACHINE, systemEnvVarRegistryPath,
+		registry.QUERY_VALUE|registry.SET_VALUE)
 	if err != nil {
 		return false, fmt.Errorf("unable to open Windows system registry key %s: %w",
 			systemEnvVarRegistryPath, err)
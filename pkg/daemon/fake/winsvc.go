@@ -10,10 +10,11 @@ import (
 )
 
 type FakeService struct {
-	name        string
-	config      mgr.Config
-	status      svc.Status
-	serviceList *fakeServiceList
+	name               string
+	config             mgr.Config
+	status             svc.Status
+	requiredPrivileges []string
+	serviceList        *fakeServiceList
 }
 
 func (f *FakeService) Close() error {
@@ -97,6 +98,15 @@ func (f *FakeService) UpdateConfig(config mgr.Config) error {
 	return nil
 }
 
+func (f *FakeService) RequiredPrivileges() ([]string, error) {
+	return f.requiredPrivileges, nil
+}
+
+func (f *FakeService) SetRequiredPrivileges(privileges []string) error {
+	f.requiredPrivileges = privileges
+	return nil
+}
+
 func (f *FakeService) ListDependentServices(_ svc.ActivityStatus) ([]string, error) {
 	var dependencies []string
 	for _, listedService := range f.serviceList.listServiceNames() {
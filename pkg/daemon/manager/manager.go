@@ -31,6 +31,18 @@ type Manager interface {
 	Disconnect() error
 }
 
+const (
+	// scManagerAccess is the access to the service manager required to manage services. It is requested in place of
+	// full access, which is not granted to WICD when it runs as a service account.
+	scManagerAccess = windows.SC_MANAGER_CONNECT | windows.SC_MANAGER_CREATE_SERVICE | windows.SC_MANAGER_ENUMERATE_SERVICE
+	// serviceAccess is the access to a service required to manage it, which excludes changing the service's access
+	// rules and owner
+	serviceAccess = windows.SERVICE_QUERY_CONFIG | windows.SERVICE_CHANGE_CONFIG | windows.SERVICE_QUERY_STATUS |
+		windows.SERVICE_ENUMERATE_DEPENDENTS | windows.SERVICE_START | windows.SERVICE_STOP |
+		windows.SERVICE_PAUSE_CONTINUE | windows.SERVICE_INTERROGATE | windows.SERVICE_USER_DEFINED_CONTROL |
+		windows.DELETE | windows.READ_CONTROL
+)
+
 // enumServiceStatus implements the ENUM_SERVICE_STATUS type as defined in the Windows API
 type enumServiceStatus struct {
 	ServiceName   *uint16
@@ -53,7 +65,53 @@ type manager mgr.Mgr
 func (m *manager) CreateService(name, exepath string, config mgr.Config, args ...string) (winsvc.Service, error) {
 	underlyingMgr := (*mgr.Mgr)(m)
 	service, err := underlyingMgr.CreateService(name, exepath, config, args...)
-	return winsvc.Service(service), err
+	if err != nil {
+		return nil, err
+	}
+	if err := grantCreatorAccess(service); err != nil {
+		// the service could not be managed through its name, remove it so that it is created again
+		deleteErr := service.Delete()
+		service.Close()
+		return nil, errors.Join(fmt.Errorf("unable to grant access to service %q: %w", name, err), deleteErr)
+	}
+	return winsvc.New(service), nil
+}
+
+// grantCreatorAccess allows the account of the current process to manage the given service it created, which the
+// default access rules of services only allow for administrators. Nothing is done if the process has administrative
+// rights.
+func grantCreatorAccess(service *mgr.Service) error {
+	token := windows.GetCurrentProcessToken()
+	if token.IsElevated() {
+		return nil
+	}
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return fmt.Errorf("unable to get process account: %w", err)
+	}
+	sd, err := windows.GetSecurityInfo(service.Handle, windows.SE_SERVICE, windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return fmt.Errorf("unable to get security descriptor: %w", err)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return fmt.Errorf("unable to get DACL: %w", err)
+	}
+	acl, err := windows.ACLFromEntries([]windows.EXPLICIT_ACCESS{{
+		AccessPermissions: serviceAccess,
+		AccessMode:        windows.GRANT_ACCESS,
+		Inheritance:       windows.NO_INHERITANCE,
+		Trustee: windows.TRUSTEE{
+			TrusteeForm:  windows.TRUSTEE_IS_SID,
+			TrusteeType:  windows.TRUSTEE_IS_USER,
+			TrusteeValue: windows.TrusteeValueFromSID(user.User.Sid),
+		},
+	}}, dacl)
+	if err != nil {
+		return fmt.Errorf("unable to build DACL: %w", err)
+	}
+	return windows.SetSecurityInfo(service.Handle, windows.SE_SERVICE, windows.DACL_SECURITY_INFORMATION, nil, nil,
+		acl, nil)
 }
 
 func (m *manager) GetServices() (map[string]struct{}, error) {
@@ -73,13 +131,28 @@ func (m *manager) GetServices() (map[string]struct{}, error) {
 }
 
 func (m *manager) OpenService(name string) (winsvc.Service, error) {
-	underlyingMgr := (*mgr.Mgr)(m)
-	return underlyingMgr.OpenService(name)
+	service, err := m.openService(name)
+	if err != nil {
+		return nil, err
+	}
+	return winsvc.New(service), nil
+}
+
+// openService opens the service of the given name with the access required to manage it
+func (m *manager) openService(name string) (*mgr.Service, error) {
+	namePtr, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := windows.OpenService(m.Handle, namePtr, serviceAccess)
+	if err != nil {
+		return nil, err
+	}
+	return &mgr.Service{Name: name, Handle: handle}, nil
 }
 
 func (m *manager) DeleteService(name string) error {
-	manager := (*mgr.Mgr)(m)
-	service, err := manager.OpenService(name)
+	service, err := m.openService(name)
 	if err != nil {
 		// Nothing to do if it already does not exist
 		if errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
@@ -89,7 +162,7 @@ func (m *manager) DeleteService(name string) error {
 	}
 	defer service.Close()
 	// Ensure service is stopped before deleting
-	if err = m.EnsureServiceState(service, svc.Stopped); err != nil {
+	if err = m.EnsureServiceState(winsvc.New(service), svc.Stopped); err != nil {
 		return fmt.Errorf("failed to stop service %q: %w", name, err)
 	}
 	if err = service.Delete(); err != nil {
@@ -115,10 +188,11 @@ func (m *manager) EnsureServiceState(service winsvc.Service, state svc.State) er
 	case svc.Stopped:
 		// Before we can stop this service, we need to make sure all services dependent on this service are stopped
 		// The service must be cast to the actual type so we can get its handle
-		winSvc, ok := service.(*mgr.Service)
+		wrapped, ok := service.(interface{ Unwrap() *mgr.Service })
 		if !ok {
 			return fmt.Errorf("service is not correct type")
 		}
+		winSvc := wrapped.Unwrap()
 		dependentServices, err := winSvc.ListDependentServices(svc.AnyActivity)
 		if err != nil {
 			return fmt.Errorf("error finding dependent services: %w", err)
@@ -156,15 +230,21 @@ func (m *manager) stopServiceAndProcess(winSvc *mgr.Service) error {
 		pHandle, err = windows.OpenProcess(windows.PROCESS_TERMINATE|windows.PROCESS_QUERY_INFORMATION, false,
 			status.ProcessId)
 		if err != nil {
-			return fmt.Errorf("unable to open service's associated process: %w", err)
+			// The process of a service running as another account cannot be opened without administrative rights, in
+			// which case the service is stopped without waiting on its process
+			if !errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+				return fmt.Errorf("unable to open service's associated process: %w", err)
+			}
+			pHandle = 0
+		} else {
+			defer windows.CloseHandle(pHandle)
 		}
-		defer windows.CloseHandle(pHandle)
 	}
 	_, err = winSvc.Control(svc.Stop)
 	if err != nil {
 		return err
 	}
-	if status.ProcessId != 0 {
+	if pHandle != 0 {
 		if err = waitForProcessToStop(pHandle); err != nil {
 			// Terminate the process if it does not exit on its own
 			if err = windows.TerminateProcess(pHandle, uint32(1)); err != nil {
@@ -181,12 +261,11 @@ func (m *manager) Disconnect() error {
 }
 
 func New() (Manager, error) {
-	newMgr, err := mgr.Connect()
+	handle, err := windows.OpenSCManager(nil, nil, scManagerAccess)
 	if err != nil {
 		return nil, err
 	}
-
-	return (*manager)(newMgr), nil
+	return (*manager)(&mgr.Mgr{Handle: handle}), nil
 }
 
 // waitForProcessToStop waits until the process has exited
@@ -3,8 +3,12 @@
 package winsvc
 
 import (
+	"errors"
 	"fmt"
+	"unicode/utf16"
+	"unsafe"
 
+	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -20,6 +24,83 @@ type Service interface {
 	Query() (svc.Status, error)
 	UpdateConfig(mgr.Config) error
 	ListDependentServices(status svc.ActivityStatus) ([]string, error)
+	// RequiredPrivileges returns the privileges the service's process is restricted to, empty if it is not restricted
+	RequiredPrivileges() ([]string, error)
+	// SetRequiredPrivileges restricts the service's process to the given privileges, lifting the restriction if empty.
+	// Takes effect the next time the service is started.
+	SetRequiredPrivileges([]string) error
+}
+
+// serviceRequiredPrivilegesInfo implements the SERVICE_REQUIRED_PRIVILEGES_INFO type as defined in the Windows API
+type serviceRequiredPrivilegesInfo struct {
+	// RequiredPrivileges is a double null-terminated list of null-terminated privilege names
+	RequiredPrivileges *uint16
+}
+
+// service extends mgr.Service with the configuration it does not expose
+type service struct {
+	*mgr.Service
+}
+
+// New returns the given Windows service as a Service
+func New(s *mgr.Service) Service {
+	return &service{s}
+}
+
+// Unwrap returns the underlying Windows service
+func (s *service) Unwrap() *mgr.Service {
+	return s.Service
+}
+
+func (s *service) RequiredPrivileges() ([]string, error) {
+	size := uint32(1024)
+	for {
+		buf := make([]byte, size)
+		err := windows.QueryServiceConfig2(s.Handle, windows.SERVICE_CONFIG_REQUIRED_PRIVILEGES_INFO, &buf[0], size,
+			&size)
+		if err == nil {
+			info := (*serviceRequiredPrivilegesInfo)(unsafe.Pointer(&buf[0]))
+			return fromMultiString(info.RequiredPrivileges), nil
+		}
+		if !errors.Is(err, windows.ERROR_INSUFFICIENT_BUFFER) {
+			return nil, fmt.Errorf("error querying required privileges of service %s: %w", s.Name, err)
+		}
+	}
+}
+
+func (s *service) SetRequiredPrivileges(privileges []string) error {
+	multiString := toMultiString(privileges)
+	info := serviceRequiredPrivilegesInfo{RequiredPrivileges: &multiString[0]}
+	err := windows.ChangeServiceConfig2(s.Handle, windows.SERVICE_CONFIG_REQUIRED_PRIVILEGES_INFO,
+		(*byte)(unsafe.Pointer(&info)))
+	if err != nil {
+		return fmt.Errorf("error setting required privileges of service %s: %w", s.Name, err)
+	}
+	return nil
+}
+
+// toMultiString returns the given strings as a double null-terminated list of null-terminated UTF-16 strings
+func toMultiString(values []string) []uint16 {
+	if len(values) == 0 {
+		return []uint16{0, 0}
+	}
+	var multiString []uint16
+	for _, value := range values {
+		multiString = append(multiString, utf16.Encode([]rune(value))...)
+		multiString = append(multiString, 0)
+	}
+	return append(multiString, 0)
+}
+
+// fromMultiString returns the strings of the given double null-terminated list of null-terminated UTF-16 strings
+func fromMultiString(p *uint16) []string {
+	var values []string
+	for p != nil && *p != 0 {
+		value := windows.UTF16PtrToString(p)
+		values = append(values, value)
+		p = (*uint16)(unsafe.Add(unsafe.Pointer(p), (len(utf16.Encode([]rune(value)))+1)*2))
+	}
+	return values
 }
 
 // WaitForState retries until the services reaches the expected state, or reaches timeout
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package filesets
+
+import "os"
+
+// restrictAccess limits access to the given directory to its owner
+func restrictAccess(dir string) error {
+	return os.Chmod(dir, 0700)
+}
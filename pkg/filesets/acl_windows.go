@@ -0,0 +1,28 @@
+//go:build windows
+
+package filesets
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// restrictedDirSDDL describes a protected DACL granting full control to SYSTEM and the built-in Administrators group
+// only, inherited by all files and directories created within the directory
+const restrictedDirSDDL = "D:P(A;OICI;FA;;;SY)(A;OICI;FA;;;BA)"
+
+// restrictAccess replaces the access rules of the given directory, so that it is only accessible by SYSTEM and
+// administrators. Rules inherited from the parent directory are dropped.
+func restrictAccess(dir string) error {
+	sd, err := windows.SecurityDescriptorFromString(restrictedDirSDDL)
+	if err != nil {
+		return fmt.Errorf("unable to parse security descriptor: %w", err)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return fmt.Errorf("unable to get DACL: %w", err)
+	}
+	return windows.SetNamedSecurityInfo(dir, windows.SE_FILE_OBJECT,
+		windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION, nil, nil, dacl, nil)
+}
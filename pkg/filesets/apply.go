@@ -0,0 +1,110 @@
+package filesets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// stagingSuffix is appended to a directory to form the directory a file set is written to before being swapped in
+	stagingSuffix = ".staging"
+	// backupSuffix is appended to a directory to form the location the previous contents are kept during the swap
+	backupSuffix = ".old"
+)
+
+// Apply places the files of the given file set in its directory on this instance. Each file is replaced atomically.
+// If the file set is exclusive, the directory is written in full to a staging directory first, which then replaces
+// the existing directory, so that readers observe either the previous or the new contents of the directory. The
+// access rules of a restricted file set are applied to the staging directory before any file is written to it.
+func Apply(fs *FileSet) error {
+	if fs.Exclusive() {
+		return replaceDir(fs.Directory(), fs.Files, fs.Restricted())
+	}
+	return writeFiles(fs.Directory(), fs.Files)
+}
+
+// replaceDir replaces the contents of the given directory with the given files, restricting access to the directory if
+// restricted is true
+func replaceDir(dir string, files map[string][]byte, restricted bool) error {
+	staging := dir + stagingSuffix
+	backup := dir + backupSuffix
+	// Remove anything left behind by a previous attempt
+	for _, leftover := range []string{staging, backup} {
+		if err := os.RemoveAll(leftover); err != nil {
+			return fmt.Errorf("unable to remove %s: %w", leftover, err)
+		}
+	}
+	if err := os.MkdirAll(staging, os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create %s: %w", staging, err)
+	}
+	if restricted {
+		// Files created within the directory inherit its access rules
+		if err := restrictAccess(staging); err != nil {
+			return fmt.Errorf("unable to restrict access to %s: %w", staging, err)
+		}
+	}
+	for path, contents := range files {
+		if err := writeFile(filepath.Join(staging, path), contents); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(dir); err == nil {
+		if err = os.Rename(dir, backup); err != nil {
+			return fmt.Errorf("unable to move %s aside: %w", dir, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("unable to stat %s: %w", dir, err)
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		// Restore the previous contents, leaving the directory as it was found
+		if restoreErr := os.Rename(backup, dir); restoreErr != nil && !os.IsNotExist(restoreErr) {
+			return fmt.Errorf("unable to move %s into place: %w, and unable to restore previous contents: %v",
+				staging, err, restoreErr)
+		}
+		return fmt.Errorf("unable to move %s into place: %w", staging, err)
+	}
+	if err := os.RemoveAll(backup); err != nil {
+		return fmt.Errorf("unable to remove %s: %w", backup, err)
+	}
+	return nil
+}
+
+// writeFiles writes each of the given files within the given directory, leaving any other files untouched
+func writeFiles(dir string, files map[string][]byte) error {
+	for path, contents := range files {
+		if err := writeFile(filepath.Join(dir, path), contents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile atomically writes the given contents to the given path, by writing to a temporary file in the same
+// directory and renaming it over the destination
+func writeFile(path string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create directory for %s: %w", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(contents); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write %s: %w", tmp.Name(), err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to sync %s: %w", tmp.Name(), err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("unable to close %s: %w", tmp.Name(), err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("unable to move %s into place: %w", path, err)
+	}
+	return nil
+}
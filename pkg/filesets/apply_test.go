@@ -0,0 +1,66 @@
+package filesets
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "registries")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "stale.io"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stale.io", "hosts.toml"), []byte("stale"), os.ModePerm))
+
+	files := map[string][]byte{
+		filepath.Join("registry.io", "hosts.toml"): []byte("server = \"https://registry.io\""),
+		"top-level.toml": []byte("top level"),
+	}
+	require.NoError(t, replaceDir(dir, files, false))
+
+	for path, contents := range files {
+		actual, err := os.ReadFile(filepath.Join(dir, path))
+		require.NoError(t, err)
+		assert.Equal(t, contents, actual)
+	}
+	assert.NoDirExists(t, filepath.Join(dir, "stale.io"))
+	assert.NoDirExists(t, dir+stagingSuffix)
+	assert.NoDirExists(t, dir+backupSuffix)
+}
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "kubelet.exe"), []byte("binary"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "kubelet-ca.crt"), []byte("old"), os.ModePerm))
+
+	require.NoError(t, writeFiles(dir, map[string][]byte{"kubelet-ca.crt": []byte("new")}))
+
+	actual, err := os.ReadFile(filepath.Join(dir, "kubelet-ca.crt"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new"), actual)
+	// Files outside of the set are left untouched
+	actual, err = os.ReadFile(filepath.Join(dir, "kubelet.exe"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("binary"), actual)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestReplaceDirRestricted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("access rules are verified through file modes")
+	}
+	dir := filepath.Join(t.TempDir(), "registry-credentials")
+	require.NoError(t, replaceDir(dir, map[string][]byte{"config.json": []byte("{}")}, true))
+
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	actual, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("{}"), actual)
+}
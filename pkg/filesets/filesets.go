@@ -0,0 +1,313 @@
+package filesets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+const (
+	// IndexConfigMap is the name of the ConfigMap holding the current generation and checksum of each file set.
+	// WICD watches this ConfigMap to learn when a file set must be applied.
+	IndexConfigMap = "windows-file-sets"
+	// secretPrefix is the prefix of the name of the Secrets holding the contents of each file set
+	secretPrefix = "windows-file-set-"
+	// filesKey is the Secret data key holding the files within a file set
+	filesKey = "files"
+	// GenerationAnnotation is applied to file set Secrets, indicating the generation of the contents
+	GenerationAnnotation = "windowsmachineconfig.openshift.io/file-set-generation"
+	// ChecksumAnnotation is applied to file set Secrets, holding the checksum of the contents
+	ChecksumAnnotation = "windowsmachineconfig.openshift.io/file-set-checksum"
+	// AppliedAnnotationPrefix is the prefix of the node annotations recording the generation of each file set applied
+	// to the node
+	AppliedAnnotationPrefix = "windowsmachineconfig.openshift.io/applied-file-set-"
+)
+
+const (
+	// Registry is the file set holding the containerd registry configuration
+	Registry = "registry"
+	// MetricsTLS is the file set holding the TLS certificate and key used by windows_exporter
+	MetricsTLS = "metrics-tls"
+	// KubeletCA is the file set holding the CA kubelet uses to verify API server clients
+	KubeletCA = "kubelet-ca"
+	// TrustedCABundle is the file set holding the CA bundle imported into the instance's trust store
+	TrustedCABundle = "trusted-ca"
+	// RegistryCredentials is the file set holding the registry credential store served by the WICD credential provider
+	RegistryCredentials = "registry-credentials"
+	// CredentialProvider is the file set holding the config of the credential providers run by kubelet
+	CredentialProvider = "credential-provider"
+	// CNIConfig is the file set holding the network configuration of a user provided CNI
+	CNIConfig = "cni-config"
+	// CNIPlugins is the file set holding the plugins of a user provided CNI
+	CNIPlugins = "cni-plugins"
+)
+
+// definition describes where and how a file set is applied on an instance
+type definition struct {
+	// directory is the directory on the instance the files are placed in
+	directory string
+	// exclusive indicates that the directory is replaced as a whole, removing any file which is not in the set
+	exclusive bool
+	// restricted indicates that the directory must only be accessible by SYSTEM and administrators. Only exclusive
+	// file sets can be restricted, as the access rules are set on the directory as a whole.
+	restricted bool
+}
+
+// definitions holds the definition of every known file set. The destination of the files is fixed, and never sourced
+// from the cluster objects.
+var definitions = map[string]definition{
+	Registry:            {directory: windows.ContainerdConfigDir, exclusive: true},
+	MetricsTLS:          {directory: windows.TLSCertsPath, exclusive: true},
+	KubeletCA:           {directory: windows.K8sDir, exclusive: false},
+	TrustedCABundle:     {directory: trustedCABundleDir(), exclusive: false},
+	RegistryCredentials: {directory: windows.RegistryCredentialsDir, exclusive: true, restricted: true},
+	CredentialProvider:  {directory: windows.K8sDir, exclusive: false},
+	CNIConfig:           {directory: windows.CniConfDir, exclusive: true},
+	CNIPlugins:          {directory: windows.CniDir, exclusive: false},
+}
+
+// trustedCABundleDir returns the directory containing the trusted CA bundle file
+func trustedCABundleDir() string {
+	dir, _ := windows.SplitPath(windows.TrustedCABundlePath)
+	return strings.TrimSuffix(dir, "\\")
+}
+
+// Names returns the names of all known file sets, sorted
+func Names() []string {
+	names := make([]string, 0, len(definitions))
+	for name := range definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FileSet is a named set of files which is published by WMCO and applied to each Windows instance by WICD
+type FileSet struct {
+	// Name identifies the file set, and determines where the files are placed on the instance
+	Name string
+	// Files maps the path of each file, relative to the directory of the file set, to its contents
+	Files map[string][]byte
+}
+
+// New returns a new FileSet with the given name and files, erroring if the name is unknown or a path is invalid
+func New(name string, files map[string][]byte) (*FileSet, error) {
+	if _, present := definitions[name]; !present {
+		return nil, fmt.Errorf("unknown file set %s", name)
+	}
+	for path := range files {
+		if err := validatePath(path); err != nil {
+			return nil, fmt.Errorf("invalid file %s in file set %s: %w", path, name, err)
+		}
+	}
+	return &FileSet{Name: name, Files: files}, nil
+}
+
+// validatePath ensures the given path stays within the directory of a file set
+func validatePath(path string) error {
+	if path == "" {
+		return fmt.Errorf("empty path")
+	}
+	// Catch Windows drive and rooted paths regardless of the platform this is running on
+	if filepath.IsAbs(path) || strings.HasPrefix(path, "\\") || strings.HasPrefix(path, "/") ||
+		(len(path) >= 2 && path[1] == ':') {
+		return fmt.Errorf("path must be relative")
+	}
+	for _, element := range strings.FieldsFunc(path, func(r rune) bool { return r == '\\' || r == '/' }) {
+		if element == ".." {
+			return fmt.Errorf("path must not contain '..'")
+		}
+	}
+	return nil
+}
+
+// Directory returns the directory on the instance the file set is applied to
+func (fs *FileSet) Directory() string {
+	return definitions[fs.Name].directory
+}
+
+// Exclusive returns true if applying the file set replaces the whole directory
+func (fs *FileSet) Exclusive() bool {
+	return definitions[fs.Name].exclusive
+}
+
+// Restricted returns true if the directory of the file set must only be accessible by SYSTEM and administrators
+func (fs *FileSet) Restricted() bool {
+	return definitions[fs.Name].restricted
+}
+
+// Checksum returns the sha256 of the file set contents
+func (fs *FileSet) Checksum() string {
+	paths := make([]string, 0, len(fs.Files))
+	for path := range fs.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	hash := sha256.New()
+	for _, path := range paths {
+		// Length prefixes ensure distinct file sets cannot produce the same input
+		fmt.Fprintf(hash, "%d:%s%d:", len(path), path, len(fs.Files[path]))
+		hash.Write(fs.Files[path])
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// Entry describes the published state of a file set
+type Entry struct {
+	// Generation is incremented each time the contents of the file set change
+	Generation int64 `json:"generation"`
+	// Checksum is the checksum of the file set contents
+	Checksum string `json:"checksum"`
+}
+
+// ParseIndex returns the entries within the given index ConfigMap, keyed by file set name
+func ParseIndex(cm *core.ConfigMap) (map[string]Entry, error) {
+	entries := make(map[string]Entry, len(cm.Data))
+	for name, value := range cm.Data {
+		var entry Entry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			return nil, fmt.Errorf("unable to parse entry for file set %s: %w", name, err)
+		}
+		entries[name] = entry
+	}
+	return entries, nil
+}
+
+// SecretName returns the name of the Secret holding the contents of the given file set
+func SecretName(name string) string {
+	return secretPrefix + name
+}
+
+// Publish ensures the contents of the given file set are published to the given namespace, returning the generation of
+// the published contents. The contents are written before the index is updated, so that WICD never observes a
+// generation whose contents are not available.
+func Publish(ctx context.Context, c client.Client, namespace string, fs *FileSet) (int64, error) {
+	index := &core.ConfigMap{}
+	err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: IndexConfigMap}, index)
+	if err != nil {
+		if !k8sapierrors.IsNotFound(err) {
+			return 0, fmt.Errorf("unable to get ConfigMap %s: %w", IndexConfigMap, err)
+		}
+		index = &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: IndexConfigMap, Namespace: namespace}}
+		if err = c.Create(ctx, index); err != nil {
+			return 0, fmt.Errorf("unable to create ConfigMap %s: %w", IndexConfigMap, err)
+		}
+	}
+	entries, err := ParseIndex(index)
+	if err != nil {
+		return 0, err
+	}
+
+	checksum := fs.Checksum()
+	current, published := entries[fs.Name]
+	if published && current.Checksum == checksum {
+		// Recreate the contents if they were removed since being published
+		return current.Generation, ensureSecret(ctx, c, namespace, fs, current)
+	}
+	entry := Entry{Generation: current.Generation + 1, Checksum: checksum}
+	if err = ensureSecret(ctx, c, namespace, fs, entry); err != nil {
+		return 0, err
+	}
+
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	if index.Data == nil {
+		index.Data = make(map[string]string)
+	}
+	index.Data[fs.Name] = string(value)
+	if err = c.Update(ctx, index); err != nil {
+		return 0, fmt.Errorf("unable to update ConfigMap %s: %w", IndexConfigMap, err)
+	}
+	return entry.Generation, nil
+}
+
+// ensureSecret ensures the Secret holding the given file set contents exists for the given entry
+func ensureSecret(ctx context.Context, c client.Client, namespace string, fs *FileSet, entry Entry) error {
+	files, err := json.Marshal(fs.Files)
+	if err != nil {
+		return err
+	}
+	expected := &core.Secret{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      SecretName(fs.Name),
+			Namespace: namespace,
+			Annotations: map[string]string{
+				GenerationAnnotation: strconv.FormatInt(entry.Generation, 10),
+				ChecksumAnnotation:   entry.Checksum,
+			},
+		},
+		Type: core.SecretTypeOpaque,
+		Data: map[string][]byte{filesKey: files},
+	}
+
+	existing := &core.Secret{}
+	err = c.Get(ctx, client.ObjectKeyFromObject(expected), existing)
+	if err != nil {
+		if !k8sapierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to get Secret %s: %w", expected.GetName(), err)
+		}
+		if err = c.Create(ctx, expected); err != nil {
+			return fmt.Errorf("unable to create Secret %s: %w", expected.GetName(), err)
+		}
+		return nil
+	}
+	if existing.GetAnnotations()[GenerationAnnotation] == expected.GetAnnotations()[GenerationAnnotation] &&
+		existing.GetAnnotations()[ChecksumAnnotation] == entry.Checksum {
+		return nil
+	}
+	existing.SetAnnotations(expected.GetAnnotations())
+	existing.Data = expected.Data
+	if err = c.Update(ctx, existing); err != nil {
+		return fmt.Errorf("unable to update Secret %s: %w", expected.GetName(), err)
+	}
+	return nil
+}
+
+// Fetch returns the contents of the given file set matching the given entry. Returns an error if the published
+// contents do not match the entry, which is expected while a new generation is being published.
+func Fetch(ctx context.Context, c client.Client, namespace, name string, entry Entry) (*FileSet, error) {
+	secret := &core.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: SecretName(name)}, secret); err != nil {
+		return nil, fmt.Errorf("unable to get Secret %s: %w", SecretName(name), err)
+	}
+	if secret.GetAnnotations()[GenerationAnnotation] != strconv.FormatInt(entry.Generation, 10) {
+		return nil, fmt.Errorf("file set %s generation %s does not match expected generation %d", name,
+			secret.GetAnnotations()[GenerationAnnotation], entry.Generation)
+	}
+	var files map[string][]byte
+	if err := json.Unmarshal(secret.Data[filesKey], &files); err != nil {
+		return nil, fmt.Errorf("unable to parse file set %s: %w", name, err)
+	}
+	fs, err := New(name, files)
+	if err != nil {
+		return nil, err
+	}
+	if fs.Checksum() != entry.Checksum {
+		return nil, fmt.Errorf("file set %s checksum does not match expected checksum", name)
+	}
+	return fs, nil
+}
+
+// AppliedAnnotation returns the node annotation which records the generation of the given file set applied to the node
+func AppliedAnnotation(name string) string {
+	return AppliedAnnotationPrefix + name
+}
+
+// IsApplied returns true if the given node reports the given generation of the file set as applied
+func IsApplied(node *core.Node, name string, generation int64) bool {
+	return node.GetAnnotations()[AppliedAnnotation(name)] == strconv.FormatInt(generation, 10)
+}
@@ -0,0 +1,112 @@
+package filesets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name        string
+		fileSet     string
+		files       map[string][]byte
+		expectedErr bool
+	}{
+		{
+			name:        "valid files",
+			fileSet:     Registry,
+			files:       map[string][]byte{"registry.io\\hosts.toml": []byte("server = \"https://registry.io\"")},
+			expectedErr: false,
+		},
+		{
+			name:        "unknown file set",
+			fileSet:     "unknown",
+			files:       map[string][]byte{"file": []byte("data")},
+			expectedErr: true,
+		},
+		{
+			name:        "absolute path",
+			fileSet:     MetricsTLS,
+			files:       map[string][]byte{"C:\\Windows\\tls.crt": []byte("data")},
+			expectedErr: true,
+		},
+		{
+			name:        "path escaping the directory",
+			fileSet:     MetricsTLS,
+			files:       map[string][]byte{"..\\..\\tls.crt": []byte("data")},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.fileSet, test.files)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	fs := &FileSet{Name: MetricsTLS, Files: map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")}}
+	same := &FileSet{Name: MetricsTLS, Files: map[string][]byte{"tls.key": []byte("key"), "tls.crt": []byte("cert")}}
+	assert.Equal(t, fs.Checksum(), same.Checksum())
+
+	// Moving bytes between the name and contents of a file must result in a different checksum
+	shifted := &FileSet{Name: MetricsTLS, Files: map[string][]byte{"tls.crtc": []byte("ert"), "tls.key": []byte("key")}}
+	assert.NotEqual(t, fs.Checksum(), shifted.Checksum())
+}
+
+func TestPublishAndFetch(t *testing.T) {
+	ctx := context.Background()
+	namespace := "wmco"
+	c := clientfake.NewClientBuilder().Build()
+
+	fs, err := New(MetricsTLS, map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")})
+	require.NoError(t, err)
+	generation, err := Publish(ctx, c, namespace, fs)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), generation)
+
+	// Publishing the same contents again must not result in a new generation
+	generation, err = Publish(ctx, c, namespace, fs)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), generation)
+
+	updated, err := New(MetricsTLS, map[string][]byte{"tls.crt": []byte("new cert"), "tls.key": []byte("new key")})
+	require.NoError(t, err)
+	generation, err = Publish(ctx, c, namespace, updated)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), generation)
+
+	index := &core.ConfigMap{}
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: IndexConfigMap}, index))
+	entries, err := ParseIndex(index)
+	require.NoError(t, err)
+	require.Contains(t, entries, MetricsTLS)
+
+	fetched, err := Fetch(ctx, c, namespace, MetricsTLS, entries[MetricsTLS])
+	require.NoError(t, err)
+	assert.Equal(t, updated.Files, fetched.Files)
+
+	// Fetching a generation which is not the published one must fail
+	_, err = Fetch(ctx, c, namespace, MetricsTLS, Entry{Generation: 1, Checksum: fs.Checksum()})
+	assert.Error(t, err)
+}
+
+func TestIsApplied(t *testing.T) {
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{
+		Annotations: map[string]string{AppliedAnnotation(Registry): "3"}}}
+	assert.True(t, IsApplied(node, Registry, 3))
+	assert.False(t, IsApplied(node, Registry, 4))
+	assert.False(t, IsApplied(node, MetricsTLS, 3))
+}
@@ -0,0 +1,120 @@
+package imageplatform
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// cgnatNetwork is the shared address space, used by OVN-Kubernetes for its internal networks
+var cgnatNetwork = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// addressGuard refuses addresses internal to the cluster or to the instances it runs on
+type addressGuard struct {
+	// clusterNetworks are the pod and service networks of the cluster
+	clusterNetworks []*net.IPNet
+}
+
+// allowed returns true if the given address is neither a loopback, link-local, private, unspecified or multicast
+// address, nor an address of the cluster's networks
+func (g *addressGuard) allowed(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() ||
+		ip.IsUnspecified() || ip.IsMulticast() || cgnatNetwork.Contains(ip) {
+		return false
+	}
+	return !slices.ContainsFunc(g.clusterNetworks, func(network *net.IPNet) bool { return network.Contains(ip) })
+}
+
+// checkHost returns an error if any address of the given host is refused
+func (g *addressGuard) checkHost(ctx context.Context, host string) error {
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if !g.allowed(address.IP) {
+			return fmt.Errorf("refusing to connect to %s, its address %s is internal", host, address.IP)
+		}
+	}
+	return nil
+}
+
+// dialContext returns a function connecting to the given address with the given dialer, unless the address is refused.
+// The address is checked once resolved, as a host may resolve to another address than the one it was checked with.
+func (g *addressGuard) dialContext(dialer *net.Dialer) func(context.Context, string, string) (net.Conn, error) {
+	guarded := *dialer
+	guarded.ControlContext = func(_ context.Context, _, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !g.allowed(ip) {
+			return fmt.Errorf("refusing to connect to internal address %s", host)
+		}
+		return nil
+	}
+	return guarded.DialContext
+}
+
+// NewClient returns an HTTP client for registries named by the images of pods. The client refuses to connect to
+// loopback, link-local and private addresses, and to the given cluster networks, so that images cannot be used to
+// have requests sent to endpoints internal to the cluster or to its cloud. The proxy set in the environment is used if
+// any, in which case the addresses of registries are checked before requests are sent through it.
+func NewClient(timeout time.Duration, clusterNetworks []*net.IPNet) *http.Client {
+	guard := &addressGuard{clusterNetworks: clusterNetworks}
+	dialer := &net.Dialer{Timeout: timeout}
+	proxyAddresses := environmentProxyAddresses()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		proxy, err := http.ProxyFromEnvironment(req)
+		if err != nil || proxy == nil {
+			return proxy, err
+		}
+		if err := guard.checkHost(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+		return proxy, nil
+	}
+	guardedDial := guard.dialContext(dialer)
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		// The proxy is configured by the cluster administrator, and may have an internal address
+		if slices.Contains(proxyAddresses, address) {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return guardedDial(ctx, network, address)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// environmentProxyAddresses returns the host:port addresses of the proxies set in the environment
+func environmentProxyAddresses() []string {
+	var addresses []string
+	for _, variable := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		value := os.Getenv(variable)
+		if value == "" {
+			continue
+		}
+		proxy, err := url.Parse(value)
+		if err != nil || proxy.Host == "" {
+			// A proxy may be given without a scheme
+			if proxy, err = url.Parse("http://" + value); err != nil {
+				continue
+			}
+		}
+		port := proxy.Port()
+		if port == "" {
+			port = "80"
+			if proxy.Scheme == "https" {
+				port = "443"
+			}
+		}
+		addresses = append(addresses, net.JoinHostPort(proxy.Hostname(), port))
+	}
+	return addresses
+}
@@ -0,0 +1,380 @@
+package imageplatform
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/kubernetes/pkg/credentialprovider"
+)
+
+const (
+	// defaultRegistry is the registry of images whose name does not start with a registry host
+	defaultRegistry = "docker.io"
+	// defaultRegistryAPIHost is the host serving the registry API of the default registry
+	defaultRegistryAPIHost = "registry-1.docker.io"
+	// maxResponseSize bounds the size of the manifests, configs and tokens read from registries
+	maxResponseSize = 4 * 1024 * 1024
+	// cacheTTL is how long the platforms of an image are remembered for
+	cacheTTL = time.Hour
+	// errorCacheTTL is how long a failure to inspect an image is remembered for, so that unreachable registries do not
+	// slow down every request
+	errorCacheTTL = 5 * time.Minute
+	// maxCacheEntries bounds the number of images remembered, the cache is cleared once it is reached
+	maxCacheEntries = 1000
+)
+
+// indexMediaTypes are the media types of manifests listing a manifest for each platform of an image
+var indexMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+}
+
+// manifestMediaTypes are the media types of manifests describing an image for a single platform
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Platform is an operating system an image can be ran on
+type Platform struct {
+	// OS is the operating system, such as windows or linux
+	OS string `json:"os"`
+	// OSVersion is the version of the operating system. For Windows, it is the full build number, e.g.
+	// 10.0.20348.2340.
+	OSVersion string `json:"os.version,omitempty"`
+}
+
+// SupportsWindowsBuild returns true if the given platforms include Windows at the given build, in the format used by
+// the node.kubernetes.io/windows-build label, e.g. 10.0.20348
+func SupportsWindowsBuild(platforms []Platform, build string) bool {
+	for _, p := range platforms {
+		if strings.EqualFold(p.OS, "windows") && (p.OSVersion == build || strings.HasPrefix(p.OSVersion, build+".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// manifest holds the fields of image indexes and manifests needed to find the platforms of an image
+type manifest struct {
+	MediaType string `json:"mediaType"`
+	// Manifests is set for image indexes
+	Manifests []struct {
+		Platform *Platform `json:"platform"`
+	} `json:"manifests"`
+	// Config is set for image manifests
+	Config *struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+}
+
+// cacheEntry holds the result of an image inspection
+type cacheEntry struct {
+	platforms []Platform
+	err       error
+	expiry    time.Time
+}
+
+// Inspector finds the platforms of images by reading their manifests from their registries
+type Inspector struct {
+	client *http.Client
+	// scheme is the scheme registries are accessed with
+	scheme string
+	mu     sync.Mutex
+	cache  map[string]cacheEntry
+}
+
+// NewInspector returns an Inspector accessing registries with the given client
+func NewInspector(client *http.Client) *Inspector {
+	return &Inspector{client: client, scheme: "https", cache: make(map[string]cacheEntry)}
+}
+
+// Platforms returns the platforms the given image can be ran on, authenticating with the credentials from the given
+// keyring if the registry requires it
+func (i *Inspector) Platforms(ctx context.Context, image string, keyring credentialprovider.DockerKeyring) (
+	[]Platform, error) {
+	registry, repository, reference, err := parseReference(image)
+	if err != nil {
+		return nil, err
+	}
+	var credentials []credentialprovider.AuthConfig
+	if keyring != nil {
+		credentials, _ = keyring.Lookup(registry + "/" + repository)
+	}
+	// Inspections are only shared by requests with the same credentials, so that the platforms of a private image are
+	// not given to requests unable to read it
+	key := cacheKey(image, credentials)
+	i.mu.Lock()
+	entry, found := i.cache[key]
+	i.mu.Unlock()
+	if found && time.Now().Before(entry.expiry) {
+		return entry.platforms, entry.err
+	}
+
+	r := &repositoryClient{inspector: i, registry: registry, repository: repository, credentials: credentials}
+	platforms, err := i.inspect(ctx, image, r, reference)
+	// A cancelled request says nothing about the image
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	entry = cacheEntry{platforms: platforms, err: err, expiry: time.Now().Add(cacheTTL)}
+	if err != nil {
+		entry.expiry = time.Now().Add(errorCacheTTL)
+	}
+	i.mu.Lock()
+	if len(i.cache) >= maxCacheEntries {
+		i.cache = make(map[string]cacheEntry)
+	}
+	i.cache[key] = entry
+	i.mu.Unlock()
+	return platforms, err
+}
+
+// cacheKey returns the key of the inspection of the given image with the given credentials
+func cacheKey(image string, credentials []credentialprovider.AuthConfig) string {
+	hash := sha256.New()
+	for _, c := range credentials {
+		hash.Write([]byte(c.Username + "\x00" + c.Password + "\x00"))
+	}
+	return image + "@" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// inspect reads the platforms of the given image, at the given tag or digest, from its repository
+func (i *Inspector) inspect(ctx context.Context, image string, r *repositoryClient, reference string) ([]Platform,
+	error) {
+	body, err := r.get(ctx, "manifests/"+reference, append(indexMediaTypes, manifestMediaTypes...))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get manifest of %s: %w", image, err)
+	}
+	m := &manifest{}
+	if err := json.Unmarshal(body, m); err != nil {
+		return nil, fmt.Errorf("unable to parse manifest of %s: %w", image, err)
+	}
+	if m.Config == nil {
+		var platforms []Platform
+		for _, entry := range m.Manifests {
+			if entry.Platform != nil {
+				platforms = append(platforms, *entry.Platform)
+			}
+		}
+		return platforms, nil
+	}
+	// The platform of an image with a single manifest is given by its config
+	body, err = r.get(ctx, "blobs/"+m.Config.Digest, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get config of %s: %w", image, err)
+	}
+	platform := Platform{}
+	if err := json.Unmarshal(body, &platform); err != nil {
+		return nil, fmt.Errorf("unable to parse config of %s: %w", image, err)
+	}
+	return []Platform{platform}, nil
+}
+
+// parseReference splits the given image into its registry, repository and tag or digest, applying the same defaults
+// as container runtimes
+func parseReference(image string) (string, string, string, error) {
+	name, reference := image, "latest"
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, reference = name[:i], name[i+1:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, reference = name[:i], name[i+1:]
+	}
+	registry, repository := defaultRegistry, name
+	if host, path, found := strings.Cut(name, "/"); found &&
+		(strings.ContainsAny(host, ".:") || host == "localhost") {
+		registry, repository = host, path
+	}
+	if registry == defaultRegistry && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	if repository == "" || reference == "" || strings.ToLower(repository) != repository {
+		return "", "", "", fmt.Errorf("invalid image reference %q", image)
+	}
+	return registry, repository, reference, nil
+}
+
+// repositoryClient reads from a repository of a registry
+type repositoryClient struct {
+	inspector   *Inspector
+	registry    string
+	repository  string
+	credentials []credentialprovider.AuthConfig
+	// authorization is the value of the Authorization header the registry accepted, if any
+	authorization string
+}
+
+// get returns the contents of the given path of the repository. If the registry requires authentication, the
+// credentials of the repository are exchanged for a token.
+func (r *repositoryClient) get(ctx context.Context, path string, accept []string) ([]byte, error) {
+	location := fmt.Sprintf("%s://%s/v2/%s/%s", r.inspector.scheme, r.apiHost(), r.repository, path)
+	resp, err := r.do(ctx, location, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && r.authorization == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if r.authorization, err = r.authorize(ctx, challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = r.do(ctx, location, accept); err != nil {
+			return nil, err
+		}
+	}
+	return readBody(resp)
+}
+
+// apiHost returns the host serving the registry API of the repository's registry
+func (r *repositoryClient) apiHost() string {
+	if r.registry == defaultRegistry {
+		return defaultRegistryAPIHost
+	}
+	return r.registry
+}
+
+// do sends a GET request for the given location, with the given accepted media types
+func (r *repositoryClient) do(ctx context.Context, location string, accept []string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	if r.authorization != "" {
+		req.Header.Set("Authorization", r.authorization)
+	}
+	return r.inspector.client.Do(req)
+}
+
+// authorize returns the Authorization header answering the given authentication challenge
+func (r *repositoryClient) authorize(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if len(r.credentials) == 0 {
+			return "", fmt.Errorf("registry %s requires credentials", r.registry)
+		}
+		credentials := r.credentials[0].Username + ":" + r.credentials[0].Password
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials)), nil
+	case "bearer":
+		token, err := r.token(ctx, parseChallengeParams(params))
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return "", fmt.Errorf("registry %s requested unsupported authentication %q", r.registry, challenge)
+}
+
+// token requests a token granting access to the repository from the realm given by the challenge parameters
+func (r *repositoryClient) token(ctx context.Context, params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("registry %s gave invalid token realm %q", r.registry, params["realm"])
+	}
+	// The credentials of the registry are sent to the realm, which must be served by the registry's own domain
+	registryHost := (&url.URL{Host: r.apiHost()}).Hostname()
+	if realm.Scheme != r.inspector.scheme || !inDomainOf(realm.Hostname(), registryHost) {
+		return "", fmt.Errorf("registry %s gave token realm %s, which is not an %s URL of its domain", r.registry,
+			realm.Redacted(), r.inspector.scheme)
+	}
+	query := realm.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", r.repository)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if len(r.credentials) > 0 {
+		req.SetBasicAuth(r.credentials[0].Username, r.credentials[0].Password)
+	}
+	resp, err := r.inspector.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	body, err := readBody(resp)
+	if err != nil {
+		return "", fmt.Errorf("unable to get token for registry %s: %w", r.registry, err)
+	}
+	tokens := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return "", fmt.Errorf("unable to parse token for registry %s: %w", r.registry, err)
+	}
+	if tokens.Token != "" {
+		return tokens.Token, nil
+	}
+	if tokens.AccessToken != "" {
+		return tokens.AccessToken, nil
+	}
+	return "", fmt.Errorf("registry %s gave no token", r.registry)
+}
+
+// inDomainOf returns true if the given host is the given registry host, or belongs to the domain the registry host is
+// part of, e.g. auth.docker.io for registry-1.docker.io. A registry named by its address, or directly below a top-level
+// domain, must serve its tokens itself.
+func inDomainOf(host, registryHost string) bool {
+	host, registryHost = strings.ToLower(host), strings.ToLower(registryHost)
+	if host == registryHost {
+		return true
+	}
+	if net.ParseIP(registryHost) != nil {
+		return false
+	}
+	_, domain, found := strings.Cut(registryHost, ".")
+	if !found || !strings.Contains(domain, ".") {
+		return false
+	}
+	return strings.HasSuffix(host, "."+domain)
+}
+
+// parseChallengeParams returns the parameters of an authentication challenge, in the key="value",... format
+func parseChallengeParams(params string) map[string]string {
+	parsed := make(map[string]string)
+	for params != "" {
+		key, rest, found := strings.Cut(params, "=")
+		if !found {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		parsed[strings.ToLower(strings.TrimSpace(key))] = value
+		params = strings.TrimLeft(rest, ", ")
+	}
+	return parsed
+}
+
+// readBody returns the body of a successful response, closing it
+func readBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
@@ -0,0 +1,262 @@
+package imageplatform
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/kubernetes/pkg/credentialprovider"
+)
+
+func TestParseReference(t *testing.T) {
+	testCases := []struct {
+		name               string
+		image              string
+		expectedRegistry   string
+		expectedRepository string
+		expectedReference  string
+		expectErr          bool
+	}{
+		{
+			name:               "official docker hub image",
+			image:              "busybox",
+			expectedRegistry:   "docker.io",
+			expectedRepository: "library/busybox",
+			expectedReference:  "latest",
+		},
+		{
+			name:               "docker hub image with tag",
+			image:              "org/app:1.0",
+			expectedRegistry:   "docker.io",
+			expectedRepository: "org/app",
+			expectedReference:  "1.0",
+		},
+		{
+			name:               "registry with port and digest",
+			image:              "registry.example.com:5000/windows/app@sha256:abcd",
+			expectedRegistry:   "registry.example.com:5000",
+			expectedRepository: "windows/app",
+			expectedReference:  "sha256:abcd",
+		},
+		{
+			name:               "registry with port and tag",
+			image:              "localhost:5000/app:ltsc2022",
+			expectedRegistry:   "localhost:5000",
+			expectedRepository: "app",
+			expectedReference:  "ltsc2022",
+		},
+		{
+			name:               "nested repository",
+			image:              "mcr.microsoft.com/windows/servercore:ltsc2022",
+			expectedRegistry:   "mcr.microsoft.com",
+			expectedRepository: "windows/servercore",
+			expectedReference:  "ltsc2022",
+		},
+		{
+			name:      "uppercase repository",
+			image:     "mcr.microsoft.com/Windows/servercore",
+			expectErr: true,
+		},
+		{
+			name:      "empty tag",
+			image:     "mcr.microsoft.com/windows/servercore:",
+			expectErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			registry, repository, reference, err := parseReference(test.image)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedRegistry, registry)
+			assert.Equal(t, test.expectedRepository, repository)
+			assert.Equal(t, test.expectedReference, reference)
+		})
+	}
+}
+
+func TestSupportsWindowsBuild(t *testing.T) {
+	platforms := []Platform{
+		{OS: "linux"},
+		{OS: "windows", OSVersion: "10.0.17763.5458"},
+		{OS: "windows", OSVersion: "10.0.20348"},
+	}
+	assert.True(t, SupportsWindowsBuild(platforms, "10.0.17763"))
+	assert.True(t, SupportsWindowsBuild(platforms, "10.0.20348"))
+	assert.False(t, SupportsWindowsBuild(platforms, "10.0.26100"))
+	assert.False(t, SupportsWindowsBuild(platforms, "10.0.1776"), "build prefixes must not match")
+	assert.False(t, SupportsWindowsBuild([]Platform{{OS: "linux", OSVersion: "10.0.20348"}}, "10.0.20348"))
+}
+
+func TestParseChallengeParams(t *testing.T) {
+	params := parseChallengeParams(`realm="https://auth.example.com/token",service="registry.example.com",` +
+		`scope="repository:app:pull,push"`)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:app:pull,push",
+	}, params)
+}
+
+// testRegistry is a registry serving the manifests of a Windows image list and of a single platform Linux image,
+// requiring a bearer token issued for the given credentials
+type testRegistry struct {
+	username string
+	password string
+	// realm is the token realm given to clients, the registry itself if empty
+	realm string
+	// requests counts the manifest requests served
+	requests int
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if username, password, ok := req.BasicAuth(); !ok || username != r.username || password != r.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("scope") == "" || req.URL.Query().Get("service") != "test" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "secret-token"})
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer secret-token" {
+		realm := r.realm
+		if realm == "" {
+			realm = "http://" + req.Host + "/token"
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`",service="test"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch req.URL.Path {
+	case "/v2/windows/app/manifests/latest":
+		r.requests++
+		w.Header().Set("Content-Type", indexMediaTypes[0])
+		w.Write([]byte(`{"mediaType":"` + indexMediaTypes[0] + `","manifests":[` +
+			`{"platform":{"os":"windows","architecture":"amd64","os.version":"10.0.17763.5458"}},` +
+			`{"platform":{"os":"windows","architecture":"amd64","os.version":"10.0.20348.2340"}}]}`))
+	case "/v2/linux/app/manifests/latest":
+		r.requests++
+		w.Header().Set("Content-Type", manifestMediaTypes[0])
+		w.Write([]byte(`{"mediaType":"` + manifestMediaTypes[0] + `","config":{"digest":"sha256:1234"}}`))
+	case "/v2/linux/app/blobs/sha256:1234":
+		w.Write([]byte(`{"os":"linux","architecture":"amd64","rootfs":{}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPlatforms(t *testing.T) {
+	registry := &testRegistry{username: "user", password: "pass"}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	keyring := &credentialprovider.BasicDockerKeyring{}
+	keyring.Add(credentialprovider.DockerConfig{host: {Username: "user", Password: "pass"}})
+	inspector := NewInspector(server.Client())
+	inspector.scheme = "http"
+
+	t.Run("image index", func(t *testing.T) {
+		platforms, err := inspector.Platforms(context.Background(), host+"/windows/app", keyring)
+		require.NoError(t, err)
+		assert.Equal(t, []Platform{
+			{OS: "windows", OSVersion: "10.0.17763.5458"},
+			{OS: "windows", OSVersion: "10.0.20348.2340"},
+		}, platforms)
+	})
+	t.Run("single platform image", func(t *testing.T) {
+		platforms, err := inspector.Platforms(context.Background(), host+"/linux/app", keyring)
+		require.NoError(t, err)
+		assert.Equal(t, []Platform{{OS: "linux"}}, platforms)
+	})
+	t.Run("cached", func(t *testing.T) {
+		requests := registry.requests
+		_, err := inspector.Platforms(context.Background(), host+"/windows/app", keyring)
+		require.NoError(t, err)
+		assert.Equal(t, requests, registry.requests)
+	})
+	t.Run("missing image", func(t *testing.T) {
+		_, err := inspector.Platforms(context.Background(), host+"/missing/app", keyring)
+		assert.Error(t, err)
+	})
+	t.Run("wrong credentials", func(t *testing.T) {
+		wrongKeyring := &credentialprovider.BasicDockerKeyring{}
+		wrongKeyring.Add(credentialprovider.DockerConfig{host: {Username: "user", Password: "wrong"}})
+		uncached := NewInspector(server.Client())
+		uncached.scheme = "http"
+		_, err := uncached.Platforms(context.Background(), host+"/windows/app", wrongKeyring)
+		assert.ErrorContains(t, err, "unable to get token")
+	})
+	t.Run("cached inspection not shared without credentials", func(t *testing.T) {
+		_, err := inspector.Platforms(context.Background(), host+"/windows/app", nil)
+		assert.ErrorContains(t, err, "unable to get token")
+	})
+}
+
+func TestPlatformsTokenRealm(t *testing.T) {
+	tests := []struct {
+		name  string
+		realm string
+	}{
+		{name: "realm of another domain", realm: "http://auth.example.com/token"},
+		{name: "realm with another scheme", realm: "https://127.0.0.1/token"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := &testRegistry{username: "user", password: "pass", realm: test.realm}
+			server := httptest.NewServer(registry)
+			defer server.Close()
+			host := strings.TrimPrefix(server.URL, "http://")
+			keyring := &credentialprovider.BasicDockerKeyring{}
+			keyring.Add(credentialprovider.DockerConfig{host: {Username: "user", Password: "pass"}})
+			inspector := NewInspector(server.Client())
+			inspector.scheme = "http"
+
+			_, err := inspector.Platforms(context.Background(), host+"/windows/app", keyring)
+			assert.ErrorContains(t, err, "token realm")
+		})
+	}
+}
+
+func TestInDomainOf(t *testing.T) {
+	assert.True(t, inDomainOf("registry.example.com", "registry.example.com"))
+	assert.True(t, inDomainOf("auth.docker.io", "registry-1.docker.io"))
+	assert.True(t, inDomainOf("sso.example.co.uk", "registry.example.co.uk"))
+	assert.False(t, inDomainOf("auth.example.com", "registry.example.org"))
+	assert.False(t, inDomainOf("evil.io", "quay.io"), "hosts of a top-level domain must not match")
+	assert.False(t, inDomainOf("registry.example.com.evil.io", "registry.example.com"))
+	assert.False(t, inDomainOf("10.0.0.2", "10.0.0.1"))
+}
+
+func TestAddressGuard(t *testing.T) {
+	_, clusterNetwork, err := net.ParseCIDR("203.0.113.0/24")
+	require.NoError(t, err)
+	guard := &addressGuard{clusterNetworks: []*net.IPNet{clusterNetwork}}
+	for _, address := range []string{"127.0.0.1", "::1", "169.254.169.254", "fe80::1", "10.0.0.1", "172.30.0.1",
+		"192.168.1.1", "fd00::1", "100.64.0.1", "0.0.0.0", "203.0.113.10"} {
+		assert.False(t, guard.allowed(net.ParseIP(address)), address)
+	}
+	for _, address := range []string{"8.8.8.8", "2001:4860:4860::8888", "198.51.100.1"} {
+		assert.True(t, guard.allowed(net.ParseIP(address)), address)
+	}
+
+	client := NewClient(time.Second, nil)
+	server := httptest.NewServer(&testRegistry{})
+	defer server.Close()
+	_, err = client.Get(server.URL)
+	assert.ErrorContains(t, err, "refusing to connect", "loopback registries must be refused")
+}
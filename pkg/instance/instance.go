@@ -10,6 +10,40 @@ import (
 	"github.com/openshift/windows-machine-config-operator/version"
 )
 
+const (
+	// PrivateKeySecretAnnotation is a node annotation holding the name of the Secret with the private key used to SSH
+	// into the node's instance, if the instance does not use the private key shared by all instances
+	PrivateKeySecretAnnotation = "windowsmachineconfig.openshift.io/private-key-secret"
+	// SSHCASecretAnnotation is a node annotation holding the name of the Secret with the private key of the OpenSSH
+	// certificate authority trusted by the node's instance, if the instance is accessed using user certificates
+	SSHCASecretAnnotation = "windowsmachineconfig.openshift.io/ssh-ca-secret"
+)
+
+// Credentials references the Secrets holding the credentials used to SSH into an instance. The zero value refers to
+// the private key shared by all instances.
+type Credentials struct {
+	// PrivateKeySecret is the name of the Secret holding the private key used to SSH into the instance. The private
+	// key shared by all instances is used if empty.
+	PrivateKeySecret string
+	// SSHCASecret is the name of the Secret holding the private key of an OpenSSH certificate authority trusted by the
+	// instance. If set, the private key is presented along with a short-lived user certificate issued by the CA.
+	SSHCASecret string
+}
+
+// Annotations returns the node annotations recording the credentials. Unset references are given an empty value.
+func (c Credentials) Annotations() map[string]string {
+	return map[string]string{PrivateKeySecretAnnotation: c.PrivateKeySecret, SSHCASecretAnnotation: c.SSHCASecret}
+}
+
+// CredentialsFromNode returns the credentials recorded on the given node
+func CredentialsFromNode(node *core.Node) Credentials {
+	if node == nil {
+		return Credentials{}
+	}
+	return Credentials{PrivateKeySecret: node.GetAnnotations()[PrivateKeySecretAnnotation],
+		SSHCASecret: node.GetAnnotations()[SSHCASecretAnnotation]}
+}
+
 // Info represents a instance that is meant to be joined to the cluster
 type Info struct {
 	// Address is the network address of the instance as specified by the associated ConfigMap entry.
@@ -23,6 +57,8 @@ type Info struct {
 	NewHostname string
 	// SetNodeIP indicates if the instance should have the node-ip arg set when bootstrapping.
 	SetNodeIP bool
+	// Credentials references the Secrets holding the credentials used to SSH into the instance.
+	Credentials Credentials
 	// Node is an optional pointer to the Node object associated with the instance, if it has one.
 	Node *core.Node
 }
@@ -105,3 +105,16 @@ func TestUpgradeRequired(t *testing.T) {
 		})
 	}
 }
+
+func TestCredentialsFromNode(t *testing.T) {
+	assert.Equal(t, Credentials{}, CredentialsFromNode(nil))
+	assert.Equal(t, Credentials{}, CredentialsFromNode(&core.Node{}))
+
+	credentials := Credentials{PrivateKeySecret: "domain-key", SSHCASecret: "domain-ca"}
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{Annotations: credentials.Annotations()}}
+	assert.Equal(t, credentials, CredentialsFromNode(node))
+
+	// clearing the references through the annotations returns to the shared private key
+	node.Annotations = Credentials{}.Annotations()
+	assert.Equal(t, Credentials{}, CredentialsFromNode(node))
+}
@@ -1,5 +1,5 @@
 # This script creates an exclusion for the given file if the Windows Defender antivirus is running on the instance.
-# No action taken otherwise. 
+# No action taken otherwise, or if the script is not run with administrative rights.
 # If getting the antivirus process or creating the exclusion fails unexpectedly, return the error.
 # Returns nothing otherwise.
 
@@ -15,6 +15,13 @@ param(
     [Parameter(Mandatory=$true)] [String] $BinPath
 )
 
+# Exclusions can only be created with administrative rights. The exclusion is created while the instance is being
+# configured, so nothing is done when the script is run by WICD under a service account.
+$principal = New-Object Security.Principal.WindowsPrincipal([Security.Principal.WindowsIdentity]::GetCurrent())
+if (-not $principal.IsInRole([Security.Principal.WindowsBuiltInRole]::Administrator)) {
+    exit 0
+}
+
 # Check if the process associated with Windows Defender exists. Reference:
 # https://learn.microsoft.com/en-us/microsoft-365/security/defender-endpoint/microsoft-defender-antivirus-compatibility?view=o365-worldwide#use-windows-powershell-to-confirm-that-microsoft-defender-antivirus-is-running
 try {
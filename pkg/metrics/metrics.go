@@ -1,5 +1,10 @@
 package metrics
 
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
 const (
 	// PortName specifies the portname used for Prometheus monitoring
 	PortName = "metrics"
@@ -9,3 +14,45 @@ const (
 	// by current operator version. Its name is defined through the bundle manifests
 	WindowsMetricsResource = "windows-exporter"
 )
+
+var (
+	// StaleRegistryConfigNodes is the number of Windows nodes which have not applied the latest published registry
+	// configuration
+	StaleRegistryConfigNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "windows_machine_config_operator_stale_registry_config_nodes",
+		Help: "Number of Windows nodes which have not applied the latest container registry configuration",
+	})
+	// PrePullImages is the number of images listed for pre-pulling on each Windows node, by pull state
+	PrePullImages = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "windows_machine_config_operator_prepull_images",
+		Help: "Number of images listed for pre-pulling on a Windows node, by pull state: pulled, pending or failed",
+	}, []string{"node", "state"})
+	// CertificateExpiry is the expiry time of each certificate WMCO manages on each Windows node
+	CertificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "windows_machine_config_operator_certificate_expiry_timestamp_seconds",
+		Help: "Time at which a certificate managed on a Windows node expires, in seconds since the Unix epoch",
+	}, []string{"node", "certificate"})
+	// CSRDecisions is the number of CSRs evaluated by WMCO, by outcome and the method through which the CSR was matched
+	// to a Windows instance
+	CSRDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "windows_machine_config_operator_csr_decisions_total",
+		Help: "Number of kubelet CSRs evaluated by WMCO, by outcome: approved, rejected, ignored or failed, and by " +
+			"the method the CSR was matched to a Windows instance through: dns, hostname or machine",
+	}, []string{"outcome", "method"})
+	// WICDCredentialExpiry is the expiry time of the credentials WICD has been verified to use on each Windows node
+	WICDCredentialExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "windows_machine_config_operator_wicd_credentials_expiry_timestamp_seconds",
+		Help: "Time at which the credentials used by WICD on a Windows node expire, in seconds since the Unix epoch",
+	}, []string{"node"})
+	// WICDCredentialRotations is the number of WICD credential rotations attempted by WMCO, by outcome
+	WICDCredentialRotations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "windows_machine_config_operator_wicd_credential_rotations_total",
+		Help: "Number of WICD credential rotations attempted by WMCO, by outcome: succeeded or failed",
+	}, []string{"outcome"})
+)
+
+// init registers the operator's metrics with the registry served by the controller-runtime metrics server
+func init() {
+	ctrlmetrics.Registry.MustRegister(StaleRegistryConfigNodes, PrePullImages, CertificateExpiry, CSRDecisions,
+		WICDCredentialExpiry, WICDCredentialRotations)
+}
@@ -2,25 +2,33 @@ package nodeconfig
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"sync"
 
 	clientset "github.com/openshift/client-go/config/clientset/versioned"
+	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	crclientcfg "sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
-// cache holds the information of the nodeConfig that is invariant for multiple reconciliation cycles. We'll use this
-// information when we don't want to get the information from the global context coming from reconciler
-// but to have something at nodeConfig package locally which will be passed onto other structs. There is no need to
-// invalidate this cache as of now, since if someone wants to change any of the fields, they've to restart the operator
-// which will invalidate the cache automatically.
+// ClusterEndpointsHashAnnotation is applied to configured nodes, and holds a hash of the cluster endpoints the node
+// was configured with. A node whose annotation does not match the current endpoints must be reconfigured.
+const ClusterEndpointsHashAnnotation = "windowsmachineconfig.openshift.io/cluster-endpoints-hash"
+
+// cache holds the cluster information used to configure nodes that is shared across reconciliation cycles. It is
+// populated at process init and is kept up to date by the cluster config controller, which watches the cluster
+// Infrastructure and Network resources, so changes to the fields do not require restarting the operator.
 type cache struct {
+	sync.RWMutex
 	// apiServerEndpoint is the address which clients can interact with the API server through
 	apiServerEndpoint string
+	// clusterServiceCIDR holds the service CIDR for the cluster
+	clusterServiceCIDR string
 }
 
-// cache has the information related to nodeConfig that should not be changed.
+// nodeConfigCache has the cluster information related to nodeConfig
 var nodeConfigCache = cache{}
 
 // init populates the cache that we need for nodeConfig
@@ -36,6 +44,74 @@ func init() {
 	nodeConfigCache.apiServerEndpoint = kubeAPIServerEndpoint
 }
 
+// SetClusterServiceCIDR sets the cluster service CIDR used to configure nodes
+func SetClusterServiceCIDR(clusterServiceCIDR string) {
+	nodeConfigCache.Lock()
+	defer nodeConfigCache.Unlock()
+	nodeConfigCache.clusterServiceCIDR = clusterServiceCIDR
+}
+
+// UpdateClusterEndpoints sets the API server endpoint and cluster service CIDR used to configure nodes, returning true
+// if either value changed
+func UpdateClusterEndpoints(apiServerEndpoint, clusterServiceCIDR string) bool {
+	nodeConfigCache.Lock()
+	defer nodeConfigCache.Unlock()
+	if nodeConfigCache.apiServerEndpoint == apiServerEndpoint &&
+		nodeConfigCache.clusterServiceCIDR == clusterServiceCIDR {
+		return false
+	}
+	nodeConfigCache.apiServerEndpoint = apiServerEndpoint
+	nodeConfigCache.clusterServiceCIDR = clusterServiceCIDR
+	return true
+}
+
+// APIServerEndpoint returns the API server endpoint used to configure nodes
+func APIServerEndpoint() string {
+	nodeConfigCache.RLock()
+	defer nodeConfigCache.RUnlock()
+	return nodeConfigCache.apiServerEndpoint
+}
+
+// ClusterServiceCIDR returns the cluster service CIDR used to configure nodes
+func ClusterServiceCIDR() string {
+	nodeConfigCache.RLock()
+	defer nodeConfigCache.RUnlock()
+	return nodeConfigCache.clusterServiceCIDR
+}
+
+// clusterEndpoints returns a consistent snapshot of the API server endpoint and cluster service CIDR
+func clusterEndpoints() (string, string) {
+	nodeConfigCache.RLock()
+	defer nodeConfigCache.RUnlock()
+	return nodeConfigCache.apiServerEndpoint, nodeConfigCache.clusterServiceCIDR
+}
+
+// ClusterEndpointsHash returns the value of the ClusterEndpointsHashAnnotation expected on nodes configured with the
+// current cluster endpoints
+func ClusterEndpointsHash() string {
+	return createClusterEndpointsHash(clusterEndpoints())
+}
+
+// ClusterEndpointsUpToDate returns true if the given node was configured with the current cluster endpoints. Nodes
+// which have not been fully configured yet are considered up to date, as they will pick up the current values, as is
+// every node while the API server endpoint has not been discovered.
+func ClusterEndpointsUpToDate(node *core.Node) bool {
+	if node == nil {
+		return true
+	}
+	hash, present := node.GetAnnotations()[ClusterEndpointsHashAnnotation]
+	if !present {
+		return true
+	}
+	apiServerEndpoint, clusterServiceCIDR := clusterEndpoints()
+	return apiServerEndpoint == "" || hash == createClusterEndpointsHash(apiServerEndpoint, clusterServiceCIDR)
+}
+
+// createClusterEndpointsHash returns the sha256 of the given cluster endpoints
+func createClusterEndpointsHash(apiServerEndpoint, clusterServiceCIDR string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(apiServerEndpoint+"\n"+clusterServiceCIDR)))
+}
+
 // discoverKubeAPIServerEndpoint discovers the kubernetes api server endpoint
 func discoverKubeAPIServerEndpoint(ctx context.Context) (string, error) {
 	cfg, err := crclientcfg.GetConfig()
@@ -2,10 +2,13 @@ package nodeconfig
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"net"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -16,7 +19,6 @@ import (
 	"github.com/vincent-petithory/dataurl"
 	"golang.org/x/crypto/ssh"
 	core "k8s.io/api/core/v1"
-	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -31,13 +33,18 @@ import (
 
 	"github.com/openshift/windows-machine-config-operator/pkg/certificates"
 	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/cni"
+	"github.com/openshift/windows-machine-config-operator/pkg/daemon/credentialprovider"
 	"github.com/openshift/windows-machine-config-operator/pkg/ignition"
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeutil"
+	"github.com/openshift/windows-machine-config-operator/pkg/prepull"
 	"github.com/openshift/windows-machine-config-operator/pkg/registries"
 	"github.com/openshift/windows-machine-config-operator/pkg/retry"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+	"github.com/openshift/windows-machine-config-operator/pkg/wicdauth"
 	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 	"github.com/openshift/windows-machine-config-operator/version"
 )
@@ -53,8 +60,16 @@ const (
 	WindowsOSLabel = "node.openshift.io/os_id=Windows"
 	// WorkerLabel is the label that needs to be applied to the Windows node to make it worker node
 	WorkerLabel = "node-role.kubernetes.io/worker"
+	// OSVersionLabel is applied to Windows nodes, indicating the full OS version of the underlying instance, including
+	// the update build revision
+	OSVersionLabel = "windowsmachineconfig.openshift.io/os-version"
+	// OSEditionLabel is applied to Windows nodes, indicating the OS edition of the underlying instance
+	OSEditionLabel = "windowsmachineconfig.openshift.io/os-edition"
 	// PubKeyHashAnnotation corresponds to the public key present on the VM
 	PubKeyHashAnnotation = "windowsmachineconfig.openshift.io/pub-key-hash"
+	// KeyRotationFailedAnnotation is applied to Windows Machine nodes whose private key could not be rotated in place,
+	// holding the hash of the public key the rotation was from, so that their Machines are recreated instead
+	KeyRotationFailedAnnotation = "windowsmachineconfig.openshift.io/key-rotation-failed"
 	// KubeletClientCAFilename is the name of the CA certificate file required by kubelet to interact
 	// with the kube-apiserver client
 	KubeletClientCAFilename = "kubelet-ca.crt"
@@ -78,9 +93,13 @@ type nodeConfig struct {
 	node *core.Node
 	// publicKeyHash is the hash of the public key present on the VM
 	publicKeyHash string
+	// apiServerEndpoint is the address which the node communicates with the API server through
+	apiServerEndpoint string
 	// clusterServiceCIDR holds the service CIDR for cluster
 	clusterServiceCIDR string
-	log                logr.Logger
+	// clusterEndpointsHash is the hash of the API server endpoint and service CIDR the node is configured with
+	clusterEndpointsHash string
+	log                  logr.Logger
 	// additionalAnnotations are extra annotations that should be applied to configured nodes
 	additionalAnnotations map[string]string
 	// additionalLabels are extra labels that should be applied to configured nodes
@@ -89,6 +108,10 @@ type nodeConfig struct {
 	platformType configv1.PlatformType
 	// wmcoNamespace is the namespace WMCO is deployed to
 	wmcoNamespace string
+	// networkBackend is the backend providing pod networking to the node
+	networkBackend cluster.NetworkBackend
+	// cniHNSNetworks are the HNS networks created by the user provided CNI the node is configured with
+	cniHNSNetworks []string
 }
 
 // ErrWriter is a wrapper to enable error-level logging inside kubectl drainer implementation
@@ -115,10 +138,13 @@ func (ow OutWriter) Write(p []byte) (n int, err error) {
 
 // NewNodeConfig creates a new instance of nodeConfig to be used by the caller.
 // hostName having a value will result in the VM's hostname being changed to the given value.
-func NewNodeConfig(c client.Client, clientset *kubernetes.Clientset, clusterServiceCIDR, wmcoNamespace string,
+// The node is configured with the cluster endpoints cached at the time this function is called.
+func NewNodeConfig(c client.Client, clientset *kubernetes.Clientset, wmcoNamespace string,
 	instanceInfo *instance.Info, signer ssh.Signer, additionalLabels,
-	additionalAnnotations map[string]string, platformType configv1.PlatformType) (*nodeConfig, error) {
+	additionalAnnotations map[string]string, platformType configv1.PlatformType,
+	networkBackend cluster.NetworkBackend) (*nodeConfig, error) {
 
+	apiServerEndpoint, clusterServiceCIDR := clusterEndpoints()
 	if err := cluster.ValidateCIDR(clusterServiceCIDR); err != nil {
 		return nil, fmt.Errorf("error receiving valid CIDR value for "+
 			"creating new node config: %w", err)
@@ -130,19 +156,22 @@ func NewNodeConfig(c client.Client, clientset *kubernetes.Clientset, clusterServ
 	}
 
 	log := ctrl.Log.WithName(fmt.Sprintf("nc %s", instanceInfo.Address))
-	win, err := windows.New(clusterDNS, instanceInfo, signer, &platformType)
+	win, err := windows.New(clusterDNS, instanceInfo, signer, &platformType, networkBackend)
 	if err != nil {
 		return nil, fmt.Errorf("error instantiating Windows instance from VM: %w", err)
 	}
 
 	return &nodeConfig{client: c, k8sclientset: clientset, Windows: win, node: instanceInfo.Node,
-		platformType: platformType, wmcoNamespace: wmcoNamespace, clusterServiceCIDR: clusterServiceCIDR,
-		publicKeyHash: CreatePubKeyHashAnnotation(signer.PublicKey()), log: log, additionalLabels: additionalLabels,
-		additionalAnnotations: additionalAnnotations}, nil
+		platformType: platformType, wmcoNamespace: wmcoNamespace, apiServerEndpoint: apiServerEndpoint,
+		clusterServiceCIDR:   clusterServiceCIDR,
+		clusterEndpointsHash: createClusterEndpointsHash(apiServerEndpoint, clusterServiceCIDR),
+		publicKeyHash:        CreatePubKeyHashAnnotation(signer.PublicKey()), log: log, additionalLabels: additionalLabels,
+		additionalAnnotations: additionalAnnotations, networkBackend: networkBackend}, nil
 }
 
-// Configure configures the Windows VM to make it a Windows worker node
-func (nc *nodeConfig) Configure(ctx context.Context) error {
+// Configure configures the Windows VM to make it a Windows worker node. The given services are allow-listed on the
+// instance, in addition to those signed by the operator.
+func (nc *nodeConfig) Configure(ctx context.Context, allowedServices []servicescm.Service) error {
 	drainHelper := nc.newDrainHelper(ctx)
 	// If a Node object exists already, it implies that we are reconfiguring and we should cordon the node
 	if nc.node != nil {
@@ -152,6 +181,16 @@ func (nc *nodeConfig) Configure(ctx context.Context) error {
 		}
 	}
 
+	// Refuse to configure instances running an unsupported Windows build before making any changes to them
+	osInfo, err := nc.Windows.GetOSInfo()
+	if err != nil {
+		return fmt.Errorf("unable to determine the Windows build of the instance: %w", err)
+	}
+	if !osInfo.IsSupported() {
+		return windows.NewUnsupportedOSErr(*osInfo)
+	}
+	nc.log.Info("detected operating system", "build", osInfo.FullVersion(), "edition", osInfo.Edition)
+
 	if err := nc.createBootstrapFiles(ctx); err != nil {
 		return err
 	}
@@ -161,9 +200,16 @@ func (nc *nodeConfig) Configure(ctx context.Context) error {
 	if err := nc.createRegistryConfigFiles(ctx); err != nil {
 		return err
 	}
+	if err := nc.createCNIFiles(ctx); err != nil {
+		return err
+	}
 	if err := nc.SyncTrustedCABundle(ctx); err != nil {
 		return err
 	}
+	// WICD configures the bootstrap services, so they must be trusted before it is started
+	if err := nc.createServiceTrustFile(ctx, allowedServices); err != nil {
+		return err
+	}
 	wicdKC, err := nc.generateWICDKubeconfig(ctx)
 	if err != nil {
 		return err
@@ -191,16 +237,28 @@ func (nc *nodeConfig) Configure(ctx context.Context) error {
 
 		// Ensure we are labeling and annotating the node as soon as the Node object is created, so that we can identify
 		// which controller should be watching it
-		annotationsToApply := map[string]string{PubKeyHashAnnotation: nc.publicKeyHash}
+		annotationsToApply := map[string]string{PubKeyHashAnnotation: nc.publicKeyHash,
+			ClusterEndpointsHashAnnotation: nc.clusterEndpointsHash}
+		if nc.networkBackend == cluster.BYOCNIBackend {
+			annotationsToApply[cni.HNSNetworksAnnotation] = cni.HNSNetworksAnnotationValue(nc.cniHNSNetworks)
+		}
 		for key, value := range nc.additionalAnnotations {
 			annotationsToApply[key] = value
 		}
-		if err := metadata.ApplyLabelsAndAnnotations(ctx, nc.client, *nc.node, nc.additionalLabels,
+		labelsToApply := osLabels(osInfo)
+		for key, value := range nc.additionalLabels {
+			labelsToApply[key] = value
+		}
+		if err := metadata.ApplyLabelsAndAnnotations(ctx, nc.client, *nc.node, labelsToApply,
 			annotationsToApply); err != nil {
 			return fmt.Errorf("error updating public key hash and additional annotations on node %s: %w",
 				nc.node.GetName(), err)
 		}
 
+		// Now that the node exists, WICD is given a token bound to it in place of the bootstrap token
+		if wicdKC, err = nc.generateWICDKubeconfig(ctx); err != nil {
+			return fmt.Errorf("error generating WICD kubeconfig for node %s: %w", nc.node.GetName(), err)
+		}
 		if err := nc.Windows.ConfigureWICD(nc.wmcoNamespace, wicdKC); err != nil {
 			return fmt.Errorf("configuring WICD failed: %w", err)
 		}
@@ -220,9 +278,17 @@ func (nc *nodeConfig) Configure(ctx context.Context) error {
 			return fmt.Errorf("error getting node object: %w", err)
 		}
 
-		// Uncordon the node now that it is fully configured
-		if err := drain.RunCordonOrUncordon(drainHelper, nc.node, false); err != nil {
-			return fmt.Errorf("error uncordoning the node %s: %w", nc.node.GetName(), err)
+		// Keep the node cordoned until the images required to be present on it have been pulled by WICD. The node is
+		// then uncordoned by the image pre-pull controller, rather than blocking the configuration of other instances.
+		awaitingImages, err := nc.awaitRequiredImages(ctx)
+		if err != nil {
+			return err
+		}
+		if !awaitingImages {
+			// Uncordon the node now that it is fully configured
+			if err := drain.RunCordonOrUncordon(drainHelper, nc.node, false); err != nil {
+				return fmt.Errorf("error uncordoning the node %s: %w", nc.node.GetName(), err)
+			}
 		}
 
 		if err := metadata.RemoveUpgradingLabel(ctx, nc.client, nc.node); err != nil {
@@ -273,58 +339,6 @@ func (nc *nodeConfig) SafeReboot(ctx context.Context) error {
 	return nil
 }
 
-// getWICDServiceAccountSecret returns the secret which holds the credentials for the WICD ServiceAccount, creating one
-// if necessary
-func (nc *nodeConfig) getWICDServiceAccountSecret(ctx context.Context) (*core.Secret, error) {
-	var tokenSecret core.Secret
-	err := nc.client.Get(ctx,
-		types.NamespacedName{Namespace: nc.wmcoNamespace, Name: windows.WicdServiceName}, &tokenSecret)
-	if err != nil {
-		if k8sapierrors.IsNotFound(err) {
-			return nc.createWICDServiceAccountTokenSecret(ctx)
-		}
-		return nil, err
-	}
-	if validWICDServiceAccountTokenSecret(tokenSecret) {
-		return &tokenSecret, nil
-	}
-
-	// If the secret is invalid, a new one should be created
-	if err = nc.client.Delete(ctx, &tokenSecret); err != nil {
-		return nil, fmt.Errorf("error deleting invalid WICD service account token secret: %w", err)
-	}
-	return nc.createWICDServiceAccountTokenSecret(ctx)
-}
-
-// createWICDServiceAccountTokenSecret creates a secret with a long-lived API token for the WICD ServiceAccount and
-// waits for the secret data to be populated
-func (nc *nodeConfig) createWICDServiceAccountTokenSecret(ctx context.Context) (*core.Secret, error) {
-	err := nc.client.Create(ctx, secrets.GenerateServiceAccountTokenSecret(nc.wmcoNamespace, windows.WicdServiceName))
-	if err != nil {
-		return nil, fmt.Errorf("error creating secret for WICD ServiceAccount: %w", err)
-	}
-	secret := &core.Secret{}
-	// wait for the secret data to be populated
-	err = wait.PollUntilContextTimeout(ctx, time.Second, time.Minute, true,
-		func(ctx context.Context) (done bool, err error) {
-			secret, err = nc.k8sclientset.CoreV1().Secrets(nc.wmcoNamespace).Get(ctx, windows.WicdServiceName,
-				meta.GetOptions{})
-			if err != nil {
-				return false, nil
-			}
-			caCert := secret.Data[core.ServiceAccountRootCAKey]
-			if caCert == nil {
-				return false, nil
-			}
-			token := secret.Data[core.ServiceAccountTokenKey]
-			if token == nil {
-				return false, nil
-			}
-			return true, nil
-		})
-	return secret, err
-}
-
 // createBootstrapFiles creates all prerequisite files on the node required to start kubelet using latest ignition spec
 func (nc *nodeConfig) createBootstrapFiles(ctx context.Context) error {
 	filePathsToContents := make(map[string]string)
@@ -343,6 +357,48 @@ func (nc *nodeConfig) createBootstrapFiles(ctx context.Context) error {
 	return nc.write(filePathsToContents)
 }
 
+// awaitRequiredImages returns true if any of the images listed as required for the node have yet to be pulled by
+// WICD, marking the node as awaiting them. Any previous mark is cleared otherwise.
+func (nc *nodeConfig) awaitRequiredImages(ctx context.Context) (bool, error) {
+	lists, parseErrs, err := prepull.GetLists(ctx, nc.client, nc.wmcoNamespace)
+	if err != nil {
+		return false, err
+	}
+	for _, parseErr := range parseErrs {
+		nc.log.Error(parseErr, "ignoring image pre-pull list")
+	}
+	_, required := prepull.ImagesForNode(lists, nc.node.GetLabels())
+	status, err := prepull.GetStatus(nc.node)
+	if err != nil {
+		nc.log.Error(err, "discarding recorded image pre-pull status")
+		status = make(prepull.Status)
+	}
+	pending := status.Pending(required)
+	if len(pending) == 0 {
+		if _, awaiting := prepull.AwaitingSince(nc.node); !awaiting {
+			return false, nil
+		}
+		patchData, err := metadata.GenerateRemovePatch([]string{}, []string{prepull.AwaitingImagesAnnotation})
+		if err != nil {
+			return false, fmt.Errorf("error creating %s annotation remove request: %w",
+				prepull.AwaitingImagesAnnotation, err)
+		}
+		if err = nc.client.Patch(ctx, nc.node, client.RawPatch(types.JSONPatchType, patchData)); err != nil {
+			return false, fmt.Errorf("error removing %s annotation from node %s: %w", prepull.AwaitingImagesAnnotation,
+				nc.node.GetName(), err)
+		}
+		return false, nil
+	}
+	nc.log.Info("keeping node cordoned until required images are pulled", "node", nc.node.GetName(),
+		"images", pending)
+	err = metadata.ApplyLabelsAndAnnotations(ctx, nc.client, *nc.node, nil,
+		map[string]string{prepull.AwaitingImagesAnnotation: time.Now().UTC().Format(time.RFC3339)})
+	if err != nil {
+		return false, fmt.Errorf("error marking node %s as awaiting required images: %w", nc.node.GetName(), err)
+	}
+	return true, nil
+}
+
 // write outputs the data to the path on the underlying Windows instance for each given pair. Creates files if needed.
 func (nc *nodeConfig) write(pathToData map[string]string) error {
 	for path, data := range pathToData {
@@ -356,13 +412,77 @@ func (nc *nodeConfig) write(pathToData map[string]string) error {
 
 // createRegistryConfigFiles creates all files on the node required for containerd to mirror images
 func (nc *nodeConfig) createRegistryConfigFiles(ctx context.Context) error {
-	configFiles, err := registries.GenerateConfigFiles(ctx, nc.client)
+	configFiles, err := registries.GenerateConfigFiles(ctx, nc.client, nc.wmcoNamespace)
 	if err != nil {
 		return err
 	}
 	return nc.Windows.ReplaceDir(configFiles, windows.ContainerdConfigDir)
 }
 
+// createCNIFiles copies the user provided CNI plugins and network configuration to the node. This is a no-op unless
+// the user provides the CNI, as otherwise the CNI files are part of the WMCO payload.
+func (nc *nodeConfig) createCNIFiles(ctx context.Context) error {
+	if nc.networkBackend != cluster.BYOCNIBackend {
+		return nil
+	}
+	cniConfig, err := nc.getCNIConfig(ctx)
+	if err != nil {
+		return err
+	}
+	nc.cniHNSNetworks = cniConfig.HNSNetworks
+	// Plugins are not removed, as the user may have installed others on the instance itself
+	for fileName, contents := range cniConfig.Plugins {
+		if err := nc.Windows.EnsureFileContent(contents, fileName, windows.CniDir); err != nil {
+			return fmt.Errorf("error copying CNI plugin %s: %w", fileName, err)
+		}
+	}
+	return nc.Windows.ReplaceDir(cniConfig.NetworkConfigs, windows.CniConfDir)
+}
+
+// getCNIConfig returns the user provided CNI configuration
+func (nc *nodeConfig) getCNIConfig(ctx context.Context) (*cni.Config, error) {
+	cm := &core.ConfigMap{}
+	if err := nc.client.Get(ctx, types.NamespacedName{Namespace: nc.wmcoNamespace, Name: cni.ConfigMapName},
+		cm); err != nil {
+		return nil, fmt.Errorf("error getting %s ConfigMap, required when the %s network backend is used: %w",
+			cni.ConfigMapName, cluster.BYOCNIBackend, err)
+	}
+	cniConfig, err := cni.Parse(cm)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CNI configuration: %w", err)
+	}
+	return cniConfig, nil
+}
+
+// hnsNetworks returns the HNS networks created on the node by its network backend. For a user provided CNI, these are
+// the networks listed by the CNI ConfigMap along with those recorded on the node when it was configured. A missing or
+// invalid ConfigMap does not prevent the node from being deconfigured.
+func (nc *nodeConfig) hnsNetworks(ctx context.Context) ([]string, error) {
+	if nc.networkBackend != cluster.BYOCNIBackend {
+		return windows.HybridOverlayHNSNetworks, nil
+	}
+	var networks []string
+	cniConfig, err := nc.getCNIConfig(ctx)
+	if err != nil {
+		nc.log.Info("unable to read the current CNI configuration, only removing the HNS networks recorded on the node",
+			"error", err)
+	} else {
+		networks = cniConfig.HNSNetworks
+	}
+	if recorded, present := nc.node.GetAnnotations()[cni.HNSNetworksAnnotation]; present {
+		recordedNetworks, err := cni.ParseHNSNetworksAnnotation(recorded)
+		if err != nil {
+			nc.log.Info("ignoring invalid annotation", "annotation", cni.HNSNetworksAnnotation, "error", err)
+		}
+		for _, network := range recordedNetworks {
+			if !slices.Contains(networks, network) {
+				networks = append(networks, network)
+			}
+		}
+	}
+	return networks, nil
+}
+
 // createFilesFromIgnition returns the contents and write locations on the instance for any file it can create from
 // ignition spec: kubelet CA cert, cloud-config file
 func (nc *nodeConfig) createFilesFromIgnition(ctx context.Context) (map[string]string, error) {
@@ -380,14 +500,26 @@ func (nc *nodeConfig) createFilesFromIgnition(ctx context.Context) (map[string]s
 	if _, ok := kubeletArgs[ignition.CloudConfigOption]; ok {
 		filesToTransfer[ignition.CloudConfigPath] = windows.K8sDir + "\\" + filepath.Base(ignition.CloudConfigPath)
 	}
-	filesToTransfer[ignition.ECRCredentialProviderPath] = windows.CredentialProviderConfig
 
 	filePathsToContents, err := translateIgnitionFilesForWindows(filesToTransfer, ign.GetFiles())
 	if err != nil {
 		return nil, fmt.Errorf("error processing ignition files: %w", err)
 	}
+	var pullSecret []byte
+	if cluster.RegistryCredentialProviderEnabled() {
+		if pullSecret, err = registries.GetPullSecret(ctx, nc.client); err != nil {
+			return nil, err
+		}
+	}
+	credentialProviderConfig, err := generateCredentialProviderConfig(ign.GetFiles(), pullSecret, nc.wmcoNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if credentialProviderConfig != nil {
+		filePathsToContents[windows.CredentialProviderConfig] = string(credentialProviderConfig)
+	}
 
-	filePathsToContents[windows.K8sDir+"\\"+KubeletClientCAFilename] = string(ign.GetKubeletCAData())
+	filePathsToContents[windows.KubeletClientCAPath] = string(ign.GetKubeletCAData())
 	return filePathsToContents, nil
 }
 
@@ -398,20 +530,108 @@ func (nc *nodeConfig) generateBootstrapKubeconfig(ctx context.Context) (string,
 	if err != nil {
 		return "", err
 	}
-	return newKubeconfigFromSecret(bootstrapSecret, "kubelet")
+	return newKubeconfigFromSecret(bootstrapSecret, nc.apiServerEndpoint, "kubelet")
 }
 
-// generateWICDKubeconfig returns the contents of a kubeconfig created from the WICD ServiceAccount
+// generateWICDKubeconfig returns the contents of a kubeconfig holding a short-lived token for the WICD
+// ServiceAccount. The token is bound to the instance's node if it has one, limiting WICD to modifying that node, and
+// any other credentials issued for the node are revoked. An instance without a node is given a bootstrap token, which
+// does not permit any changes to nodes.
 func (nc *nodeConfig) generateWICDKubeconfig(ctx context.Context) (string, error) {
-	wicdSASecret, err := nc.getWICDServiceAccountSecret(ctx)
+	kubeconfig, claims, err := nc.issueWICDKubeconfig(ctx)
 	if err != nil {
 		return "", err
 	}
-	return newKubeconfigFromSecret(wicdSASecret, "wicd")
+	if nc.node == nil {
+		return kubeconfig, nil
+	}
+	if err = wicdauth.SetAllowedCredentials(ctx, nc.client, nc.wmcoNamespace, nc.node.GetName(),
+		claims.ID); err != nil {
+		return "", fmt.Errorf("error allowing WICD credentials for node %s: %w", nc.node.GetName(), err)
+	}
+	if err = wicdauth.ApplyRotationStatus(ctx, nc.client, nc.node,
+		wicdauth.NewRotationStatus(claims)); err != nil {
+		return "", err
+	}
+	return kubeconfig, nil
+}
+
+// RotateWICDCredentials issues new credentials for the WICD of the instance's node and writes them to the instance.
+// The new credentials are allowed in addition to those WICD is currently using, which remain valid until they are
+// revoked once WICD is verified to be using the new credentials. Returns the claims of the new credentials.
+func (nc *nodeConfig) RotateWICDCredentials(ctx context.Context) (*wicdauth.Claims, error) {
+	if nc.node == nil {
+		return nil, fmt.Errorf("rotation of WICD credentials requires an associated node")
+	}
+	kubeconfig, claims, err := nc.issueWICDKubeconfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = wicdauth.AllowCredential(ctx, nc.client, nc.wmcoNamespace, nc.node.GetName(), claims.ID); err != nil {
+		return nil, fmt.Errorf("error allowing WICD credentials for node %s: %w", nc.node.GetName(), err)
+	}
+	if err = nc.Windows.UpdateWICDKubeconfig(kubeconfig); err != nil {
+		return nil, err
+	}
+	return claims, nil
 }
 
-// newKubeconfigFromSecret returns the contents of a kubeconfig generated from the given service account token secret
-func newKubeconfigFromSecret(saSecret *core.Secret, username string) (string, error) {
+// RotateSSHKey replaces the given previous public key, authorized to access the instance, with the public key of the
+// given signer. Access using the new key is verified before the previous key is revoked. The node's public key hash
+// annotation is updated to reflect the new key.
+func (nc *nodeConfig) RotateSSHKey(ctx context.Context, signer ssh.Signer, previous ssh.PublicKey) error {
+	if nc.node == nil {
+		return fmt.Errorf("rotation of the SSH key requires an associated node")
+	}
+	if err := nc.Windows.AuthorizeKey(signer.PublicKey()); err != nil {
+		return err
+	}
+	if err := nc.Windows.VerifyKey(signer); err != nil {
+		return err
+	}
+	if err := nc.Windows.RevokeKey(previous, signer.PublicKey()); err != nil {
+		return err
+	}
+	if err := metadata.ApplyLabelsAndAnnotations(ctx, nc.client, *nc.node, nil,
+		map[string]string{PubKeyHashAnnotation: CreatePubKeyHashAnnotation(signer.PublicKey())}); err != nil {
+		return fmt.Errorf("error updating public key hash annotation on node %s: %w", nc.node.GetName(), err)
+	}
+	return nil
+}
+
+// issueWICDKubeconfig returns the contents of a kubeconfig holding a new token for the WICD ServiceAccount, bound to
+// the instance's node if it has one, and the claims of the token
+func (nc *nodeConfig) issueWICDKubeconfig(ctx context.Context) (string, *wicdauth.Claims, error) {
+	rootCA, err := nc.k8sclientset.CoreV1().ConfigMaps(nc.wmcoNamespace).Get(ctx, wicdauth.RootCAConfigMap,
+		meta.GetOptions{})
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to get API server CA bundle: %w", err)
+	}
+	caCert, present := rootCA.Data[wicdauth.RootCAKey]
+	if !present {
+		return "", nil, fmt.Errorf("unable to find %s CA cert in ConfigMap %s", wicdauth.RootCAKey,
+			rootCA.GetName())
+	}
+	tokenRequest, err := nc.k8sclientset.CoreV1().ServiceAccounts(nc.wmcoNamespace).CreateToken(ctx,
+		windows.WicdServiceName, wicdauth.NewTokenRequest(nc.node), meta.CreateOptions{})
+	if err != nil {
+		return "", nil, fmt.Errorf("error requesting token for WICD ServiceAccount: %w", err)
+	}
+	claims, err := wicdauth.ParseClaims(tokenRequest.Status.Token)
+	if err != nil {
+		return "", nil, fmt.Errorf("error parsing token issued for WICD ServiceAccount: %w", err)
+	}
+	kc := generateKubeconfig([]byte(caCert), tokenRequest.Status.Token, nc.apiServerEndpoint, "wicd")
+	kubeconfigData, err := json.Marshal(kc)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(kubeconfigData), claims, nil
+}
+
+// newKubeconfigFromSecret returns the contents of a kubeconfig generated from the given service account token secret,
+// pointing to the given API server endpoint
+func newKubeconfigFromSecret(saSecret *core.Secret, apiServerEndpoint, username string) (string, error) {
 	// extract ca.crt and token data fields
 	caCert := saSecret.Data[core.ServiceAccountRootCAKey]
 	if caCert == nil {
@@ -423,8 +643,7 @@ func newKubeconfigFromSecret(saSecret *core.Secret, username string) (string, er
 		return "", fmt.Errorf("unable to find %s token in secret %s", core.ServiceAccountTokenKey,
 			saSecret.GetName())
 	}
-	kc := generateKubeconfig(caCert, string(token), nodeConfigCache.apiServerEndpoint,
-		username)
+	kc := generateKubeconfig(caCert, string(token), apiServerEndpoint, username)
 	kubeconfigData, err := json.Marshal(kc)
 	if err != nil {
 		return "", err
@@ -516,7 +735,11 @@ func (nc *nodeConfig) Deconfigure(ctx context.Context) error {
 	if err := nc.cleanupWithWICD(ctx); err != nil {
 		return err
 	}
-	if err := nc.Windows.RemoveFilesAndNetworks(); err != nil {
+	hnsNetworks, err := nc.hnsNetworks(ctx)
+	if err != nil {
+		return err
+	}
+	if err := nc.Windows.RemoveFilesAndNetworks(hnsNetworks); err != nil {
 		return fmt.Errorf("error deconfiguring instance: %w", err)
 	}
 
@@ -537,46 +760,70 @@ func (nc *nodeConfig) cleanupWithWICD(ctx context.Context) error {
 	return metadata.WaitForRebootAnnotationRemoval(ctx, nc.client, nc.node.Name)
 }
 
-// UpdateKubeletClientCA updates the kubelet client CA certificate file in the Windows node. No service restart or
-// reboot required, kubelet detects the changes in the file system and use the new CA certificate. The file is replaced
-// if and only if it does not exist or there is a checksum mismatch.
-func (nc *nodeConfig) UpdateKubeletClientCA(contents []byte) error {
-	// check CA bundle contents
-	if len(contents) == 0 {
-		// nothing do to, return
-		return nil
+// createServiceTrustFile publishes the services WICD may configure on the instance, along with the key the signatures
+// of any other services are verified with. The file is written over SSH so that it cannot be influenced by anyone able
+// to create services ConfigMaps.
+func (nc *nodeConfig) createServiceTrustFile(ctx context.Context, allowedServices []servicescm.Service) error {
+	signingKey, err := secrets.GetServiceSigningKey(ctx, nc.client, nc.wmcoNamespace)
+	if err != nil {
+		return err
 	}
-	err := nc.Windows.EnsureFileContent(contents, KubeletClientCAFilename, windows.GetK8sDir())
+	trust, err := servicescm.NewServiceTrust(signingKey.Public().(ed25519.PublicKey), allowedServices)
 	if err != nil {
 		return err
 	}
+	contents, err := json.Marshal(trust)
+	if err != nil {
+		return fmt.Errorf("unable to encode service trust: %w", err)
+	}
+	if err = nc.Windows.EnsureFileContent(contents, windows.ServiceTrustFile, windows.K8sDir); err != nil {
+		return fmt.Errorf("error publishing service trust: %w", err)
+	}
 	return nil
 }
 
 // SyncTrustedCABundle builds the trusted CA ConfigMap from image registry certificates and the proxy trust bundle
 // and ensures the cert bundle on the instance has up-to-date data
 func (nc *nodeConfig) SyncTrustedCABundle(ctx context.Context) error {
-	caBundle := ""
-	var cc mcfg.ControllerConfig
-	if err := nc.client.Get(ctx, types.NamespacedName{Namespace: nc.wmcoNamespace,
-		Name: MccName}, &cc); err != nil {
+	caBundle, userCABundle, err := GenerateTrustedCABundle(ctx, nc.client, nc.wmcoNamespace)
+	if err != nil {
+		return err
+	}
+	if err = nc.UpdateTrustedCABundleFile(caBundle); err != nil {
 		return err
 	}
+	dir, fileName := windows.SplitPath(windows.UserCABundlePath)
+	return nc.Windows.EnsureFileContent([]byte(userCABundle), fileName, dir)
+}
+
+// GenerateTrustedCABundle returns the trusted CA bundle for Windows instances, built from image registry certificates
+// and the proxy trust bundle. The CAs supplied by the cluster administrator within it, the image registry certificates
+// given through the image config and the proxy's additional trust bundle, are also returned on their own, as their
+// expiry is monitored. The rest of the bundle is made of CAs managed by the cluster and of the cluster's system trust
+// store.
+func GenerateTrustedCABundle(ctx context.Context, c client.Client, wmcoNamespace string) (caBundle, userCABundle string,
+	err error) {
+	var cc mcfg.ControllerConfig
+	if err := c.Get(ctx, types.NamespacedName{Namespace: wmcoNamespace, Name: MccName}, &cc); err != nil {
+		return "", "", err
+	}
 	for _, bundle := range cc.Spec.ImageRegistryBundleUserData {
 		caBundle += appendToCABundle(bundle)
+		userCABundle += appendToCABundle(bundle)
 	}
 	for _, bundle := range cc.Spec.ImageRegistryBundleData {
 		caBundle += appendToCABundle(bundle)
 	}
 	if cluster.IsProxyEnabled() {
 		proxyCA := &core.ConfigMap{}
-		if err := nc.client.Get(ctx, types.NamespacedName{Namespace: nc.wmcoNamespace,
+		if err := c.Get(ctx, types.NamespacedName{Namespace: wmcoNamespace,
 			Name: certificates.ProxyCertsConfigMap}, proxyCA); err != nil {
-			return fmt.Errorf("unable to get ConfigMap %s: %w", certificates.ProxyCertsConfigMap, err)
+			return "", "", fmt.Errorf("unable to get ConfigMap %s: %w", certificates.ProxyCertsConfigMap, err)
 		}
 		caBundle += proxyCA.Data[certificates.CABundleKey]
+		userCABundle += string(cc.Spec.AdditionalTrustBundle)
 	}
-	return nc.UpdateTrustedCABundleFile(caBundle)
+	return caBundle, userCABundle, nil
 }
 
 // UpdateTrustedCABundleFile updates the file containing the trusted CA bundle in the Windows node, if needed
@@ -646,7 +893,7 @@ func generateKubeletConfiguration(clusterDNS string) kubeletconfig.KubeletConfig
 		ServerTLSBootstrap: true,
 		Authentication: kubeletconfig.KubeletAuthentication{
 			X509: kubeletconfig.KubeletX509Authentication{
-				ClientCAFile: windows.K8sDir + "\\" + KubeletClientCAFilename,
+				ClientCAFile: windows.KubeletClientCAPath,
 			},
 			Anonymous: kubeletconfig.KubeletAnonymousAuthentication{
 				Enabled: &falseBool,
@@ -687,10 +934,8 @@ func generateKubeletConfiguration(clusterDNS string) kubeletconfig.KubeletConfig
 		ContainerRuntimeEndpoint: "npipe://./pipe/containerd-containerd",
 		// Registers the Kubelet with Windows specific taints so that linux pods won't get scheduled onto
 		// Windows nodes. Explicitly set RegisterNode to ensure RegisterWithTaints takes effect.
-		RegisterNode: &trueBool,
-		RegisterWithTaints: []core.Taint{
-			{Key: "os", Value: "Windows", Effect: core.TaintEffectNoSchedule},
-		},
+		RegisterNode:       &trueBool,
+		RegisterWithTaints: []core.Taint{nodeutil.WindowsTaint},
 		// Set to empty string to override the default. Network configuration in Windows is stored in the
 		// registry database rather than files like in Linux.
 		ResolverConfig: &emptyString,
@@ -724,6 +969,105 @@ func translateIgnitionFilesForWindows(ignToWindowsPaths map[string]string, ignit
 	return filePathsToContents, nil
 }
 
+// GenerateCredentialProviderConfig returns the kubelet credential provider config for Windows nodes, holding the
+// providers given by ignition, and the WICD credential provider if registry credentials are served from the node's
+// credential store. Returns nil if there are no providers.
+func GenerateCredentialProviderConfig(ctx context.Context, c client.Client, namespace string) ([]byte, error) {
+	ign, err := ignition.New(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	var pullSecret []byte
+	if cluster.RegistryCredentialProviderEnabled() {
+		if pullSecret, err = registries.GetPullSecret(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	return generateCredentialProviderConfig(ign.GetFiles(), pullSecret, namespace)
+}
+
+// generateCredentialProviderConfig returns the kubelet credential provider config for Windows nodes based on the given
+// ignition files and pull secret. WICD is given the namespace WMCO is deployed in.
+func generateCredentialProviderConfig(ignitionFiles []ignCfgTypes.File, pullSecret []byte,
+	namespace string) ([]byte, error) {
+	filePathsToContents, err := translateIgnitionFilesForWindows(
+		map[string]string{ignition.ECRCredentialProviderPath: windows.CredentialProviderConfig}, ignitionFiles)
+	if err != nil {
+		return nil, fmt.Errorf("error processing ignition files: %w", err)
+	}
+	contents, present := filePathsToContents[windows.CredentialProviderConfig]
+	if !cluster.RegistryCredentialProviderEnabled() {
+		if !present {
+			return nil, nil
+		}
+		return []byte(contents), nil
+	}
+	return addWICDCredentialProvider([]byte(contents), pullSecret, namespace)
+}
+
+// addWICDCredentialProvider takes the contents of a CredentialProviderConfig yaml file, which may be empty, and returns
+// one which additionally has kubelet request the credentials of every image from WICD. WICD serves the credentials
+// held by the node's registry credential store, which holds the given pull secret.
+func addWICDCredentialProvider(fileContents, pullSecret []byte, namespace string) ([]byte, error) {
+	providerConf := kubeletconfigv1.CredentialProviderConfig{}
+	if err := yaml.Unmarshal(fileContents, &providerConf); err != nil {
+		return nil, fmt.Errorf("could not unmarshal provider config: %w", err)
+	}
+	// A '*' only matches a single subdomain, so a pattern is required for each number of subdomains an image
+	// registry hostname may have
+	matchImages := []string{"*", "*.*", "*.*.*", "*.*.*.*", "*.*.*.*.*", "*.*.*.*.*.*"}
+	// A pattern only matches images of registries served on the same port, so the registries with a port are matched
+	// through the hosts the pull secret holds credentials for
+	portQualified, err := portQualifiedRegistries(pullSecret)
+	if err != nil {
+		return nil, err
+	}
+	matchImages = append(matchImages, portQualified...)
+	providerConf.APIVersion = kubeletconfigv1.SchemeGroupVersion.String()
+	providerConf.Kind = "CredentialProviderConfig"
+	providerConf.Providers = append(providerConf.Providers, kubeletconfigv1.CredentialProvider{
+		// kubelet runs the provider from the directory given by --image-credential-provider-bin-dir
+		Name:                 windows.WicdServiceName + ".exe",
+		MatchImages:          matchImages,
+		DefaultCacheDuration: &meta.Duration{Duration: credentialprovider.CacheDuration},
+		APIVersion:           "credentialprovider.kubelet.k8s.io/v1",
+		Args: []string{"credential-provider", "--kubeconfig=" + windows.WICDKubeconfigPath,
+			"--namespace=" + namespace},
+	})
+	fileContents, err = yaml.Marshal(&providerConf)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling provider config: %w", err)
+	}
+	return fileContents, nil
+}
+
+// portQualifiedRegistries returns the registries, with their port and any repository path, which the given pull secret
+// holds credentials for and whose host includes a port. The result is sorted.
+func portQualifiedRegistries(pullSecret []byte) ([]string, error) {
+	if len(pullSecret) == 0 {
+		return nil, nil
+	}
+	var conf struct {
+		Auths map[string]json.RawMessage `json:"auths"`
+	}
+	if err := json.Unmarshal(pullSecret, &conf); err != nil {
+		return nil, fmt.Errorf("error unmarshalling pull secret: %w", err)
+	}
+	var registriesWithPort []string
+	for key := range conf.Auths {
+		registry := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://"), "/")
+		host, _, _ := strings.Cut(registry, "/")
+		if _, port, err := net.SplitHostPort(host); err != nil || port == "" {
+			continue
+		}
+		if !slices.Contains(registriesWithPort, registry) {
+			registriesWithPort = append(registriesWithPort, registry)
+		}
+	}
+	slices.Sort(registriesWithPort)
+	return registriesWithPort, nil
+}
+
 // modifyCredentialProviderConfig takes the contents of a CredentialProviderConfig yaml file, and returns one which
 // points to '*.exe' files, instead of binaries without extensions. This is needed for the referenced files to be
 // properly run on Windows.
@@ -745,9 +1089,21 @@ func modifyCredentialProviderConfig(fileContents []byte) ([]byte, error) {
 	return fileContents, nil
 }
 
+// osLabels returns the Node labels describing the given operating system
+func osLabels(osInfo *windows.OSInfo) map[string]string {
+	return map[string]string{
+		OSVersionLabel: osInfo.FullVersion(),
+		OSEditionLabel: osInfo.Edition,
+	}
+}
+
 // CreatePubKeyHashAnnotation returns a formatted string which can be used for a public key annotation on a node.
-// The annotation is the sha256 of the public key
+// The annotation is the sha256 of the public key. For user certificates, it is the sha256 of the certified key, so that
+// the annotation is unchanged as certificates are reissued.
 func CreatePubKeyHashAnnotation(key ssh.PublicKey) string {
+	if certificate, ok := key.(*ssh.Certificate); ok {
+		key = certificate.Key
+	}
 	pubKey := string(ssh.MarshalAuthorizedKey(key))
 	trimmedKey := strings.TrimSuffix(pubKey, "\n")
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(trimmedKey)))
@@ -758,14 +1114,3 @@ func CreatePubKeyHashAnnotation(key ssh.PublicKey) string {
 func appendToCABundle(bundle mcfg.ImageRegistryBundle) string {
 	return fmt.Sprintf("# %s\n%s\n\n", strings.ReplaceAll(bundle.File, "..", ":"), bundle.Data)
 }
-
-// validWICDServiceAccountTokenSecret returns true if the given secret provides a token for the WICD SA
-func validWICDServiceAccountTokenSecret(secret core.Secret) bool {
-	if secret.Type != core.SecretTypeServiceAccountToken {
-		return false
-	}
-	if secret.Annotations[core.ServiceAccountNameKey] != windows.WicdServiceName {
-		return false
-	}
-	return true
-}
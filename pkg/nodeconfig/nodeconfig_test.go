@@ -1,13 +1,21 @@
 package nodeconfig
 
 import (
+	"context"
 	"testing"
 
+	mcfg "github.com/openshift/api/machineconfiguration/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	config "k8s.io/kubelet/config/v1"
+	k8scredentialprovider "k8s.io/kubernetes/pkg/credentialprovider"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
 )
 
 func TestNewKubeConfigFromSecret(t *testing.T) {
@@ -63,7 +71,7 @@ func TestNewKubeConfigFromSecret(t *testing.T) {
 
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
-			actualSpec, err := newKubeconfigFromSecret(test.secret, "kubelet")
+			actualSpec, err := newKubeconfigFromSecret(test.secret, "", "kubelet")
 			if test.expectedErr {
 				assert.Error(t, err)
 				return
@@ -148,3 +156,199 @@ func TestModifyCredentialProviderConfig(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, expected, output)
 }
+
+func TestAddWICDCredentialProvider(t *testing.T) {
+	ecrProvider := config.CredentialProvider{
+		Name:        "ecr-credential-provider.exe",
+		MatchImages: []string{"*.dkr.ecr.*.amazonaws.com"},
+		APIVersion:  "credentialprovider.kubelet.k8s.io/v1",
+	}
+	ecrConfig, err := yaml.Marshal(config.CredentialProviderConfig{Providers: []config.CredentialProvider{ecrProvider}})
+	require.NoError(t, err)
+
+	pullSecret := []byte(`{"auths":{"quay.io":{"auth":"dXNlcjpwYXNz"},` +
+		`"https://registry.example.com:5000/":{"auth":"dXNlcjpwYXNz"},` +
+		`"mirror.example.com:8443/org":{"auth":"dXNlcjpwYXNz"}}}`)
+
+	testCases := []struct {
+		name          string
+		input         []byte
+		pullSecret    []byte
+		expectedNames []string
+		matched       []string
+		notMatched    []string
+	}{
+		{
+			name:          "no existing providers",
+			input:         nil,
+			expectedNames: []string{"windows-instance-config-daemon.exe"},
+			matched:       []string{"quay.io/org/image:tag", "registry.example.com/image:tag"},
+			notMatched:    []string{"registry.example.com:5000/org/image:tag"},
+		},
+		{
+			name:          "existing ECR provider",
+			input:         ecrConfig,
+			expectedNames: []string{"ecr-credential-provider.exe", "windows-instance-config-daemon.exe"},
+			matched:       []string{"quay.io/org/image:tag"},
+		},
+		{
+			name:          "pull secret with registries served on a port",
+			input:         nil,
+			pullSecret:    pullSecret,
+			expectedNames: []string{"windows-instance-config-daemon.exe"},
+			matched: []string{"quay.io/org/image:tag", "registry.example.com:5000/org/image:tag",
+				"mirror.example.com:8443/org/image@sha256:0123"},
+			notMatched: []string{"registry.example.com:5001/org/image:tag", "mirror.example.com:8443/other/image"},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := addWICDCredentialProvider(test.input, test.pullSecret,
+				"openshift-windows-machine-config-operator")
+			require.NoError(t, err)
+			output := config.CredentialProviderConfig{}
+			require.NoError(t, yaml.Unmarshal(out, &output))
+			assert.Equal(t, "kubelet.config.k8s.io/v1", output.APIVersion)
+			assert.Equal(t, "CredentialProviderConfig", output.Kind)
+			var names []string
+			for _, provider := range output.Providers {
+				names = append(names, provider.Name)
+			}
+			assert.Equal(t, test.expectedNames, names)
+			wicdProvider := output.Providers[len(output.Providers)-1]
+			assert.Contains(t, wicdProvider.MatchImages, "*.*")
+			for _, image := range test.matched {
+				assert.True(t, matchesAny(t, wicdProvider.MatchImages, image), "%s must be matched", image)
+			}
+			for _, image := range test.notMatched {
+				assert.False(t, matchesAny(t, wicdProvider.MatchImages, image), "%s must not be matched", image)
+			}
+			assert.Contains(t, wicdProvider.Args, "--namespace=openshift-windows-machine-config-operator")
+			assert.Equal(t, "credential-provider", wicdProvider.Args[0])
+		})
+	}
+}
+
+// matchesAny returns true if the given image is matched by any of the given patterns, the way kubelet matches images
+// to credential providers
+func matchesAny(t *testing.T, patterns []string, image string) bool {
+	for _, pattern := range patterns {
+		matched, err := k8scredentialprovider.URLsMatchStr(pattern, image)
+		require.NoError(t, err)
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAddWICDCredentialProviderInvalidPullSecret(t *testing.T) {
+	_, err := addWICDCredentialProvider(nil, []byte("not json"), "namespace")
+	assert.Error(t, err)
+}
+
+func TestGenerateCredentialProviderConfig(t *testing.T) {
+	t.Setenv(cluster.RegistryCredentialProviderEnvVar, "false")
+	out, err := generateCredentialProviderConfig(nil, nil, "namespace")
+	require.NoError(t, err)
+	assert.Nil(t, out)
+
+	t.Setenv(cluster.RegistryCredentialProviderEnvVar, "true")
+	out, err = generateCredentialProviderConfig(nil, nil, "namespace")
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "windows-instance-config-daemon.exe")
+}
+
+func TestClusterEndpointsUpToDate(t *testing.T) {
+	apiServerEndpoint, clusterServiceCIDR := clusterEndpoints()
+	defer UpdateClusterEndpoints(apiServerEndpoint, clusterServiceCIDR)
+
+	nodeWithHash := func(hash string) *core.Node {
+		return &core.Node{ObjectMeta: meta.ObjectMeta{
+			Annotations: map[string]string{ClusterEndpointsHashAnnotation: hash}}}
+	}
+	currentHash := createClusterEndpointsHash("https://api-int.example.com:6443", "172.30.0.0/16")
+
+	testCases := []struct {
+		name              string
+		apiServerEndpoint string
+		node              *core.Node
+		expected          bool
+	}{
+		{
+			name:              "no node",
+			apiServerEndpoint: "https://api-int.example.com:6443",
+			node:              nil,
+			expected:          true,
+		},
+		{
+			name:              "node missing annotation",
+			apiServerEndpoint: "https://api-int.example.com:6443",
+			node:              &core.Node{},
+			expected:          true,
+		},
+		{
+			name:              "node configured with current endpoints",
+			apiServerEndpoint: "https://api-int.example.com:6443",
+			node:              nodeWithHash(currentHash),
+			expected:          true,
+		},
+		{
+			name:              "node configured with old endpoints",
+			apiServerEndpoint: "https://api-int.example.com:6443",
+			node:              nodeWithHash(createClusterEndpointsHash("https://api-int.old.com:6443", "172.30.0.0/16")),
+			expected:          false,
+		},
+		{
+			name:              "API server endpoint not discovered",
+			apiServerEndpoint: "",
+			node:              nodeWithHash(currentHash),
+			expected:          true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			UpdateClusterEndpoints(test.apiServerEndpoint, "172.30.0.0/16")
+			assert.Equal(t, test.expected, ClusterEndpointsUpToDate(test.node))
+		})
+	}
+}
+
+func TestUpdateClusterEndpoints(t *testing.T) {
+	apiServerEndpoint, clusterServiceCIDR := clusterEndpoints()
+	defer UpdateClusterEndpoints(apiServerEndpoint, clusterServiceCIDR)
+
+	UpdateClusterEndpoints("https://api-int.example.com:6443", "172.30.0.0/16")
+	originalHash := ClusterEndpointsHash()
+	assert.False(t, UpdateClusterEndpoints("https://api-int.example.com:6443", "172.30.0.0/16"))
+	assert.Equal(t, originalHash, ClusterEndpointsHash())
+
+	assert.True(t, UpdateClusterEndpoints("https://api-int.example.com:6443", "10.0.0.0/16"))
+	assert.NotEqual(t, originalHash, ClusterEndpointsHash())
+	assert.Equal(t, "10.0.0.0/16", ClusterServiceCIDR())
+}
+
+func TestGenerateTrustedCABundle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, mcfg.Install(scheme))
+	cc := &mcfg.ControllerConfig{
+		ObjectMeta: meta.ObjectMeta{Name: MccName, Namespace: "namespace"},
+		Spec: mcfg.ControllerConfigSpec{
+			AdditionalTrustBundle: []byte("proxy CA"),
+			ImageRegistryBundleUserData: []mcfg.ImageRegistryBundle{
+				{File: "registry.example.com..5000", Data: []byte("user registry CA")},
+			},
+			ImageRegistryBundleData: []mcfg.ImageRegistryBundle{
+				{File: "image-registry.openshift-image-registry.svc..5000", Data: []byte("service CA")},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cc).Build()
+
+	caBundle, userCABundle, err := GenerateTrustedCABundle(context.TODO(), c, "namespace")
+	require.NoError(t, err)
+	assert.Contains(t, caBundle, "# registry.example.com:5000\nuser registry CA")
+	assert.Contains(t, caBundle, "service CA")
+	assert.Equal(t, "# registry.example.com:5000\nuser registry CA\n\n", userCABundle,
+		"only the CAs supplied by the cluster administrator should be returned")
+}
@@ -4,6 +4,9 @@ import (
 	core "k8s.io/api/core/v1"
 )
 
+// WindowsTaint is the taint Windows nodes are registered with, keeping pods which do not tolerate it off of them
+var WindowsTaint = core.Taint{Key: "os", Value: "Windows", Effect: core.TaintEffectNoSchedule}
+
 // FindByAddress returns a pointer to the node within the given list with an address matching the given address, or
 // nil if the node was not found.
 func FindByAddress(address string, nodes *core.NodeList) *core.Node {
@@ -0,0 +1,230 @@
+package prepull
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ListLabel is applied to the ConfigMaps in the WMCO namespace which list images to pre-pull on Windows nodes
+	ListLabel = "windowsmachineconfig.openshift.io/image-prepull"
+	// ImagesKey is the ConfigMap data key listing the images to pre-pull, one per line
+	ImagesKey = "images"
+	// NodeSelectorKey is the optional ConfigMap data key holding a label selector, such as
+	// "machine.openshift.io/cluster-api-machineset=winworker", restricting the list to the matching Windows nodes.
+	// The list applies to all Windows nodes when it is not given.
+	NodeSelectorKey = "nodeSelector"
+	// RequiredKey is the optional ConfigMap data key which, when "true", prevents a node from being uncordoned after
+	// being configured until all images in the list have been pulled
+	RequiredKey = "required"
+	// StatusAnnotation is applied to Windows nodes by WICD, holding the pull status of each image listed for the node
+	StatusAnnotation = "windowsmachineconfig.openshift.io/image-prepull-status"
+	// AwaitingImagesAnnotation is applied by WMCO to a configured node which is kept cordoned until its required images
+	// have been pulled. Its value is the time, in RFC 3339 format, at which the node started waiting.
+	AwaitingImagesAnnotation = "windowsmachineconfig.openshift.io/awaiting-required-images"
+	// RequiredImagesTimeout is the maximum amount of time a configured node is kept cordoned waiting for its required
+	// images to be pulled
+	RequiredImagesTimeout = time.Hour
+)
+
+// List is a list of images to pre-pull on the Windows nodes it applies to
+type List struct {
+	// Name is the name of the ConfigMap holding the list
+	Name string
+	// Images are the images to pre-pull
+	Images []string
+	// Selector selects the nodes the list applies to
+	Selector labels.Selector
+	// Required indicates that nodes must not be uncordoned until all images have been pulled
+	Required bool
+}
+
+// Parse returns the image list held by the given ConfigMap
+func Parse(cm *core.ConfigMap) (*List, error) {
+	if cm == nil {
+		return nil, fmt.Errorf("image pre-pull ConfigMap cannot be nil")
+	}
+	list := &List{Name: cm.GetName(), Selector: labels.Everything()}
+	for key, value := range cm.Data {
+		var err error
+		switch key {
+		case ImagesKey:
+			list.Images, err = parseImages(value)
+		case NodeSelectorKey:
+			list.Selector, err = labels.Parse(value)
+		case RequiredKey:
+			list.Required, err = strconv.ParseBool(strings.TrimSpace(value))
+		default:
+			err = fmt.Errorf("unexpected data key, expected one of %s, %s or %s", ImagesKey, NodeSelectorKey,
+				RequiredKey)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry in ConfigMap %s: %w", key, cm.GetName(), err)
+		}
+	}
+	return list, nil
+}
+
+// parseImages returns the images listed in the given value, ignoring empty lines
+func parseImages(value string) ([]string, error) {
+	var images []string
+	for _, line := range strings.Split(value, "\n") {
+		image := strings.TrimSpace(line)
+		if image == "" {
+			continue
+		}
+		if strings.ContainsAny(image, " \t") {
+			return nil, fmt.Errorf("invalid image %q", image)
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// GetLists returns the image lists held by the labelled ConfigMaps in the given namespace. ConfigMaps which cannot be
+// parsed are returned as errors alongside the lists which can.
+func GetLists(ctx context.Context, c client.Client, namespace string) ([]List, []error, error) {
+	cms := &core.ConfigMapList{}
+	if err := c.List(ctx, cms, client.InNamespace(namespace), client.HasLabels{ListLabel}); err != nil {
+		return nil, nil, fmt.Errorf("error listing image pre-pull ConfigMaps: %w", err)
+	}
+	var lists []List
+	var parseErrs []error
+	for i := range cms.Items {
+		list, err := Parse(&cms.Items[i])
+		if err != nil {
+			parseErrs = append(parseErrs, err)
+			continue
+		}
+		lists = append(lists, *list)
+	}
+	return lists, parseErrs, nil
+}
+
+// ImagesForNode returns the images the given lists specify for a node with the given labels, and the subset of those
+// which are required before the node is uncordoned. Both are sorted and free of duplicates.
+func ImagesForNode(lists []List, nodeLabels map[string]string) (images []string, required []string) {
+	all := make(map[string]struct{})
+	requiredSet := make(map[string]struct{})
+	for _, list := range lists {
+		if !list.Selector.Matches(labels.Set(nodeLabels)) {
+			continue
+		}
+		for _, image := range list.Images {
+			all[image] = struct{}{}
+			if list.Required {
+				requiredSet[image] = struct{}{}
+			}
+		}
+	}
+	return sortedKeys(all), sortedKeys(requiredSet)
+}
+
+// sortedKeys returns the members of the given set in sorted order
+func sortedKeys(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ImageStatus is the pull status of an image on a node
+type ImageStatus struct {
+	// Pulled is true if the image is present on the node
+	Pulled bool `json:"pulled"`
+	// Error holds the reason the latest attempt to pull the image failed
+	Error string `json:"error,omitempty"`
+}
+
+// Status maps each image listed for a node to its pull status on the node
+type Status map[string]ImageStatus
+
+// GetStatus returns the pull status recorded on the given node. An empty status is returned if none is recorded.
+func GetStatus(node *core.Node) (Status, error) {
+	status := make(Status)
+	value, present := node.GetAnnotations()[StatusAnnotation]
+	if !present {
+		return status, nil
+	}
+	if err := json.Unmarshal([]byte(value), &status); err != nil {
+		return nil, fmt.Errorf("unable to parse %s annotation of node %s: %w", StatusAnnotation, node.GetName(), err)
+	}
+	return status, nil
+}
+
+// Marshal returns the status in the form recorded on nodes
+func (s Status) Marshal() (string, error) {
+	out, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// AwaitingSince returns the time at which the given node started waiting for its required images to be pulled, and
+// whether it is waiting. A node with an unparsable annotation is treated as having waited for the full timeout.
+func AwaitingSince(node *core.Node) (time.Time, bool) {
+	value, present := node.GetAnnotations()[AwaitingImagesAnnotation]
+	if !present {
+		return time.Time{}, false
+	}
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, true
+	}
+	return since, true
+}
+
+// Pending returns the given images which have not been pulled according to the status
+func (s Status) Pending(images []string) []string {
+	var pending []string
+	for _, image := range images {
+		if !s[image].Pulled {
+			pending = append(pending, image)
+		}
+	}
+	return pending
+}
+
+// Counts returns the number of the given images which have been pulled, are yet to be pulled, and whose latest pull
+// attempt failed, according to the status
+func (s Status) Counts(images []string) (pulled, pending, failed int) {
+	for _, image := range images {
+		status := s[image]
+		switch {
+		case status.Pulled:
+			pulled++
+		case status.Error != "":
+			failed++
+		default:
+			pending++
+		}
+	}
+	return pulled, pending, failed
+}
+
+// Failed returns the images whose latest pull attempt failed, sorted
+func (s Status) Failed() []string {
+	var failed []string
+	for image, status := range s {
+		if !status.Pulled && status.Error != "" {
+			failed = append(failed, image)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
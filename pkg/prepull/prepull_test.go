@@ -0,0 +1,122 @@
+package prepull
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name             string
+		data             map[string]string
+		expectedImages   []string
+		expectedRequired bool
+		matchingLabels   map[string]string
+		otherLabels      map[string]string
+		expectedErr      bool
+	}{
+		{
+			name: "cluster-wide list",
+			data: map[string]string{
+				ImagesKey: "mcr.microsoft.com/windows/servercore:ltsc2022\r\n\n quay.io/org/app@sha256:abc \n",
+			},
+			expectedImages: []string{"mcr.microsoft.com/windows/servercore:ltsc2022", "quay.io/org/app@sha256:abc"},
+			matchingLabels: map[string]string{"any": "node"},
+		},
+		{
+			name: "required list for a pool",
+			data: map[string]string{
+				ImagesKey:       "mcr.microsoft.com/windows/servercore:ltsc2022",
+				NodeSelectorKey: "machine.openshift.io/cluster-api-machineset=winworker",
+				RequiredKey:     "true",
+			},
+			expectedImages:   []string{"mcr.microsoft.com/windows/servercore:ltsc2022"},
+			expectedRequired: true,
+			matchingLabels:   map[string]string{"machine.openshift.io/cluster-api-machineset": "winworker"},
+			otherLabels:      map[string]string{"machine.openshift.io/cluster-api-machineset": "other"},
+		},
+		{
+			name:        "invalid image",
+			data:        map[string]string{ImagesKey: "quay.io/org/app latest"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid node selector",
+			data:        map[string]string{ImagesKey: "quay.io/org/app", NodeSelectorKey: "a=b=c"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid required value",
+			data:        map[string]string{ImagesKey: "quay.io/org/app", RequiredKey: "sometimes"},
+			expectedErr: true,
+		},
+		{
+			name:        "unrecognized data key",
+			data:        map[string]string{ImagesKey: "quay.io/org/app", "timeout": "5m"},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			list, err := Parse(&core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: "list"}, Data: test.data})
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedImages, list.Images)
+			assert.Equal(t, test.expectedRequired, list.Required)
+			assert.True(t, list.Selector.Matches(labels.Set(test.matchingLabels)))
+			if test.otherLabels != nil {
+				assert.False(t, list.Selector.Matches(labels.Set(test.otherLabels)))
+			}
+		})
+	}
+}
+
+func TestImagesForNode(t *testing.T) {
+	clusterWide, err := Parse(&core.ConfigMap{Data: map[string]string{ImagesKey: "b.io/image\na.io/image"}})
+	require.NoError(t, err)
+	pool, err := Parse(&core.ConfigMap{Data: map[string]string{ImagesKey: "a.io/image\nc.io/image",
+		NodeSelectorKey: "pool=gpu", RequiredKey: "true"}})
+	require.NoError(t, err)
+	lists := []List{*clusterWide, *pool}
+
+	images, required := ImagesForNode(lists, map[string]string{"pool": "gpu"})
+	assert.Equal(t, []string{"a.io/image", "b.io/image", "c.io/image"}, images)
+	assert.Equal(t, []string{"a.io/image", "c.io/image"}, required)
+
+	images, required = ImagesForNode(lists, map[string]string{"pool": "cpu"})
+	assert.Equal(t, []string{"a.io/image", "b.io/image"}, images)
+	assert.Nil(t, required)
+}
+
+func TestStatus(t *testing.T) {
+	status := Status{
+		"a.io/image": {Pulled: true},
+		"b.io/image": {Error: "not found"},
+	}
+	value, err := status.Marshal()
+	require.NoError(t, err)
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{Annotations: map[string]string{StatusAnnotation: value}}}
+	parsed, err := GetStatus(node)
+	require.NoError(t, err)
+	assert.Equal(t, status, parsed)
+
+	images := []string{"a.io/image", "b.io/image", "c.io/image"}
+	assert.Equal(t, []string{"b.io/image", "c.io/image"}, parsed.Pending(images))
+	assert.Equal(t, []string{"b.io/image"}, parsed.Failed())
+	pulled, pending, failed := parsed.Counts(images)
+	assert.Equal(t, []int{1, 1, 1}, []int{pulled, pending, failed})
+
+	empty, err := GetStatus(&core.Node{})
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+	_, err = GetStatus(&core.Node{ObjectMeta: meta.ObjectMeta{Annotations: map[string]string{StatusAnnotation: "{"}}})
+	assert.Error(t, err)
+}
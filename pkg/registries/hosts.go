@@ -0,0 +1,93 @@
+package registries
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// hostsFileName is the name of the registry host configuration file within a registry's config directory
+const hostsFileName = "hosts.toml"
+
+// HostConfig holds the settings containerd uses when interacting with a registry host. The fields follow the hosts.toml
+// schema described in https://github.com/containerd/containerd/blob/main/docs/hosts.md
+type HostConfig struct {
+	// Capabilities are the operations the host may perform. Nil gives the host all capabilities, while an empty list
+	// prevents the host from being contacted.
+	Capabilities *[]string `toml:"capabilities,omitempty"`
+	// CA holds the paths of the CA bundles the host's certificate is verified with
+	CA []string `toml:"ca,omitempty"`
+	// Client holds the paths of the client certificate and key pairs presented to the host
+	Client [][2]string `toml:"client,omitempty"`
+	// SkipVerify disables verification of the host's certificate
+	SkipVerify bool `toml:"skip_verify,omitempty"`
+	// OverridePath indicates the host's URL already holds the API root path, so /v2 must not be appended
+	OverridePath bool `toml:"override_path,omitempty"`
+	// Header holds the headers added to each request to the host
+	Header map[string][]string `toml:"header,omitempty"`
+}
+
+// hostsFile is the typed representation of a containerd registry host configuration file
+type hostsFile struct {
+	// Server is the registry's default host, contacted after all other hosts have failed
+	Server string `toml:"server,omitempty"`
+	// HostConfig holds the settings of the default host
+	HostConfig
+	// Hosts holds the settings of each host, keyed by the host's URL. containerd tries the hosts in the order they
+	// appear in the file, which is the order of their URLs, as map keys are sorted when encoded.
+	Hosts map[string]HostConfig `toml:"host,omitempty"`
+}
+
+// capabilities returns the given capabilities in the form expected by HostConfig
+func capabilities(c ...string) *[]string {
+	if c == nil {
+		c = []string{}
+	}
+	return &c
+}
+
+// hostURLs returns the URLs of the hosts within the file, in the order containerd tries them
+func (f *hostsFile) hostURLs() []string {
+	urls := make([]string, 0, len(f.Hosts))
+	for url := range f.Hosts {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// marshal returns the TOML encoding of the file
+func (f *hostsFile) marshal() ([]byte, error) {
+	out, err := toml.Marshal(f)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s for %s: %w", hostsFileName, f.Server, err)
+	}
+	return out, nil
+}
+
+// hostURL returns the URL containerd uses to reach the registry API at the given location, which can include the
+// registry hostname, port, and namespace path
+func hostURL(location string) string {
+	url := fmt.Sprintf("https://%s/v2", extractRegistryHostname(location))
+	if orgPath := extractRegistryOrgPath(location); orgPath != "" {
+		url += "/" + orgPath
+	}
+	return url
+}
+
+// hostDirectory returns the name of the config directory containerd looks up for the given registry host on Windows.
+// ':' is not valid within Windows paths, so containerd expects the port of a host to be given as "_port_".
+func hostDirectory(host string) string {
+	if idx := strings.LastIndex(host, ":"); idx > 0 {
+		return host[:idx] + "_" + host[idx+1:] + "_"
+	}
+	return host
+}
+
+// hostFilePath returns the path, relative to the config directory of a registry, of the given file within the config
+// directory of the given registry host. containerd resolves relative paths against the directory of the hosts file.
+func hostFilePath(host, fileName string) string {
+	return fmt.Sprintf("../%s/%s", hostDirectory(host), fileName)
+}
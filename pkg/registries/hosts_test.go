@@ -0,0 +1,151 @@
+package registries
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	config "github.com/openshift/api/config/v1"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/kubernetes/pkg/credentialprovider"
+)
+
+// containerdHostFileConfig mirrors the schema containerd uses to parse each host within a hosts.toml file
+type containerdHostFileConfig struct {
+	Capabilities []string               `toml:"capabilities"`
+	CACert       interface{}            `toml:"ca"`
+	Client       interface{}            `toml:"client"`
+	SkipVerify   *bool                  `toml:"skip_verify"`
+	Header       map[string]interface{} `toml:"header"`
+	OverridePath bool                   `toml:"override_path"`
+}
+
+// containerdHostsFile mirrors the schema containerd uses to parse a hosts.toml file
+type containerdHostsFile struct {
+	Server       string                              `toml:"server"`
+	Capabilities []string                            `toml:"capabilities"`
+	CACert       interface{}                         `toml:"ca"`
+	Client       interface{}                         `toml:"client"`
+	SkipVerify   *bool                               `toml:"skip_verify"`
+	Header       map[string]interface{}              `toml:"header"`
+	OverridePath bool                                `toml:"override_path"`
+	HostConfigs  map[string]containerdHostFileConfig `toml:"host"`
+}
+
+// parseContainerdHostsFile decodes the given hosts.toml contents, erroring on any key containerd does not recognize
+func parseContainerdHostsFile(t *testing.T, contents []byte) containerdHostsFile {
+	var parsed containerdHostsFile
+	decoder := toml.NewDecoder(bytes.NewReader(contents))
+	decoder.DisallowUnknownFields()
+	require.NoError(t, decoder.Decode(&parsed), "invalid hosts.toml:\n%s", contents)
+	return parsed
+}
+
+func TestGenerateConfigRoundTrip(t *testing.T) {
+	// credentials containing characters which require escaping within TOML strings
+	username := `user"name`
+	password := `pass\word'"`
+	secretsConfig := credentialprovider.DockerConfigJSON{
+		Auths: credentialprovider.DockerConfig{
+			"mirror.example.com:5000": credentialprovider.DockerConfigEntry{Username: username, Password: password},
+		},
+	}
+	policy := newRegistryPolicy(config.RegistrySources{InsecureRegistries: []string{"mirror.example.com:5000"}},
+		map[string]string{"mirror.example.com..5000": "cert"},
+		map[string][]byte{"mirror.example.com..5000.crt": []byte("cert"), "mirror.example.com..5000.key": []byte("key")})
+	ms := mirrorSet{
+		source: "registry.example.com",
+		mirrors: []mirror{
+			{host: "mirror.example.com:5000/org's/path", resolveTags: true},
+			{host: "other.example.com", resolveTags: false},
+		},
+		mirrorSourcePolicy: config.AllowContactingSource,
+	}
+
+	out, err := ms.generateConfig(secretsConfig, policy)
+	require.NoError(t, err)
+	parsed := parseContainerdHostsFile(t, out)
+
+	assert.Equal(t, "https://registry.example.com/v2", parsed.Server)
+	assert.True(t, parsed.OverridePath)
+	assert.Nil(t, parsed.Capabilities)
+	require.Len(t, parsed.HostConfigs, 2)
+
+	mirrorHost, ok := parsed.HostConfigs["https://mirror.example.com:5000/v2/org's/path"]
+	require.True(t, ok, "mirror host missing from %v", parsed.HostConfigs)
+	assert.Equal(t, []string{"pull", "resolve"}, mirrorHost.Capabilities)
+	assert.True(t, mirrorHost.OverridePath)
+	require.NotNil(t, mirrorHost.SkipVerify)
+	assert.True(t, *mirrorHost.SkipVerify)
+	assert.Equal(t, []interface{}{"../mirror.example.com_5000_/ca.crt"}, mirrorHost.CACert)
+	assert.Equal(t, []interface{}{[]interface{}{"../mirror.example.com_5000_/client.cert",
+		"../mirror.example.com_5000_/client.key"}}, mirrorHost.Client)
+	token := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	assert.Equal(t, []interface{}{"Basic " + token}, mirrorHost.Header["authorization"])
+
+	otherHost, ok := parsed.HostConfigs["https://other.example.com/v2"]
+	require.True(t, ok, "mirror host missing from %v", parsed.HostConfigs)
+	assert.Equal(t, []string{"pull"}, otherHost.Capabilities)
+	assert.Nil(t, otherHost.SkipVerify)
+	assert.Nil(t, otherHost.CACert)
+	assert.Nil(t, otherHost.Client)
+	assert.Nil(t, otherHost.Header)
+}
+
+func TestGenerateConfigRoundTripBlocked(t *testing.T) {
+	policy := newRegistryPolicy(config.RegistrySources{BlockedRegistries: []string{"registry.example.com"}}, nil, nil)
+	ms := mirrorSet{source: "registry.example.com", mirrors: []mirror{}}
+
+	out, err := ms.generateConfig(credentialprovider.DockerConfigJSON{}, policy)
+	require.NoError(t, err)
+	parsed := parseContainerdHostsFile(t, out)
+	// an empty, rather than missing, capabilities list prevents containerd from contacting the server
+	assert.NotNil(t, parsed.Capabilities)
+	assert.Empty(t, parsed.Capabilities)
+
+	out, err = generateBlockedDefaultConfig()
+	require.NoError(t, err)
+	parsed = parseContainerdHostsFile(t, out)
+	assert.Equal(t, blockedServer, parsed.Server)
+	assert.NotNil(t, parsed.Capabilities)
+	assert.Empty(t, parsed.Capabilities)
+}
+
+func TestHostURLs(t *testing.T) {
+	file := hostsFile{Hosts: map[string]HostConfig{
+		"https://b.example.com/v2":      {},
+		"https://a.example.com/v2/org":  {},
+		"https://a.example.com:5000/v2": {},
+	}}
+	out, err := file.marshal()
+	require.NoError(t, err)
+	urls := file.hostURLs()
+	assert.Equal(t, []string{"https://a.example.com/v2/org", "https://a.example.com:5000/v2",
+		"https://b.example.com/v2"}, urls)
+	// the hosts must appear in the file in the same order, as that is the order containerd tries them in
+	previous := -1
+	for _, url := range urls {
+		index := bytes.Index(out, []byte(url))
+		require.NotEqual(t, -1, index)
+		assert.Greater(t, index, previous)
+		previous = index
+	}
+}
+
+func TestHostDirectory(t *testing.T) {
+	testCases := []struct {
+		host     string
+		expected string
+	}{
+		{host: "registry.example.com", expected: "registry.example.com"},
+		{host: "registry.example.com:5000", expected: "registry.example.com_5000_"},
+		{host: "10.0.0.1:443", expected: "10.0.0.1_443_"},
+	}
+	for _, test := range testCases {
+		t.Run(test.host, func(t *testing.T) {
+			assert.Equal(t, test.expected, hostDirectory(test.host))
+		})
+	}
+}
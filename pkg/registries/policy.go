@@ -0,0 +1,207 @@
+package registries
+
+import (
+	"strings"
+
+	config "github.com/openshift/api/config/v1"
+)
+
+const (
+	// caFileName is the name of the file holding a registry's additional trusted CA, within the registry's config
+	// directory
+	caFileName = "ca.crt"
+	// clientCertFileName is the name of the file holding the client certificate presented to a registry, within the
+	// registry's config directory
+	clientCertFileName = "client.cert"
+	// clientKeyFileName is the name of the file holding the key of the client certificate presented to a registry,
+	// within the registry's config directory
+	clientKeyFileName = "client.key"
+	// clientCertKeySuffix is the suffix of the client certificates Secret keys holding the certificate of a registry
+	clientCertKeySuffix = ".crt"
+	// clientKeyKeySuffix is the suffix of the client certificates Secret keys holding the key of a registry
+	clientKeyKeySuffix = ".key"
+	// defaultHostDir is the config directory containerd uses for any registry without a config directory of its own
+	defaultHostDir = "_default"
+	// caKeyPortSeparator replaces the ':' separating a registry hostname and port in the keys of the additional trusted
+	// CA ConfigMap, as ':' is not valid within ConfigMap keys
+	caKeyPortSeparator = ".."
+	// blockedServer is the server used in the config of the default host when registries are restricted to an allowed
+	// list. The .invalid TLD is reserved, and the server is never contacted as it is given no capabilities.
+	blockedServer = "https://registry.blocked.invalid/v2"
+)
+
+// registryPolicy holds the cluster-wide policy for pulling from registries, as given by the cluster image config.
+// containerd is only able to apply policy to whole registry hosts, so repository scoped and wildcard entries are
+// handled as described by newRegistryPolicy.
+type registryPolicy struct {
+	// insecure holds the registry hosts whose certificates are not verified
+	insecure map[string]struct{}
+	// blocked holds the registry hosts images cannot be pulled from
+	blocked map[string]struct{}
+	// allowed holds the only registry hosts images can be pulled from. Nil if pulls are not restricted.
+	allowed map[string]struct{}
+	// trustedCAs maps registry hosts to the additional CA bundle their certificates are verified with
+	trustedCAs map[string]string
+	// clientCerts maps registry hosts to the client certificate and key presented to them
+	clientCerts map[string]clientCert
+}
+
+// clientCert is a client certificate and key presented to a registry
+type clientCert struct {
+	cert []byte
+	key  []byte
+}
+
+// newRegistryPolicy returns the policy described by the given registry sources, additional trusted CA ConfigMap data
+// and client certificates Secret data. The client certificate and key of a registry are given by the keys
+// <host>[..port].crt and <host>[..port].key, following the additional trusted CA key format. Repository scoped insecure
+// and allowed entries apply to the whole registry host, while repository scoped blocked entries are ignored, as
+// blocking the host would block more than intended. Wildcard entries are ignored.
+func newRegistryPolicy(sources config.RegistrySources, trustedCAs map[string]string,
+	clientCerts map[string][]byte) registryPolicy {
+	policy := registryPolicy{
+		insecure:    toHostSet(sources.InsecureRegistries, true),
+		blocked:     toHostSet(sources.BlockedRegistries, false),
+		trustedCAs:  make(map[string]string),
+		clientCerts: make(map[string]clientCert),
+	}
+	if len(sources.AllowedRegistries) > 0 {
+		policy.allowed = toHostSet(sources.AllowedRegistries, true)
+	}
+	for key, ca := range trustedCAs {
+		if host, ok := hostFromKey(key); ok {
+			policy.trustedCAs[host] = ca
+		}
+	}
+	for key, cert := range clientCerts {
+		if !strings.HasSuffix(key, clientCertKeySuffix) {
+			continue
+		}
+		key = strings.TrimSuffix(key, clientCertKeySuffix)
+		host, ok := hostFromKey(key)
+		if !ok {
+			continue
+		}
+		// a certificate without its key is unusable
+		if certKey, present := clientCerts[key+clientKeyKeySuffix]; present {
+			policy.clientCerts[host] = clientCert{cert: cert, key: certKey}
+		}
+	}
+	return policy
+}
+
+// hostFromKey returns the registry host given by a key of the form <host>[..port], and false if the key does not
+// refer to a single registry host
+func hostFromKey(key string) (string, bool) {
+	host := strings.Replace(key, caKeyPortSeparator, ":", 1)
+	if host == "" || strings.Contains(host, "*") || strings.Contains(host, imagePathSeparator) {
+		return "", false
+	}
+	return host, true
+}
+
+// toHostSet returns the set of registry hosts in the given registry source entries, skipping wildcard entries.
+// Repository scoped entries are reduced to their registry host if includeScoped is true, and skipped otherwise.
+func toHostSet(entries []string, includeScoped bool) map[string]struct{} {
+	hosts := make(map[string]struct{})
+	for _, entry := range entries {
+		if strings.Contains(entry, "*") {
+			continue
+		}
+		host := extractRegistryHostname(entry)
+		if host != entry && !includeScoped {
+			continue
+		}
+		hosts[host] = struct{}{}
+	}
+	return hosts
+}
+
+// isBlocked returns true if images cannot be pulled from the given registry host
+func (p registryPolicy) isBlocked(host string) bool {
+	if _, ok := p.blocked[host]; ok {
+		return true
+	}
+	if p.allowed != nil {
+		_, ok := p.allowed[host]
+		return !ok
+	}
+	return false
+}
+
+// appliesTo returns true if the given registry host requires a config file of its own to apply the policy
+func (p registryPolicy) appliesTo(host string) bool {
+	if _, ok := p.insecure[host]; ok {
+		return true
+	}
+	if _, ok := p.trustedCAs[host]; ok {
+		return true
+	}
+	if _, ok := p.clientCerts[host]; ok {
+		return true
+	}
+	if _, ok := p.allowed[host]; ok {
+		// explicitly allowed hosts must not fall back to the blocked default host config
+		return true
+	}
+	return p.isBlocked(host)
+}
+
+// applyHostSettings sets the TLS settings for the given registry host in the given host config
+func (p registryPolicy) applyHostSettings(host string, hostConfig *HostConfig) {
+	if _, ok := p.insecure[host]; ok {
+		hostConfig.SkipVerify = true
+	}
+	if _, ok := p.trustedCAs[host]; ok {
+		hostConfig.CA = []string{hostFilePath(host, caFileName)}
+	}
+	if _, ok := p.clientCerts[host]; ok {
+		hostConfig.Client = [][2]string{{hostFilePath(host, clientCertFileName), hostFilePath(host, clientKeyFileName)}}
+	}
+}
+
+// files returns the files referenced by the TLS settings of the registry hosts, keyed by their path within containerd's
+// config directory
+func (p registryPolicy) files() map[string][]byte {
+	files := make(map[string][]byte)
+	for host, ca := range p.trustedCAs {
+		files[hostDirectory(host)+"\\"+caFileName] = []byte(ca)
+	}
+	for host, cert := range p.clientCerts {
+		files[hostDirectory(host)+"\\"+clientCertFileName] = cert.cert
+		files[hostDirectory(host)+"\\"+clientKeyFileName] = cert.key
+	}
+	return files
+}
+
+// addPolicySources returns the given mirror sets, with an entry without mirrors added for each registry host which
+// the policy applies to but which has no mirror set of its own. Output is sorted to ensure it is deterministic.
+func addPolicySources(mirrorSets []mirrorSet, policy registryPolicy) []mirrorSet {
+	hosts := make(map[string]struct{})
+	for _, set := range []map[string]struct{}{policy.insecure, policy.blocked, policy.allowed} {
+		for host := range set {
+			hosts[host] = struct{}{}
+		}
+	}
+	for host := range policy.trustedCAs {
+		hosts[host] = struct{}{}
+	}
+	for host := range policy.clientCerts {
+		hosts[host] = struct{}{}
+	}
+	for _, ms := range mirrorSets {
+		delete(hosts, ms.source)
+	}
+	for host := range hosts {
+		mirrorSets = append(mirrorSets, mirrorSet{source: host, mirrors: []mirror{}})
+	}
+	sortMirrorSets(mirrorSets)
+	return mirrorSets
+}
+
+// generateBlockedDefaultConfig returns the config applied to any registry without a config file of its own when
+// registries are restricted to an allowed list, preventing images from being pulled from them
+func generateBlockedDefaultConfig() ([]byte, error) {
+	file := hostsFile{Server: blockedServer, HostConfig: HostConfig{Capabilities: capabilities()}}
+	return file.marshal()
+}
@@ -0,0 +1,162 @@
+package registries
+
+import (
+	"testing"
+
+	config "github.com/openshift/api/config/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRegistryPolicy(t *testing.T) {
+	testCases := []struct {
+		name             string
+		sources          config.RegistrySources
+		trustedCAs       map[string]string
+		clientCerts      map[string][]byte
+		expectedInsecure []string
+		expectedBlocked  []string
+		expectedAllowed  []string
+		expectedCAHosts  []string
+		expectedCertHost []string
+	}{
+		{
+			name:    "no policy",
+			sources: config.RegistrySources{},
+		},
+		{
+			name: "insecure registries",
+			sources: config.RegistrySources{
+				InsecureRegistries: []string{"registry.example.com", "quay.io/org/image", "*.example.net"},
+			},
+			expectedInsecure: []string{"registry.example.com", "quay.io"},
+		},
+		{
+			name: "blocked registries",
+			sources: config.RegistrySources{
+				BlockedRegistries: []string{"registry.example.com:5000", "quay.io/org/image", "*.example.net"},
+			},
+			expectedBlocked: []string{"registry.example.com:5000"},
+		},
+		{
+			name: "allowed registries",
+			sources: config.RegistrySources{
+				AllowedRegistries: []string{"registry.example.com", "quay.io/org", "*.example.net"},
+			},
+			expectedAllowed: []string{"registry.example.com", "quay.io"},
+		},
+		{
+			name: "trusted CAs",
+			trustedCAs: map[string]string{
+				"registry.example.com":       "cert",
+				"registry.example.com..5000": "cert",
+				"*.example.net":              "cert",
+			},
+			expectedCAHosts: []string{"registry.example.com", "registry.example.com:5000"},
+		},
+		{
+			name: "client certificates",
+			clientCerts: map[string][]byte{
+				"registry.example.com.crt":       []byte("cert"),
+				"registry.example.com.key":       []byte("key"),
+				"registry.example.com..5000.crt": []byte("cert"),
+				"registry.example.com..5000.key": []byte("key"),
+				"missing-key.example.com.crt":    []byte("cert"),
+				"missing-cert.example.com.key":   []byte("key"),
+			},
+			expectedCertHost: []string{"registry.example.com", "registry.example.com:5000"},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			policy := newRegistryPolicy(test.sources, test.trustedCAs, test.clientCerts)
+			assert.ElementsMatch(t, test.expectedInsecure, keys(policy.insecure))
+			assert.ElementsMatch(t, test.expectedBlocked, keys(policy.blocked))
+			assert.ElementsMatch(t, test.expectedAllowed, keys(policy.allowed))
+			assert.Equal(t, len(test.sources.AllowedRegistries) == 0, policy.allowed == nil)
+			var caHosts []string
+			for host := range policy.trustedCAs {
+				caHosts = append(caHosts, host)
+			}
+			assert.ElementsMatch(t, test.expectedCAHosts, caHosts)
+			var certHosts []string
+			for host := range policy.clientCerts {
+				certHosts = append(certHosts, host)
+			}
+			assert.ElementsMatch(t, test.expectedCertHost, certHosts)
+		})
+	}
+}
+
+func TestIsBlocked(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sources  config.RegistrySources
+		host     string
+		expected bool
+	}{
+		{
+			name:     "no policy",
+			host:     "registry.example.com",
+			expected: false,
+		},
+		{
+			name:     "blocked host",
+			sources:  config.RegistrySources{BlockedRegistries: []string{"registry.example.com"}},
+			host:     "registry.example.com",
+			expected: true,
+		},
+		{
+			name:     "host not in blocked list",
+			sources:  config.RegistrySources{BlockedRegistries: []string{"registry.example.com"}},
+			host:     "quay.io",
+			expected: false,
+		},
+		{
+			name:     "allowed host",
+			sources:  config.RegistrySources{AllowedRegistries: []string{"registry.example.com"}},
+			host:     "registry.example.com",
+			expected: false,
+		},
+		{
+			name:     "host not in allowed list",
+			sources:  config.RegistrySources{AllowedRegistries: []string{"registry.example.com"}},
+			host:     "quay.io",
+			expected: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, newRegistryPolicy(test.sources, nil, nil).isBlocked(test.host))
+		})
+	}
+}
+
+func TestAddPolicySources(t *testing.T) {
+	policy := newRegistryPolicy(config.RegistrySources{
+		InsecureRegistries: []string{"insecure.example.com", "registry.access.redhat.com"},
+		AllowedRegistries:  []string{"allowed.example.com"},
+	}, map[string]string{"ca.example.com": "cert"},
+		map[string][]byte{"client.example.com.crt": []byte("cert"), "client.example.com.key": []byte("key")})
+	mirrorSets := []mirrorSet{
+		{source: "registry.access.redhat.com", mirrors: []mirror{{host: "example.io/example"}}},
+	}
+
+	out := addPolicySources(mirrorSets, policy)
+	var sources []string
+	for _, ms := range out {
+		sources = append(sources, ms.source)
+	}
+	assert.Equal(t, []string{"allowed.example.com", "ca.example.com", "client.example.com", "insecure.example.com",
+		"registry.access.redhat.com"}, sources)
+	// existing mirror sets must be left untouched
+	assert.Equal(t, []mirror{{host: "example.io/example"}}, out[4].mirrors)
+}
+
+// keys returns the members of the given set
+func keys(set map[string]struct{}) []string {
+	var result []string
+	for key := range set {
+		result = append(result, key)
+	}
+	return result
+}
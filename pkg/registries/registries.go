@@ -11,9 +11,12 @@ import (
 
 	config "github.com/openshift/api/config/v1"
 	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/kubernetes/pkg/credentialprovider"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
 )
 
 // imagePathSeparator separates the repo name, namespaces, and image name in an OCI-compliant image name
@@ -22,6 +25,14 @@ const imagePathSeparator = "/"
 var (
 	GlobalPullSecretNamespace = "openshift-config"
 	GlobalPullSecretName      = "pull-secret"
+	// ImageConfigName is the name of the cluster-wide image config
+	ImageConfigName = "cluster"
+	// AdditionalTrustedCANamespace is the namespace of the ConfigMap referenced by the image config's
+	// additionalTrustedCA field
+	AdditionalTrustedCANamespace = "openshift-config"
+	// ClientCertsSecretName is the name of the Secret in the operator namespace holding the client certificates
+	// presented to registries
+	ClientCertsSecretName = "windows-registry-client-certs"
 )
 
 // mirror represents a mirrored image repo entry in a registry configuration file
@@ -215,72 +226,57 @@ func mergeMirrors(existingMirrors, newMirrors []mirror) []mirror {
 	return result
 }
 
-// generateConfig is a serialization method that generates a valid TOML representation from a mirrorSet object.
-// Results in content usable as a containerd image registry configuration file. Returns empty string if no mirrors exist
-func (ms *mirrorSet) generateConfig(secretsConfig credentialprovider.DockerConfigJSON) string {
-	if len(ms.mirrors) == 0 {
-		return ""
+// generateConfig generates the containerd registry host configuration file for the mirrorSet. Returns nil if there
+// are no mirrors and no registry policy applies to the source.
+func (ms *mirrorSet) generateConfig(secretsConfig credentialprovider.DockerConfigJSON,
+	policy registryPolicy) ([]byte, error) {
+	if len(ms.mirrors) == 0 && !policy.appliesTo(ms.source) {
+		return nil, nil
 	}
 
-	result := ""
-
-	fallbackServer := ms.source
-	if ms.mirrorSourcePolicy == config.NeverContactSource {
-		// set the fallback server to the first mirror to ensure the source is never contacted, even if all mirrors fail
-		fallbackServer = ms.mirrors[0].host
-	}
-	fallbackRegistry := extractRegistryHostname(fallbackServer)
-	result += fmt.Sprintf("server = \"https://%s/v2", fallbackRegistry)
-	if orgPath := extractRegistryOrgPath(fallbackServer); orgPath != "" {
-		result += "/" + orgPath
-	}
-	result += "\"\n"
-	result += "\noverride_path = true\n"
-
-	// Each mirror should result in an entry followed by a set of settings for interacting with the mirror host
+	file := hostsFile{Hosts: make(map[string]HostConfig)}
+	// Each mirror should result in an entry with a set of settings for interacting with the mirror host
 	for _, m := range ms.mirrors {
 		hostRegistry := extractRegistryHostname(m.host)
-		hostOrgPath := extractRegistryOrgPath(m.host)
-		result += "\n"
-		result += fmt.Sprintf("[host.\"https://%s/v2", hostRegistry)
-		if hostOrgPath != "" {
-			result += "/" + hostOrgPath
-		}
-		result += "\"]\n"
-
+		hostConfig := HostConfig{OverridePath: true}
 		// Specify the operations the registry host may perform. IDMS mirrors can only be pulled by directly by digest,
 		// whereas ITMS mirrors have the additional resolve capability, which allows converting a tag name into a digest
-		var hostCapabilities string
 		if m.resolveTags {
-			hostCapabilities = "  capabilities = [\"pull\", \"resolve\"]"
+			hostConfig.Capabilities = capabilities("pull", "resolve")
 		} else {
-			hostCapabilities = "  capabilities = [\"pull\"]"
+			hostConfig.Capabilities = capabilities("pull")
 		}
-		result += hostCapabilities
-		result += "\n"
-		result += "  override_path = true\n"
+		policy.applyHostSettings(hostRegistry, &hostConfig)
 
-		// Extract the mirror repo's authorization credentials, if one exists
-		if entry, ok := secretsConfig.Auths[extractRegistryHostname(m.host)]; ok {
+		// Extract the mirror repo's authorization credentials, if one exists, adding the access token as a header
+		if entry, ok := secretsConfig.Auths[hostRegistry]; ok {
 			credentials := entry.Username + ":" + entry.Password
 			token := base64.StdEncoding.EncodeToString([]byte(credentials))
-
-			// Add the access token as a request header
-			result += fmt.Sprintf("  [host.\"https://%s/v2", hostRegistry)
-			if hostOrgPath != "" {
-				result += "/" + hostOrgPath
-			}
-			result += "\".header]\n"
-			result += fmt.Sprintf("    authorization = \"Basic %s\"", token)
-			result += "\n"
+			hostConfig.Header = map[string][]string{"authorization": {"Basic " + token}}
 		}
+		file.Hosts[hostURL(m.host)] = hostConfig
 	}
 
-	return result
+	file.Server = hostURL(ms.source)
+	file.OverridePath = true
+	if policy.isBlocked(ms.source) {
+		// A host without capabilities is never contacted, images can only be pulled from the source through its mirrors
+		file.Capabilities = capabilities()
+	} else if ms.mirrorSourcePolicy == config.NeverContactSource && len(file.Hosts) > 0 {
+		// set the fallback server to the first mirror to ensure the source is never contacted, even if all mirrors fail
+		firstMirror := file.hostURLs()[0]
+		file.Server = firstMirror
+		file.HostConfig = file.Hosts[firstMirror]
+		file.Capabilities = nil
+	} else {
+		policy.applyHostSettings(ms.source, &file.HostConfig)
+	}
+	return file.marshal()
 }
 
-// GenerateConfigFiles uses cluster resources to generate the containerd mirror registry configuration files
-func GenerateConfigFiles(ctx context.Context, c client.Client) (map[string][]byte, error) {
+// GenerateConfigFiles uses cluster resources to generate the containerd mirror registry configuration files. Registry
+// client certificates are read from the given namespace.
+func GenerateConfigFiles(ctx context.Context, c client.Client, namespace string) (map[string][]byte, error) {
 	// List IDMS/ITMS resources
 	imageDigestMirrorSetList := &config.ImageDigestMirrorSetList{}
 	if err := c.List(ctx, imageDigestMirrorSetList); err != nil {
@@ -293,25 +289,84 @@ func GenerateConfigFiles(ctx context.Context, c client.Client) (map[string][]byt
 
 	registryConf := getMergedMirrorSets(imageDigestMirrorSetList.Items, imageTagMirrorSetList.Items)
 
-	// Check for registry authorization credentials
+	// Check for registry authorization credentials. When the credential provider is used, credentials are served to
+	// kubelet from the node's credential store instead, and are left out of the config files.
+	var conf credentialprovider.DockerConfigJSON
+	if !cluster.RegistryCredentialProviderEnabled() {
+		pullSecret, err := GetPullSecret(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(pullSecret, &conf); err != nil {
+			return nil, fmt.Errorf("error unmarshalling to DockerConfigJSON: %w", err)
+		}
+	}
+
+	imageConfig, trustedCAs, err := getImageConfig(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	clientCerts := &core.Secret{}
+	err = c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ClientCertsSecretName}, clientCerts)
+	if err != nil && !k8sapierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("error getting registry client certificates: %w", err)
+	}
+	policy := newRegistryPolicy(imageConfig.Spec.RegistrySources, trustedCAs, clientCerts.Data)
+	registryConf = addPolicySources(registryConf, policy)
+
+	// configFiles is a map from file path within containerd's config directory on the Windows node to the file content
+	configFiles := make(map[string][]byte)
+	for _, ms := range registryConf {
+		hostsFileContents, err := ms.generateConfig(conf, policy)
+		if err != nil {
+			return nil, err
+		}
+		configFiles[hostDirectory(ms.source)+"\\"+hostsFileName] = hostsFileContents
+	}
+	for path, contents := range policy.files() {
+		configFiles[path] = contents
+	}
+	if policy.allowed != nil {
+		defaultConfig, err := generateBlockedDefaultConfig()
+		if err != nil {
+			return nil, err
+		}
+		configFiles[defaultHostDir+"\\"+hostsFileName] = defaultConfig
+	}
+	return configFiles, nil
+}
+
+// GetPullSecret returns the contents of the cluster's global pull secret, in the .dockerconfigjson format
+func GetPullSecret(ctx context.Context, c client.Client) ([]byte, error) {
 	pullSecret := &core.Secret{}
 	err := c.Get(ctx, types.NamespacedName{Namespace: GlobalPullSecretNamespace, Name: GlobalPullSecretName},
 		pullSecret)
 	if err != nil {
 		return nil, fmt.Errorf("error getting pull secret: %w", err)
 	}
-	var conf credentialprovider.DockerConfigJSON
-	err = json.Unmarshal(pullSecret.Data[core.DockerConfigJsonKey], &conf)
+	return pullSecret.Data[core.DockerConfigJsonKey], nil
+}
+
+// getImageConfig returns the cluster image config and the contents of the additional trusted CA ConfigMap it
+// references. An empty image config is returned if the cluster has none.
+func getImageConfig(ctx context.Context, c client.Client) (*config.Image, map[string]string, error) {
+	imageConfig := &config.Image{}
+	err := c.Get(ctx, types.NamespacedName{Name: ImageConfigName}, imageConfig)
 	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling to DockerConfigJSON: %w", err)
+		if !k8sapierrors.IsNotFound(err) {
+			return nil, nil, fmt.Errorf("error getting image config: %w", err)
+		}
+		return &config.Image{}, nil, nil
 	}
-
-	// configFiles is a map from file path on the Windows node to the file content
-	configFiles := make(map[string][]byte)
-	for _, ms := range registryConf {
-		// fileShortPath is the file path within containerd's config directory
-		fileShortPath := fmt.Sprintf("%s\\hosts.toml", ms.source)
-		configFiles[fileShortPath] = []byte(ms.generateConfig(conf))
+	if imageConfig.Spec.AdditionalTrustedCA.Name == "" {
+		return imageConfig, nil, nil
 	}
-	return configFiles, nil
+	caConfigMap := &core.ConfigMap{}
+	err = c.Get(ctx, types.NamespacedName{Namespace: AdditionalTrustedCANamespace,
+		Name: imageConfig.Spec.AdditionalTrustedCA.Name}, caConfigMap)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting additional trusted CA ConfigMap %s: %w",
+			imageConfig.Spec.AdditionalTrustedCA.Name, err)
+	}
+	return imageConfig, caConfigMap.Data, nil
 }
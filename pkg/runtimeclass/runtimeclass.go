@@ -0,0 +1,139 @@
+package runtimeclass
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+	node "k8s.io/api/node/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/nodeutil"
+)
+
+const (
+	// ManagedLabel is present on all RuntimeClasses created by WMCO. Its value is the Windows build the RuntimeClass
+	// targets, allowing stale RuntimeClasses to be found once the last Node of that build leaves the cluster.
+	ManagedLabel = "windowsmachineconfig.openshift.io/runtimeclass-build"
+	// IsolationLabel indicates the isolation mode of a WMCO managed RuntimeClass
+	IsolationLabel = "windowsmachineconfig.openshift.io/runtimeclass-isolation"
+	// ProcessHandler is the containerd runtime handler for process isolated Windows containers
+	ProcessHandler = "runhcs-wcow-process"
+	// HyperVHandler is the containerd runtime handler for Hyper-V isolated Windows containers
+	HyperVHandler = "runhcs-wcow-hypervisor"
+	// HyperVIsolationEnvVar is the name of the environment variable that enables Hyper-V RuntimeClasses when set to
+	// "true"
+	HyperVIsolationEnvVar = "HYPERV_ISOLATION_ENABLED"
+	// namePrefix is prepended to the Windows build to form the RuntimeClass name
+	namePrefix = "windows-"
+)
+
+// Isolation is the Windows container isolation mode of a RuntimeClass
+type Isolation string
+
+const (
+	// ProcessIsolation shares the kernel of the host. The container image build must match the host build.
+	ProcessIsolation Isolation = "process"
+	// HyperVIsolation runs each pod in a lightweight utility VM
+	HyperVIsolation Isolation = "hyperv"
+)
+
+// handlers maps each isolation mode to its containerd runtime handler
+var handlers = map[Isolation]string{
+	ProcessIsolation: ProcessHandler,
+	HyperVIsolation:  HyperVHandler,
+}
+
+// Name returns the name of the RuntimeClass for the given Windows build and isolation mode,
+// e.g. windows-10.0.20348 or windows-10.0.20348-hyperv
+func Name(build string, isolation Isolation) string {
+	name := namePrefix + strings.ToLower(build)
+	if isolation != ProcessIsolation {
+		name += "-" + string(isolation)
+	}
+	return name
+}
+
+// Generate returns the RuntimeClass for the given Windows build and isolation mode. The RuntimeClass schedules pods
+// onto Windows Nodes of the given build, and tolerates the taint that WMCO applies to all Windows Nodes.
+func Generate(build string, isolation Isolation) (*node.RuntimeClass, error) {
+	if build == "" {
+		return nil, fmt.Errorf("windows build cannot be empty")
+	}
+	handler, ok := handlers[isolation]
+	if !ok {
+		return nil, fmt.Errorf("unsupported isolation mode %s", isolation)
+	}
+	return &node.RuntimeClass{
+		ObjectMeta: meta.ObjectMeta{
+			Name: Name(build, isolation),
+			Labels: map[string]string{
+				ManagedLabel:   build,
+				IsolationLabel: string(isolation),
+			},
+		},
+		Handler: handler,
+		Scheduling: &node.Scheduling{
+			NodeSelector: map[string]string{
+				core.LabelOSStable:     string(core.Windows),
+				core.LabelArchStable:   "amd64",
+				core.LabelWindowsBuild: build,
+			},
+			Tolerations: []core.Toleration{
+				{
+					Key:      nodeutil.WindowsTaint.Key,
+					Operator: core.TolerationOpEqual,
+					Value:    nodeutil.WindowsTaint.Value,
+					Effect:   nodeutil.WindowsTaint.Effect,
+				},
+			},
+		},
+	}, nil
+}
+
+// GenerateAll returns the RuntimeClasses that should exist for the given set of Windows builds. Process isolated
+// RuntimeClasses are always generated, Hyper-V isolated RuntimeClasses only if hyperVEnabled is true.
+func GenerateAll(builds []string, hyperVEnabled bool) ([]*node.RuntimeClass, error) {
+	isolations := []Isolation{ProcessIsolation}
+	if hyperVEnabled {
+		isolations = append(isolations, HyperVIsolation)
+	}
+	var runtimeClasses []*node.RuntimeClass
+	for _, build := range builds {
+		for _, isolation := range isolations {
+			rc, err := Generate(build, isolation)
+			if err != nil {
+				return nil, err
+			}
+			runtimeClasses = append(runtimeClasses, rc)
+		}
+	}
+	return runtimeClasses, nil
+}
+
+// HyperVEnabled returns true if Hyper-V isolated RuntimeClasses have been enabled through the WMCO container's
+// environment
+func HyperVEnabled() bool {
+	value, found := os.LookupEnv(HyperVIsolationEnvVar)
+	return found && strings.EqualFold(value, "true")
+}
+
+// BuildsFromNodes returns the distinct Windows builds present on the given Nodes. Nodes without the Windows build
+// label are ignored.
+func BuildsFromNodes(nodes []core.Node) []string {
+	seen := make(map[string]struct{})
+	var builds []string
+	for _, n := range nodes {
+		build := n.GetLabels()[core.LabelWindowsBuild]
+		if build == "" {
+			continue
+		}
+		if _, ok := seen[build]; ok {
+			continue
+		}
+		seen[build] = struct{}{}
+		builds = append(builds, build)
+	}
+	return builds
+}
@@ -0,0 +1,106 @@
+package runtimeclass
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/nodeutil"
+)
+
+func TestGenerate(t *testing.T) {
+	testCases := []struct {
+		name            string
+		build           string
+		isolation       Isolation
+		expectedName    string
+		expectedHandler string
+		expectedErr     bool
+	}{
+		{
+			name:            "process isolation",
+			build:           "10.0.20348",
+			isolation:       ProcessIsolation,
+			expectedName:    "windows-10.0.20348",
+			expectedHandler: ProcessHandler,
+		},
+		{
+			name:            "hyper-v isolation",
+			build:           "10.0.17763",
+			isolation:       HyperVIsolation,
+			expectedName:    "windows-10.0.17763-hyperv",
+			expectedHandler: HyperVHandler,
+		},
+		{
+			name:        "empty build",
+			build:       "",
+			isolation:   ProcessIsolation,
+			expectedErr: true,
+		},
+		{
+			name:        "unknown isolation",
+			build:       "10.0.20348",
+			isolation:   Isolation("sandbox"),
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			rc, err := Generate(test.build, test.isolation)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedName, rc.GetName())
+			assert.Equal(t, test.expectedHandler, rc.Handler)
+			assert.Equal(t, test.build, rc.GetLabels()[ManagedLabel])
+			require.NotNil(t, rc.Scheduling)
+			assert.Equal(t, test.build, rc.Scheduling.NodeSelector[core.LabelWindowsBuild])
+			assert.Equal(t, string(core.Windows), rc.Scheduling.NodeSelector[core.LabelOSStable])
+			require.Len(t, rc.Scheduling.Tolerations, 1)
+			assert.True(t, rc.Scheduling.Tolerations[0].ToleratesTaint(&nodeutil.WindowsTaint),
+				"RuntimeClass must tolerate the taint applied to Windows Nodes")
+		})
+	}
+}
+
+func TestGenerateAll(t *testing.T) {
+	builds := []string{"10.0.17763", "10.0.20348"}
+
+	rcs, err := GenerateAll(builds, false)
+	require.NoError(t, err)
+	assert.Len(t, rcs, 2)
+	for _, rc := range rcs {
+		assert.Equal(t, ProcessHandler, rc.Handler)
+	}
+
+	rcs, err = GenerateAll(builds, true)
+	require.NoError(t, err)
+	assert.Len(t, rcs, 4)
+
+	rcs, err = GenerateAll(nil, true)
+	require.NoError(t, err)
+	assert.Empty(t, rcs)
+}
+
+func TestBuildsFromNodes(t *testing.T) {
+	nodeWithBuild := func(name, build string) core.Node {
+		n := core.Node{ObjectMeta: meta.ObjectMeta{Name: name, Labels: map[string]string{}}}
+		if build != "" {
+			n.Labels[core.LabelWindowsBuild] = build
+		}
+		return n
+	}
+	nodes := []core.Node{
+		nodeWithBuild("a", "10.0.20348"),
+		nodeWithBuild("b", "10.0.17763"),
+		nodeWithBuild("c", "10.0.20348"),
+		nodeWithBuild("d", ""),
+	}
+	assert.ElementsMatch(t, []string{"10.0.20348", "10.0.17763"}, BuildsFromNodes(nodes))
+	assert.Empty(t, BuildsFromNodes(nil))
+}
@@ -0,0 +1,106 @@
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/crypto"
+)
+
+const (
+	// AnnotationKeySecret is the name of the secret WMCO creates, holding the versioned key material the node
+	// annotations holding instance usernames are encrypted with
+	AnnotationKeySecret = "windows-annotation-encryption-key"
+	// RotateAnnotationKeyAnnotation can be applied to the AnnotationKeySecret to request the creation of a new key
+	// version. WMCO removes it once the new version has been created.
+	RotateAnnotationKeyAnnotation = "windowsmachineconfig.openshift.io/rotate-annotation-key"
+	// annotationKeyPrefix prefixes the version number of each AnnotationKeySecret data key holding a key version
+	annotationKeyPrefix = "v"
+)
+
+// NewAnnotationKeySecret returns a new AnnotationKeySecret in the given namespace, holding a single key version
+func NewAnnotationKeySecret(namespace string) (*core.Secret, error) {
+	secret := &core.Secret{
+		ObjectMeta: meta.ObjectMeta{Name: AnnotationKeySecret, Namespace: namespace},
+		Type:       core.SecretTypeOpaque,
+	}
+	if _, err := AddAnnotationKeyVersion(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// AddAnnotationKeyVersion adds a new key version to the given AnnotationKeySecret, which becomes the active version.
+// Returns the ID of the new version.
+func AddAnnotationKeyVersion(secret *core.Secret) (string, error) {
+	latest := 0
+	if versions := AnnotationKeyVersions(secret); len(versions) > 0 {
+		latest, _ = strconv.Atoi(strings.TrimPrefix(versions[len(versions)-1], annotationKeyPrefix))
+	}
+	material := make([]byte, crypto.MinKeySize)
+	if _, err := rand.Read(material); err != nil {
+		return "", fmt.Errorf("unable to generate annotation key: %w", err)
+	}
+	id := annotationKeyPrefix + strconv.Itoa(latest+1)
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	secret.Data[id] = material
+	return id, nil
+}
+
+// AnnotationKeyVersions returns the IDs of the key versions held by the given AnnotationKeySecret, from oldest to
+// newest
+func AnnotationKeyVersions(secret *core.Secret) []string {
+	var versions []int
+	for key := range secret.Data {
+		version, err := strconv.Atoi(strings.TrimPrefix(key, annotationKeyPrefix))
+		if err != nil || !strings.HasPrefix(key, annotationKeyPrefix) || version < 1 {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	slices.Sort(versions)
+	ids := make([]string, len(versions))
+	for i, version := range versions {
+		ids[i] = annotationKeyPrefix + strconv.Itoa(version)
+	}
+	return ids
+}
+
+// AnnotationKeyring returns the keyring of the key versions held by the given AnnotationKeySecret, which encrypts with
+// the newest version
+func AnnotationKeyring(secret *core.Secret) (*crypto.Keyring, error) {
+	versions := AnnotationKeyVersions(secret)
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("secret %s has no key versions", secret.GetName())
+	}
+	keys := make(map[string][]byte, len(versions))
+	for _, id := range versions {
+		keys[id] = secret.Data[id]
+	}
+	keyring, err := crypto.NewKeyring(versions[len(versions)-1], keys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret %s: %w", secret.GetName(), err)
+	}
+	return keyring, nil
+}
+
+// GetAnnotationKeyring fetches the AnnotationKeySecret from the given namespace and returns its keyring
+func GetAnnotationKeyring(ctx context.Context, c client.Client, namespace string) (*crypto.Keyring, error) {
+	secret := &core.Secret{}
+	if err := c.Get(ctx, kubeTypes.NamespacedName{Namespace: namespace, Name: AnnotationKeySecret},
+		secret); err != nil {
+		return nil, fmt.Errorf("unable to get secret %s/%s: %w", namespace, AnnotationKeySecret, err)
+	}
+	return AnnotationKeyring(secret)
+}
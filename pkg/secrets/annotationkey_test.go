@@ -0,0 +1,47 @@
+package secrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+)
+
+func TestAnnotationKeySecret(t *testing.T) {
+	secret, err := NewAnnotationKeySecret("wmco-namespace")
+	require.NoError(t, err)
+	assert.Equal(t, AnnotationKeySecret, secret.GetName())
+	assert.Equal(t, "wmco-namespace", secret.GetNamespace())
+	assert.Equal(t, []string{"v1"}, AnnotationKeyVersions(secret))
+
+	keyring, err := AnnotationKeyring(secret)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", keyring.ActiveKeyID())
+	envelope, err := keyring.Encrypt("Administrator")
+	require.NoError(t, err)
+
+	id, err := AddAnnotationKeyVersion(secret)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", id)
+	assert.NotEqual(t, secret.Data["v1"], secret.Data["v2"])
+	keyring, err = AnnotationKeyring(secret)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", keyring.ActiveKeyID())
+	plaintext, err := keyring.Decrypt(envelope, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Administrator", plaintext)
+}
+
+func TestAnnotationKeyVersions(t *testing.T) {
+	secret := &core.Secret{Data: map[string][]byte{"v10": nil, "v2": nil, "v9": nil, "v0": nil, "other": nil,
+		"10": nil}}
+	assert.Equal(t, []string{"v2", "v9", "v10"}, AnnotationKeyVersions(secret))
+
+	id, err := AddAnnotationKeyVersion(secret)
+	require.NoError(t, err)
+	assert.Equal(t, "v11", id)
+
+	_, err = AnnotationKeyring(&core.Secret{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/audit"
+)
+
+const (
+	// AuditKeySecret is the name of the secret WMCO creates, holding the key the hashes chaining the records of the
+	// audit log are computed with
+	AuditKeySecret = "windows-audit-log-key"
+	// auditKey is the AuditKeySecret data key holding the key
+	auditKey = "key"
+)
+
+// NewAuditKeySecret returns a new AuditKeySecret in the given namespace, holding a newly generated key
+func NewAuditKeySecret(namespace string) (*core.Secret, error) {
+	key := make([]byte, audit.MinKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("unable to generate audit log key: %w", err)
+	}
+	return &core.Secret{
+		ObjectMeta: meta.ObjectMeta{Name: AuditKeySecret, Namespace: namespace},
+		Type:       core.SecretTypeOpaque,
+		Data:       map[string][]byte{auditKey: key},
+	}, nil
+}
+
+// AuditKey returns the key held by the given AuditKeySecret
+func AuditKey(secret *core.Secret) ([]byte, error) {
+	key := secret.Data[auditKey]
+	if len(key) < audit.MinKeySize {
+		return nil, fmt.Errorf("secret %s has an invalid audit log key of size %d", secret.GetName(), len(key))
+	}
+	return key, nil
+}
+
+// EnsureAuditKey returns the key held by the AuditKeySecret in the given namespace, creating the secret if it does not
+// exist
+func EnsureAuditKey(ctx context.Context, c client.Client, namespace string) ([]byte, error) {
+	secret := &core.Secret{}
+	err := c.Get(ctx, kubeTypes.NamespacedName{Namespace: namespace, Name: AuditKeySecret}, secret)
+	if err == nil {
+		return AuditKey(secret)
+	}
+	if !k8sapierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("unable to get secret %s/%s: %w", namespace, AuditKeySecret, err)
+	}
+	if secret, err = NewAuditKeySecret(namespace); err != nil {
+		return nil, err
+	}
+	if err = c.Create(ctx, secret); err != nil {
+		if k8sapierrors.IsAlreadyExists(err) {
+			// Created concurrently, the existing key must be used
+			return EnsureAuditKey(ctx, c, namespace)
+		}
+		return nil, fmt.Errorf("unable to create secret %s/%s: %w", namespace, AuditKeySecret, err)
+	}
+	return AuditKey(secret)
+}
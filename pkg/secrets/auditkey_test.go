@@ -0,0 +1,24 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEnsureAuditKey(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().Build()
+	key, err := EnsureAuditKey(ctx, c, "wmco-namespace")
+	require.NoError(t, err)
+	existing, err := EnsureAuditKey(ctx, c, "wmco-namespace")
+	require.NoError(t, err)
+	assert.Equal(t, key, existing)
+
+	_, err = AuditKey(&core.Secret{Data: map[string][]byte{auditKey: []byte("short")}})
+	assert.Error(t, err)
+}
@@ -21,6 +21,10 @@ const (
 	PrivateKeySecret = "cloud-private-key"
 	// PrivateKeySecretKey is the key within the private key secret which holds the private key
 	PrivateKeySecretKey = "private-key.pem"
+	// AppliedPrivateKeySecret is the name of the secret WMCO creates, holding a copy of the private key the Windows
+	// instances are configured with. When the private key secret changes, the previous key is used to access the
+	// instances and authorize the new key.
+	AppliedPrivateKeySecret = "windows-applied-private-key"
 	// TLSSecret is the name of the TLS secret that servica-ca-operator creates
 	TLSSecret = "windows-machine-config-operator-tls"
 )
@@ -39,6 +43,15 @@ func GetPrivateKey(ctx context.Context, secret kubeTypes.NamespacedName, c clien
 	return privateKey, nil
 }
 
+// NewAppliedPrivateKeySecret returns an AppliedPrivateKeySecret in the given namespace holding the given private key
+func NewAppliedPrivateKeySecret(namespace string, privateKey []byte) *core.Secret {
+	return &core.Secret{
+		ObjectMeta: meta.ObjectMeta{Name: AppliedPrivateKeySecret, Namespace: namespace},
+		Type:       core.SecretTypeOpaque,
+		Data:       map[string][]byte{PrivateKeySecretKey: privateKey},
+	}
+}
+
 // GenerateUserData generates the desired value of userdata secret.
 func GenerateUserData(platformType oconfig.PlatformType, publicKey ssh.PublicKey) (*core.Secret, error) {
 	pubKeyBytes := ssh.MarshalAuthorizedKey(publicKey)
@@ -185,17 +198,3 @@ func processTags(platformType oconfig.PlatformType, userData string) string {
 	}
 	return userData
 }
-
-// GenerateServiceAccountTokenSecret returns a pointer to a secret with the given name and namespace with
-// ServiceAccountToken type and the given serviceAccountName as the annotation
-func GenerateServiceAccountTokenSecret(namespace, serviceAccountName string) *core.Secret {
-	return &core.Secret{
-		TypeMeta: meta.TypeMeta{},
-		ObjectMeta: meta.ObjectMeta{
-			Name:        serviceAccountName,
-			Namespace:   namespace,
-			Annotations: map[string]string{core.ServiceAccountNameKey: serviceAccountName},
-		},
-		Type: core.SecretTypeServiceAccountToken,
-	}
-}
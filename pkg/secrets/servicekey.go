@@ -0,0 +1,76 @@
+package secrets
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ServiceSigningKeySecret is the name of the secret WMCO creates, holding the key the services of the services
+	// ConfigMap are signed with
+	ServiceSigningKeySecret = "windows-service-signing-key"
+	// serviceSigningKeySeed is the ServiceSigningKeySecret data key holding the seed of the ed25519 signing key
+	serviceSigningKeySeed = "seed"
+)
+
+// NewServiceSigningKeySecret returns a new ServiceSigningKeySecret in the given namespace, holding a newly
+// generated key
+func NewServiceSigningKeySecret(namespace string) (*core.Secret, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate service signing key: %w", err)
+	}
+	return &core.Secret{
+		ObjectMeta: meta.ObjectMeta{Name: ServiceSigningKeySecret, Namespace: namespace},
+		Type:       core.SecretTypeOpaque,
+		Data:       map[string][]byte{serviceSigningKeySeed: key.Seed()},
+	}, nil
+}
+
+// ServiceSigningKey returns the signing key held by the given ServiceSigningKeySecret
+func ServiceSigningKey(secret *core.Secret) (ed25519.PrivateKey, error) {
+	seed := secret.Data[serviceSigningKeySeed]
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("secret %s has an invalid signing key seed of size %d", secret.GetName(), len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// GetServiceSigningKey fetches the ServiceSigningKeySecret from the given namespace and returns its signing key
+func GetServiceSigningKey(ctx context.Context, c client.Client, namespace string) (ed25519.PrivateKey, error) {
+	secret := &core.Secret{}
+	if err := c.Get(ctx, kubeTypes.NamespacedName{Namespace: namespace, Name: ServiceSigningKeySecret},
+		secret); err != nil {
+		return nil, fmt.Errorf("unable to get secret %s/%s: %w", namespace, ServiceSigningKeySecret, err)
+	}
+	return ServiceSigningKey(secret)
+}
+
+// EnsureServiceSigningKey returns the signing key held by the ServiceSigningKeySecret in the given namespace,
+// creating the secret if it does not exist
+func EnsureServiceSigningKey(ctx context.Context, c client.Client, namespace string) (ed25519.PrivateKey, error) {
+	key, err := GetServiceSigningKey(ctx, c, namespace)
+	if err == nil || !k8sapierrors.IsNotFound(err) {
+		return key, err
+	}
+	secret, err := NewServiceSigningKeySecret(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.Create(ctx, secret); err != nil {
+		if k8sapierrors.IsAlreadyExists(err) {
+			// Created concurrently, the existing key must be used
+			return GetServiceSigningKey(ctx, c, namespace)
+		}
+		return nil, fmt.Errorf("unable to create secret %s/%s: %w", namespace, ServiceSigningKeySecret, err)
+	}
+	return ServiceSigningKey(secret)
+}
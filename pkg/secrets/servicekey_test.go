@@ -0,0 +1,30 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEnsureServiceSigningKey(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().Build()
+	_, err := GetServiceSigningKey(ctx, c, "wmco-namespace")
+	require.Error(t, err)
+
+	key, err := EnsureServiceSigningKey(ctx, c, "wmco-namespace")
+	require.NoError(t, err)
+	existing, err := EnsureServiceSigningKey(ctx, c, "wmco-namespace")
+	require.NoError(t, err)
+	assert.Equal(t, key, existing)
+	fetched, err := GetServiceSigningKey(ctx, c, "wmco-namespace")
+	require.NoError(t, err)
+	assert.Equal(t, key, fetched)
+
+	_, err = ServiceSigningKey(&core.Secret{Data: map[string][]byte{serviceSigningKeySeed: []byte("short")}})
+	assert.Error(t, err)
+}
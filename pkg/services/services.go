@@ -22,12 +22,20 @@ const (
 	// hostnameOverrideVar is the variable that should be replaced with the value of the desired instance hostname
 	hostnameOverrideVar = "HOSTNAME_OVERRIDE"
 	NodeIPVar           = "NODE_IP"
+	// performanceMonitorUsersSID is the SID of the built-in Performance Monitor Users group, whose members can read
+	// performance counters
+	performanceMonitorUsersSID = "S-1-5-32-558"
+	// hybridOverlayVXLANPortArg is the hybrid-overlay flag setting the VXLAN port of its HNS networks
+	hybridOverlayVXLANPortArg = "--hybrid-overlay-vxlan-port"
+	// hybridOverlayMTUArg is the hybrid-overlay flag setting the MTU of its HNS networks
+	hybridOverlayMTUArg = "--mtu"
 )
 
 // GenerateManifest returns the expected state of the Windows service configmap. If debug is true, debug logging
-// will be enabled for services that support it.
-func GenerateManifest(kubeletArgsFromIgnition map[string]string, vxlanPort string, platform config.PlatformType,
-	debug bool) (*servicescm.Data, error) {
+// will be enabled for services that support it. The networking services are only included if the given network
+// backend is one that WMCO manages.
+func GenerateManifest(kubeletArgsFromIgnition map[string]string, networkBackend cluster.NetworkBackend,
+	hybridOverlay cluster.HybridOverlayConfig, platform config.PlatformType, debug bool) (*servicescm.Data, error) {
 	windowsExporterServiceCommand := fmt.Sprintf("%s --collectors.enabled "+
 		"cpu,cs,logical_disk,net,os,service,system,textfile,container,memory,cpu_info --web.config.file %s",
 		windows.WindowsExporterPath, windows.TLSConfPath)
@@ -35,6 +43,14 @@ func GenerateManifest(kubeletArgsFromIgnition map[string]string, vxlanPort strin
 	if err != nil {
 		return nil, fmt.Errorf("could not determine kubelet service configuration spec: %w", err)
 	}
+	windowsExporterAccount, err := windowsExporterAccount()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine windows_exporter service account: %w", err)
+	}
+	hybridOverlayAccount, err := hybridOverlayAccount()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine hybrid-overlay service account: %w", err)
+	}
 	services := &[]servicescm.Service{{
 		Name:                   windows.WindowsExporterServiceName,
 		Command:                windowsExporterServiceCommand,
@@ -43,13 +59,13 @@ func GenerateManifest(kubeletArgsFromIgnition map[string]string, vxlanPort strin
 		Dependencies:           nil,
 		Bootstrap:              false,
 		Priority:               2,
+		Account:                windowsExporterAccount,
 	},
 		containerdConfiguration(debug),
 		kubeletConfiguration,
-		hybridOverlayConfiguration(vxlanPort, debug),
-		kubeProxyConfiguration(debug),
 		csiProxyConfiguration(debug),
 	}
+	*services = append(*services, networkServices(networkBackend, hybridOverlay, hybridOverlayAccount, debug)...)
 	if platform == config.AzurePlatformType {
 		*services = append(*services, azureCloudNodeManagerConfiguration())
 	}
@@ -62,6 +78,73 @@ func GenerateManifest(kubeletArgsFromIgnition map[string]string, vxlanPort strin
 	return servicescm.NewData(services, files, cluster.GetProxyVars(), watchedEnvVars)
 }
 
+// windowsExporterAccount returns the account windows_exporter runs as, or nil if it runs as LocalSystem. The account is
+// given read access to the exporter's binary and TLS configuration, and is added to the Performance Monitor Users
+// group to read performance counters.
+func windowsExporterAccount() (*servicescm.ServiceAccount, error) {
+	accounts, err := cluster.GetServiceAccounts(windows.AccountConfigurableServices)
+	if err != nil {
+		return nil, err
+	}
+	name, present := accounts[windows.WindowsExporterServiceName]
+	if !present {
+		return nil, nil
+	}
+	return &servicescm.ServiceAccount{
+		Name:               name,
+		RequiredPrivileges: []string{servicescm.ChangeNotifyPrivilege},
+		Groups:             []string{performanceMonitorUsersSID},
+		Access: []servicescm.PathAccess{
+			{Path: windows.WindowsExporterPath},
+			{Path: windows.TLSDir},
+		},
+	}, nil
+}
+
+// hybridOverlayAccount returns the account hybrid-overlay runs as, or nil if it runs as LocalSystem. The account is
+// added to the Hyper-V Administrators group to manage the HNS networks of the hybrid overlay. It is given read access
+// to the hybrid-overlay binary and the node's kubeconfig, and write access to the directory hybrid-overlay keeps its
+// certificates in and to its log directory.
+func hybridOverlayAccount() (*servicescm.ServiceAccount, error) {
+	accounts, err := cluster.GetServiceAccounts(windows.AccountConfigurableServices)
+	if err != nil {
+		return nil, err
+	}
+	name, present := accounts[windows.HybridOverlayServiceName]
+	if !present {
+		return nil, nil
+	}
+	return &servicescm.ServiceAccount{
+		Name:               name,
+		RequiredPrivileges: []string{servicescm.ChangeNotifyPrivilege},
+		Groups:             []string{windows.HyperVAdministratorsSID},
+		Access: []servicescm.PathAccess{
+			{Path: windows.HybridOverlayPath},
+			{Path: windows.KubeconfigPath},
+			{Path: windows.CniConfDir, Write: true},
+			{Path: windows.HybridOverlayLogDir, Write: true},
+		},
+	}, nil
+}
+
+// networkServices returns the services that provide pod networking for the given network backend. A user provided
+// CNI is expected to run any services it requires itself. hybrid-overlay runs as the given account, or as LocalSystem
+// if nil.
+func networkServices(networkBackend cluster.NetworkBackend, hybridOverlay cluster.HybridOverlayConfig,
+	hybridOverlayAccount *servicescm.ServiceAccount, debug bool) []servicescm.Service {
+	switch networkBackend {
+	case cluster.BYOCNIBackend:
+		return nil
+	default:
+		hybridOverlayService := hybridOverlayConfiguration(hybridOverlay, debug)
+		hybridOverlayService.Account = hybridOverlayAccount
+		return []servicescm.Service{
+			hybridOverlayService,
+			kubeProxyConfiguration(debug),
+		}
+	}
+}
+
 // containerdConfiguration returns the service specification for the Windows containerd service
 func containerdConfiguration(debug bool) servicescm.Service {
 	containerdServiceCmd := fmt.Sprintf("%s --config %s --log-file %s --run-service",
@@ -104,12 +187,17 @@ func azureCloudNodeManagerConfiguration() servicescm.Service {
 }
 
 // hybridOverlayConfiguration returns the Service definition for hybrid-overlay
-func hybridOverlayConfiguration(vxlanPort string, debug bool) servicescm.Service {
+func hybridOverlayConfiguration(hybridOverlay cluster.HybridOverlayConfig, debug bool) servicescm.Service {
 	hybridOverlayServiceCmd := fmt.Sprintf("%s --node NODE_NAME --bootstrap-kubeconfig=%s --cert-dir=%s --cert-duration=24h "+
 		"--windows-service --logfile "+"%s\\hybrid-overlay.log", windows.HybridOverlayPath, windows.KubeconfigPath, windows.CniConfDir,
 		windows.HybridOverlayLogDir)
-	if len(vxlanPort) > 0 {
-		hybridOverlayServiceCmd = fmt.Sprintf("%s --hybrid-overlay-vxlan-port %s", hybridOverlayServiceCmd, vxlanPort)
+	if len(hybridOverlay.VXLANPort) > 0 {
+		hybridOverlayServiceCmd = fmt.Sprintf("%s %s %s", hybridOverlayServiceCmd, hybridOverlayVXLANPortArg,
+			hybridOverlay.VXLANPort)
+	}
+	if len(hybridOverlay.MTU) > 0 {
+		hybridOverlayServiceCmd = fmt.Sprintf("%s %s %s", hybridOverlayServiceCmd, hybridOverlayMTUArg,
+			hybridOverlay.MTU)
 	}
 
 	// check log level and increase hybrid-overlay verbosity if needed
@@ -131,6 +219,10 @@ func hybridOverlayConfiguration(vxlanPort string, debug bool) servicescm.Service
 		Dependencies:         []string{windows.KubeletServiceName},
 		Bootstrap:            false,
 		Priority:             2,
+		// The HNS networks are created with the VXLAN port and MTU given in the command, and must be recreated for
+		// changes to either to take effect
+		HNSNetworks:    windows.HybridOverlayHNSNetworks,
+		HNSNetworkArgs: []string{hybridOverlayVXLANPortArg, hybridOverlayMTUArg},
 	}
 }
 
@@ -202,17 +294,8 @@ func getKubeletServiceConfiguration(argsFromIginition map[string]string, debug b
 	if err != nil {
 		return servicescm.Service{}, err
 	}
-	var preScripts []servicescm.PowershellPreScript
-
-	hostnameOverrideCmd := getHostnameCmd(platform)
-	if hostnameOverrideCmd != "" {
-		hostnameOverrideArg := "--hostname-override=" + hostnameOverrideVar
-		hostnameOverridePowershellVar := servicescm.PowershellPreScript{
-			VariableName: hostnameOverrideVar,
-			Path:         hostnameOverrideCmd,
-		}
-		kubeletArgs = append(kubeletArgs, hostnameOverrideArg)
-		preScripts = append(preScripts, hostnameOverridePowershellVar)
+	if getHostnameCmd(platform) != "" {
+		kubeletArgs = append(kubeletArgs, "--hostname-override="+hostnameOverrideVar)
 	}
 
 	kubeletServiceCmd := fmt.Sprintf("%s -log-file=%s %s",
@@ -224,29 +307,43 @@ func getKubeletServiceConfiguration(argsFromIginition map[string]string, debug b
 
 	// explicitly set node ip and resolves to the first IPv4 address of the default gateway
 	kubeletServiceCmd = fmt.Sprintf("%s --node-ip=%s", kubeletServiceCmd, NodeIPVar)
-	if platform == config.AWSPlatformType {
+	// The credential provider config holds the ECR credential provider on AWS, and the WICD credential provider when
+	// registry credentials are served from the node's credential store
+	if platform == config.AWSPlatformType || cluster.RegistryCredentialProviderEnabled() {
 		kubeletServiceCmd = fmt.Sprintf("%s --image-credential-provider-bin-dir=%s --image-credential-provider-config=%s",
 			kubeletServiceCmd, windows.K8sDir, windows.CredentialProviderConfig)
 	}
-	preScripts = append(preScripts, servicescm.PowershellPreScript{
-		VariableName: NodeIPVar,
-		Path: "(Get-NetRoute -DestinationPrefix '0.0.0.0/0' | " +
-			"Get-NetIpAddress -AddressFamily IPv4 -ifIndex {$_.ifIndex}[0]).IPAddress",
-	})
 	return servicescm.Service{
 		Name:                   windows.KubeletServiceName,
 		Command:                kubeletServiceCmd,
 		Priority:               1,
 		Bootstrap:              true,
 		Dependencies:           []string{windows.ContainerdServiceName},
-		PowershellPreScripts:   preScripts,
+		PowershellPreScripts:   kubeletPreScripts(platform),
 		NodeVariablesInCommand: nil,
 	}, nil
 }
 
+// kubeletPreScripts returns the PowerShell pre-scripts resolving the variables of the kubelet command
+func kubeletPreScripts(platform config.PlatformType) []servicescm.PowershellPreScript {
+	var preScripts []servicescm.PowershellPreScript
+	if hostnameOverrideCmd := getHostnameCmd(platform); hostnameOverrideCmd != "" {
+		preScripts = append(preScripts, servicescm.PowershellPreScript{
+			VariableName: hostnameOverrideVar,
+			Path:         hostnameOverrideCmd,
+		})
+	}
+	// the node IP resolves to the first IPv4 address of the default gateway
+	return append(preScripts, servicescm.PowershellPreScript{
+		VariableName: NodeIPVar,
+		Path: "(Get-NetRoute -DestinationPrefix '0.0.0.0/0' | " +
+			"Get-NetIpAddress -AddressFamily IPv4 -ifIndex {$_.ifIndex}[0]).IPAddress",
+	})
+}
+
 // generateKubeletArgs returns the kubelet args required during initial kubelet start up
 func generateKubeletArgs(argsFromIgnition map[string]string, debug bool) ([]string, error) {
-	certDirectory := "c:\\var\\lib\\kubelet\\pki\\"
+	certDirectory := windows.KubeletCertDir + "\\"
 	windowsPriorityClass := "ABOVE_NORMAL_PRIORITY_CLASS"
 	// TODO: Removal of deprecated flags to be done in https://issues.redhat.com/browse/WINC-924
 	kubeletArgs := []string{
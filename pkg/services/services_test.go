@@ -5,6 +5,11 @@ import (
 
 	config "github.com/openshift/api/config/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
 )
 
 func TestGetHostnameCmd(t *testing.T) {
@@ -41,3 +46,225 @@ func TestGetHostnameCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateManifestNetworkBackend(t *testing.T) {
+	tests := []struct {
+		name            string
+		backend         cluster.NetworkBackend
+		expectedPresent bool
+	}{
+		{
+			name:            "hybrid overlay",
+			backend:         cluster.HybridOverlayBackend,
+			expectedPresent: true,
+		},
+		{
+			name:            "bring your own CNI",
+			backend:         cluster.BYOCNIBackend,
+			expectedPresent: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := GenerateManifest(map[string]string{}, test.backend,
+				cluster.HybridOverlayConfig{VXLANPort: "4800"}, config.NonePlatformType, false)
+			require.NoError(t, err)
+			names := make(map[string]struct{})
+			for _, svc := range data.Services {
+				names[svc.Name] = struct{}{}
+			}
+			for _, svcName := range []string{windows.KubeletServiceName, windows.ContainerdServiceName} {
+				assert.Contains(t, names, svcName)
+			}
+			for _, svcName := range []string{windows.HybridOverlayServiceName, windows.KubeProxyServiceName} {
+				_, present := names[svcName]
+				assert.Equal(t, test.expectedPresent, present, svcName)
+			}
+		})
+	}
+}
+
+func TestGenerateManifestVariableUsage(t *testing.T) {
+	// The generated manifest must pass the validation of the services ConfigMap webhook
+	platforms := []config.PlatformType{config.NonePlatformType, config.AWSPlatformType, config.AzurePlatformType,
+		config.GCPPlatformType, config.VSpherePlatformType, config.NutanixPlatformType}
+	for _, backend := range []cluster.NetworkBackend{cluster.HybridOverlayBackend, cluster.BYOCNIBackend} {
+		for _, platform := range platforms {
+			data, err := GenerateManifest(map[string]string{}, backend, cluster.HybridOverlayConfig{VXLANPort: "4800"},
+				platform, false)
+			require.NoError(t, err)
+			assert.NoError(t, data.ValidateVariableUsage(), "%s on %s", backend, platform)
+		}
+	}
+}
+
+func TestHybridOverlayConfiguration(t *testing.T) {
+	tests := []struct {
+		name          string
+		hybridOverlay cluster.HybridOverlayConfig
+		contains      []string
+		notContains   []string
+	}{
+		{
+			name:          "defaults",
+			hybridOverlay: cluster.HybridOverlayConfig{},
+			notContains:   []string{"--hybrid-overlay-vxlan-port", "--mtu"},
+		},
+		{
+			name:          "custom VXLAN port and MTU",
+			hybridOverlay: cluster.HybridOverlayConfig{VXLANPort: "4800", MTU: "1400"},
+			contains:      []string{"--hybrid-overlay-vxlan-port 4800", "--mtu 1400"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := hybridOverlayConfiguration(test.hybridOverlay, false)
+			for _, s := range test.contains {
+				assert.Contains(t, svc.Command, s)
+			}
+			for _, s := range test.notContains {
+				assert.NotContains(t, svc.Command, s)
+			}
+			assert.Equal(t, windows.HybridOverlayHNSNetworks, svc.HNSNetworks)
+		})
+	}
+}
+
+func TestKubeletCredentialProviderArgs(t *testing.T) {
+	tests := []struct {
+		name             string
+		platform         config.PlatformType
+		providerEnabled  string
+		expectedProvider bool
+	}{
+		{
+			name:             "no platform provider",
+			platform:         config.NonePlatformType,
+			expectedProvider: false,
+		},
+		{
+			name:             "AWS",
+			platform:         config.AWSPlatformType,
+			expectedProvider: true,
+		},
+		{
+			name:             "WICD credential provider",
+			platform:         config.NonePlatformType,
+			providerEnabled:  "true",
+			expectedProvider: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(cluster.RegistryCredentialProviderEnvVar, test.providerEnabled)
+			svc, err := getKubeletServiceConfiguration(map[string]string{}, false, test.platform)
+			require.NoError(t, err)
+			arg := "--image-credential-provider-config=" + windows.CredentialProviderConfig
+			if test.expectedProvider {
+				assert.Contains(t, svc.Command, arg)
+			} else {
+				assert.NotContains(t, svc.Command, arg)
+			}
+		})
+	}
+}
+
+func TestWindowsExporterAccount(t *testing.T) {
+	tests := []struct {
+		name            string
+		serviceAccounts string
+		expectedAccount string
+		expectErr       bool
+	}{
+		{
+			name:            "LocalSystem",
+			serviceAccounts: "",
+		},
+		{
+			name:            "virtual account",
+			serviceAccounts: "windows_exporter=virtual",
+			expectedAccount: "NT SERVICE\\windows_exporter",
+		},
+		{
+			name:            "group managed service account",
+			serviceAccounts: "windows_exporter=EXAMPLE\\exporter$",
+			expectedAccount: "EXAMPLE\\exporter$",
+		},
+		{
+			name:            "unsupported service",
+			serviceAccounts: "kubelet=virtual",
+			expectErr:       true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(cluster.ServiceAccountsEnvVar, test.serviceAccounts)
+			account, err := windowsExporterAccount()
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if test.expectedAccount == "" {
+				assert.Nil(t, account)
+				return
+			}
+			require.NotNil(t, account)
+			assert.Equal(t, test.expectedAccount, account.Name)
+			assert.Contains(t, account.Groups, performanceMonitorUsersSID)
+			assert.Contains(t, account.Access, servicescm.PathAccess{Path: windows.WindowsExporterPath})
+		})
+	}
+}
+
+func TestHybridOverlayAccount(t *testing.T) {
+	tests := []struct {
+		name            string
+		serviceAccounts string
+		expectedAccount string
+		expectErr       bool
+	}{
+		{
+			name:            "LocalSystem",
+			serviceAccounts: "windows_exporter=virtual",
+		},
+		{
+			name:            "virtual account",
+			serviceAccounts: "hybrid-overlay-node=virtual",
+			expectedAccount: "NT SERVICE\\hybrid-overlay-node",
+		},
+		{
+			name:            "group managed service account",
+			serviceAccounts: "hybrid-overlay-node=EXAMPLE\\overlay$",
+			expectedAccount: "EXAMPLE\\overlay$",
+		},
+		{
+			name:            "unsupported service",
+			serviceAccounts: "kube-proxy=virtual",
+			expectErr:       true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(cluster.ServiceAccountsEnvVar, test.serviceAccounts)
+			account, err := hybridOverlayAccount()
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			services := networkServices(cluster.HybridOverlayBackend, cluster.HybridOverlayConfig{}, account, false)
+			require.Len(t, services, 2)
+			assert.Equal(t, windows.HybridOverlayServiceName, services[0].Name)
+			assert.Equal(t, account, services[0].Account)
+			if test.expectedAccount == "" {
+				assert.Nil(t, account)
+				return
+			}
+			require.NotNil(t, account)
+			assert.Equal(t, test.expectedAccount, account.Name)
+			assert.Equal(t, []string{windows.HyperVAdministratorsSID}, account.Groups)
+			assert.Contains(t, account.Access, servicescm.PathAccess{Path: windows.HybridOverlayLogDir, Write: true})
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package servicescm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// LocalSystemAccount is the name of the account services run as when no other account is given
+	LocalSystemAccount = "LocalSystem"
+	// virtualAccountDomain is the domain of the virtual accounts of services
+	virtualAccountDomain = "NT SERVICE\\"
+	// ChangeNotifyPrivilege is always given to services restricted to a set of privileges
+	ChangeNotifyPrivilege = "SeChangeNotifyPrivilege"
+)
+
+var (
+	// serviceNameRegex matches the names of services which can run as an account other than LocalSystem. The name is
+	// part of the name of the service's virtual account, which is quoted in PowerShell commands.
+	serviceNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	// gmsaRegex matches the names of group managed service accounts, in the DOMAIN\name$ format
+	gmsaRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]*\\[A-Za-z0-9][A-Za-z0-9._-]{0,14}\$$`)
+	// privilegeRegex matches the names of Windows privileges
+	privilegeRegex = regexp.MustCompile(`^Se[A-Za-z]+Privilege$`)
+	// sidRegex matches well-known security identifiers, such as those of the built-in local groups
+	sidRegex = regexp.MustCompile(`^S-1-5(-[0-9]+)+$`)
+	// pathRegex matches absolute paths of files, directories and named pipes
+	pathRegex = regexp.MustCompile(`^([A-Za-z]:\\|\\\\\.\\pipe\\)[^*?"<>|]*$`)
+)
+
+// ServiceAccount describes a Windows account a service runs as in place of LocalSystem, and what the account is
+// permitted to do
+type ServiceAccount struct {
+	// Name is the name of the account, either NT SERVICE\<service> for the virtual account of the service, or a group
+	// managed service account in the DOMAIN\name$ format
+	Name string `json:"name"`
+	// RequiredPrivileges are the only privileges given to the service's process, in addition to
+	// SeChangeNotifyPrivilege. The service is given all the privileges of the account if empty.
+	RequiredPrivileges []string `json:"requiredPrivileges,omitempty"`
+	// Groups lists the SIDs of the local groups the account is added to, such as S-1-5-32-558 for Performance Monitor
+	// Users
+	Groups []string `json:"groups,omitempty"`
+	// Access lists the files, directories and named pipes the account is granted access to
+	Access []PathAccess `json:"access,omitempty"`
+}
+
+// PathAccess describes access to a file, directory or named pipe. Access to a directory is inherited by its contents.
+type PathAccess struct {
+	// Path is the absolute path of the file, directory or named pipe
+	Path string `json:"path"`
+	// Write grants modify access, in addition to read and execute access
+	Write bool `json:"write,omitempty"`
+}
+
+// VirtualAccount returns the name of the virtual account of the given service
+func VirtualAccount(service string) string {
+	return virtualAccountDomain + service
+}
+
+// IsGroupManagedServiceAccount returns true if the given account name is that of a group managed service account, in
+// the DOMAIN\name$ format
+func IsGroupManagedServiceAccount(name string) bool {
+	return gmsaRegex.MatchString(name)
+}
+
+// AccountName returns the name of the account the service runs as
+func (s *Service) AccountName() string {
+	if s.Account == nil {
+		return LocalSystemAccount
+	}
+	return s.Account.Name
+}
+
+// Privileges returns the privileges the service's process is restricted to, or nil if it is not restricted
+func (s *Service) Privileges() []string {
+	if s.Account == nil || len(s.Account.RequiredPrivileges) == 0 {
+		return nil
+	}
+	privileges := []string{ChangeNotifyPrivilege}
+	for _, privilege := range s.Account.RequiredPrivileges {
+		if privilege != ChangeNotifyPrivilege {
+			privileges = append(privileges, privilege)
+		}
+	}
+	return privileges
+}
+
+// validateAccounts ensures the accounts of the given services are well-formed. A virtual account must belong to the
+// service running as it.
+func validateAccounts(services []Service) error {
+	for _, svc := range services {
+		account := svc.Account
+		if account == nil {
+			continue
+		}
+		if !serviceNameRegex.MatchString(svc.Name) {
+			return fmt.Errorf("service %q cannot run as an account other than %s, as its name is invalid", svc.Name,
+				LocalSystemAccount)
+		}
+		if strings.HasPrefix(account.Name, virtualAccountDomain) {
+			if account.Name != VirtualAccount(svc.Name) {
+				return fmt.Errorf("service %s cannot run as the virtual account %s of another service", svc.Name,
+					account.Name)
+			}
+		} else if !IsGroupManagedServiceAccount(account.Name) {
+			return fmt.Errorf("service %s has invalid account %q, expected a virtual account or a group managed "+
+				"service account", svc.Name, account.Name)
+		}
+		for _, privilege := range account.RequiredPrivileges {
+			if !privilegeRegex.MatchString(privilege) {
+				return fmt.Errorf("service %s has invalid required privilege %q", svc.Name, privilege)
+			}
+		}
+		for _, group := range account.Groups {
+			if !sidRegex.MatchString(group) {
+				return fmt.Errorf("service %s has invalid group SID %q", svc.Name, group)
+			}
+		}
+		for _, access := range account.Access {
+			if !pathRegex.MatchString(access.Path) {
+				return fmt.Errorf("service %s has invalid access path %q", svc.Name, access.Path)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package servicescm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAccounts(t *testing.T) {
+	tests := []struct {
+		name        string
+		serviceName string
+		account     *ServiceAccount
+		expectErr   bool
+	}{
+		{name: "LocalSystem", account: nil},
+		{
+			name: "virtual account",
+			account: &ServiceAccount{
+				Name:               "NT SERVICE\\svc",
+				RequiredPrivileges: []string{"SeChangeNotifyPrivilege"},
+				Groups:             []string{"S-1-5-32-558"},
+				Access:             []PathAccess{{Path: "C:\\k\\svc.exe"}, {Path: "\\\\.\\pipe\\svc", Write: true}},
+			},
+		},
+		{name: "group managed service account", account: &ServiceAccount{Name: "EXAMPLE\\svc-gmsa$"}},
+		{name: "virtual account of another service", account: &ServiceAccount{Name: "NT SERVICE\\other"},
+			expectErr: true},
+		{name: "user account", account: &ServiceAccount{Name: "EXAMPLE\\user"}, expectErr: true},
+		{name: "LocalSystem given explicitly", account: &ServiceAccount{Name: LocalSystemAccount}, expectErr: true},
+		{name: "invalid privilege", account: &ServiceAccount{Name: "NT SERVICE\\svc",
+			RequiredPrivileges: []string{"SeChangeNotify"}}, expectErr: true},
+		{name: "group name in place of SID", account: &ServiceAccount{Name: "NT SERVICE\\svc",
+			Groups: []string{"Administrators"}}, expectErr: true},
+		{name: "relative path", account: &ServiceAccount{Name: "NT SERVICE\\svc",
+			Access: []PathAccess{{Path: "k\\svc.exe"}}}, expectErr: true},
+		{name: "quote in service name", serviceName: "svc' }; Remove-Item C:\\k -Recurse; { '",
+			account: &ServiceAccount{Name: "NT SERVICE\\svc' }; Remove-Item C:\\k -Recurse; { '"}, expectErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			serviceName := test.serviceName
+			if serviceName == "" {
+				serviceName = "svc"
+			}
+			err := validateAccounts([]Service{{Name: serviceName, Account: test.account}})
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestPrivileges(t *testing.T) {
+	tests := []struct {
+		name     string
+		account  *ServiceAccount
+		expected []string
+	}{
+		{name: "LocalSystem", account: nil, expected: nil},
+		{name: "unrestricted", account: &ServiceAccount{Name: "NT SERVICE\\svc"}, expected: nil},
+		{
+			name:     "restricted",
+			account:  &ServiceAccount{Name: "NT SERVICE\\svc", RequiredPrivileges: []string{"SeBackupPrivilege"}},
+			expected: []string{ChangeNotifyPrivilege, "SeBackupPrivilege"},
+		},
+		{
+			name: "change notify given explicitly",
+			account: &ServiceAccount{Name: "NT SERVICE\\svc",
+				RequiredPrivileges: []string{"SeBackupPrivilege", ChangeNotifyPrivilege}},
+			expected: []string{ChangeNotifyPrivilege, "SeBackupPrivilege"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := Service{Name: "svc", Account: test.account}
+			assert.Equal(t, test.expected, svc.Privileges())
+		})
+	}
+}
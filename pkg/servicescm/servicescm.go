@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"regexp"
 	"sort"
 	"strings"
 
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/jsonpath"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/openshift/windows-machine-config-operator/version"
@@ -33,6 +35,10 @@ const (
 )
 
 var (
+	// hnsNetworkNameRegex matches the HNS network names that can be safely used within a PowerShell command
+	hnsNetworkNameRegex = regexp.MustCompile(`^[A-Za-z0-9._ -]+$`)
+	// hnsNetworkArgRegex matches the command line flags which can be given as HNS network arguments
+	hnsNetworkArgRegex = regexp.MustCompile(`^--?[A-Za-z0-9][A-Za-z0-9_-]*$`)
 	// Name is the full name of the Windows services ConfigMap, detailing the service config for a specific WMCO version
 	Name string
 )
@@ -81,6 +87,18 @@ type Service struct {
 	// Priority is a non-negative integer that will be used to order the creation of the services.
 	// Priority 0 is created first
 	Priority uint `json:"priority"`
+	// HNSNetworks is a list of HNS networks created by the service. When the value of any of the HNSNetworkArgs in the
+	// service's command changes, these networks are removed while the service is stopped, so that the service
+	// recreates them with the new configuration.
+	HNSNetworks []string `json:"hnsNetworks,omitempty"`
+	// HNSNetworkArgs is a list of the command line flags of the service which configure its HNS networks, such as
+	// "--mtu". Changes to any other part of the command leave the HNS networks in place.
+	HNSNetworkArgs []string `json:"hnsNetworkArgs,omitempty"`
+	// Account is the Windows account the service runs as. The service runs as LocalSystem if nil.
+	Account *ServiceAccount `json:"account,omitempty"`
+	// Signature is the base64 encoded signature of the rest of the service by the operator's service signing key.
+	// Services which are neither signed nor allow-listed on the instance are not configured.
+	Signature string `json:"signature,omitempty"`
 }
 
 // FileInfo contains the path and checksum of a file copied to an instance by WMCO
@@ -256,9 +274,45 @@ func (cmData *Data) validate() error {
 	if err := validateDependencies(cmData.Services); err != nil {
 		return err
 	}
+	if err := validateVariables(cmData.Services); err != nil {
+		return err
+	}
+	if err := validateAccounts(cmData.Services); err != nil {
+		return err
+	}
+	if err := validateHNSNetworks(cmData.Services); err != nil {
+		return err
+	}
 	return validatePriorities(cmData.Services)
 }
 
+// validateHNSNetworks ensures that the HNS networks and HNS network arguments of each service can be safely used
+// within the PowerShell commands ran by WICD
+func validateHNSNetworks(services []Service) error {
+	for _, svc := range services {
+		for _, network := range svc.HNSNetworks {
+			if err := ValidateHNSNetworkName(network); err != nil {
+				return fmt.Errorf("service %s: %w", svc.Name, err)
+			}
+		}
+		for _, arg := range svc.HNSNetworkArgs {
+			if !hnsNetworkArgRegex.MatchString(arg) {
+				return fmt.Errorf("service %s has invalid HNS network argument %q", svc.Name, arg)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateHNSNetworkName returns an error if the given HNS network name contains characters other than letters,
+// digits, spaces, dots, dashes and underscores
+func ValidateHNSNetworkName(name string) error {
+	if !hnsNetworkNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid HNS network name %q", name)
+	}
+	return nil
+}
+
 // ValidateExpectedContent ensures that the given slices are all comprised of only the expected services, files, and
 // environment variables
 func (cmData *Data) ValidateExpectedContent(expected *Data) error {
@@ -334,6 +388,64 @@ func validateDependencies(services []Service) error {
 	return validateCycles(services)
 }
 
+// validateVariables ensures that each node variable of a service is named and given by a valid JSON path
+func validateVariables(services []Service) error {
+	for _, svc := range services {
+		for _, nodeVar := range svc.NodeVariablesInCommand {
+			if err := nodeVar.validate(); err != nil {
+				return fmt.Errorf("service %s has an invalid node variable: %w", svc.Name, err)
+			}
+		}
+		for _, script := range svc.PowershellPreScripts {
+			for _, nodeArg := range script.NodeArgs {
+				if err := nodeArg.validate(); err != nil {
+					return fmt.Errorf("service %s has an invalid argument for PowerShell script %s: %w", svc.Name,
+						script.Path, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateVariableUsage ensures that each variable of each service is used where it is replaced: node variables and
+// PowerShell variables in the service's command, and script arguments in the script's path. A variable which is not
+// used is most likely misspelled where it is meant to be used, leaving the misspelled name unreplaced.
+func (cmData *Data) ValidateVariableUsage() error {
+	for _, svc := range cmData.Services {
+		for _, nodeVar := range svc.NodeVariablesInCommand {
+			if !strings.Contains(svc.Command, nodeVar.Name) {
+				return fmt.Errorf("service %s has unknown node variable %s, which is not used in its command",
+					svc.Name, nodeVar.Name)
+			}
+		}
+		for _, script := range svc.PowershellPreScripts {
+			if script.VariableName != "" && !strings.Contains(svc.Command, script.VariableName) {
+				return fmt.Errorf("service %s has unknown PowerShell variable %s, which is not used in its command",
+					svc.Name, script.VariableName)
+			}
+			for _, nodeArg := range script.NodeArgs {
+				if !strings.Contains(script.Path, nodeArg.Name) {
+					return fmt.Errorf("service %s has unknown argument %s, which is not used by PowerShell script %s",
+						svc.Name, nodeArg.Name, script.Path)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validate ensures the variable is named, and that its JSON path can be parsed
+func (a *NodeCmdArg) validate() error {
+	if a.Name == "" {
+		return fmt.Errorf("variable name cannot be empty")
+	}
+	if err := jsonpath.New(a.Name).Parse(a.NodeObjectJsonPath); err != nil {
+		return fmt.Errorf("variable %s has invalid JSON path %q: %w", a.Name, a.NodeObjectJsonPath, err)
+	}
+	return nil
+}
+
 // hasDependency checks if a service is dependent on any services in the given slice
 func (s *Service) hasDependency(possibleDependencies []Service) bool {
 	for _, dependency := range s.Dependencies {
@@ -383,8 +495,8 @@ func (s *Service) hasCycle(servicesMap map[string]*Service, state map[string]boo
 		}
 		if _, seen := state[dependencyName]; !seen {
 			// Only explore a dependency service if it's also managed by the services ConfigMap. Continue otherwise
-			if dependencyService, ok := servicesMap[dependencyName]; ok {
-				return dependencyService.hasCycle(servicesMap, state)
+			if dependencyService, ok := servicesMap[dependencyName]; ok && dependencyService.hasCycle(servicesMap, state) {
+				return true
 			}
 		}
 	}
@@ -548,6 +548,34 @@ func TestValidateDependencies(t *testing.T) {
 			},
 			expectedErr: true,
 		},
+		{
+			name: "multiple dependencies shared without a cycle",
+			input: []Service{
+				{
+					Name:         "service-1",
+					Command:      "C:\\service-1",
+					Dependencies: []string{"service-2", "service-3"},
+					Priority:     1,
+				},
+				{
+					Name:     "service-2",
+					Command:  "C:\\service-2",
+					Priority: 2,
+				},
+				{
+					Name:     "service-3",
+					Command:  "C:\\service-3",
+					Priority: 3,
+				},
+				{
+					Name:         "service-4",
+					Command:      "C:\\service-4",
+					Dependencies: []string{"service-1"},
+					Priority:     4,
+				},
+			},
+			expectedErr: false,
+		},
 	}
 
 	for _, test := range testCases {
@@ -751,3 +779,139 @@ func TestValidatePriorities(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateVariables(t *testing.T) {
+	testCases := []struct {
+		name        string
+		service     Service
+		expectedErr bool
+		usageErr    bool
+	}{
+		{
+			name: "valid variables",
+			service: Service{
+				Name:    "svc",
+				Command: "C:\\k\\svc.exe --node-name=NODE_NAME --node-ip=NODE_IP",
+				NodeVariablesInCommand: []NodeCmdArg{{Name: "NODE_NAME",
+					NodeObjectJsonPath: "{.metadata.name}"}},
+				PowershellPreScripts: []PowershellPreScript{{VariableName: "NODE_IP",
+					Path: "C:\\k\\get_ip.ps1 -name NAME", NodeArgs: []NodeCmdArg{{Name: "NAME",
+						NodeObjectJsonPath: "{.metadata.name}"}}}},
+			},
+		},
+		{
+			name: "pre-script without variable",
+			service: Service{
+				Name:                 "svc",
+				Command:              "C:\\k\\svc.exe",
+				PowershellPreScripts: []PowershellPreScript{{Path: "C:\\k\\prepare.ps1"}},
+			},
+		},
+		{
+			name: "unnamed node variable",
+			service: Service{Name: "svc", Command: "C:\\k\\svc.exe",
+				NodeVariablesInCommand: []NodeCmdArg{{NodeObjectJsonPath: "{.metadata.name}"}}},
+			expectedErr: true,
+		},
+		{
+			name: "invalid JSON path",
+			service: Service{Name: "svc", Command: "C:\\k\\svc.exe --node-name=NODE_NAME",
+				NodeVariablesInCommand: []NodeCmdArg{{Name: "NODE_NAME", NodeObjectJsonPath: "{.metadata.name"}}},
+			expectedErr: true,
+		},
+		{
+			name: "invalid pre-script argument JSON path",
+			service: Service{Name: "svc", Command: "C:\\k\\svc.exe",
+				PowershellPreScripts: []PowershellPreScript{{Path: "C:\\k\\prepare.ps1 NAME",
+					NodeArgs: []NodeCmdArg{{Name: "NAME", NodeObjectJsonPath: "{.metadata[}"}}}}},
+			expectedErr: true,
+		},
+		{
+			name: "misspelled node variable",
+			service: Service{Name: "svc", Command: "C:\\k\\svc.exe --node-name=NODENAME",
+				NodeVariablesInCommand: []NodeCmdArg{{Name: "NODE_NAME", NodeObjectJsonPath: "{.metadata.name}"}}},
+			usageErr: true,
+		},
+		{
+			name: "misspelled PowerShell variable",
+			service: Service{Name: "svc", Command: "C:\\k\\svc.exe --node-ip=NODEIP",
+				PowershellPreScripts: []PowershellPreScript{{VariableName: "NODE_IP", Path: "C:\\k\\get_ip.ps1"}}},
+			usageErr: true,
+		},
+		{
+			name: "misspelled pre-script argument",
+			service: Service{Name: "svc", Command: "C:\\k\\svc.exe",
+				PowershellPreScripts: []PowershellPreScript{{Path: "C:\\k\\prepare.ps1 -name NAM",
+					NodeArgs: []NodeCmdArg{{Name: "NAME", NodeObjectJsonPath: "{.metadata.name}"}}}}},
+			usageErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateVariables([]Service{test.service})
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			data := &Data{Services: []Service{test.service}}
+			err = data.ValidateVariableUsage()
+			if test.usageErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestValidateHNSNetworks(t *testing.T) {
+	testCases := []struct {
+		name        string
+		service     Service
+		expectedErr bool
+	}{
+		{
+			name: "valid networks and arguments",
+			service: Service{Name: "svc", HNSNetworks: []string{"BaseOVNKubernetesHybridOverlayNetwork", "my net-1.0"},
+				HNSNetworkArgs: []string{"--mtu", "-port"}},
+		},
+		{
+			name:        "network name with quote",
+			service:     Service{Name: "svc", HNSNetworks: []string{"net'; Remove-Item C:\\k -Recurse; '"}},
+			expectedErr: true,
+		},
+		{
+			name:        "network name with variable",
+			service:     Service{Name: "svc", HNSNetworks: []string{"$env:PATH"}},
+			expectedErr: true,
+		},
+		{
+			name:        "empty network name",
+			service:     Service{Name: "svc", HNSNetworks: []string{""}},
+			expectedErr: true,
+		},
+		{
+			name:        "argument without dash",
+			service:     Service{Name: "svc", HNSNetworkArgs: []string{"mtu"}},
+			expectedErr: true,
+		},
+		{
+			name:        "argument with value",
+			service:     Service{Name: "svc", HNSNetworkArgs: []string{"--mtu=1400"}},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateHNSNetworks([]Service{test.service})
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
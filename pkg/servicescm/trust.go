@@ -0,0 +1,120 @@
+package servicescm
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// ServiceTrust describes which services WICD may configure on an instance. It is published to each instance by WMCO
+// over SSH, so that it cannot be influenced by anyone able to create services ConfigMaps.
+type ServiceTrust struct {
+	// PublicKey is the public half of the operator's service signing key
+	PublicKey ed25519.PublicKey `json:"publicKey"`
+	// Checksums lists the checksums of the services which may be configured without a signature
+	Checksums []string `json:"checksums,omitempty"`
+}
+
+// NewServiceTrust returns a ServiceTrust accepting services signed by the given key, as well as the given services
+func NewServiceTrust(publicKey ed25519.PublicKey, allowed []Service) (*ServiceTrust, error) {
+	trust := &ServiceTrust{PublicKey: publicKey}
+	for _, svc := range allowed {
+		checksum, err := svc.Checksum()
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(trust.Checksums, checksum) {
+			trust.Checksums = append(trust.Checksums, checksum)
+		}
+	}
+	return trust, nil
+}
+
+// ParseServiceTrust parses the given JSON encoded ServiceTrust
+func ParseServiceTrust(data []byte) (*ServiceTrust, error) {
+	trust := &ServiceTrust{}
+	if err := json.Unmarshal(data, trust); err != nil {
+		return nil, fmt.Errorf("unable to parse service trust: %w", err)
+	}
+	if len(trust.PublicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid service signing public key of size %d", len(trust.PublicKey))
+	}
+	return trust, nil
+}
+
+// Verify returns an error if the given service, held by the services ConfigMap of the given operator version, is
+// neither allow-listed nor validly signed. The signature covers the whole service, so that neither its command, its
+// PowerShell pre-scripts, nor the account it runs as can be changed. It also covers the operator version, so that a
+// service signed by another version of the operator cannot be replayed into the services ConfigMap of this version.
+func (t *ServiceTrust) Verify(svc Service, version string) error {
+	checksum, err := svc.Checksum()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(t.Checksums, checksum) {
+		return nil
+	}
+	if svc.Signature == "" {
+		return fmt.Errorf("service %s is not allow-listed and is unsigned", svc.Name)
+	}
+	signature, err := base64.StdEncoding.DecodeString(svc.Signature)
+	if err != nil {
+		return fmt.Errorf("service %s has a malformed signature: %w", svc.Name, err)
+	}
+	payload, err := svc.signedPayload(version)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(t.PublicKey, payload, signature) {
+		return fmt.Errorf("service %s is not allow-listed and its signature is invalid", svc.Name)
+	}
+	return nil
+}
+
+// Checksum returns the sha256 of the service's definition, excluding its signature
+func (s Service) Checksum() (string, error) {
+	definition, err := s.definition()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(definition)), nil
+}
+
+// definition returns the canonical encoding of the service's definition, excluding its signature
+func (s Service) definition() ([]byte, error) {
+	s.Signature = ""
+	definition, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode service %s: %w", s.Name, err)
+	}
+	return definition, nil
+}
+
+// signedPayload returns the data signed for the service, held by the services ConfigMap of the given operator version:
+// the operator version followed by the service's definition
+func (s Service) signedPayload(version string) ([]byte, error) {
+	definition, err := s.definition()
+	if err != nil {
+		return nil, err
+	}
+	// The version cannot contain a newline, as it is part of the services ConfigMap name, so the payload of a version
+	// cannot be mistaken for that of another
+	return append([]byte(version+"\n"), definition...), nil
+}
+
+// Sign signs all services, held by the services ConfigMap of the given operator version, with the given key. As
+// ed25519 signatures are deterministic, signing the same data with the same key always gives the same result.
+func (cmData *Data) Sign(key ed25519.PrivateKey, version string) error {
+	for i := range cmData.Services {
+		svc := &cmData.Services[i]
+		payload, err := svc.signedPayload(version)
+		if err != nil {
+			return err
+		}
+		svc.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	}
+	return nil
+}
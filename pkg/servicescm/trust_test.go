@@ -0,0 +1,99 @@
+package servicescm
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceTrust(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	allowed := Service{Name: "allowed", Command: "C:\\k\\allowed.exe", Priority: 1}
+	svc := Service{Name: "svc", Command: "C:\\k\\svc.exe --node-name=NODE_NAME",
+		NodeVariablesInCommand: []NodeCmdArg{{Name: "NODE_NAME", NodeObjectJsonPath: "{.metadata.name}"}},
+		PowershellPreScripts:   []PowershellPreScript{{VariableName: "NODE_IP", Path: "C:\\k\\script.ps1"}}}
+	const version = "10.20.0-abcdef0"
+	sign := func(key ed25519.PrivateKey, svc Service, version string) Service {
+		data := &Data{Services: []Service{svc}}
+		require.NoError(t, data.Sign(key, version))
+		return data.Services[0]
+	}
+
+	trust, err := NewServiceTrust(publicKey, []Service{allowed, allowed})
+	require.NoError(t, err)
+	require.Len(t, trust.Checksums, 1)
+	// The trust must survive being published to the instance
+	encoded, err := json.Marshal(trust)
+	require.NoError(t, err)
+	trust, err = ParseServiceTrust(encoded)
+	require.NoError(t, err)
+
+	signed := sign(privateKey, svc, version)
+	assert.NotEmpty(t, signed.Signature)
+	assert.Equal(t, signed, sign(privateKey, svc, version), "signatures must be deterministic")
+
+	// Any change to a signed service must invalidate its signature
+	modifiedCommand := signed
+	modifiedCommand.Command = "C:\\evil.exe"
+	renamed := signed
+	renamed.Name = "other"
+	modifiedScript := signed
+	modifiedScript.PowershellPreScripts = []PowershellPreScript{{VariableName: "NODE_IP", Path: "C:\\evil.ps1"}}
+	modifiedVariables := signed
+	modifiedVariables.NodeVariablesInCommand = []NodeCmdArg{{Name: "NODE_NAME",
+		NodeObjectJsonPath: "{.metadata.annotations.other}"}}
+	modifiedAccount := signed
+	modifiedAccount.Account = &ServiceAccount{Name: "Administrator"}
+	modifiedDependencies := signed
+	modifiedDependencies.Dependencies = []string{"other"}
+	signedAllowed := allowed
+	signedAllowed.Signature = "invalid"
+
+	tests := []struct {
+		name      string
+		svc       Service
+		expectErr bool
+	}{
+		{name: "allow-listed", svc: allowed},
+		{name: "allow-listed with invalid signature", svc: signedAllowed},
+		{name: "signed", svc: signed},
+		{name: "unsigned", svc: svc, expectErr: true},
+		{name: "signed by another key", svc: sign(otherKey, svc, version), expectErr: true},
+		{name: "signed for another operator version", svc: sign(privateKey, svc, "10.19.0-abcdef0"), expectErr: true},
+		{name: "malformed signature", svc: Service{Name: svc.Name, Command: svc.Command, Signature: "!"},
+			expectErr: true},
+		{name: "modified command", svc: modifiedCommand, expectErr: true},
+		{name: "renamed", svc: renamed, expectErr: true},
+		{name: "modified pre-script", svc: modifiedScript, expectErr: true},
+		{name: "modified node variables", svc: modifiedVariables, expectErr: true},
+		{name: "modified account", svc: modifiedAccount, expectErr: true},
+		{name: "modified dependencies", svc: modifiedDependencies, expectErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := trust.Verify(test.svc, version)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestParseServiceTrust(t *testing.T) {
+	_, err := ParseServiceTrust([]byte("{"))
+	assert.Error(t, err)
+	_, err = ParseServiceTrust([]byte(`{"publicKey":"AAAA"}`))
+	assert.Error(t, err)
+	_, err = ParseServiceTrust([]byte(`{}`))
+	assert.Error(t, err)
+}
@@ -2,15 +2,28 @@ package signer
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 	kubeTypes "k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
 )
 
+const (
+	// certificateValidity is how long the user certificates issued to access an instance are valid for. A signer is
+	// created for each interaction with an instance, so this only needs to cover the longest of those.
+	certificateValidity = time.Hour
+	// certificateClockSkew is how far in the past user certificates are valid from, to tolerate instance clocks
+	// running behind
+	certificateClockSkew = 5 * time.Minute
+)
+
 // Create creates a signer using the private key data
 func Create(ctx context.Context, secret kubeTypes.NamespacedName, c client.Client) (ssh.Signer, error) {
 	privateKey, err := secrets.GetPrivateKey(ctx, secret, c)
@@ -23,3 +36,57 @@ func Create(ctx context.Context, secret kubeTypes.NamespacedName, c client.Clien
 	}
 	return signer, nil
 }
+
+// ForInstance creates the signer used to SSH into the given instance, from the Secrets in the given namespace
+// referenced by the instance's credentials. Instances not referencing a private key Secret use the private key shared
+// by all instances. Instances referencing an OpenSSH certificate authority are given a user certificate for their
+// username, issued by the CA.
+func ForInstance(ctx context.Context, c client.Client, namespace string,
+	instanceInfo *instance.Info) (ssh.Signer, error) {
+	keySecret := instanceInfo.Credentials.PrivateKeySecret
+	if keySecret == "" {
+		keySecret = secrets.PrivateKeySecret
+	}
+	keySigner, err := Create(ctx, kubeTypes.NamespacedName{Namespace: namespace, Name: keySecret}, c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create signer from secret %s: %w", keySecret, err)
+	}
+	if instanceInfo.Credentials.SSHCASecret == "" {
+		return keySigner, nil
+	}
+	caSigner, err := Create(ctx, kubeTypes.NamespacedName{Namespace: namespace,
+		Name: instanceInfo.Credentials.SSHCASecret}, c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create certificate authority signer from secret %s: %w",
+			instanceInfo.Credentials.SSHCASecret, err)
+	}
+	return NewCertificateSigner(keySigner, caSigner, instanceInfo.Username, instanceInfo.Address)
+}
+
+// NewCertificateSigner returns a signer presenting the given key along with a new OpenSSH user certificate for it,
+// issued by the given certificate authority. The certificate is only valid for the given principal, and is identified
+// by the given key ID in the logs of the SSH server.
+func NewCertificateSigner(key, authority ssh.Signer, principal, keyID string) (ssh.Signer, error) {
+	serial := make([]byte, 8)
+	if _, err := rand.Read(serial); err != nil {
+		return nil, fmt.Errorf("unable to generate certificate serial: %w", err)
+	}
+	now := time.Now()
+	certificate := &ssh.Certificate{
+		Key:             key.PublicKey(),
+		Serial:          binary.BigEndian.Uint64(serial),
+		CertType:        ssh.UserCert,
+		KeyId:           keyID,
+		ValidPrincipals: []string{principal},
+		ValidAfter:      uint64(now.Add(-certificateClockSkew).Unix()),
+		ValidBefore:     uint64(now.Add(certificateValidity).Unix()),
+	}
+	if err := certificate.SignCert(rand.Reader, authority); err != nil {
+		return nil, fmt.Errorf("unable to sign user certificate: %w", err)
+	}
+	signer, err := ssh.NewCertSigner(certificate, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create certificate signer: %w", err)
+	}
+	return signer, nil
+}
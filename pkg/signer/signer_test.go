@@ -0,0 +1,102 @@
+package signer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/instance"
+	"github.com/openshift/windows-machine-config-operator/pkg/secrets"
+)
+
+// newKeySecret returns a Secret with the given name holding a new private key, and the key's signer
+func newKeySecret(t *testing.T, name string) (*core.Secret, ssh.Signer) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return &core.Secret{
+		ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "test"},
+		Data:       map[string][]byte{secrets.PrivateKeySecretKey: pem.EncodeToMemory(block)},
+	}, signer
+}
+
+func TestForInstance(t *testing.T) {
+	sharedSecret, sharedSigner := newKeySecret(t, secrets.PrivateKeySecret)
+	domainSecret, domainSigner := newKeySecret(t, "domain-key")
+	caSecret, caSigner := newKeySecret(t, "domain-ca")
+	c := fake.NewClientBuilder().WithObjects(sharedSecret, domainSecret, caSecret).Build()
+
+	testCases := []struct {
+		name        string
+		credentials instance.Credentials
+		expectedKey ssh.PublicKey
+		certificate bool
+		expectedErr bool
+	}{
+		{name: "shared private key", expectedKey: sharedSigner.PublicKey()},
+		{
+			name:        "instance private key",
+			credentials: instance.Credentials{PrivateKeySecret: "domain-key"},
+			expectedKey: domainSigner.PublicKey(),
+		},
+		{
+			name:        "shared private key with certificate",
+			credentials: instance.Credentials{SSHCASecret: "domain-ca"},
+			expectedKey: sharedSigner.PublicKey(),
+			certificate: true,
+		},
+		{
+			name:        "instance private key with certificate",
+			credentials: instance.Credentials{PrivateKeySecret: "domain-key", SSHCASecret: "domain-ca"},
+			expectedKey: domainSigner.PublicKey(),
+			certificate: true,
+		},
+		{
+			name:        "missing private key secret",
+			credentials: instance.Credentials{PrivateKeySecret: "missing"},
+			expectedErr: true,
+		},
+		{
+			name:        "missing CA secret",
+			credentials: instance.Credentials{SSHCASecret: "missing"},
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			instanceInfo := &instance.Info{Address: "10.0.0.1", Username: "Administrator",
+				Credentials: test.credentials}
+			signer, err := ForInstance(context.Background(), c, "test", instanceInfo)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			certificate, ok := signer.PublicKey().(*ssh.Certificate)
+			require.Equal(t, test.certificate, ok)
+			if !test.certificate {
+				assert.Equal(t, test.expectedKey.Marshal(), signer.PublicKey().Marshal())
+				return
+			}
+			assert.Equal(t, test.expectedKey.Marshal(), certificate.Key.Marshal())
+			assert.Equal(t, "10.0.0.1", certificate.KeyId)
+			checker := ssh.CertChecker{IsUserAuthority: func(auth ssh.PublicKey) bool {
+				return string(auth.Marshal()) == string(caSigner.PublicKey().Marshal())
+			}}
+			assert.NoError(t, checker.CheckCert("Administrator", certificate))
+			assert.Error(t, checker.CheckCert("core", certificate), "certificate valid for another principal")
+		})
+	}
+}
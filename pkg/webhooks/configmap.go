@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
+)
+
+const (
+	// ConfigMapValidatorPath is the path the ConfigMap validating webhook is served at
+	ConfigMapValidatorPath = "/validate-configmaps"
+	// ConfigMapValidatorName is the name the ConfigMap validating webhook is registered with OLM under
+	ConfigMapValidatorName = "vconfigmaps.windowsmachineconfig.openshift.io"
+	// OLMWebhookNameLabel is set by OLM on the webhook configurations it creates, to the name of their webhook
+	OLMWebhookNameLabel = "olm.webhook-description-generate-name"
+)
+
+// ConfigMapValidator rejects malformed windows-instances and Windows services ConfigMaps in the operator's namespace,
+// which would otherwise only be found to be invalid once they are acted upon
+type ConfigMapValidator struct {
+	// namespace is the namespace the operator is deployed in
+	namespace string
+	decoder   admission.Decoder
+}
+
+// NewConfigMapValidator returns a validator for the ConfigMaps of the given namespace
+func NewConfigMapValidator(namespace string, scheme *runtime.Scheme) *ConfigMapValidator {
+	return &ConfigMapValidator{namespace: namespace, decoder: admission.NewDecoder(scheme)}
+}
+
+// Handle allows the given ConfigMap to be created or updated if it is valid, or is not one of the ConfigMaps
+// consumed by the operator or WICD. On update, the previous ConfigMap is used to only validate what was changed.
+func (v *ConfigMapValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Namespace != v.namespace {
+		return admission.Allowed("")
+	}
+	cm := &core.ConfigMap{}
+	if err := v.decoder.Decode(req, cm); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var previous *core.ConfigMap
+	if req.Operation == admissionv1.Update && len(req.OldObject.Raw) > 0 {
+		previous = &core.ConfigMap{}
+		if err := v.decoder.DecodeRaw(req.OldObject, previous); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+	warnings, err := validateConfigMap(ctx, cm, previous)
+	if err != nil {
+		// Multiple errors are joined by newlines, which are hard to read once returned to the client
+		return admission.Denied(fmt.Sprintf("invalid ConfigMap %s: %s", cm.Name,
+			strings.ReplaceAll(err.Error(), "\n", "; "))).WithWarnings(warnings...)
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// validateConfigMap returns an error if the given ConfigMap is a windows-instances or Windows services ConfigMap with
+// invalid contents. previous is the ConfigMap being updated, and is nil when the ConfigMap is being created. Warnings
+// are returned for the contents which could not be validated.
+func validateConfigMap(ctx context.Context, cm, previous *core.ConfigMap) ([]string, error) {
+	switch {
+	case cm.Name == wiparser.InstanceConfigMap:
+		var previousData map[string]string
+		if previous != nil {
+			previousData = previous.Data
+		}
+		return wiparser.Validate(ctx, cm.Data, previousData)
+	case strings.HasPrefix(cm.Name, servicescm.NamePrefix):
+		data, err := servicescm.Parse(cm.Data)
+		if err != nil {
+			return nil, err
+		}
+		return nil, data.ValidateVariableUsage()
+	}
+	return nil, nil
+}
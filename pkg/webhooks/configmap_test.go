@@ -0,0 +1,139 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+	"github.com/openshift/windows-machine-config-operator/pkg/wiparser"
+)
+
+const namespace = "openshift-windows-machine-config-operator"
+
+func TestConfigMapValidator(t *testing.T) {
+	validServices, err := servicescm.Generate(servicescm.Name, namespace, &servicescm.Data{
+		Services: []servicescm.Service{{Name: "svc", Command: "C:\\k\\svc.exe --node-name=NODE_NAME",
+			NodeVariablesInCommand: []servicescm.NodeCmdArg{{Name: "NODE_NAME",
+				NodeObjectJsonPath: "{.metadata.name}"}}}},
+		Files: []servicescm.FileInfo{},
+	})
+	require.NoError(t, err)
+	misspelledServices := validServices.DeepCopy()
+	misspelledServices.Data["services"] = `[{"name":"svc","path":"C:\\k\\svc.exe --node-name=NODENAME",` +
+		`"nodeVariablesInCommand":[{"name":"NODE_NAME","nodeObjectJsonPath":"{.metadata.name}"}]}]`
+	cyclicServices := validServices.DeepCopy()
+	cyclicServices.Data["services"] = `[{"name":"a","path":"a.exe","dependencies":["b"],"priority":1},` +
+		`{"name":"b","path":"b.exe","dependencies":["a"],"priority":2}]`
+
+	tests := []struct {
+		name      string
+		configMap *core.ConfigMap
+		// previous is the ConfigMap being updated, the ConfigMap is created if nil
+		previous        *core.ConfigMap
+		expectedAllowed bool
+	}{
+		{
+			name:            "valid instances",
+			configMap:       instancesConfigMap(namespace, map[string]string{"127.0.0.1": "username=core"}),
+			expectedAllowed: true,
+		},
+		{
+			name:            "malformed instance entry",
+			configMap:       instancesConfigMap(namespace, map[string]string{"127.0.0.1": "user=core"}),
+			expectedAllowed: false,
+		},
+		{
+			name: "duplicate instance address",
+			configMap: instancesConfigMap(namespace, map[string]string{"127.0.0.1": "username=core",
+				"localhost": "username=core"}),
+			expectedAllowed: false,
+		},
+		{
+			name: "update leaving a malformed instance entry unchanged",
+			configMap: instancesConfigMap(namespace, map[string]string{"127.0.0.1": "user=core",
+				"127.0.0.2": "username=core"}),
+			previous:        instancesConfigMap(namespace, map[string]string{"127.0.0.1": "user=core"}),
+			expectedAllowed: true,
+		},
+		{
+			name:            "update malforming an instance entry",
+			configMap:       instancesConfigMap(namespace, map[string]string{"127.0.0.1": "user=core"}),
+			previous:        instancesConfigMap(namespace, map[string]string{"127.0.0.1": "username=core"}),
+			expectedAllowed: false,
+		},
+		{
+			name:            "instances in another namespace",
+			configMap:       instancesConfigMap("default", map[string]string{"127.0.0.1": "user=core"}),
+			expectedAllowed: true,
+		},
+		{
+			name:            "valid services",
+			configMap:       validServices,
+			expectedAllowed: true,
+		},
+		{
+			name:            "misspelled services variable",
+			configMap:       misspelledServices,
+			expectedAllowed: false,
+		},
+		{
+			name:            "services dependency cycle",
+			configMap:       cyclicServices,
+			expectedAllowed: false,
+		},
+		{
+			name: "malformed services",
+			configMap: &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: servicescm.NamePrefix + "1.0.0",
+				Namespace: namespace}, Data: map[string]string{"services": "[", "files": "[]"}},
+			expectedAllowed: false,
+		},
+		{
+			name: "unrelated ConfigMap",
+			configMap: &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: "other", Namespace: namespace},
+				Data: map[string]string{"127.0.0.1": "user=core"}},
+			expectedAllowed: true,
+		},
+	}
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	validator := NewConfigMapValidator(namespace, scheme)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			raw, err := json.Marshal(test.configMap)
+			require.NoError(t, err)
+			operation := admissionv1.Create
+			var oldRaw []byte
+			if test.previous != nil {
+				operation = admissionv1.Update
+				oldRaw, err = json.Marshal(test.previous)
+				require.NoError(t, err)
+			}
+			resp := validator.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Name:      test.configMap.Name,
+				Namespace: test.configMap.Namespace,
+				Operation: operation,
+				Object:    runtime.RawExtension{Raw: raw},
+				OldObject: runtime.RawExtension{Raw: oldRaw},
+			}})
+			assert.Equal(t, test.expectedAllowed, resp.Allowed, resp.Result)
+		})
+	}
+}
+
+// instancesConfigMap returns a windows-instances ConfigMap in the given namespace with the given data
+func instancesConfigMap(namespace string, data map[string]string) *core.ConfigMap {
+	return &core.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{Name: wiparser.InstanceConfigMap, Namespace: namespace},
+		Data:       data,
+	}
+}
@@ -0,0 +1,351 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	core "k8s.io/api/core/v1"
+	node "k8s.io/api/node/v1"
+	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/kubernetes/pkg/credentialprovider"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/imageplatform"
+	"github.com/openshift/windows-machine-config-operator/pkg/nodeutil"
+	"github.com/openshift/windows-machine-config-operator/pkg/runtimeclass"
+)
+
+const (
+	// PodMutatorPath is the path the pod mutating webhook is served at
+	PodMutatorPath = "/mutate-pods"
+	// PodMutatorName is the name of the pod mutating webhook, and of the MutatingWebhookConfiguration registering it
+	PodMutatorName = "mpods.windowsmachineconfig.openshift.io"
+	// podMutatorTimeout is the number of seconds the API server waits on the pod mutating webhook
+	podMutatorTimeout = 10
+	// imageInspectionTimeout bounds the time spent reading the manifests of the images of a pod
+	imageInspectionTimeout = 5 * time.Second
+)
+
+// imageInspector finds the platforms images can be ran on
+type imageInspector interface {
+	Platforms(ctx context.Context, image string, keyring credentialprovider.DockerKeyring) ([]imageplatform.Platform,
+		error)
+}
+
+// PodMutator steers Windows pods onto Windows nodes. A pod is a Windows pod if it declares the Windows OS, or uses a
+// Windows RuntimeClass.
+type PodMutator struct {
+	client client.Client
+	// secretReader reads the image pull secrets of pods. Secrets are read uncached, as only those of the pods being
+	// admitted are needed.
+	secretReader client.Reader
+	decoder      admission.Decoder
+	inspector    imageInspector
+	log          logr.Logger
+}
+
+// NewPodMutator returns a mutator reading nodes and RuntimeClasses with the given client, and the image pull secrets
+// of pods with the given reader. The registries of images are not accessed at any address of the given cluster
+// networks, nor at any other internal address.
+func NewPodMutator(c client.Client, secretReader client.Reader, scheme *runtime.Scheme,
+	clusterNetworks []*net.IPNet) *PodMutator {
+	return &PodMutator{
+		client:       c,
+		secretReader: secretReader,
+		decoder:      admission.NewDecoder(scheme),
+		inspector:    imageplatform.NewInspector(imageplatform.NewClient(imageInspectionTimeout, clusterNetworks)),
+		log:          ctrl.Log.WithName("webhooks").WithName("pod"),
+	}
+}
+
+// Handle has the given Windows pod tolerate the taint of Windows nodes and select Windows nodes of a build able to
+// run its images. Warnings are returned for images which cannot be ran on the Windows builds the pod may be scheduled
+// to.
+func (m *PodMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod := &core.Pod{}
+	if err := m.decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	windowsPod, err := m.isWindowsPod(ctx, pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !windowsPod {
+		return admission.Allowed("")
+	}
+
+	warnings, err := m.mutate(ctx, pod, req.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	marshalled, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	resp := admission.PatchResponseFromRaw(req.Object.Raw, marshalled)
+	resp.Warnings = warnings
+	return resp
+}
+
+// mutate has the given Windows pod tolerate the taint of Windows nodes and select Windows nodes, restricting it to
+// the Windows builds able to run its images. The pod is created in the given namespace. Warnings are returned for
+// conflicting node selectors and images.
+func (m *PodMutator) mutate(ctx context.Context, pod *core.Pod, namespace string) ([]string, error) {
+	tolerateWindowsTaint(pod)
+	var warnings []string
+	if os, found := pod.Spec.NodeSelector[core.LabelOSStable]; !found {
+		if pod.Spec.NodeSelector == nil {
+			pod.Spec.NodeSelector = make(map[string]string)
+		}
+		pod.Spec.NodeSelector[core.LabelOSStable] = string(core.Windows)
+	} else if os != string(core.Windows) {
+		warnings = append(warnings, fmt.Sprintf("Windows pod selects nodes with %s=%s, it cannot be scheduled",
+			core.LabelOSStable, os))
+	}
+	buildWarnings, err := m.selectBuild(ctx, pod, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return append(warnings, buildWarnings...), nil
+}
+
+// isWindowsPod returns true if the pod declares the Windows OS, or uses a RuntimeClass for Windows containers
+func (m *PodMutator) isWindowsPod(ctx context.Context, pod *core.Pod) (bool, error) {
+	if pod.Spec.OS != nil {
+		return pod.Spec.OS.Name == core.Windows, nil
+	}
+	if pod.Spec.RuntimeClassName == nil {
+		return false, nil
+	}
+	rc := &node.RuntimeClass{}
+	if err := m.client.Get(ctx, client.ObjectKey{Name: *pod.Spec.RuntimeClassName}, rc); err != nil {
+		if k8sapierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to get RuntimeClass %s: %w", *pod.Spec.RuntimeClassName, err)
+	}
+	if _, managed := rc.GetLabels()[runtimeclass.ManagedLabel]; managed {
+		return true, nil
+	}
+	if rc.Handler == runtimeclass.ProcessHandler || rc.Handler == runtimeclass.HyperVHandler {
+		return true, nil
+	}
+	return rc.Scheduling != nil && rc.Scheduling.NodeSelector[core.LabelOSStable] == string(core.Windows), nil
+}
+
+// tolerateWindowsTaint adds a toleration of the taint of Windows nodes to the given pod, unless it already tolerates it
+func tolerateWindowsTaint(pod *core.Pod) {
+	for _, toleration := range pod.Spec.Tolerations {
+		if toleration.ToleratesTaint(&nodeutil.WindowsTaint) {
+			return
+		}
+	}
+	pod.Spec.Tolerations = append(pod.Spec.Tolerations, core.Toleration{
+		Key:      nodeutil.WindowsTaint.Key,
+		Operator: core.TolerationOpEqual,
+		Value:    nodeutil.WindowsTaint.Value,
+		Effect:   nodeutil.WindowsTaint.Effect,
+	})
+}
+
+// selectBuild restricts the given pod to the Windows builds present in the cluster which can run all of its images,
+// unless the pod already selects a build. Warnings are returned for each image which cannot be ran on any build the
+// pod may be scheduled to. Images whose platforms cannot be found are assumed to run on all builds. Registries are
+// accessed with the credentials of the pod's image pull secrets, in the given namespace.
+func (m *PodMutator) selectBuild(ctx context.Context, pod *core.Pod, namespace string) ([]string, error) {
+	nodes := &core.NodeList{}
+	if err := m.client.List(ctx, nodes, client.MatchingLabels{core.LabelOSStable: string(core.Windows)}); err != nil {
+		return nil, fmt.Errorf("error listing Windows nodes: %w", err)
+	}
+	clusterBuilds := runtimeclass.BuildsFromNodes(nodes.Items)
+	if len(clusterBuilds) == 0 {
+		return nil, nil
+	}
+	slices.Sort(clusterBuilds)
+	selectedBuild, buildSelected := pod.Spec.NodeSelector[core.LabelWindowsBuild]
+	candidates := clusterBuilds
+	if buildSelected {
+		candidates = []string{selectedBuild}
+	}
+
+	inspectCtx, cancel := context.WithTimeout(ctx, imageInspectionTimeout)
+	defer cancel()
+	keyring := m.keyring(inspectCtx, namespace, pod.Spec.ImagePullSecrets)
+	compatible := slices.Clone(candidates)
+	var warnings []string
+	for _, image := range podImages(pod) {
+		platforms, err := m.inspector.Platforms(inspectCtx, image, keyring)
+		if err != nil {
+			m.log.V(1).Info("unable to find the platforms of image", "image", image, "error", err)
+			continue
+		}
+		supported := slices.DeleteFunc(slices.Clone(candidates), func(build string) bool {
+			return !imageplatform.SupportsWindowsBuild(platforms, build)
+		})
+		if len(supported) == 0 {
+			warnings = append(warnings, fmt.Sprintf("image %s has no Windows manifest for Windows build %s", image,
+				strings.Join(candidates, " or ")))
+			continue
+		}
+		compatible = slices.DeleteFunc(compatible, func(build string) bool {
+			return !slices.Contains(supported, build)
+		})
+	}
+	if buildSelected || len(compatible) == 0 || len(compatible) == len(clusterBuilds) {
+		return warnings, nil
+	}
+	if len(compatible) == 1 {
+		pod.Spec.NodeSelector[core.LabelWindowsBuild] = compatible[0]
+	} else {
+		requireNodeLabelIn(pod, core.LabelWindowsBuild, compatible)
+	}
+	return warnings, nil
+}
+
+// keyring returns the credentials of the given image pull secrets of the given namespace. Secrets which cannot be
+// read are skipped, as they are by the kubelet. The cluster's global pull secret is never used, so that pods cannot
+// have registries inspected with credentials their creators do not have.
+func (m *PodMutator) keyring(ctx context.Context, namespace string,
+	pullSecrets []core.LocalObjectReference) credentialprovider.DockerKeyring {
+	keyring := &credentialprovider.BasicDockerKeyring{}
+	for _, ref := range pullSecrets {
+		secret := &core.Secret{}
+		if err := m.secretReader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+			m.log.V(1).Info("unable to read image pull secret", "namespace", namespace, "name", ref.Name,
+				"error", err)
+			continue
+		}
+		config, err := dockerConfig(secret)
+		if err != nil {
+			m.log.V(1).Info("unable to parse image pull secret", "namespace", namespace, "name", ref.Name,
+				"error", err)
+			continue
+		}
+		keyring.Add(config)
+	}
+	return keyring
+}
+
+// dockerConfig returns the registry credentials held by the given image pull secret, in either the .dockerconfigjson
+// or the legacy .dockercfg format
+func dockerConfig(secret *core.Secret) (credentialprovider.DockerConfig, error) {
+	if contents, found := secret.Data[core.DockerConfigJsonKey]; found {
+		config := credentialprovider.DockerConfigJSON{}
+		if err := json.Unmarshal(contents, &config); err != nil {
+			return nil, err
+		}
+		return config.Auths, nil
+	}
+	if contents, found := secret.Data[core.DockerConfigKey]; found {
+		config := credentialprovider.DockerConfig{}
+		if err := json.Unmarshal(contents, &config); err != nil {
+			return nil, err
+		}
+		return config, nil
+	}
+	return nil, fmt.Errorf("secret has neither a %s nor a %s key", core.DockerConfigJsonKey, core.DockerConfigKey)
+}
+
+// podImages returns the distinct images of the init containers and containers of the given pod
+func podImages(pod *core.Pod) []string {
+	var images []string
+	for _, container := range append(slices.Clone(pod.Spec.InitContainers), pod.Spec.Containers...) {
+		if container.Image != "" && !slices.Contains(images, container.Image) {
+			images = append(images, container.Image)
+		}
+	}
+	return images
+}
+
+// requireNodeLabelIn restricts the given pod to nodes with the given label set to one of the given values, in
+// addition to any node affinity the pod already requires
+func requireNodeLabelIn(pod *core.Pod, label string, values []string) {
+	requirement := core.NodeSelectorRequirement{Key: label, Operator: core.NodeSelectorOpIn, Values: values}
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &core.Affinity{}
+	}
+	if pod.Spec.Affinity.NodeAffinity == nil {
+		pod.Spec.Affinity.NodeAffinity = &core.NodeAffinity{}
+	}
+	required := pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &core.NodeSelector{
+			NodeSelectorTerms: []core.NodeSelectorTerm{{MatchExpressions: []core.NodeSelectorRequirement{requirement}}},
+		}
+		return
+	}
+	// Terms are ORed, so the requirement must be added to each of them
+	for i := range required.NodeSelectorTerms {
+		required.NodeSelectorTerms[i].MatchExpressions = append(required.NodeSelectorTerms[i].MatchExpressions,
+			requirement)
+	}
+}
+
+// GeneratePodMutatorConfiguration returns the MutatingWebhookConfiguration registering the pod mutating webhook. OLM
+// restricts the webhooks it registers to the operator's namespace, so the pod webhook is registered by WMCO itself,
+// served by the same Service as the given OLM registered webhook. Pods in the operator's namespace and in the
+// control plane's run-level namespaces are never sent to the webhook, so they can be admitted while WMCO is down.
+// All fields defaulted by the API server are set, so the returned configuration can be compared to the existing one.
+func GeneratePodMutatorConfiguration(olmWebhook admissionregistration.WebhookClientConfig,
+	namespace string) (*admissionregistration.MutatingWebhookConfiguration, error) {
+	if olmWebhook.Service == nil {
+		return nil, fmt.Errorf("webhook is not served through a Service")
+	}
+	path := PodMutatorPath
+	port := int32(443)
+	service := olmWebhook.Service.DeepCopy()
+	service.Path = &path
+	if service.Port == nil {
+		service.Port = &port
+	}
+	scope := admissionregistration.NamespacedScope
+	failurePolicy := admissionregistration.Ignore
+	matchPolicy := admissionregistration.Equivalent
+	sideEffects := admissionregistration.SideEffectClassNone
+	timeout := int32(podMutatorTimeout)
+	reinvocationPolicy := admissionregistration.NeverReinvocationPolicy
+	return &admissionregistration.MutatingWebhookConfiguration{
+		ObjectMeta: meta.ObjectMeta{Name: PodMutatorName},
+		Webhooks: []admissionregistration.MutatingWebhook{{
+			Name: PodMutatorName,
+			ClientConfig: admissionregistration.WebhookClientConfig{
+				Service:  service,
+				CABundle: olmWebhook.CABundle,
+			},
+			Rules: []admissionregistration.RuleWithOperations{{
+				Operations: []admissionregistration.OperationType{admissionregistration.Create},
+				Rule: admissionregistration.Rule{
+					APIGroups:   []string{""},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"pods"},
+					Scope:       &scope,
+				},
+			}},
+			FailurePolicy: &failurePolicy,
+			MatchPolicy:   &matchPolicy,
+			NamespaceSelector: &meta.LabelSelector{
+				MatchExpressions: []meta.LabelSelectorRequirement{
+					{Key: core.LabelMetadataName, Operator: meta.LabelSelectorOpNotIn, Values: []string{namespace}},
+					{Key: "openshift.io/run-level", Operator: meta.LabelSelectorOpNotIn, Values: []string{"0", "1"}},
+				},
+			},
+			ObjectSelector:          &meta.LabelSelector{},
+			SideEffects:             &sideEffects,
+			TimeoutSeconds:          &timeout,
+			AdmissionReviewVersions: []string{"v1"},
+			ReinvocationPolicy:      &reinvocationPolicy,
+		}},
+	}, nil
+}
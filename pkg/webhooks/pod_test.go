@@ -0,0 +1,359 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	core "k8s.io/api/core/v1"
+	node "k8s.io/api/node/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/kubernetes/pkg/credentialprovider"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/imageplatform"
+	"github.com/openshift/windows-machine-config-operator/pkg/nodeutil"
+	"github.com/openshift/windows-machine-config-operator/pkg/registries"
+	"github.com/openshift/windows-machine-config-operator/pkg/runtimeclass"
+)
+
+const (
+	ltsc2019 = "10.0.17763"
+	ltsc2022 = "10.0.20348"
+)
+
+// fakeInspector returns the platforms of images from a map, failing for the images it does not know
+type fakeInspector map[string][]imageplatform.Platform
+
+func (f fakeInspector) Platforms(_ context.Context, image string, _ credentialprovider.DockerKeyring) (
+	[]imageplatform.Platform, error) {
+	platforms, found := f[image]
+	if !found {
+		return nil, fmt.Errorf("image %s not found", image)
+	}
+	return platforms, nil
+}
+
+func TestPodMutatorHandle(t *testing.T) {
+	windowsRuntimeClass := &node.RuntimeClass{ObjectMeta: meta.ObjectMeta{Name: "windows"},
+		Handler: runtimeclass.ProcessHandler}
+	linuxRuntimeClass := &node.RuntimeClass{ObjectMeta: meta.ObjectMeta{Name: "kata"}, Handler: "kata"}
+	c := fake.NewClientBuilder().WithObjects(windowsRuntimeClass, linuxRuntimeClass).Build()
+	mutator := &PodMutator{
+		client:       c,
+		secretReader: c,
+		decoder:      admission.NewDecoder(clientgoscheme.Scheme),
+		inspector:    fakeInspector{},
+		log:          logr.Discard(),
+	}
+	windowsRuntimeClassName := windowsRuntimeClass.GetName()
+	linuxRuntimeClassName := linuxRuntimeClass.GetName()
+	missingRuntimeClassName := "missing"
+
+	tests := []struct {
+		name            string
+		spec            core.PodSpec
+		expectedMutated bool
+	}{
+		{
+			name:            "Windows OS",
+			spec:            core.PodSpec{OS: &core.PodOS{Name: core.Windows}},
+			expectedMutated: true,
+		},
+		{
+			name:            "Windows RuntimeClass",
+			spec:            core.PodSpec{RuntimeClassName: &windowsRuntimeClassName},
+			expectedMutated: true,
+		},
+		{
+			name:            "Linux OS",
+			spec:            core.PodSpec{OS: &core.PodOS{Name: core.Linux}},
+			expectedMutated: false,
+		},
+		{
+			name:            "Linux RuntimeClass",
+			spec:            core.PodSpec{RuntimeClassName: &linuxRuntimeClassName},
+			expectedMutated: false,
+		},
+		{
+			name:            "missing RuntimeClass",
+			spec:            core.PodSpec{RuntimeClassName: &missingRuntimeClassName},
+			expectedMutated: false,
+		},
+		{
+			name:            "no OS or RuntimeClass",
+			spec:            core.PodSpec{},
+			expectedMutated: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.spec.Containers = []core.Container{{Name: "app", Image: "app"}}
+			raw, err := json.Marshal(&core.Pod{ObjectMeta: meta.ObjectMeta{Name: "pod", Namespace: "default"},
+				Spec: test.spec})
+			require.NoError(t, err)
+			resp := mutator.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Name:      "pod",
+				Namespace: "default",
+				Operation: admissionv1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+			require.True(t, resp.Allowed, resp.Result)
+			assert.Equal(t, test.expectedMutated, len(resp.Patches) > 0, resp.Patches)
+		})
+	}
+}
+
+func TestIsWindowsPod(t *testing.T) {
+	managed := &node.RuntimeClass{ObjectMeta: meta.ObjectMeta{Name: "managed",
+		Labels: map[string]string{runtimeclass.ManagedLabel: ltsc2022}}, Handler: "custom"}
+	hyperV := &node.RuntimeClass{ObjectMeta: meta.ObjectMeta{Name: "hyperv"}, Handler: runtimeclass.HyperVHandler}
+	scheduled := &node.RuntimeClass{ObjectMeta: meta.ObjectMeta{Name: "scheduled"}, Handler: "custom",
+		Scheduling: &node.Scheduling{NodeSelector: map[string]string{core.LabelOSStable: "windows"}}}
+	mutator := &PodMutator{client: fake.NewClientBuilder().WithObjects(managed, hyperV, scheduled).Build()}
+
+	for _, rc := range []*node.RuntimeClass{managed, hyperV, scheduled} {
+		name := rc.GetName()
+		windowsPod, err := mutator.isWindowsPod(context.Background(),
+			&core.Pod{Spec: core.PodSpec{RuntimeClassName: &name}})
+		require.NoError(t, err)
+		assert.True(t, windowsPod, name)
+	}
+	// The declared OS takes precedence over the RuntimeClass
+	name := managed.GetName()
+	windowsPod, err := mutator.isWindowsPod(context.Background(),
+		&core.Pod{Spec: core.PodSpec{OS: &core.PodOS{Name: core.Linux}, RuntimeClassName: &name}})
+	require.NoError(t, err)
+	assert.False(t, windowsPod)
+}
+
+func TestPodMutatorMutate(t *testing.T) {
+	windowsToleration := core.Toleration{Key: nodeutil.WindowsTaint.Key, Operator: core.TolerationOpEqual,
+		Value: nodeutil.WindowsTaint.Value, Effect: nodeutil.WindowsTaint.Effect}
+	inspector := fakeInspector{
+		"multi-arch": {{OS: "windows", OSVersion: ltsc2019 + ".5458"}, {OS: "windows", OSVersion: ltsc2022 + ".2340"}},
+		"ltsc2019":   {{OS: "windows", OSVersion: ltsc2019 + ".5458"}},
+		"ltsc2022":   {{OS: "windows", OSVersion: ltsc2022 + ".2340"}},
+		"linux":      {{OS: "linux"}},
+	}
+
+	tests := []struct {
+		name                  string
+		clusterBuilds         []string
+		pod                   core.PodSpec
+		expectedTolerations   []core.Toleration
+		expectedNodeSelector  map[string]string
+		expectedAffinity      *core.Affinity
+		expectedWarningsCount int
+	}{
+		{
+			name:                 "no Windows nodes",
+			pod:                  podSpec("ltsc2022"),
+			expectedTolerations:  []core.Toleration{windowsToleration},
+			expectedNodeSelector: map[string]string{core.LabelOSStable: "windows"},
+		},
+		{
+			name:                 "image runs on all builds",
+			clusterBuilds:        []string{ltsc2019, ltsc2022},
+			pod:                  podSpec("multi-arch"),
+			expectedTolerations:  []core.Toleration{windowsToleration},
+			expectedNodeSelector: map[string]string{core.LabelOSStable: "windows"},
+		},
+		{
+			name:                "image runs on one build",
+			clusterBuilds:       []string{ltsc2019, ltsc2022},
+			pod:                 podSpec("multi-arch", "ltsc2022"),
+			expectedTolerations: []core.Toleration{windowsToleration},
+			expectedNodeSelector: map[string]string{core.LabelOSStable: "windows",
+				core.LabelWindowsBuild: ltsc2022},
+		},
+		{
+			name:          "image runs on some builds",
+			clusterBuilds: []string{ltsc2019, ltsc2022, "10.0.26100"},
+			pod: core.PodSpec{
+				Containers: []core.Container{{Name: "app", Image: "multi-arch"}},
+				Affinity: &core.Affinity{NodeAffinity: &core.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &core.NodeSelector{
+						NodeSelectorTerms: []core.NodeSelectorTerm{
+							{MatchExpressions: []core.NodeSelectorRequirement{{Key: "zone",
+								Operator: core.NodeSelectorOpIn, Values: []string{"a"}}}},
+							{MatchExpressions: []core.NodeSelectorRequirement{{Key: "zone",
+								Operator: core.NodeSelectorOpIn, Values: []string{"b"}}}},
+						},
+					},
+				}},
+			},
+			expectedTolerations:  []core.Toleration{windowsToleration},
+			expectedNodeSelector: map[string]string{core.LabelOSStable: "windows"},
+			expectedAffinity: &core.Affinity{NodeAffinity: &core.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &core.NodeSelector{
+					NodeSelectorTerms: []core.NodeSelectorTerm{
+						{MatchExpressions: []core.NodeSelectorRequirement{
+							{Key: "zone", Operator: core.NodeSelectorOpIn, Values: []string{"a"}},
+							{Key: core.LabelWindowsBuild, Operator: core.NodeSelectorOpIn,
+								Values: []string{ltsc2019, ltsc2022}},
+						}},
+						{MatchExpressions: []core.NodeSelectorRequirement{
+							{Key: "zone", Operator: core.NodeSelectorOpIn, Values: []string{"b"}},
+							{Key: core.LabelWindowsBuild, Operator: core.NodeSelectorOpIn,
+								Values: []string{ltsc2019, ltsc2022}},
+						}},
+					},
+				},
+			}},
+		},
+		{
+			name:                  "image runs on no build",
+			clusterBuilds:         []string{ltsc2022},
+			pod:                   podSpec("ltsc2019", "linux"),
+			expectedTolerations:   []core.Toleration{windowsToleration},
+			expectedNodeSelector:  map[string]string{core.LabelOSStable: "windows"},
+			expectedWarningsCount: 2,
+		},
+		{
+			name:          "selected build incompatible with image",
+			clusterBuilds: []string{ltsc2019, ltsc2022},
+			pod: core.PodSpec{
+				Containers:   []core.Container{{Name: "app", Image: "ltsc2022"}},
+				NodeSelector: map[string]string{core.LabelWindowsBuild: ltsc2019},
+			},
+			expectedTolerations: []core.Toleration{windowsToleration},
+			expectedNodeSelector: map[string]string{core.LabelOSStable: "windows",
+				core.LabelWindowsBuild: ltsc2019},
+			expectedWarningsCount: 1,
+		},
+		{
+			name:                 "unknown image",
+			clusterBuilds:        []string{ltsc2019, ltsc2022},
+			pod:                  podSpec("unknown", "ltsc2019"),
+			expectedTolerations:  []core.Toleration{windowsToleration},
+			expectedNodeSelector: map[string]string{core.LabelOSStable: "windows", core.LabelWindowsBuild: ltsc2019},
+		},
+		{
+			name:          "taint already tolerated",
+			clusterBuilds: []string{ltsc2022},
+			pod: core.PodSpec{
+				Containers:  []core.Container{{Name: "app", Image: "ltsc2022"}},
+				Tolerations: []core.Toleration{{Operator: core.TolerationOpExists}},
+			},
+			expectedTolerations:  []core.Toleration{{Operator: core.TolerationOpExists}},
+			expectedNodeSelector: map[string]string{core.LabelOSStable: "windows"},
+		},
+		{
+			name:          "conflicting OS selector",
+			clusterBuilds: []string{ltsc2022},
+			pod: core.PodSpec{
+				Containers:   []core.Container{{Name: "app", Image: "ltsc2022"}},
+				NodeSelector: map[string]string{core.LabelOSStable: "linux"},
+			},
+			expectedTolerations:   []core.Toleration{windowsToleration},
+			expectedNodeSelector:  map[string]string{core.LabelOSStable: "linux"},
+			expectedWarningsCount: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var objects []client.Object
+			for i, build := range test.clusterBuilds {
+				objects = append(objects, &core.Node{ObjectMeta: meta.ObjectMeta{Name: fmt.Sprintf("node-%d", i),
+					Labels: map[string]string{core.LabelOSStable: "windows", core.LabelWindowsBuild: build}}})
+			}
+			objects = append(objects, &core.Node{ObjectMeta: meta.ObjectMeta{Name: "linux",
+				Labels: map[string]string{core.LabelOSStable: "linux"}}})
+			c := fake.NewClientBuilder().WithObjects(objects...).Build()
+			mutator := &PodMutator{
+				client:       c,
+				secretReader: c,
+				inspector:    inspector,
+				log:          logr.Discard(),
+			}
+			pod := &core.Pod{Spec: test.pod}
+
+			warnings, err := mutator.mutate(context.Background(), pod, "default")
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedTolerations, pod.Spec.Tolerations)
+			assert.Equal(t, test.expectedNodeSelector, pod.Spec.NodeSelector)
+			assert.Equal(t, test.expectedAffinity, pod.Spec.Affinity)
+			assert.Len(t, warnings, test.expectedWarningsCount, warnings)
+		})
+	}
+}
+
+func TestPodMutatorKeyring(t *testing.T) {
+	pullSecret := func(namespace, name, key, contents string) *core.Secret {
+		return &core.Secret{ObjectMeta: meta.ObjectMeta{Name: name, Namespace: namespace},
+			Data: map[string][]byte{key: []byte(contents)}}
+	}
+	c := fake.NewClientBuilder().WithObjects(
+		pullSecret("default", "json", core.DockerConfigJsonKey,
+			`{"auths":{"registry.example.com":{"username":"pod","password":"json"}}}`),
+		pullSecret("default", "legacy", core.DockerConfigKey,
+			`{"legacy.example.com":{"username":"pod","password":"legacy"}}`),
+		pullSecret("other", "json", core.DockerConfigJsonKey,
+			`{"auths":{"other.example.com":{"username":"other","password":"other"}}}`),
+		pullSecret(registries.GlobalPullSecretNamespace, registries.GlobalPullSecretName, core.DockerConfigJsonKey,
+			`{"auths":{"global.example.com":{"username":"global","password":"global"}}}`),
+	).Build()
+	mutator := &PodMutator{client: c, secretReader: c, log: logr.Discard()}
+
+	keyring := mutator.keyring(context.Background(), "default", []core.LocalObjectReference{{Name: "json"},
+		{Name: "legacy"}, {Name: "missing"}})
+	credentials, found := keyring.Lookup("registry.example.com/app")
+	require.True(t, found)
+	assert.Equal(t, "json", credentials[0].Password)
+	credentials, found = keyring.Lookup("legacy.example.com/app")
+	require.True(t, found)
+	assert.Equal(t, "legacy", credentials[0].Password)
+	_, found = keyring.Lookup("other.example.com/app")
+	assert.False(t, found, "secrets of other namespaces must not be used")
+	_, found = keyring.Lookup("global.example.com/app")
+	assert.False(t, found, "the global pull secret must not be used")
+}
+
+func TestGeneratePodMutatorConfiguration(t *testing.T) {
+	port := int32(9443)
+	olmWebhook := admissionregistration.WebhookClientConfig{
+		Service: &admissionregistration.ServiceReference{Namespace: namespace,
+			Name: "windows-machine-config-operator-service", Port: &port},
+		CABundle: []byte("ca"),
+	}
+
+	configuration, err := GeneratePodMutatorConfiguration(olmWebhook, namespace)
+	require.NoError(t, err)
+	assert.Equal(t, PodMutatorName, configuration.GetName())
+	require.Len(t, configuration.Webhooks, 1)
+	webhook := configuration.Webhooks[0]
+	require.NotNil(t, webhook.ClientConfig.Service)
+	assert.Equal(t, olmWebhook.Service.Name, webhook.ClientConfig.Service.Name)
+	assert.Equal(t, port, *webhook.ClientConfig.Service.Port)
+	assert.Equal(t, PodMutatorPath, *webhook.ClientConfig.Service.Path)
+	assert.Equal(t, olmWebhook.CABundle, webhook.ClientConfig.CABundle)
+	assert.Nil(t, olmWebhook.Service.Path, "the given client config must not be modified")
+	assert.Equal(t, admissionregistration.Ignore, *webhook.FailurePolicy)
+	require.NotNil(t, webhook.NamespaceSelector)
+	assert.Contains(t, webhook.NamespaceSelector.MatchExpressions, meta.LabelSelectorRequirement{
+		Key: core.LabelMetadataName, Operator: meta.LabelSelectorOpNotIn, Values: []string{namespace}})
+
+	_, err = GeneratePodMutatorConfiguration(admissionregistration.WebhookClientConfig{CABundle: []byte("ca")},
+		namespace)
+	assert.Error(t, err)
+}
+
+// podSpec returns a pod spec with a container for each of the given images
+func podSpec(images ...string) core.PodSpec {
+	spec := core.PodSpec{}
+	for i, image := range images {
+		spec.Containers = append(spec.Containers, core.Container{Name: fmt.Sprintf("c%d", i), Image: image})
+	}
+	return spec
+}
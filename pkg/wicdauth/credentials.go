@@ -0,0 +1,250 @@
+package wicdauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	k8sretry "k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+)
+
+const (
+	// CredentialsConfigMap is the ConfigMap in the WMCO namespace holding the IDs of the WICD credentials each node is
+	// allowed to use, as a comma-separated list keyed by node name. Requests made with any other credentials are denied
+	// by the NodeRestrictionPolicy.
+	CredentialsConfigMap = "windows-wicd-credentials"
+	// CredentialAnnotation is applied to Windows nodes by WICD, holding the ID of the credentials WICD is using
+	CredentialAnnotation = "windowsmachineconfig.openshift.io/wicd-credential-id"
+	// RotationStatusAnnotation is applied to Windows nodes by WMCO, holding the RotationStatus of the node's WICD
+	// credentials
+	RotationStatusAnnotation = "windowsmachineconfig.openshift.io/wicd-credential-rotation"
+	// RotationRequestAnnotation can be applied to a Windows node to request the rotation of its WICD credentials. WMCO
+	// removes it once the credentials have been rotated.
+	RotationRequestAnnotation = "windowsmachineconfig.openshift.io/rotate-wicd-credentials"
+)
+
+// RotationPhase is the stage the rotation of a node's WICD credentials is at
+type RotationPhase string
+
+const (
+	// RotationDistributed indicates new credentials have been written to the instance, and WICD has yet to be verified
+	// to be using them. Both the new and current credentials are allowed.
+	RotationDistributed RotationPhase = "Distributed"
+	// RotationComplete indicates WICD is using the most recently issued credentials, and all others have been revoked
+	RotationComplete RotationPhase = "Complete"
+	// RotationFailed indicates the most recent rotation failed, and WICD continues to use its current credentials
+	RotationFailed RotationPhase = "Failed"
+)
+
+// RotationStatus is the status of the rotation of a node's WICD credentials
+type RotationStatus struct {
+	// Phase is the stage the most recent rotation is at
+	Phase RotationPhase `json:"phase"`
+	// CredentialID is the ID of the credentials WICD has been verified to use, empty if unknown
+	CredentialID string `json:"credentialID,omitempty"`
+	// ExpiresAt is when the credentials WICD has been verified to use expire
+	ExpiresAt meta.Time `json:"expiresAt,omitempty"`
+	// PendingCredentialID is the ID of the credentials distributed to the instance, which WICD has yet to be verified
+	// to use
+	PendingCredentialID string `json:"pendingCredentialID,omitempty"`
+	// PendingExpiresAt is when the pending credentials expire
+	PendingExpiresAt meta.Time `json:"pendingExpiresAt,omitempty"`
+	// Message describes the reason for a failed rotation
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is when the phase last changed
+	LastTransitionTime meta.Time `json:"lastTransitionTime"`
+}
+
+// NewRotationStatus returns the status of a node whose WICD has been configured with the credentials with the given
+// claims
+func NewRotationStatus(claims *Claims) RotationStatus {
+	return RotationStatus{
+		Phase:              RotationComplete,
+		CredentialID:       claims.ID,
+		ExpiresAt:          meta.NewTime(claims.Expiry),
+		LastTransitionTime: meta.Now(),
+	}
+}
+
+// Distributed returns the status once the credentials with the given claims have been distributed to the instance
+func (s RotationStatus) Distributed(claims *Claims) RotationStatus {
+	s.Phase = RotationDistributed
+	s.PendingCredentialID = claims.ID
+	s.PendingExpiresAt = meta.NewTime(claims.Expiry)
+	s.Message = ""
+	s.LastTransitionTime = meta.Now()
+	return s
+}
+
+// Verified returns the status once WICD has been verified to use the pending credentials
+func (s RotationStatus) Verified() RotationStatus {
+	s.Phase = RotationComplete
+	s.CredentialID = s.PendingCredentialID
+	s.ExpiresAt = s.PendingExpiresAt
+	s.PendingCredentialID = ""
+	s.PendingExpiresAt = meta.Time{}
+	s.Message = ""
+	s.LastTransitionTime = meta.Now()
+	return s
+}
+
+// Failed returns the status once a rotation has failed for the given reason, discarding any pending credentials
+func (s RotationStatus) Failed(message string) RotationStatus {
+	s.Phase = RotationFailed
+	s.PendingCredentialID = ""
+	s.PendingExpiresAt = meta.Time{}
+	s.Message = message
+	s.LastTransitionTime = meta.Now()
+	return s
+}
+
+// RotationDue returns the time at which the credentials WICD is using are close enough to expiry to be rotated. The
+// zero time is returned if their expiry is unknown.
+func (s RotationStatus) RotationDue() time.Time {
+	if s.ExpiresAt.IsZero() {
+		return time.Time{}
+	}
+	return s.ExpiresAt.Add(-time.Duration(float64(TokenLifetime) * RotationFraction))
+}
+
+// Marshal returns the RotationStatus as the value of the RotationStatusAnnotation
+func (s RotationStatus) Marshal() (string, error) {
+	out, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// GetRotationStatus returns the RotationStatus recorded on the given node, nil if there is none
+func GetRotationStatus(node *core.Node) (*RotationStatus, error) {
+	value, present := node.GetAnnotations()[RotationStatusAnnotation]
+	if !present {
+		return nil, nil
+	}
+	status := &RotationStatus{}
+	if err := json.Unmarshal([]byte(value), status); err != nil {
+		return nil, fmt.Errorf("unable to parse node %s annotation %s: %w", node.GetName(), RotationStatusAnnotation,
+			err)
+	}
+	return status, nil
+}
+
+// ApplyRotationStatus records the given RotationStatus on the given node
+func ApplyRotationStatus(ctx context.Context, c client.Client, node *core.Node, status RotationStatus) error {
+	value, err := status.Marshal()
+	if err != nil {
+		return err
+	}
+	if err = metadata.ApplyLabelsAndAnnotations(ctx, c, *node, nil,
+		map[string]string{RotationStatusAnnotation: value}); err != nil {
+		return fmt.Errorf("error recording WICD credential rotation status on node %s: %w", node.GetName(), err)
+	}
+	return nil
+}
+
+// RemoveRotationRequest removes the RotationRequestAnnotation from the given node, if present
+func RemoveRotationRequest(ctx context.Context, c client.Client, node *core.Node) error {
+	if _, present := node.GetAnnotations()[RotationRequestAnnotation]; !present {
+		return nil
+	}
+	patchData, err := metadata.GenerateRemovePatch([]string{}, []string{RotationRequestAnnotation})
+	if err != nil {
+		return fmt.Errorf("error creating rotation request annotation remove request: %w", err)
+	}
+	if err = c.Patch(ctx, node, client.RawPatch(kubeTypes.JSONPatchType, patchData)); err != nil {
+		return fmt.Errorf("error removing rotation request annotation from node %s: %w", node.GetName(), err)
+	}
+	return nil
+}
+
+// AllowedCredentials returns the IDs of the credentials the given node is allowed to use, according to the given
+// CredentialsConfigMap
+func AllowedCredentials(cm *core.ConfigMap, nodeName string) []string {
+	value := cm.Data[nodeName]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// SetAllowedCredentials sets the credentials the given node is allowed to use to the given IDs, revoking all others. If
+// no IDs are given, the node's entry is removed.
+func SetAllowedCredentials(ctx context.Context, c client.Client, namespace, nodeName string, ids ...string) error {
+	return updateAllowedCredentials(ctx, c, namespace, nodeName, func([]string) []string {
+		return ids
+	})
+}
+
+// AllowCredential allows the given node to use the credentials with the given ID, in addition to those it is already
+// allowed to use
+func AllowCredential(ctx context.Context, c client.Client, namespace, nodeName, id string) error {
+	return updateAllowedCredentials(ctx, c, namespace, nodeName, func(current []string) []string {
+		if slices.Contains(current, id) {
+			return current
+		}
+		return append(current, id)
+	})
+}
+
+// RevokeCredential revokes the credentials with the given ID from the given node, leaving any others it is allowed to
+// use in place
+func RevokeCredential(ctx context.Context, c client.Client, namespace, nodeName, id string) error {
+	return updateAllowedCredentials(ctx, c, namespace, nodeName, func(current []string) []string {
+		return slices.DeleteFunc(current, func(allowed string) bool { return allowed == id })
+	})
+}
+
+// EnsureCredentialsConfigMap creates the CredentialsConfigMap in the given namespace if it does not exist
+func EnsureCredentialsConfigMap(ctx context.Context, c client.Client, namespace string) error {
+	cm := &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: CredentialsConfigMap, Namespace: namespace}}
+	if err := c.Create(ctx, cm); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("unable to create ConfigMap %s/%s: %w", namespace, CredentialsConfigMap, err)
+	}
+	return nil
+}
+
+// updateAllowedCredentials sets the credentials the given node is allowed to use to the result of the given function,
+// which is passed those currently allowed. The CredentialsConfigMap is created if it does not exist.
+func updateAllowedCredentials(ctx context.Context, c client.Client, namespace, nodeName string,
+	update func([]string) []string) error {
+	key := kubeTypes.NamespacedName{Namespace: namespace, Name: CredentialsConfigMap}
+	// the cached ConfigMap may be stale, in which case the update conflicts or the ConfigMap already exists
+	retriable := func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}
+	return k8sretry.OnError(k8sretry.DefaultBackoff, retriable, func() error {
+		cm := &core.ConfigMap{}
+		err := c.Get(ctx, key, cm)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		exists := err == nil
+		ids := update(AllowedCredentials(cm, nodeName))
+		if !exists {
+			cm = &core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+		}
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		if len(ids) == 0 {
+			delete(cm.Data, nodeName)
+		} else {
+			cm.Data[nodeName] = strings.Join(ids, ",")
+		}
+		if !exists {
+			return c.Create(ctx, cm)
+		}
+		return c.Update(ctx, cm)
+	})
+}
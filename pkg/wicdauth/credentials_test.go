@@ -0,0 +1,105 @@
+package wicdauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeTypes "k8s.io/apimachinery/pkg/types"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRotationStatus(t *testing.T) {
+	now := time.Now()
+	current := &Claims{ID: "JTI=current", IssuedAt: now, Expiry: now.Add(TokenLifetime)}
+	pending := &Claims{ID: "JTI=pending", IssuedAt: now, Expiry: now.Add(TokenLifetime)}
+
+	status := NewRotationStatus(current)
+	assert.Equal(t, RotationComplete, status.Phase)
+	assert.Equal(t, current.ID, status.CredentialID)
+
+	status = status.Distributed(pending)
+	assert.Equal(t, RotationDistributed, status.Phase)
+	assert.Equal(t, current.ID, status.CredentialID)
+	assert.Equal(t, pending.ID, status.PendingCredentialID)
+
+	failed := status.Failed("unreachable")
+	assert.Equal(t, RotationFailed, failed.Phase)
+	assert.Equal(t, current.ID, failed.CredentialID)
+	assert.Empty(t, failed.PendingCredentialID)
+	assert.Equal(t, "unreachable", failed.Message)
+
+	status = status.Verified()
+	assert.Equal(t, RotationComplete, status.Phase)
+	assert.Equal(t, pending.ID, status.CredentialID)
+	assert.True(t, status.ExpiresAt.Time.Equal(pending.Expiry))
+	assert.Empty(t, status.PendingCredentialID)
+}
+
+func TestRotationDue(t *testing.T) {
+	assert.True(t, RotationStatus{}.RotationDue().IsZero())
+
+	expiry := time.Unix(1700000000, 0)
+	status := RotationStatus{ExpiresAt: meta.NewTime(expiry)}
+	assert.True(t, status.RotationDue().Equal(expiry.Add(-time.Hour)))
+}
+
+func TestGetRotationStatus(t *testing.T) {
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "winnode"}}
+	status, err := GetRotationStatus(node)
+	require.NoError(t, err)
+	assert.Nil(t, status)
+
+	value, err := RotationStatus{Phase: RotationFailed, Message: "unreachable"}.Marshal()
+	require.NoError(t, err)
+	node.Annotations = map[string]string{RotationStatusAnnotation: value}
+	status, err = GetRotationStatus(node)
+	require.NoError(t, err)
+	require.NotNil(t, status)
+	assert.Equal(t, RotationFailed, status.Phase)
+	assert.Equal(t, "unreachable", status.Message)
+
+	node.Annotations[RotationStatusAnnotation] = "invalid"
+	_, err = GetRotationStatus(node)
+	assert.Error(t, err)
+}
+
+func TestAllowedCredentials(t *testing.T) {
+	ctx := context.Background()
+	namespace := "wmco-namespace"
+	c := clientfake.NewClientBuilder().Build()
+	key := kubeTypes.NamespacedName{Namespace: namespace, Name: CredentialsConfigMap}
+	get := func(nodeName string) []string {
+		cm := &core.ConfigMap{}
+		require.NoError(t, c.Get(ctx, key, cm))
+		return AllowedCredentials(cm, nodeName)
+	}
+
+	// the ConfigMap is created if it does not exist
+	require.NoError(t, AllowCredential(ctx, c, namespace, "winnode", "JTI=a"))
+	assert.Equal(t, []string{"JTI=a"}, get("winnode"))
+
+	require.NoError(t, AllowCredential(ctx, c, namespace, "winnode", "JTI=b"))
+	require.NoError(t, AllowCredential(ctx, c, namespace, "winnode", "JTI=b"))
+	require.NoError(t, AllowCredential(ctx, c, namespace, "other", "JTI=c"))
+	assert.Equal(t, []string{"JTI=a", "JTI=b"}, get("winnode"))
+	assert.Equal(t, []string{"JTI=c"}, get("other"))
+
+	require.NoError(t, RevokeCredential(ctx, c, namespace, "winnode", "JTI=a"))
+	assert.Equal(t, []string{"JTI=b"}, get("winnode"))
+
+	require.NoError(t, SetAllowedCredentials(ctx, c, namespace, "winnode", "JTI=d"))
+	assert.Equal(t, []string{"JTI=d"}, get("winnode"))
+
+	require.NoError(t, SetAllowedCredentials(ctx, c, namespace, "winnode"))
+	assert.Nil(t, get("winnode"))
+	assert.Equal(t, []string{"JTI=c"}, get("other"))
+
+	// creating the ConfigMap must not reset the credentials already allowed
+	require.NoError(t, EnsureCredentialsConfigMap(ctx, c, namespace))
+	assert.Equal(t, []string{"JTI=c"}, get("other"))
+}
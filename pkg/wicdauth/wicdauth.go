@@ -0,0 +1,249 @@
+package wicdauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	admissionregistration "k8s.io/api/admissionregistration/v1"
+	authentication "k8s.io/api/authentication/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/certexpiry"
+	"github.com/openshift/windows-machine-config-operator/pkg/filesets"
+	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
+	"github.com/openshift/windows-machine-config-operator/pkg/prepull"
+	"github.com/openshift/windows-machine-config-operator/pkg/windows"
+)
+
+const (
+	// TokenLifetime is the validity period of the node-bound tokens WICD authenticates with. Revocation only applies to
+	// changes to nodes, so a revoked token can still be used to read until it expires. The lifetime is kept short so
+	// that a token rotated on schedule is readable for at most an hour after it is revoked.
+	TokenLifetime = 3 * time.Hour
+	// BootstrapTokenLifetime is the validity period of the tokens given to instances which do not have a node yet. These
+	// tokens are only used to bootstrap the node, and do not permit any changes to nodes.
+	BootstrapTokenLifetime = time.Hour
+	// RotationFraction is the fraction of a token's lifetime remaining at which WMCO rotates it. This leaves WMCO a
+	// third of the token's lifetime to distribute new credentials, should the instance be unreachable.
+	RotationFraction = 1.0 / 3
+	// RootCAConfigMap is the ConfigMap published in every namespace holding the CA bundle of the API server
+	RootCAConfigMap = "kube-root-ca.crt"
+	// RootCAKey is the RootCAConfigMap data key holding the CA bundle
+	RootCAKey = "ca.crt"
+	// PolicyName is the name of the ValidatingAdmissionPolicy, and its binding, restricting the changes WICD can make
+	PolicyName = "windows-instance-config-daemon-node-restriction"
+	// nodeNameExtra is the user info extra key populated by the API server with the name of the node a service account
+	// token is bound to
+	nodeNameExtra = "authentication.kubernetes.io/node-name"
+	// credentialIDExtra is the user info extra key populated by the API server with the ID of the credentials a
+	// request was authenticated with
+	credentialIDExtra = "authentication.kubernetes.io/credential-id"
+)
+
+// wicdAnnotations returns the node annotations WICD sets, and the prefixes of those which are set per file set
+func wicdAnnotations() ([]string, []string) {
+	return []string{metadata.VersionAnnotation, metadata.RebootAnnotation, prepull.StatusAnnotation,
+		certexpiry.Annotation, CredentialAnnotation}, []string{filesets.AppliedAnnotationPrefix}
+}
+
+// NewTokenRequest returns a request for a WICD ServiceAccount token bound to the given node. The API server associates
+// the node with the requests made with the token, and invalidates the token once the node is deleted. If node is nil,
+// the request is for a short-lived bootstrap token which is not bound to any node.
+func NewTokenRequest(node *core.Node) *authentication.TokenRequest {
+	if node == nil {
+		expiration := int64(BootstrapTokenLifetime.Seconds())
+		return &authentication.TokenRequest{Spec: authentication.TokenRequestSpec{ExpirationSeconds: &expiration}}
+	}
+	expiration := int64(TokenLifetime.Seconds())
+	return &authentication.TokenRequest{
+		Spec: authentication.TokenRequestSpec{
+			ExpirationSeconds: &expiration,
+			BoundObjectRef: &authentication.BoundObjectReference{
+				Kind:       "Node",
+				APIVersion: "v1",
+				Name:       node.GetName(),
+				UID:        node.GetUID(),
+			},
+		},
+	}
+}
+
+// Claims holds the claims of a ServiceAccount token relevant to WICD
+type Claims struct {
+	// ID identifies the token, in the form the API server reports as the credential ID of the requests made with it
+	ID string
+	// Expiry is when the token expires
+	Expiry time.Time
+	// IssuedAt is when the token was issued
+	IssuedAt time.Time
+	// NodeName is the name of the node the token is bound to, empty if the token is not bound to a node
+	NodeName string
+}
+
+// ParseClaims returns the claims of the given ServiceAccount token. The token's signature is not verified, as the
+// claims are only used to track the token, not to authenticate it.
+func ParseClaims(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode token payload: %w", err)
+	}
+	var claims struct {
+		ID         string `json:"jti"`
+		Expiry     int64  `json:"exp"`
+		IssuedAt   int64  `json:"iat"`
+		Kubernetes struct {
+			Node *struct {
+				Name string `json:"name"`
+			} `json:"node"`
+		} `json:"kubernetes.io"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("unable to parse token claims: %w", err)
+	}
+	if claims.Expiry == 0 {
+		return nil, fmt.Errorf("token has no expiry")
+	}
+	if claims.ID == "" {
+		return nil, fmt.Errorf("token has no ID")
+	}
+	parsed := &Claims{ID: "JTI=" + claims.ID, Expiry: time.Unix(claims.Expiry, 0),
+		IssuedAt: time.Unix(claims.IssuedAt, 0)}
+	if claims.Kubernetes.Node != nil {
+		parsed.NodeName = claims.Kubernetes.Node.Name
+	}
+	return parsed, nil
+}
+
+// KubeconfigToken returns the token used by the current context of the given kubeconfig
+func KubeconfigToken(kubeconfig []byte) (string, error) {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return "", fmt.Errorf("unable to load kubeconfig: %w", err)
+	}
+	kubeContext, present := config.Contexts[config.CurrentContext]
+	if !present {
+		return "", fmt.Errorf("kubeconfig current context %q not found", config.CurrentContext)
+	}
+	authInfo, present := config.AuthInfos[kubeContext.AuthInfo]
+	if !present || authInfo.Token == "" {
+		return "", fmt.Errorf("kubeconfig user %q has no token", kubeContext.AuthInfo)
+	}
+	return authInfo.Token, nil
+}
+
+// NodeRestrictionPolicy returns the ValidatingAdmissionPolicy, and its binding, which restrict the WICD ServiceAccount
+// of the given namespace to:
+//   - modifying only the node its token is bound to
+//   - using only the credentials allowed for that node in the CredentialsConfigMap
+//   - modifying only the WICD-managed annotations of that node
+//   - reporting only the ID of the credentials it is using in the CredentialAnnotation
+//
+// This limits the impact of a compromised Windows instance to its own node, despite the cluster-wide permissions WICD
+// requires to find its node, and allows revoking the credentials of a node before they expire.
+func NodeRestrictionPolicy(namespace string) (*admissionregistration.ValidatingAdmissionPolicy,
+	*admissionregistration.ValidatingAdmissionPolicyBinding) {
+	failurePolicy := admissionregistration.Fail
+	paramNotFoundAction := admissionregistration.DenyAction
+	names, prefixes := wicdAnnotations()
+	// an annotation is managed by WICD if it is one of the WICD annotations, or starts with one of the prefixes
+	isWICDAnnotation := fmt.Sprintf("(k in %s || %s.exists(p, k.startsWith(p)))", celList(names),
+		celList(prefixes))
+
+	policy := &admissionregistration.ValidatingAdmissionPolicy{
+		ObjectMeta: meta.ObjectMeta{Name: PolicyName},
+		Spec: admissionregistration.ValidatingAdmissionPolicySpec{
+			FailurePolicy: &failurePolicy,
+			ParamKind:     &admissionregistration.ParamKind{APIVersion: "v1", Kind: "ConfigMap"},
+			MatchConstraints: &admissionregistration.MatchResources{
+				ResourceRules: []admissionregistration.NamedRuleWithOperations{{
+					RuleWithOperations: admissionregistration.RuleWithOperations{
+						Operations: []admissionregistration.OperationType{admissionregistration.Update},
+						Rule: admissionregistration.Rule{
+							APIGroups:   []string{""},
+							APIVersions: []string{"v1"},
+							Resources:   []string{"nodes", "nodes/status"},
+						},
+					},
+				}},
+			},
+			MatchConditions: []admissionregistration.MatchCondition{{
+				Name: "windows-instance-config-daemon",
+				Expression: fmt.Sprintf("request.userInfo.username == 'system:serviceaccount:%s:%s'", namespace,
+					windows.WicdServiceName),
+			}},
+			Variables: []admissionregistration.Variable{
+				{Name: "nodeName", Expression: userExtraExpression(nodeNameExtra)},
+				{Name: "credentialID", Expression: userExtraExpression(credentialIDExtra)},
+				{
+					Name: "allowedCredentials",
+					Expression: "variables.nodeName != '' && variables.nodeName in params.?data.orValue({}) ? " +
+						"params.data[variables.nodeName].split(',') : []",
+				},
+				{Name: "annotations", Expression: "object.metadata.?annotations.orValue({})"},
+				{Name: "oldAnnotations", Expression: "oldObject.metadata.?annotations.orValue({})"},
+			},
+			Validations: []admissionregistration.Validation{
+				{
+					Expression: "variables.nodeName != '' && object.metadata.name == variables.nodeName",
+					Message:    "WICD may only modify the node its credentials are bound to",
+				},
+				{
+					Expression: "variables.credentialID != '' && variables.credentialID in variables.allowedCredentials",
+					Message:    "WICD credentials have been revoked",
+				},
+				{
+					Expression: "request.subResource != '' || " +
+						"(object.spec == oldObject.spec && " +
+						"object.metadata.?labels.orValue({}) == oldObject.metadata.?labels.orValue({}) && " +
+						"variables.annotations.all(k, " + isWICDAnnotation + " || " +
+						"(k in variables.oldAnnotations && variables.oldAnnotations[k] == variables.annotations[k])) && " +
+						"variables.oldAnnotations.all(k, " + isWICDAnnotation + " || k in variables.annotations))",
+					Message: "WICD may only modify the WICD-managed annotations of its node",
+				},
+				{
+					Expression: fmt.Sprintf("!(%[1]q in variables.annotations) || "+
+						"variables.oldAnnotations[?%[1]q] == variables.annotations[?%[1]q] || "+
+						"variables.annotations[%[1]q] == variables.credentialID", CredentialAnnotation),
+					Message: "WICD may only report the ID of the credentials it is using",
+				},
+			},
+		},
+	}
+	binding := &admissionregistration.ValidatingAdmissionPolicyBinding{
+		ObjectMeta: meta.ObjectMeta{Name: PolicyName},
+		Spec: admissionregistration.ValidatingAdmissionPolicyBindingSpec{
+			PolicyName: PolicyName,
+			ParamRef: &admissionregistration.ParamRef{
+				Name:                    CredentialsConfigMap,
+				Namespace:               namespace,
+				ParameterNotFoundAction: &paramNotFoundAction,
+			},
+			ValidationActions: []admissionregistration.ValidationAction{admissionregistration.Deny},
+		},
+	}
+	return policy, binding
+}
+
+// userExtraExpression returns the CEL expression evaluating to the first value of the given user info extra key of
+// the request, or an empty string if the key is not present
+func userExtraExpression(key string) string {
+	return fmt.Sprintf("%q in request.userInfo.extra ? request.userInfo.extra[%q][0] : ''", key, key)
+}
+
+// celList returns the CEL list literal of the given strings
+func celList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
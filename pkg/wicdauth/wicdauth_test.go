@@ -0,0 +1,103 @@
+package wicdauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientcmdv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+)
+
+// newToken returns an unsigned ServiceAccount token with the given claims, bound to the given node if not empty
+func newToken(t *testing.T, issuedAt, expiry time.Time, nodeName string) string {
+	claims := map[string]interface{}{"jti": "1234", "iat": issuedAt.Unix(), "exp": expiry.Unix()}
+	if nodeName != "" {
+		claims["kubernetes.io"] = map[string]interface{}{"node": map[string]string{"name": nodeName}}
+	}
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return strings.Join([]string{"header", base64.RawURLEncoding.EncodeToString(payload), "signature"}, ".")
+}
+
+func TestNewTokenRequest(t *testing.T) {
+	request := NewTokenRequest(nil)
+	assert.Nil(t, request.Spec.BoundObjectRef)
+	assert.Equal(t, int64(BootstrapTokenLifetime.Seconds()), *request.Spec.ExpirationSeconds)
+
+	node := &core.Node{ObjectMeta: meta.ObjectMeta{Name: "winnode", UID: "1234"}}
+	request = NewTokenRequest(node)
+	require.NotNil(t, request.Spec.BoundObjectRef)
+	assert.Equal(t, "Node", request.Spec.BoundObjectRef.Kind)
+	assert.Equal(t, "winnode", request.Spec.BoundObjectRef.Name)
+	assert.Equal(t, node.GetUID(), request.Spec.BoundObjectRef.UID)
+	assert.Equal(t, int64(TokenLifetime.Seconds()), *request.Spec.ExpirationSeconds)
+}
+
+func TestParseClaims(t *testing.T) {
+	issuedAt := time.Unix(1700000000, 0)
+	claims, err := ParseClaims(newToken(t, issuedAt, issuedAt.Add(TokenLifetime), "winnode"))
+	require.NoError(t, err)
+	assert.Equal(t, "JTI=1234", claims.ID)
+	assert.Equal(t, "winnode", claims.NodeName)
+	assert.True(t, claims.Expiry.Equal(issuedAt.Add(TokenLifetime)))
+
+	claims, err = ParseClaims(newToken(t, issuedAt, issuedAt.Add(BootstrapTokenLifetime), ""))
+	require.NoError(t, err)
+	assert.Empty(t, claims.NodeName)
+
+	_, err = ParseClaims("not-a-token")
+	assert.Error(t, err)
+	_, err = ParseClaims("header.!!!.signature")
+	assert.Error(t, err)
+}
+
+func TestKubeconfigToken(t *testing.T) {
+	kubeconfig, err := json.Marshal(clientcmdv1.Config{
+		Clusters: []clientcmdv1.NamedCluster{{Name: "local",
+			Cluster: clientcmdv1.Cluster{Server: "https://api.example.com:6443"}}},
+		AuthInfos: []clientcmdv1.NamedAuthInfo{{Name: "wicd", AuthInfo: clientcmdv1.AuthInfo{Token: "token"}}},
+		Contexts: []clientcmdv1.NamedContext{{Name: "wicd",
+			Context: clientcmdv1.Context{Cluster: "local", AuthInfo: "wicd"}}},
+		CurrentContext: "wicd",
+	})
+	require.NoError(t, err)
+
+	token, err := KubeconfigToken(kubeconfig)
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	_, err = KubeconfigToken([]byte("{}"))
+	assert.Error(t, err)
+}
+
+func TestNodeRestrictionPolicy(t *testing.T) {
+	policy, binding := NodeRestrictionPolicy("wmco-namespace")
+	assert.Equal(t, PolicyName, binding.Spec.PolicyName)
+	require.Len(t, policy.Spec.MatchConditions, 1)
+	assert.Equal(t, "request.userInfo.username == 'system:serviceaccount:wmco-namespace:windows-instance-config-daemon'",
+		policy.Spec.MatchConditions[0].Expression)
+	require.NotNil(t, binding.Spec.ParamRef)
+	assert.Equal(t, CredentialsConfigMap, binding.Spec.ParamRef.Name)
+	assert.Equal(t, "wmco-namespace", binding.Spec.ParamRef.Namespace)
+	require.Len(t, policy.Spec.Validations, 4)
+	assert.Contains(t, policy.Spec.Validations[1].Expression, "variables.allowedCredentials")
+	annotationsRule := policy.Spec.Validations[2].Expression
+	assert.Contains(t, annotationsRule, `"windowsmachineconfig.openshift.io/version"`)
+	assert.Contains(t, annotationsRule, `"windowsmachineconfig.openshift.io/applied-file-set-"`)
+	// annotations owned by WMCO must not be changeable by WICD
+	assert.NotContains(t, annotationsRule, "desired-version")
+	assert.NotContains(t, annotationsRule, "pub-key-hash")
+	assert.NotContains(t, annotationsRule, RotationStatusAnnotation)
+	assert.NotContains(t, annotationsRule, RotationRequestAnnotation)
+}
+
+func TestCELList(t *testing.T) {
+	assert.Equal(t, `["a", "b"]`, celList([]string{"a", "b"}))
+	assert.Equal(t, "[]", celList(nil))
+}
@@ -2,6 +2,7 @@ package windows
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
@@ -13,6 +14,7 @@ import (
 	"golang.org/x/crypto/ssh"
 	"k8s.io/apimachinery/pkg/util/wait"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/audit"
 	"github.com/openshift/windows-machine-config-operator/pkg/retry"
 )
 
@@ -52,6 +54,8 @@ type sshConnectivity struct {
 	username string
 	// ipAddress is the VM's IP address
 	ipAddress string
+	// nodeName is the name of the VM's node, empty if the VM is not a node yet
+	nodeName string
 	// signer is used for authenticating against the VM
 	signer ssh.Signer
 	// sshClient is the client used to access the Windows VM via ssh
@@ -60,10 +64,12 @@ type sshConnectivity struct {
 }
 
 // newSshConnectivity returns an instance of sshConnectivity
-func newSshConnectivity(username, ipAddress string, signer ssh.Signer, logger logr.Logger) (connectivity, error) {
+func newSshConnectivity(username, ipAddress, nodeName string, signer ssh.Signer,
+	logger logr.Logger) (connectivity, error) {
 	c := &sshConnectivity{
 		username:  username,
 		ipAddress: ipAddress,
+		nodeName:  nodeName,
 		signer:    signer,
 		log:       logger,
 	}
@@ -108,11 +114,24 @@ func (c *sshConnectivity) init() error {
 	return nil
 }
 
-// run instantiates a new SSH session and runs the command on the VM and returns the combined stdout and stderr output
-func (c *sshConnectivity) run(cmd string) (string, error) {
+// run instantiates a new SSH session and runs the command on the VM and returns the combined stdout and stderr output.
+// The command is audited.
+func (c *sshConnectivity) run(cmd string) (out string, err error) {
 	if c.sshClient == nil {
 		return "", fmt.Errorf("run cannot be called with nil SSH client")
 	}
+	start := time.Now()
+	defer func() {
+		exitStatus := audit.UnknownExitStatus
+		var exitErr *ssh.ExitError
+		if err == nil {
+			exitStatus = 0
+		} else if errors.As(err, &exitErr) {
+			exitStatus = exitErr.ExitStatus()
+		}
+		audit.Log(c.auditRecord(start, audit.CommandOperation, err, audit.Record{Command: cmd,
+			ExitStatus: exitStatus}))
+	}()
 
 	session, err := c.sshClient.NewSession()
 	if err != nil {
@@ -126,8 +145,20 @@ func (c *sshConnectivity) run(cmd string) (string, error) {
 		}
 	}()
 
-	out, err := session.CombinedOutput(cmd)
-	return string(out), err
+	combinedOut, err := session.CombinedOutput(cmd)
+	return string(combinedOut), err
+}
+
+// auditRecord returns the given record completed with the details of an operation on the VM, started at the given
+// time and failed with the given error, if any
+func (c *sshConnectivity) auditRecord(start time.Time, operation audit.Operation, err error,
+	r audit.Record) audit.Record {
+	r.Time, r.Instance, r.Node, r.Operation = start, c.ipAddress, c.nodeName, operation
+	r.DurationMilliseconds = time.Since(start).Milliseconds()
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
 }
 
 func (c *sshConnectivity) createSFTPClient() (*sftp.Client, error) {
@@ -142,23 +173,35 @@ func (c *sshConnectivity) createSFTPClient() (*sftp.Client, error) {
 	return sftpClient, nil
 }
 
-func (c *sshConnectivity) transfer(sftpClient *sftp.Client, reader io.Reader, filename, remoteDir string) error {
+// transfer creates a file in the remote VM directory with the contents read from the given reader. The transfer is
+// audited, along with the checksum of the contents.
+func (c *sshConnectivity) transfer(sftpClient *sftp.Client, reader io.Reader, filename, remoteDir string) (err error) {
 	if sftpClient == nil {
 		return fmt.Errorf("transfer cannot be called with nil SFTP client")
 	}
+	remoteFile := remoteDir + "\\" + filename
+	start := time.Now()
+	checksum := sha256.New()
+	defer func() {
+		exitStatus := 0
+		if err != nil {
+			exitStatus = audit.UnknownExitStatus
+		}
+		audit.Log(c.auditRecord(start, audit.TransferOperation, err, audit.Record{Path: remoteFile,
+			SHA256: fmt.Sprintf("%x", checksum.Sum(nil)), ExitStatus: exitStatus}))
+	}()
 
 	// Create the destination directory, no-op if it already exists
 	if err := sftpClient.MkdirAll(remoteDir); err != nil {
 		return fmt.Errorf("error creating remote directory %s: %w", remoteDir, err)
 	}
 
-	remoteFile := remoteDir + "\\" + filename
 	dstFile, err := sftpClient.Create(remoteFile)
 	if err != nil {
 		return fmt.Errorf("error initializing %s file on Windows VM: %w", remoteFile, err)
 	}
 
-	_, err = io.Copy(dstFile, reader)
+	_, err = io.Copy(dstFile, io.TeeReader(reader, checksum))
 	if err != nil {
 		return fmt.Errorf("error copying %s to the Windows VM: %w", filename, err)
 	}
@@ -0,0 +1,94 @@
+package windows
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// Server2019Build is the build of Windows Server 2019 LTSC, as given by the node.kubernetes.io/windows-build label
+	Server2019Build = "10.0.17763"
+	// Server2022Build is the build of Windows Server 2022 LTSC, as given by the node.kubernetes.io/windows-build label
+	Server2022Build = "10.0.20348"
+	// getOSInfoCommand is the PowerShell command that outputs the OS build, update build revision and edition of the
+	// instance, separated by spaces. For example: 10.0.20348 2227 ServerDatacenter
+	getOSInfoCommand = "$v = [Environment]::OSVersion.Version; " +
+		"$cv = Get-ItemProperty 'HKLM:\\SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion'; " +
+		"($v.Major, $v.Minor, $v.Build -join '.') + ' ' + $cv.UBR + ' ' + $cv.EditionID"
+)
+
+// SupportedBuilds maps the Windows Server builds that WMCO is able to configure to their product names
+var SupportedBuilds = map[string]string{
+	Server2019Build: "Windows Server 2019",
+	Server2022Build: "Windows Server 2022",
+}
+
+// OSInfo describes the operating system running on a Windows instance
+type OSInfo struct {
+	// Build is the <major>.<minor>.<build> version of the OS, matching the format used by the
+	// node.kubernetes.io/windows-build label
+	Build string
+	// Revision is the update build revision of the OS, which increases as cumulative updates are installed
+	Revision string
+	// Edition is the edition ID of the OS, such as ServerDatacenter or ServerStandard
+	Edition string
+}
+
+// FullVersion returns the complete version of the OS, including the update build revision when known
+func (o *OSInfo) FullVersion() string {
+	if o.Revision == "" {
+		return o.Build
+	}
+	return o.Build + "." + o.Revision
+}
+
+// IsSupported returns true if the OS build is one that WMCO is able to configure
+func (o *OSInfo) IsSupported() bool {
+	_, ok := SupportedBuilds[o.Build]
+	return ok
+}
+
+// UnsupportedOSErr occurs when an instance is running a Windows build that WMCO cannot configure
+type UnsupportedOSErr struct {
+	osInfo OSInfo
+}
+
+func (e *UnsupportedOSErr) Error() string {
+	return fmt.Sprintf("Windows build %s (%s) is not supported, supported builds are: %s", e.osInfo.FullVersion(),
+		e.osInfo.Edition, supportedBuildsString())
+}
+
+// NewUnsupportedOSErr returns a new UnsupportedOSErr for the given OS
+func NewUnsupportedOSErr(osInfo OSInfo) *UnsupportedOSErr {
+	return &UnsupportedOSErr{osInfo: osInfo}
+}
+
+// supportedBuildsString returns a human readable list of the supported builds
+func supportedBuildsString() string {
+	var builds []string
+	for _, build := range []string{Server2019Build, Server2022Build} {
+		builds = append(builds, fmt.Sprintf("%s (%s)", build, SupportedBuilds[build]))
+	}
+	return strings.Join(builds, ", ")
+}
+
+// parseOSInfo parses the output of getOSInfoCommand
+func parseOSInfo(out string) (*OSInfo, error) {
+	fields := strings.Fields(out)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected OS information format: %q", out)
+	}
+	osInfo := &OSInfo{Build: fields[0], Revision: fields[1], Edition: fields[2]}
+	if strings.Count(osInfo.Build, ".") != 2 {
+		return nil, fmt.Errorf("unexpected OS build format: %s", osInfo.Build)
+	}
+	// These values are applied as Node labels, ensure they are valid as such
+	for _, value := range []string{osInfo.FullVersion(), osInfo.Edition} {
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid OS information %s: %s", value, strings.Join(errs, ", "))
+		}
+	}
+	return osInfo, nil
+}
@@ -0,0 +1,76 @@
+package windows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOSInfo(t *testing.T) {
+	testCases := []struct {
+		name              string
+		input             string
+		expected          *OSInfo
+		expectedVersion   string
+		expectedSupported bool
+		expectedErr       bool
+	}{
+		{
+			name:              "Windows Server 2022",
+			input:             "10.0.20348 2227 ServerDatacenter\r\n",
+			expected:          &OSInfo{Build: Server2022Build, Revision: "2227", Edition: "ServerDatacenter"},
+			expectedVersion:   "10.0.20348.2227",
+			expectedSupported: true,
+		},
+		{
+			name:              "Windows Server 2019",
+			input:             "10.0.17763 5329 ServerStandard",
+			expected:          &OSInfo{Build: Server2019Build, Revision: "5329", Edition: "ServerStandard"},
+			expectedVersion:   "10.0.17763.5329",
+			expectedSupported: true,
+		},
+		{
+			name:              "unsupported build",
+			input:             "10.0.14393 6452 ServerDatacenter",
+			expected:          &OSInfo{Build: "10.0.14393", Revision: "6452", Edition: "ServerDatacenter"},
+			expectedVersion:   "10.0.14393.6452",
+			expectedSupported: false,
+		},
+		{
+			name:        "missing edition",
+			input:       "10.0.20348 2227",
+			expectedErr: true,
+		},
+		{
+			name:        "malformed build",
+			input:       "20348 2227 ServerDatacenter",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid label value",
+			input:       "10.0.20348 2227 Server#Datacenter",
+			expectedErr: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := parseOSInfo(test.input)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out)
+			assert.Equal(t, test.expectedVersion, out.FullVersion())
+			assert.Equal(t, test.expectedSupported, out.IsSupported())
+		})
+	}
+}
+
+func TestUnsupportedOSErr(t *testing.T) {
+	err := NewUnsupportedOSErr(OSInfo{Build: "10.0.14393", Revision: "6452", Edition: "ServerDatacenter"})
+	assert.Contains(t, err.Error(), "10.0.14393.6452")
+	assert.Contains(t, err.Error(), Server2019Build)
+	assert.Contains(t, err.Error(), Server2022Build)
+}
@@ -29,6 +29,10 @@ type service struct {
 	// recoveryPeriod is the amount of time in seconds with no failures after which the recoveryAction crash counter
 	// resets
 	recoveryPeriod int
+	// account is the account the service runs as. LocalSystem is used if empty.
+	account string
+	// requiredPrivileges restricts the privileges of the service's process to the given privileges, if not empty
+	requiredPrivileges []string
 }
 
 // newService initializes and returns a pointer to the service struct. The dependencies, recoveryActions, and
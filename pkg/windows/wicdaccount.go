@@ -0,0 +1,106 @@
+package windows
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openshift/windows-machine-config-operator/pkg/servicescm"
+)
+
+const (
+	// HyperVAdministratorsSID is the well known SID of the local Hyper-V Administrators group, whose members can manage
+	// HNS networks without administrative rights
+	HyperVAdministratorsSID = "S-1-5-32-578"
+	// scManagerRights are the rights on the service manager given to the account WICD runs as, in SDDL format: connect,
+	// create services, enumerate services and read the service manager's access rules
+	scManagerRights = "CCDCLCRC"
+	// managedServiceRights are the rights on each service managed by WMCO given to the account WICD runs as, in SDDL
+	// format: query and change the configuration, query the status, enumerate dependents, start, stop, pause, interrogate,
+	// send controls, delete and read the access rules. Changing the access rules or owner of the service is not allowed.
+	managedServiceRights = "CCDCLCSWRPWPDTLOCRSDRC"
+	// certStoreRegistryPath is the registry key of the root certificate store of the instance
+	certStoreRegistryPath = "HKLM:\\SOFTWARE\\Microsoft\\SystemCertificates\\ROOT"
+	// envVarRegistryPath is the registry key of the system environment variables of the instance
+	envVarRegistryPath = "HKLM:\\SYSTEM\\CurrentControlSet\\Control\\Session Manager\\Environment"
+)
+
+// wicdRequiredPrivileges are the privileges WICD's process is restricted to when it is not running as LocalSystem
+var wicdRequiredPrivileges = []string{servicescm.ChangeNotifyPrivilege}
+
+// GroupMemberCmd returns the PowerShell command adding the given account to the local group with the given SID, if it
+// is not already a member
+func GroupMemberCmd(groupSID, account string) string {
+	return fmt.Sprintf("if (-not (Get-LocalGroupMember -SID %s -Member '%s' -ErrorAction SilentlyContinue)) "+
+		"{ Add-LocalGroupMember -SID %s -Member '%s' }", groupSID, account, groupSID, account)
+}
+
+// grantWICDAccessCmd returns the PowerShell command giving the given account WICD runs as the access it requires to
+// configure the instance without administrative rights. The account is added to the Hyper-V Administrators group to
+// manage HNS networks, and is allowed to:
+//   - modify the contents of C:\k and the log directories, and grant the accounts of other services access to them
+//   - pull images through the containerd named pipe
+//   - import certificates into the root certificate store and set system environment variables
+//   - create services, and manage the services configured by WMCO, aside from WICD itself
+func grantWICDAccessCmd(account string) string {
+	return strings.Join([]string{
+		accountSIDCmd(account),
+		GroupMemberCmd(HyperVAdministratorsSID, account),
+		grantPathAccessCmd(K8sDir, "Modify, ChangePermissions", "ContainerInherit, ObjectInherit"),
+		grantPathAccessCmd(logDir, "Modify, ChangePermissions", "ContainerInherit, ObjectInherit"),
+		grantPathAccessCmd(ContainerdPipePath, "Read, Write", "None"),
+		grantRegistryAccessCmd(certStoreRegistryPath, "ReadKey, WriteKey, Delete", "ContainerInherit"),
+		grantRegistryAccessCmd(envVarRegistryPath, "ReadKey, SetValue", "None"),
+		grantServiceAccessCmd("scmanager", scManagerRights),
+		fmt.Sprintf("Get-CimInstance Win32_Service | Where-Object { $_.Description -like '%s *' -and $_.Name -ne '%s' } "+
+			"| ForEach-Object { $name = $_.Name; %s }", ManagedTag, WicdServiceName,
+			grantServiceAccessCmd("$name", managedServiceRights)),
+	}, "; ")
+}
+
+// revokeWICDAccessCmd returns the PowerShell command removing the account WICD runs as from the Hyper-V
+// Administrators group and revoking its access to the service manager, if WICD is not running as LocalSystem. Access to
+// the other services is removed along with them, while access to files is left in place, as it does not allow the
+// account to act on the instance once WICD is removed.
+func revokeWICDAccessCmd() string {
+	return fmt.Sprintf("$account = (Get-CimInstance Win32_Service | Where-Object Name -eq '%s').StartName; "+
+		"if ($account -and $account -ne '%s') { %s; Remove-LocalGroupMember -SID %s -Member $sid "+
+		"-ErrorAction SilentlyContinue; $sd = (sc.exe sdshow scmanager | Out-String).Trim(); "+
+		"sc.exe sdset scmanager $sd.Replace('(A;;%s;;;' + $sid.Value + ')', '') }", WicdServiceName,
+		servicescm.LocalSystemAccount, accountSIDCmd("$account"), HyperVAdministratorsSID, scManagerRights)
+}
+
+// accountSIDCmd returns the PowerShell command setting $sid to the security identifier of the given account, which is
+// either a name or a PowerShell variable holding one
+func accountSIDCmd(account string) string {
+	if !strings.HasPrefix(account, "$") {
+		account = "'" + account + "'"
+	}
+	return fmt.Sprintf("$sid = (New-Object Security.Principal.NTAccount(%s))."+
+		"Translate([Security.Principal.SecurityIdentifier])", account)
+}
+
+// grantPathAccessCmd returns the PowerShell command allowing $sid the given file system rights on the given directory
+// or named pipe, with the given inheritance by the contents of a directory
+func grantPathAccessCmd(path, rights, inheritance string) string {
+	return fmt.Sprintf("$info = New-Object IO.DirectoryInfo('%s'); $acl = $info.GetAccessControl('Access'); "+
+		"$acl.SetAccessRule((New-Object Security.AccessControl.FileSystemAccessRule($sid, '%s', '%s', 'None', "+
+		"'Allow'))); $info.SetAccessControl($acl)", path, rights, inheritance)
+}
+
+// grantRegistryAccessCmd returns the PowerShell command allowing $sid the given rights on the given registry key, with
+// the given inheritance by its subkeys
+func grantRegistryAccessCmd(key, rights, inheritance string) string {
+	return fmt.Sprintf("$acl = Get-Acl -Path '%s'; "+
+		"$acl.SetAccessRule((New-Object Security.AccessControl.RegistryAccessRule($sid, '%s', '%s', 'None', "+
+		"'Allow'))); Set-Acl -Path '%s' -AclObject $acl", key, rights, inheritance, key)
+}
+
+// grantServiceAccessCmd returns the PowerShell command adding an entry allowing $sid the given rights, in SDDL format,
+// to the access rules of the given service, or of the service manager if given scmanager. Nothing is done if the rules
+// already have an entry for $sid.
+func grantServiceAccessCmd(service, rights string) string {
+	return fmt.Sprintf("$sd = (sc.exe sdshow %s | Out-String).Trim(); "+
+		"if ($sd -notlike ('*;;;' + $sid.Value + ')*')) "+
+		"{ sc.exe sdset %s ($sd -replace '^(D:[A-Z]*(\\([^)]*\\))*)', ('$1(A;;%s;;;' + $sid.Value + ')')) }",
+		service, service, rights)
+}
@@ -0,0 +1,50 @@
+package windows
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrantWICDAccessCmd(t *testing.T) {
+	for _, account := range []string{"NT SERVICE\\windows-instance-config-daemon", "EXAMPLE\\wicd-gmsa$"} {
+		t.Run(account, func(t *testing.T) {
+			cmd := grantWICDAccessCmd(account)
+			assert.Contains(t, cmd, "$sid = (New-Object Security.Principal.NTAccount('"+account+"'))")
+			assert.Contains(t, cmd, GroupMemberCmd(HyperVAdministratorsSID, account))
+			// the account is never made an administrator of the instance
+			assert.NotContains(t, cmd, "S-1-5-32-544")
+			assert.Contains(t, cmd, "New-Object IO.DirectoryInfo('C:\\k')")
+			assert.Contains(t, cmd, "New-Object IO.DirectoryInfo('C:\\var\\log')")
+			assert.Contains(t, cmd, "New-Object IO.DirectoryInfo('\\\\.\\pipe\\containerd-containerd')")
+			assert.Contains(t, cmd, "sc.exe sdshow scmanager")
+			// WICD is not given access to its own service
+			assert.Contains(t, cmd, "$_.Name -ne 'windows-instance-config-daemon'")
+			// the command is run within double quotes
+			assert.NotContains(t, cmd, "\"")
+		})
+	}
+}
+
+func TestGrantServiceAccessCmd(t *testing.T) {
+	assert.Equal(t, "$sd = (sc.exe sdshow kubelet | Out-String).Trim(); "+
+		"if ($sd -notlike ('*;;;' + $sid.Value + ')*')) "+
+		"{ sc.exe sdset kubelet ($sd -replace '^(D:[A-Z]*(\\([^)]*\\))*)', ('$1(A;;CCLC;;;' + $sid.Value + ')')) }",
+		grantServiceAccessCmd("kubelet", "CCLC"))
+}
+
+func TestAccountSIDCmd(t *testing.T) {
+	assert.Equal(t, "$sid = (New-Object Security.Principal.NTAccount('EXAMPLE\\wicd-gmsa$'))."+
+		"Translate([Security.Principal.SecurityIdentifier])", accountSIDCmd("EXAMPLE\\wicd-gmsa$"))
+	assert.Equal(t, "$sid = (New-Object Security.Principal.NTAccount($account))."+
+		"Translate([Security.Principal.SecurityIdentifier])", accountSIDCmd("$account"))
+}
+
+func TestRevokeWICDAccessCmd(t *testing.T) {
+	cmd := revokeWICDAccessCmd()
+	assert.Contains(t, cmd, "Where-Object Name -eq 'windows-instance-config-daemon'")
+	assert.Contains(t, cmd, "if ($account -and $account -ne 'LocalSystem')")
+	assert.Contains(t, cmd, "Remove-LocalGroupMember -SID "+HyperVAdministratorsSID+" -Member $sid")
+	assert.Contains(t, cmd, "$sd.Replace('(A;;"+scManagerRights+";;;' + $sid.Value + ')', '')")
+	assert.NotContains(t, cmd, "\"")
+}
@@ -15,6 +15,8 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	ctrl "sigs.k8s.io/controller-runtime"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/audit"
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig/payload"
 	"github.com/openshift/windows-machine-config-operator/pkg/retry"
@@ -33,8 +35,22 @@ const (
 	HNSPSModule = remoteDir + "\\hns.psm1"
 	// K8sDir is the remote kubernetes executable directory
 	K8sDir = "C:\\k"
+	// ServiceTrustFile is the name of the file listing the services WICD may configure, and the key their signatures
+	// are verified with
+	ServiceTrustFile = "service-trust.json"
+	// ServiceTrustPath is the remote location of the ServiceTrustFile
+	ServiceTrustPath = K8sDir + "\\" + ServiceTrustFile
 	// CredentialProviderConfig is the config file for the credential provider
 	CredentialProviderConfig = K8sDir + "\\credential-provider-config.yaml"
+	// RegistryCredentialsDir is the remote directory holding the registry credential store, readable only by
+	// SYSTEM and administrators
+	RegistryCredentialsDir = K8sDir + "\\registry-credentials"
+	// RegistryCredentialStorePath is the remote location of the registry credential store served by the WICD
+	// credential provider
+	RegistryCredentialStorePath = RegistryCredentialsDir + "\\config.json"
+	// AdministratorsAuthorizedKeysPath is the remote location of the public keys authorized to access the instance as
+	// an administrator over SSH
+	AdministratorsAuthorizedKeysPath = "C:\\ProgramData\\ssh\\administrators_authorized_keys"
 	// KubeconfigPath is the remote location of the kubelet's kubeconfig
 	KubeconfigPath = K8sDir + "\\kubeconfig"
 	// logDir is the remote kubernetes log directory
@@ -47,10 +63,10 @@ const (
 	HybridOverlayLogDir = logDir + "\\hybrid-overlay"
 	// wicdLogDir is the remote wicd log directory
 	wicdLogDir = logDir + "\\wicd"
-	// cniDir is the directory for storing CNI binaries
-	cniDir = K8sDir + "\\cni"
+	// CniDir is the directory for storing CNI binaries
+	CniDir = K8sDir + "\\cni"
 	// CniConfDir is the directory for storing CNI configuration
-	CniConfDir = cniDir + "\\config"
+	CniConfDir = CniDir + "\\config"
 	// ContainerdDir is the directory for storing Containerd binary
 	ContainerdDir = K8sDir + "\\containerd"
 	// TLSDir is the directory for storing WMCO tls certs
@@ -60,6 +76,8 @@ const (
 	// TLSCertsPath is the location of TLS cert files
 	TLSCertsPath   = TLSDir + "\\certs"
 	ContainerdPath = ContainerdDir + "\\containerd.exe"
+	// ContainerdPipePath is the named pipe containerd serves the CRI API through
+	ContainerdPipePath = `\\.\pipe\containerd-containerd`
 	// ContainerdConfPath is the location of containerd config file
 	ContainerdConfPath = ContainerdDir + "\\containerd_conf.toml"
 	// ContainerdConfigDir is the remote directory for containerd registry config
@@ -93,6 +111,10 @@ const (
 	KubeLogRunnerPath = K8sDir + "\\kube-log-runner.exe"
 	// KubeletConfigPath is the location of the kubelet configuration file
 	KubeletConfigPath = K8sDir + "\\kubelet.conf"
+	// KubeletClientCAPath is the location of the CA bundle kubelet authenticates clients with
+	KubeletClientCAPath = K8sDir + "\\kubelet-ca.crt"
+	// KubeletCertDir is the directory kubelet keeps its rotated client and serving certificates in
+	KubeletCertDir = "c:\\var\\lib\\kubelet\\pki"
 	// KubeletLog is the location of the kubelet log file
 	KubeletLog = KubeletLogDir + "\\kubelet.log"
 	// KubeProxyConfigPath is the location of the kube proxy configuration file
@@ -141,6 +163,9 @@ const (
 	WICDKubeconfigPath = K8sDir + "\\wicd-kubeconfig"
 	// TrustedCABundlePath is the location of the trusted CA bundle file
 	TrustedCABundlePath = K8sDir + "\\ca-bundle.crt"
+	// UserCABundlePath is the location of the file holding the CAs supplied by the cluster administrator within the
+	// trusted CA bundle
+	UserCABundlePath = K8sDir + "\\user-ca-bundle.crt"
 	// GetHostnameFQDNCommand is the PowerShell command to get the FQDN hostname of the Windows instance
 	GetHostnameFQDNCommand = "$output = Invoke-Expression 'ipconfig /all'; " +
 		"$hostNameLine = ($output -split '`n') | Where-Object { $_ -match 'Host Name' }; " +
@@ -164,10 +189,15 @@ var (
 		WicdServiceName,
 		ContainerdServiceName,
 	}
+	// AccountConfigurableServices lists the services which can be run as an account other than LocalSystem, through
+	// the cluster.ServiceAccountsEnvVar environment variable
+	AccountConfigurableServices = []string{WindowsExporterServiceName, HybridOverlayServiceName, WicdServiceName}
+	// HybridOverlayHNSNetworks are the HNS networks created when configuring the OVN-Kubernetes hybrid overlay
+	HybridOverlayHNSNetworks = []string{BaseOVNKubeOverlayNetwork, OVNKubeOverlayNetwork}
 	// RequiredDirectories is a list of directories to be created by WMCO
 	RequiredDirectories = []string{
 		remoteDir,
-		cniDir,
+		CniDir,
 		CniConfDir,
 		logDir,
 		KubeletLogDir,
@@ -185,8 +215,9 @@ var (
 )
 
 // createPayload returns the map of files to transfer with generated file info
-func createPayload(platform *config.PlatformType) (map[*payload.FileInfo]string, error) {
-	srcDestPairs := getFilesToTransfer(platform)
+func createPayload(platform *config.PlatformType, networkBackend cluster.NetworkBackend) (map[*payload.FileInfo]string,
+	error) {
+	srcDestPairs := getFilesToTransfer(platform, networkBackend)
 	files := make(map[*payload.FileInfo]string)
 	for src, dest := range srcDestPairs {
 		f, err := payload.NewFileInfo(src)
@@ -199,17 +230,13 @@ func createPayload(platform *config.PlatformType) (map[*payload.FileInfo]string,
 }
 
 // getFilesToTransfer returns the properly populated filesToTransfer map. Note this does not include the WICD binary.
-func getFilesToTransfer(platform *config.PlatformType) map[string]string {
+// The networking files are only included for network backends managed by WMCO.
+func getFilesToTransfer(platform *config.PlatformType, networkBackend cluster.NetworkBackend) map[string]string {
 	srcDestPairs := map[string]string{
 		payload.GcpGetValidHostnameScriptPath:  remoteDir,
 		payload.WinDefenderExclusionScriptPath: remoteDir,
-		payload.HybridOverlayPath:              K8sDir,
 		payload.HNSPSModule:                    remoteDir,
 		payload.WindowsExporterPath:            K8sDir,
-		payload.WinBridgeCNIPlugin:             cniDir,
-		payload.HostLocalCNIPlugin:             cniDir,
-		payload.WinOverlayCNIPlugin:            cniDir,
-		payload.KubeProxyPath:                  K8sDir,
 		payload.KubeletPath:                    K8sDir,
 		payload.KubeLogRunnerPath:              K8sDir,
 		payload.CSIProxyPath:                   K8sDir,
@@ -217,7 +244,14 @@ func getFilesToTransfer(platform *config.PlatformType) map[string]string {
 		payload.HcsshimPath:                    ContainerdDir,
 		payload.ContainerdConfPath:             ContainerdDir,
 		payload.TLSConfPath:                    TLSDir,
-		payload.NetworkConfigurationScript:     remoteDir,
+	}
+	if networkBackend != cluster.BYOCNIBackend {
+		srcDestPairs[payload.HybridOverlayPath] = K8sDir
+		srcDestPairs[payload.WinBridgeCNIPlugin] = CniDir
+		srcDestPairs[payload.HostLocalCNIPlugin] = CniDir
+		srcDestPairs[payload.WinOverlayCNIPlugin] = CniDir
+		srcDestPairs[payload.KubeProxyPath] = K8sDir
+		srcDestPairs[payload.NetworkConfigurationScript] = remoteDir
 	}
 
 	if platform == nil {
@@ -243,6 +277,8 @@ type Windows interface {
 	GetIPv4Address() string
 	// GetHostname returns the FQDN of the associated instance including the domain name, if any
 	GetHostname() (string, error)
+	// GetOSInfo returns the build and edition of the operating system running on the associated instance
+	GetOSInfo() (*OSInfo, error)
 	// EnsureFile ensures the given file exists within the specified directory on the Windows VM. The file will be copied
 	// to the Windows VM if it is not present or if it has the incorrect contents. The remote directory is created if it
 	// does not exist.
@@ -268,8 +304,18 @@ type Windows interface {
 	Bootstrap(context.Context, string, string, string) error
 	// ConfigureWICD ensures that the Windows Instance Config Daemon is running on the node
 	ConfigureWICD(string, string) error
-	// RemoveFilesAndNetworks removes all files and networks created by WMCO
-	RemoveFilesAndNetworks() error
+	// UpdateWICDKubeconfig replaces the kubeconfig WICD authenticates with. A running WICD picks up the new credentials
+	// without being restarted.
+	UpdateWICDKubeconfig(string) error
+	// AuthorizeKey adds the given public key to the keys authorized to access the instance, if it is not already
+	AuthorizeKey(ssh.PublicKey) error
+	// VerifyKey verifies that the instance can be accessed using the given signer
+	VerifyKey(ssh.Signer) error
+	// RevokeKey removes the first given public key from the keys authorized to access the instance. The second given
+	// key is the key replacing it, which must remain authorized; revoking a key equal to it is refused.
+	RevokeKey(ssh.PublicKey, ssh.PublicKey) error
+	// RemoveFilesAndNetworks removes all files created by WMCO, and the given HNS networks
+	RemoveFilesAndNetworks([]string) error
 	// RunWICDCleanup ensures the WICD service is stopped and runs the cleanup command that ensures all WICD-managed
 	// services are also stopped
 	RunWICDCleanup(string, string) error
@@ -291,18 +337,21 @@ type windows struct {
 	defaultShellPowerShell bool
 	// filesToTransfer is the map of files needed for the windows VM
 	filesToTransfer map[*payload.FileInfo]string
+	// osInfo describes the operating system of the VM. It is nil until GetOSInfo has been called successfully.
+	osInfo *OSInfo
 }
 
 // New returns a new Windows instance constructed from the given WindowsVM
-func New(clusterDNS string, instanceInfo *instance.Info, signer ssh.Signer, platform *config.PlatformType) (Windows, error) {
+func New(clusterDNS string, instanceInfo *instance.Info, signer ssh.Signer, platform *config.PlatformType,
+	networkBackend cluster.NetworkBackend) (Windows, error) {
 	log := ctrl.Log.WithName(fmt.Sprintf("wc %s", instanceInfo.Address))
 	log.V(1).Info("initializing SSH connection")
-	conn, err := newSshConnectivity(instanceInfo.Username, instanceInfo.Address, signer, log)
+	conn, err := newSshConnectivity(instanceInfo.Username, instanceInfo.Address, nodeName(instanceInfo), signer, log)
 	if err != nil {
 		return nil, fmt.Errorf("unable to setup VM %s sshConnectivity: %w", instanceInfo.Address, err)
 	}
 
-	files, err := createPayload(platform)
+	files, err := createPayload(platform, networkBackend)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create payload: %w", err)
 	}
@@ -318,6 +367,14 @@ func New(clusterDNS string, instanceInfo *instance.Info, signer ssh.Signer, plat
 		nil
 }
 
+// nodeName returns the name of the given instance's node, or an empty string if it is not a node yet
+func nodeName(instanceInfo *instance.Info) string {
+	if instanceInfo.Node == nil {
+		return ""
+	}
+	return instanceInfo.Node.GetName()
+}
+
 // defaultShellPowershell returns true if the default SSH shell of the connected VM is PowerShell.
 func defaultShellPowershell(conn connectivity) bool {
 	// Get-Help is a basic command that is expected to work on PowerShell and not through cmd.exe.
@@ -345,6 +402,22 @@ func (vm *windows) GetHostname() (string, error) {
 	return strings.TrimSpace(hostName), nil
 }
 
+func (vm *windows) GetOSInfo() (*OSInfo, error) {
+	if vm.osInfo != nil {
+		return vm.osInfo, nil
+	}
+	out, err := vm.Run(getOSInfoCommand, true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting OS information, with stdout %s: %w", out, err)
+	}
+	osInfo, err := parseOSInfo(out)
+	if err != nil {
+		return nil, err
+	}
+	vm.osInfo = osInfo
+	return vm.osInfo, nil
+}
+
 func (vm *windows) EnsureFileContent(contents []byte, filename string, remoteDir string) error {
 	// build remote path
 	remotePath := remoteDir + "\\" + filepath.Base(filename)
@@ -478,7 +551,7 @@ func (vm *windows) Run(cmd string, psCmd bool) (string, error) {
 	if err != nil {
 		return out, fmt.Errorf("error running %s: %w", cmd, err)
 	}
-	vm.log.V(1).Info("run", "cmd", cmd, "out", out)
+	vm.log.V(1).Info("run", "cmd", audit.Redact(cmd), "out", audit.Redact(out))
 	return out, nil
 }
 
@@ -519,8 +592,8 @@ func (vm *windows) RunWICDCleanup(watchNamespace, wicdKubeconfig string) error {
 	return nil
 }
 
-func (vm *windows) RemoveFilesAndNetworks() error {
-	if err := vm.ensureHNSNetworksAreRemoved(); err != nil {
+func (vm *windows) RemoveFilesAndNetworks(hnsNetworks []string) error {
+	if err := vm.ensureHNSNetworksAreRemoved(hnsNetworks); err != nil {
 		return fmt.Errorf("unable to ensure HNS networks are removed: %w", err)
 	}
 	if err := vm.removeDirectories(); err != nil {
@@ -590,15 +663,79 @@ func (vm *windows) ConfigureWICD(watchNamespace, wicdKubeconfigContents string)
 	if err != nil {
 		return fmt.Errorf("error creating %s service object: %w", WicdServiceName, err)
 	}
-	if err := vm.ensureServiceIsRunning(wicdService); err != nil {
-		return fmt.Errorf("error ensuring %s Windows service has started running: %w", WicdServiceName, err)
+	accounts, err := cluster.GetServiceAccounts(AccountConfigurableServices)
+	if err != nil {
+		return err
+	}
+	if account, ok := accounts[WicdServiceName]; ok {
+		wicdService.account = account
+		wicdService.requiredPrivileges = wicdRequiredPrivileges
+	}
+	if err := vm.ensureServiceExists(wicdService); err != nil {
+		return err
+	}
+	// The account is granted access once the service exists, as a virtual account only exists while its service does
+	if wicdService.account != "" {
+		if out, err := vm.Run(grantWICDAccessCmd(wicdService.account), true); err != nil {
+			return fmt.Errorf("error granting %s access to the instance with output %s: %w", wicdService.account, out,
+				err)
+		}
+	}
+	if err := vm.startService(wicdService); err != nil {
+		return fmt.Errorf("error starting %s Windows service: %w", WicdServiceName, err)
+	}
+	vm.log.Info("configured", "service", WicdServiceName, "account", wicdService.account, "args", wicdServiceArgs)
+	return nil
+}
+
+// UpdateWICDKubeconfig writes the given contents to the WICD kubeconfig on the instance
+func (vm *windows) UpdateWICDKubeconfig(contents string) error {
+	if err := vm.ensureWICDKubeconfig(contents); err != nil {
+		return fmt.Errorf("error updating WICD kubeconfig: %w", err)
 	}
-	vm.log.Info("configured", "service", WicdServiceName, "args", wicdServiceArgs)
 	return nil
 }
 
 // Interface helper methods
 
+func (vm *windows) AuthorizeKey(key ssh.PublicKey) error {
+	// The file is rewritten rather than appended to, as it may not end with a line break. Rewriting the file retains its
+	// restricted ACL, which sshd requires.
+	cmd := fmt.Sprintf("$keys = @(Get-Content -Path %s -ErrorAction Stop); "+
+		"if (-not ($keys | Where-Object { %s })) { Set-Content -Path %s -Value ($keys + '%s') -Encoding ascii }",
+		AdministratorsAuthorizedKeysPath, authorizedKeyMatch(key), AdministratorsAuthorizedKeysPath, authorizedKey(key))
+	if out, err := vm.Run(cmd, true); err != nil {
+		return fmt.Errorf("unable to authorize key, output: %s: %w", out, err)
+	}
+	return nil
+}
+
+func (vm *windows) VerifyKey(signer ssh.Signer) error {
+	conn := &sshConnectivity{username: vm.instance.Username, ipAddress: vm.instance.Address,
+		nodeName: nodeName(vm.instance), signer: signer, log: vm.log}
+	if err := conn.init(); err != nil {
+		return fmt.Errorf("unable to access instance using key: %w", err)
+	}
+	defer conn.sshClient.Close()
+	if out, err := conn.run("whoami"); err != nil {
+		return fmt.Errorf("unable to run command using key, output: %s: %w", out, err)
+	}
+	return nil
+}
+
+func (vm *windows) RevokeKey(key, replacement ssh.PublicKey) error {
+	if bytes.Equal(key.Marshal(), replacement.Marshal()) {
+		return fmt.Errorf("refusing to revoke key %s, as it is the key replacing it", ssh.FingerprintSHA256(key))
+	}
+	cmd := fmt.Sprintf("$keys = @(Get-Content -Path %s -ErrorAction Stop | Where-Object { -not %s }); "+
+		"Set-Content -Path %s -Value $keys -Encoding ascii",
+		AdministratorsAuthorizedKeysPath, authorizedKeyMatch(key), AdministratorsAuthorizedKeysPath)
+	if out, err := vm.Run(cmd, true); err != nil {
+		return fmt.Errorf("unable to revoke key, output: %s: %w", out, err)
+	}
+	return nil
+}
+
 // ensureWICDFilesExist ensures all files required for WICD to run exist. If needed, creates the destination directory,
 // WICD binary, and kubeconfig.
 func (vm *windows) ensureWICDFilesExist(wicdKubeconfig string) error {
@@ -721,18 +858,26 @@ func (vm *windows) transferFiles() error {
 
 // ensureServiceIsRunning ensures a Windows service is running on the VM, creating and starting it if not already so
 func (vm *windows) ensureServiceIsRunning(svc *service) error {
+	if err := vm.ensureServiceExists(svc); err != nil {
+		return err
+	}
+	if err := vm.startService(svc); err != nil {
+		return fmt.Errorf("error starting %s Windows service: %w", svc.name, err)
+	}
+	return nil
+}
+
+// ensureServiceExists creates the given service if it does not exist
+func (vm *windows) ensureServiceExists(svc *service) error {
 	serviceExists, err := vm.serviceExists(svc.name)
 	if err != nil {
 		return fmt.Errorf("error checking if %s Windows service exists: %w", svc.name, err)
 	}
-	// create service if it does not exist
-	if !serviceExists {
-		if err := vm.createService(svc); err != nil {
-			return fmt.Errorf("error creating %s Windows service: %w", svc.name, err)
-		}
+	if serviceExists {
+		return nil
 	}
-	if err := vm.startService(svc); err != nil {
-		return fmt.Errorf("error starting %s Windows service: %w", svc.name, err)
+	if err := vm.createService(svc); err != nil {
+		return fmt.Errorf("error creating %s Windows service: %w", svc.name, err)
 	}
 	return nil
 }
@@ -749,11 +894,17 @@ func (vm *windows) createService(svc *service) error {
 		dependencyList := strings.Join(svc.dependencies, "/")
 		svcCreateCmd += " depend=" + dependencyList
 	}
+	if svc.account != "" {
+		svcCreateCmd += fmt.Sprintf(" obj= \"%s\"", svc.account)
+	}
 
 	_, err := vm.Run(svcCreateCmd, false)
 	if err != nil {
 		return fmt.Errorf("failed to create service %s: %w", svc.name, err)
 	}
+	if err := vm.configureServiceAccount(svc); err != nil {
+		return fmt.Errorf("error configuring the account of the %s Windows service: %w", svc.name, err)
+	}
 
 	if err := vm.setServiceDescription(svc.name); err != nil {
 		return fmt.Errorf("error setting description of the %s Windows service: %w", svc.name, err)
@@ -765,6 +916,25 @@ func (vm *windows) createService(svc *service) error {
 	return nil
 }
 
+// configureServiceAccount gives the service its own SID and restricts its privileges. Nothing is done for services
+// running as LocalSystem.
+func (vm *windows) configureServiceAccount(svc *service) error {
+	if svc.account == "" {
+		return nil
+	}
+	// a virtual account only exists if the service has its own SID
+	if out, err := vm.Run(fmt.Sprintf("sc.exe sidtype %s unrestricted", svc.name), false); err != nil {
+		return fmt.Errorf("failed to set service SID type with stdout %s: %w", out, err)
+	}
+	if len(svc.requiredPrivileges) > 0 {
+		cmd := fmt.Sprintf("sc.exe privs %s %s", svc.name, strings.Join(svc.requiredPrivileges, "/"))
+		if out, err := vm.Run(cmd, false); err != nil {
+			return fmt.Errorf("failed to set required privileges with stdout %s: %w", out, err)
+		}
+	}
+	return nil
+}
+
 // setServiceDescription sets the given service's description to the expected value. This can only be done after service
 // creation.
 func (vm *windows) setServiceDescription(svcName string) error {
@@ -955,13 +1125,13 @@ func (vm *windows) newFileInfo(path string) (*payload.FileInfo, error) {
 	return &payload.FileInfo{Path: path, SHA256: sha}, nil
 }
 
-// ensureHNSNetworksAreRemoved ensures the HNS networks created by the hybrid-overlay configuration process are removed
-// by repeatedly checking and retrying the removal of each network.
-func (vm *windows) ensureHNSNetworksAreRemoved() error {
-	vm.log.Info("removing HNS networks")
+// ensureHNSNetworksAreRemoved ensures the given HNS networks, created by the network backend, are removed by
+// repeatedly checking and retrying the removal of each network.
+func (vm *windows) ensureHNSNetworksAreRemoved(hnsNetworks []string) error {
+	vm.log.Info("removing HNS networks", "networks", hnsNetworks)
 	var err error
 	// VIP HNS endpoint created by the operator is also deleted when the HNS networks are deleted.
-	for _, network := range []string{BaseOVNKubeOverlayNetwork, OVNKubeOverlayNetwork} {
+	for _, network := range hnsNetworks {
 		err = wait.PollImmediate(retry.Interval, retry.Timeout, func() (bool, error) {
 			// reinitialize and retry on failure to avoid connection reset SSH errors
 			if err := vm.removeHNSNetwork(network); err != nil {
@@ -1043,6 +1213,11 @@ func (vm *windows) ensureWICDKubeconfig(contents string) error {
 
 // deconfigureWICD ensures the WICD service running on the Windows instance is removed
 func (vm *windows) deconfigureWICD() error {
+	// The account WICD ran as may have been given access to the instance, revoke it. This is best effort, as there is
+	// nothing to revoke if WICD was running as LocalSystem or does not exist.
+	if out, err := vm.Run(revokeWICDAccessCmd(), true); err != nil {
+		vm.log.V(1).Info("unable to revoke the access of the WICD account", "output", out, "error", err)
+	}
 	if err := vm.ensureServiceIsRemoved(WicdServiceName); err != nil {
 		return fmt.Errorf("error ensuring %s Windows service is removed: %w", WicdServiceName, err)
 	}
@@ -1080,6 +1255,17 @@ func getHNSNetworkCmd(networkName string) string {
 	return "Get-HnsNetwork | where { $_.Name -eq '" + networkName + "'}"
 }
 
+// authorizedKey returns the authorized_keys entry of the given public key, without a comment
+func authorizedKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+// authorizedKeyMatch returns the PowerShell condition matching the authorized_keys lines holding the given public key,
+// regardless of any comment
+func authorizedKeyMatch(key ssh.PublicKey) string {
+	return fmt.Sprintf("($_.Trim() + ' ').StartsWith('%s ')", authorizedKey(key))
+}
+
 // SplitPath splits a Windows file path into the directory and base file name.
 // Example: 'C:\\k\\bootstrap-kubeconfig' --> dir: 'C:\\k\\', fileName: 'bootstrap-kubeconfig'
 func SplitPath(filepath string) (dir string, fileName string) {
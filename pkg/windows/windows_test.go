@@ -5,7 +5,10 @@ import (
 
 	config "github.com/openshift/api/config/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
 
+	"github.com/openshift/windows-machine-config-operator/pkg/cluster"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeconfig/payload"
 )
 
@@ -30,7 +33,7 @@ func TestGetFilesToTransfer(t *testing.T) {
 
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
-			files := getFilesToTransfer(test.platform)
+			files := getFilesToTransfer(test.platform, cluster.HybridOverlayBackend)
 			if test.platform != nil && *test.platform == config.AzurePlatformType {
 				file := files[payload.AzureCloudNodeManagerPath]
 				assert.Equal(t, K8sDir, file)
@@ -42,6 +45,23 @@ func TestGetFilesToTransfer(t *testing.T) {
 	}
 }
 
+func TestGetFilesToTransferNetworkBackend(t *testing.T) {
+	networkFiles := []string{payload.HybridOverlayPath, payload.KubeProxyPath, payload.WinOverlayCNIPlugin,
+		payload.WinBridgeCNIPlugin, payload.HostLocalCNIPlugin, payload.NetworkConfigurationScript}
+
+	files := getFilesToTransfer(nil, cluster.HybridOverlayBackend)
+	for _, file := range networkFiles {
+		assert.Contains(t, files, file)
+	}
+
+	files = getFilesToTransfer(nil, cluster.BYOCNIBackend)
+	for _, file := range networkFiles {
+		assert.NotContains(t, files, file)
+	}
+	assert.Equal(t, K8sDir, files[payload.KubeletPath])
+	assert.Equal(t, ContainerdDir, files[payload.ContainerdPath])
+}
+
 func TestSplitPath(t *testing.T) {
 	testCases := []struct {
 		name                string
@@ -89,3 +109,15 @@ func TestSplitPath(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthorizedKey(t *testing.T) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte("ssh-ed25519 " +
+		"AAAAC3NzaC1lZDI1NTE5AAAAIJYp3kEPqPFVLBmBPWnVw0mFHnlFj+qmXvRRvQ/ZkgAq user@example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJYp3kEPqPFVLBmBPWnVw0mFHnlFj+qmXvRRvQ/ZkgAq",
+		authorizedKey(key))
+	// the key is matched regardless of any comment, and not matched as a prefix of a different key
+	assert.Equal(t, "($_.Trim() + ' ').StartsWith("+
+		"'ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIJYp3kEPqPFVLBmBPWnVw0mFHnlFj+qmXvRRvQ/ZkgAq ')",
+		authorizedKeyMatch(key))
+}
@@ -2,21 +2,37 @@ package wiparser
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	core "k8s.io/api/core/v1"
 	k8sapierrors "k8s.io/apimachinery/pkg/api/errors"
 	kubeTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/openshift/windows-machine-config-operator/pkg/instance"
 	"github.com/openshift/windows-machine-config-operator/pkg/nodeutil"
 )
 
-// InstanceConfigMap is the name of the ConfigMap where VMs to be configured should be described.
-const InstanceConfigMap = "windows-instances"
+const (
+	// InstanceConfigMap is the name of the ConfigMap where VMs to be configured should be described.
+	InstanceConfigMap = "windows-instances"
+	// privateKeySecretField is the optional field of an instance entry naming the Secret holding the private key used
+	// to SSH into the instance
+	privateKeySecretField = "privateKeySecret"
+	// sshCASecretField is the optional field of an instance entry naming the Secret holding the private key of the
+	// OpenSSH certificate authority trusted by the instance
+	sshCASecretField = "sshCASecret"
+	// ResolutionTimeout bounds the time taken to resolve the addresses of the instances while validating them. It is
+	// kept well under the 10 second timeout of the validating webhook.
+	ResolutionTimeout = 3 * time.Second
+)
 
 // GetInstances returns a list of Windows instances by parsing the Windows instance configMap.
 func GetInstances(ctx context.Context, c client.Client, namespace string) ([]*instance.Info, error) {
@@ -50,11 +66,11 @@ func Parse(instancesData map[string]string, nodes *core.NodeList) ([]*instance.I
 	}
 	instances := make([]*instance.Info, 0)
 	// Get information about the instances from each entry. The expected key/value format for each entry is:
-	// <address>: username=<username>
+	// <address>: username=<username>[;privateKeySecret=<secret name>][;sshCASecret=<secret name>]
 	for address, data := range instancesData {
-		username, err := extractUsername(data)
+		username, credentials, err := parseEntry(data)
 		if err != nil {
-			return instances, fmt.Errorf("unable to get username for %s: %w", address, err)
+			return instances, fmt.Errorf("unable to parse entry for %s: %w", address, err)
 		}
 
 		// Node is only guaranteed to be found when looking for its IP address
@@ -69,11 +85,117 @@ func Parse(instancesData map[string]string, nodes *core.NodeList) ([]*instance.I
 		if err != nil {
 			return nil, err
 		}
+		instanceInfo.Credentials = credentials
 		instances = append(instances, instanceInfo)
 	}
 	return instances, nil
 }
 
+// ipResolver resolves host names to IP addresses
+type ipResolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// resolver resolves the addresses of the instances being validated
+var resolver ipResolver = net.DefaultResolver
+
+// resolution is the result of resolving an address to an IPv4 address
+type resolution struct {
+	ip  net.IP
+	err error
+}
+
+// Validate ensures each added or changed entry of the Windows instances data is well-formed, that its address resolves
+// to an IPv4 address, and that no two addresses resolve to the same IPv4 address, which would configure the same
+// instance twice. previousData holds the entries before the change, and is nil when the data is being created. Entries
+// left unchanged are not validated again, so that an entry whose address no longer resolves does not prevent the other
+// entries from being changed. All invalid entries are reported.
+// All addresses must be resolved within ResolutionTimeout. Addresses which could not be resolved due to a temporary
+// failure, such as a DNS server being unreachable, are not validated, and a warning is returned for each.
+func Validate(ctx context.Context, instancesData, previousData map[string]string) ([]string, error) {
+	addresses := make([]string, 0, len(instancesData))
+	for address := range instancesData {
+		addresses = append(addresses, address)
+	}
+	slices.Sort(addresses)
+	resolutions := resolveAll(ctx, addresses)
+
+	var warnings []string
+	var errs []error
+	// resolved maps each IPv4 address to the first address resolving to it
+	resolved := make(map[string]string)
+	changedAddresses := make(map[string]bool)
+	for _, address := range addresses {
+		previous, existed := previousData[address]
+		changed := !existed || previous != instancesData[address]
+		changedAddresses[address] = changed
+		if changed {
+			if _, _, err := parseEntry(instancesData[address]); err != nil {
+				errs = append(errs, fmt.Errorf("invalid entry for %s: %w", address, err))
+			}
+		}
+		result := resolutions[address]
+		if result.err != nil {
+			switch {
+			case !changed:
+			case isTemporary(result.err):
+				warnings = append(warnings, fmt.Sprintf("unable to resolve address %s, its entry was not validated: %v",
+					address, result.err))
+			default:
+				errs = append(errs, fmt.Errorf("unable to resolve address %s to an IPv4 address: %w", address,
+					result.err))
+			}
+			continue
+		}
+		if other, found := resolved[result.ip.String()]; found {
+			if changed || changedAddresses[other] {
+				errs = append(errs, fmt.Errorf("addresses %s and %s both resolve to %s", other, address, result.ip))
+			}
+			continue
+		}
+		resolved[result.ip.String()] = address
+	}
+	return warnings, errors.Join(errs...)
+}
+
+// resolveAll resolves each of the given addresses to its first IPv4 address, as Parse does. The addresses are resolved
+// concurrently, and must all be resolved within ResolutionTimeout.
+func resolveAll(ctx context.Context, addresses []string) map[string]resolution {
+	ctx, cancel := context.WithTimeout(ctx, ResolutionTimeout)
+	defer cancel()
+
+	results := make([]resolution, len(addresses))
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ips, err := resolver.LookupIP(ctx, "ip4", address)
+			if err != nil {
+				results[i] = resolution{err: err}
+				return
+			}
+			results[i] = resolution{ip: ips[0]}
+		}()
+	}
+	wg.Wait()
+
+	resolutions := make(map[string]resolution, len(addresses))
+	for i, address := range addresses {
+		resolutions[address] = results[i]
+	}
+	return resolutions
+}
+
+// isTemporary returns true if the given resolution error may not occur if the resolution was attempted again
+func isTemporary(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && (dnsErr.IsTimeout || dnsErr.IsTemporary)
+}
+
 // GetNodeUsername retrieves the username associated with the given node from the instance ConfigMap data
 func GetNodeUsername(instancesData map[string]string, node *core.Node) (string, error) {
 	if node == nil {
@@ -82,17 +204,44 @@ func GetNodeUsername(instancesData map[string]string, node *core.Node) (string,
 	// Find entry in ConfigMap that is associated to node via address
 	for _, address := range node.Status.Addresses {
 		if value, found := instancesData[address.Address]; found {
-			return extractUsername(value)
+			username, _, err := parseEntry(value)
+			return username, err
 		}
 	}
 	return "", fmt.Errorf("unable to find instance associated with node %s", node.GetName())
 }
 
-// extractUsername returns the username string from data in the form username=<username>
-func extractUsername(value string) (string, error) {
-	splitData := strings.SplitN(value, "=", 2)
-	if len(splitData) == 0 || splitData[0] != "username" {
-		return "", fmt.Errorf("data has an incorrect format")
+// parseEntry returns the username and credentials from data in the form
+// username=<username>[;privateKeySecret=<secret name>][;sshCASecret=<secret name>]. Windows usernames cannot contain
+// semicolons, so they are safe to use as field separator.
+func parseEntry(value string) (string, instance.Credentials, error) {
+	credentials := instance.Credentials{}
+	fields := strings.Split(value, ";")
+	splitData := strings.SplitN(fields[0], "=", 2)
+	if len(splitData) != 2 || splitData[0] != "username" {
+		return "", credentials, fmt.Errorf("data has an incorrect format, expected username=<username> but found %q",
+			fields[0])
+	}
+	username := splitData[1]
+	if username == "" {
+		return "", credentials, fmt.Errorf("username cannot be empty")
+	}
+	for _, field := range fields[1:] {
+		key, name, found := strings.Cut(field, "=")
+		if !found || name == "" {
+			return "", credentials, fmt.Errorf("field %q has an incorrect format", field)
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return "", credentials, fmt.Errorf("invalid secret name %q: %s", name, strings.Join(errs, ", "))
+		}
+		switch key {
+		case privateKeySecretField:
+			credentials.PrivateKeySecret = name
+		case sshCASecretField:
+			credentials.SSHCASecret = name
+		default:
+			return "", credentials, fmt.Errorf("unknown field %q", key)
+		}
 	}
-	return splitData[1], nil
+	return username, credentials, nil
 }
@@ -1,6 +1,8 @@
 package wiparser
 
 import (
+	"context"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -62,6 +64,35 @@ func TestParse(t *testing.T) {
 			expectedOut: []*instance.Info{{Address: "127.0.0.1", IPv4Address: "127.0.0.1", Username: "core"}},
 			expectedErr: false,
 		},
+		{
+			name:     "valid credentials",
+			input:    map[string]string{"127.0.0.1": "username=core;privateKeySecret=domain-key;sshCASecret=domain-ca"},
+			nodeList: &core.NodeList{},
+			expectedOut: []*instance.Info{{Address: "127.0.0.1", IPv4Address: "127.0.0.1", Username: "core",
+				Credentials: instance.Credentials{PrivateKeySecret: "domain-key", SSHCASecret: "domain-ca"}}},
+			expectedErr: false,
+		},
+		{
+			name:        "unknown credentials field",
+			input:       map[string]string{"127.0.0.1": "username=core;password=secret"},
+			nodeList:    &core.NodeList{},
+			expectedOut: nil,
+			expectedErr: true,
+		},
+		{
+			name:        "invalid secret name",
+			input:       map[string]string{"127.0.0.1": "username=core;privateKeySecret=Domain_Key"},
+			nodeList:    &core.NodeList{},
+			expectedOut: nil,
+			expectedErr: true,
+		},
+		{
+			name:        "missing secret name",
+			input:       map[string]string{"127.0.0.1": "username=core;sshCASecret="},
+			nodeList:    &core.NodeList{},
+			expectedOut: nil,
+			expectedErr: true,
+		},
 		{
 			name:     "valid dns and ip addresses with no nodes",
 			input:    map[string]string{"localhost": "username=core", "127.0.0.1": "username=Admin"},
@@ -150,6 +181,132 @@ func TestParse(t *testing.T) {
 	}
 }
 
+// fakeResolver fails to resolve the host names it holds an error for, and resolves others with the default resolver
+type fakeResolver map[string]error
+
+func (f fakeResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	if err, found := f[host]; found {
+		return nil, err
+	}
+	return net.DefaultResolver.LookupIP(ctx, network, host)
+}
+
+func TestValidate(t *testing.T) {
+	defer func(original ipResolver) { resolver = original }(resolver)
+	resolver = fakeResolver{
+		"unreachable.example.com": &net.DNSError{Err: "server misbehaving", Name: "unreachable.example.com",
+			IsTemporary: true},
+		"slow.example.com":    &net.DNSError{Err: "i/o timeout", Name: "slow.example.com", IsTimeout: true},
+		"missing.example.com": &net.DNSError{Err: "no such host", Name: "missing.example.com", IsNotFound: true},
+	}
+
+	testCases := []struct {
+		name             string
+		input            map[string]string
+		previous         map[string]string
+		expectedErrors   []string
+		expectedWarnings []string
+	}{
+		{
+			name:  "empty data",
+			input: map[string]string{},
+		},
+		{
+			name: "valid entries",
+			input: map[string]string{"127.0.0.1": "username=core", "127.0.0.2": "username=core;privateKeySecret=key",
+				"127.0.0.3": "username=Administrator;sshCASecret=ca"},
+		},
+		{
+			name:           "addresses resolving to the same IP",
+			input:          map[string]string{"127.0.0.1": "username=core", "localhost": "username=core"},
+			expectedErrors: []string{"127.0.0.1 and localhost both resolve to 127.0.0.1"},
+		},
+		{
+			name:           "misspelled username field",
+			input:          map[string]string{"127.0.0.1": "user=Administrator"},
+			expectedErrors: []string{"invalid entry for 127.0.0.1", `found "user=Administrator"`},
+		},
+		{
+			name:           "empty username",
+			input:          map[string]string{"127.0.0.1": "username="},
+			expectedErrors: []string{"username cannot be empty"},
+		},
+		{
+			name:           "unknown field",
+			input:          map[string]string{"127.0.0.1": "username=core;privateKey=key"},
+			expectedErrors: []string{`unknown field "privateKey"`},
+		},
+		{
+			name:           "unresolvable address",
+			input:          map[string]string{"missing.example.com": "username=core"},
+			expectedErrors: []string{"unable to resolve address missing.example.com"},
+		},
+		{
+			name:           "IPv6 address",
+			input:          map[string]string{"::1": "username=core"},
+			expectedErrors: []string{"unable to resolve address ::1"},
+		},
+		{
+			name:  "all invalid entries reported",
+			input: map[string]string{"127.0.0.1": "core", "missing.example.com": "username=core"},
+			expectedErrors: []string{"invalid entry for 127.0.0.1",
+				"unable to resolve address missing.example.com"},
+		},
+		{
+			name: "temporary resolution failures are warned about",
+			input: map[string]string{"127.0.0.1": "username=core", "unreachable.example.com": "username=core",
+				"slow.example.com": "username=core"},
+			expectedWarnings: []string{"unable to resolve address slow.example.com",
+				"unable to resolve address unreachable.example.com"},
+		},
+		{
+			name:             "malformed entry with a temporary resolution failure",
+			input:            map[string]string{"unreachable.example.com": "user=core"},
+			expectedErrors:   []string{"invalid entry for unreachable.example.com"},
+			expectedWarnings: []string{"unable to resolve address unreachable.example.com"},
+		},
+		{
+			name:     "unchanged entries are not validated on update",
+			input:    map[string]string{"missing.example.com": "core", "127.0.0.1": "username=core"},
+			previous: map[string]string{"missing.example.com": "core"},
+		},
+		{
+			name:           "changed entries are validated on update",
+			input:          map[string]string{"missing.example.com": "username=Administrator"},
+			previous:       map[string]string{"missing.example.com": "username=core"},
+			expectedErrors: []string{"unable to resolve address missing.example.com"},
+		},
+		{
+			name:     "unchanged addresses resolving to the same IP",
+			input:    map[string]string{"127.0.0.1": "username=core", "localhost": "username=core"},
+			previous: map[string]string{"127.0.0.1": "username=core", "localhost": "username=core"},
+		},
+		{
+			name:           "added address resolving to the IP of an unchanged address",
+			input:          map[string]string{"127.0.0.1": "username=core", "localhost": "username=core"},
+			previous:       map[string]string{"localhost": "username=core"},
+			expectedErrors: []string{"127.0.0.1 and localhost both resolve to 127.0.0.1"},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			warnings, err := Validate(context.TODO(), test.input, test.previous)
+			require.Len(t, warnings, len(test.expectedWarnings))
+			for i, expected := range test.expectedWarnings {
+				assert.Contains(t, warnings[i], expected)
+			}
+			if len(test.expectedErrors) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, expected := range test.expectedErrors {
+				assert.Contains(t, err.Error(), expected)
+			}
+		})
+	}
+}
+
 func TestGetNodeUsername(t *testing.T) {
 	testNode := &core.Node{
 		ObjectMeta: meta.ObjectMeta{
@@ -218,6 +375,13 @@ func TestGetNodeUsername(t *testing.T) {
 			expectedOut: "Admin",
 			expectedErr: false,
 		},
+		{
+			name:        "entry with credentials",
+			data:        map[string]string{"111.1.1.1": "username=Admin;privateKeySecret=domain-key"},
+			node:        testNode,
+			expectedOut: "Admin",
+			expectedErr: false,
+		},
 	}
 	for _, test := range testCases {
 		t.Run(test.name, func(t *testing.T) {
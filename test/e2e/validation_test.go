@@ -27,7 +27,6 @@ import (
 
 	"github.com/openshift/windows-machine-config-operator/controllers"
 	"github.com/openshift/windows-machine-config-operator/pkg/condition"
-	"github.com/openshift/windows-machine-config-operator/pkg/crypto"
 	"github.com/openshift/windows-machine-config-operator/pkg/csr"
 	"github.com/openshift/windows-machine-config-operator/pkg/metadata"
 	nc "github.com/openshift/windows-machine-config-operator/pkg/nodeconfig"
@@ -846,7 +845,16 @@ func (tc *testContext) checkUsernameAnnotation(node *core.Node) (bool, error) {
 	if !present {
 		return false, nil
 	}
-	username, err := crypto.DecryptFromJSONString(usernameValue, privKey)
+	keySecret, err := tc.client.K8s.CoreV1().Secrets(wmcoNamespace).Get(context.TODO(), secrets.AnnotationKeySecret,
+		meta.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve annotation key secret: %w", err)
+	}
+	keyring, err := secrets.AnnotationKeyring(keySecret)
+	if err != nil {
+		return false, err
+	}
+	username, err := keyring.Decrypt(usernameValue, privKey)
 	if err != nil {
 		return false, err
 	}